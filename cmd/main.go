@@ -1,160 +1,278 @@
-package main
-
-import (
-	"flag"
-	"net"
-	"net/http"	
-	//"os"
-	"strconv"
-	"time"
-
-	"github.com/golang/glog"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-
-	"k8s.io/api/core/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
-	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
-
-	"k8s.io/client-go/tools/leaderelection"
-	"k8s.io/client-go/tools/leaderelection/resourcelock"
-	"k8s.io/client-go/tools/record"	
-
-	"github.com/sak0/ygw/pkg/controller"
-	"github.com/sak0/ygw/pkg/utils"
-)
-
-const (
-	healthzPath = "/healthz"
-	electionKey = "ygw"
-)
-
-var (
-	kubeConf			string
-	runTest				bool
-	createCrd			bool
-	
-	metricsPath			string
-	metricsPort			int
-	
-	electionName		string
-	electionId			string
-	electionNamespace	string
-)
-
-func init() {
-	flag.StringVar(&kubeConf, "kubeconf", "admin.conf", "Path to a kube config. Only required if out-of-cluster.")
-	flag.BoolVar(&runTest, "runtest", false, "If create test resource.")
-	flag.BoolVar(&createCrd, "createCrd", true, "If create crd.")
-	
-	flag.StringVar(&metricsPath, "metrics-path", "/metrics", "metrcis url path.")
-	flag.IntVar(&metricsPort, "port", 8080, "metrics listen port.")
-	
-	//TODO read from env.
-	flag.StringVar(&electionName, "name", "lb-operator", "electionName for this instance.")
-	flag.StringVar(&electionId, "id", "host123", "electionId for this instance.")
-	flag.StringVar(&electionNamespace, "namespace", "default", "election resource's Namespace.")
-	
-	flag.Parse()
-}
-
-func run(stopCh <-chan struct{}){
-	// Get all clients
-//	kubeClient, extClient, crdcs, scheme, err := utils.CreateClients(kubeConf)
-	kubeClient, _, crdcs, scheme, lbcs, lbscheme, err := utils.CreateClients(kubeConf)
-	if err != nil {
-		panic(err.Error())
-	}
-
-	//Init CRD Object if needed
-//	if createCrd {
-//		err := utils.InitAllCRD(extClient)
-//		if err != nil {
-//			panic(err.Error())
-//		}
-//	}
-
-	aexctr, err := controller.NewAexController(kubeClient, crdcs, scheme)
-	if err != nil {
-		panic(err.Error())
-	}	
-	go aexctr.Run(stopCh)
-	cexctr, err := controller.NewCexController(kubeClient, crdcs, scheme)
-	if err != nil {
-		panic(err.Error())
-	}	
-	go cexctr.Run(stopCh)
-	poolctr, err := controller.NewPoolController(kubeClient, crdcs, scheme)
-	if err != nil {
-		panic(err.Error())
-	}	
-	go poolctr.Run(stopCh)
-	
-	calbpoolctr, err := controller.NewCALBPoolController(kubeClient, lbcs, lbscheme)
-	if err != nil {
-		panic(err.Error())
-	}	
-	go calbpoolctr.Run(stopCh)
-	
-	calbctr, err := controller.NewCALBController(kubeClient, lbcs, lbscheme)
-	if err != nil {
-		panic(err.Error())
-	}	
-	go calbctr.Run(stopCh)			
-}
-
-
-func main() {
-	http.Handle(metricsPath, promhttp.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
-			<head><title>YH Gateway&LB Controller</title></head>
-			<body>
-			<h1>Hello YGW</h1>
-			<p><a href='` + metricsPath + `'>Metrics</a></p>
-			</body>
-			</html>`))
-	})
-	http.HandleFunc(healthzPath, func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(200)
-		w.Write([]byte("ok"))
-	})
-	listenAddress := net.JoinHostPort("0.0.0.0", strconv.Itoa(metricsPort))
-	go http.ListenAndServe(listenAddress, nil)
-	
-	kubeclient := utils.MustNewKubeClient()
-	glog.V(2).Infof("Begin leaderejection %s %s", electionName, electionId)
-
-	rl, err := resourcelock.New(resourcelock.EndpointsResourceLock,
-		electionNamespace,
-		electionKey,
-		kubeclient.Core(),
-		resourcelock.ResourceLockConfig{
-			Identity:      electionId,
-			EventRecorder: createRecorder(kubeclient, electionName, electionNamespace),
-		})
-	if err != nil {
-		glog.Fatalf("error creating lock: %v", err)
-		panic(err)
-	}
-
-	leaderelection.RunOrDie(leaderelection.LeaderElectionConfig{
-		Lock:          rl,
-		LeaseDuration: 15 * time.Second,
-		RenewDeadline: 10 * time.Second,
-		RetryPeriod:   2 * time.Second,
-		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: run,
-			OnStoppedLeading: func() {
-				glog.Fatalf("leader election lost")
-			},
-		},
-	})	
-}
-
-func createRecorder(kubecli kubernetes.Interface, name, namespace string) record.EventRecorder {
-	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartLogging(glog.Infof)
-	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: v1core.New(kubecli.Core().RESTClient()).Events(namespace)})
-	return eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: name})
-}
+package main
+
+import (
+	"flag"
+	"net"
+	"net/http"	
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"	
+
+	gwv1 		"github.com/sak0/ygw/pkg/apis/gateway/v1alpha2"
+	"github.com/sak0/ygw/pkg/controller"
+	"github.com/sak0/ygw/pkg/utils"
+)
+
+const (
+	healthzPath = "/healthz"
+	electionKey = "ygw"
+)
+
+var (
+	kubeConf			string
+	runTest				bool
+	createCrd			bool
+	
+	metricsPath			string
+	metricsPort			int
+	
+	electionName		string
+	electionId			string
+	electionNamespace	string
+	
+	enableIngress		bool
+	enableServices		bool
+	enableGateway		bool
+	
+	ingressClass		string
+	ingressProvider		string
+	
+	serviceSubnet		string
+	gatewaySubnet		string
+	
+	bigipPartitionPerNamespace	bool
+	bigipCredentialsSecret		string
+	netscalerCredentialsSecret	string
+	defaultDeviceTypes			string
+)
+
+var (
+	// stopCh stops the controllers on shutdown.
+	stopCh			= make(chan struct{})
+	shutdownLock	sync.Mutex
+	// devices are logged out on shutdown, nil until we lead.
+	devices			*controller.DeviceController
+)
+
+func init() {
+	flag.StringVar(&kubeConf, "kubeconf", "admin.conf", "Path to a kube config. Only required if out-of-cluster.")
+	flag.BoolVar(&runTest, "runtest", false, "If create test resource.")
+	flag.BoolVar(&createCrd, "createCrd", true, "If create crd.")
+	
+	flag.StringVar(&metricsPath, "metrics-path", "/metrics", "metrcis url path.")
+	flag.IntVar(&metricsPort, "port", 8080, "metrics listen port.")
+	
+	//TODO read from env.
+	flag.StringVar(&electionName, "name", "lb-operator", "electionName for this instance.")
+	flag.StringVar(&electionId, "id", "host123", "electionId for this instance.")
+	flag.StringVar(&electionNamespace, "namespace", "default", "election resource's Namespace.")
+	
+	flag.BoolVar(&enableIngress, "enable-ingress", false, "translate the Ingresses of -ingress-class.")
+	flag.BoolVar(&enableServices, "enable-services", false, 
+		"give the LoadBalancer Services a vip from -service-subnet or their subnet annotation.")
+	flag.BoolVar(&enableGateway, "enable-gateway", false, 
+		"implement the Gateway API, once its CRDs are installed.")
+	
+	flag.StringVar(&ingressClass, "ingress-class", "ygw", "kubernetes.io/ingress.class of the Ingresses to translate.")
+	flag.StringVar(&ingressProvider, "ingress-provider", "citrix", "device Ingresses are translated for, citrix or f5.")
+	
+	flag.StringVar(&serviceSubnet, "service-subnet", "", "subnet the vips of LoadBalancer Services are allocated from.")
+	flag.StringVar(&gatewaySubnet, "gateway-subnet", "", "subnet the vips of Gateways are allocated from.")
+	
+	flag.BoolVar(&bigipPartitionPerNamespace, "bigip-partition-per-namespace", false, 
+		"create the f5 objects of a namespace in a BIG-IP partition named after it instead of Common.")
+	flag.StringVar(&bigipCredentialsSecret, "bigip-credentials-secret", "", 
+		"namespace/name of the Secret with the username and password of the BIG-IP of BIGIP_URL, instead of the environment.")
+	flag.StringVar(&netscalerCredentialsSecret, "netscaler-credentials-secret", "", 
+		"namespace/name of the Secret with the username and password of the NetScaler of NS_URL, instead of the environment.")
+	flag.StringVar(&defaultDeviceTypes, "default-device-types", 
+		"appexternalnat=f5,classicexternalnat=f5,externalnatpool=f5,capploadbalance=citrix,capploadbalancepool=citrix", 
+		"device type, the name of a registered provider, of the objects of each kind without a deviceRef, as kind=type pairs.")
+	
+	flag.Parse()
+}
+
+// run starts the controllers once we lead, they run until shutdown.
+func run(_ <-chan struct{}){
+	// Get all clients
+//	kubeClient, extClient, crdcs, scheme, err := utils.CreateClients(kubeConf)
+	kubeClient, _, crdcs, scheme, lbcs, lbscheme, gwcs, gwscheme, err := utils.CreateClients(kubeConf)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	//Init CRD Object if needed
+//	if createCrd {
+//		err := utils.InitAllCRD(extClient)
+//		if err != nil {
+//			panic(err.Error())
+//		}
+//	}
+
+	// the other controllers get their drivers from the devices, so they
+	// are synced first.
+	devicectr, err := controller.NewDeviceController(kubeClient, lbcs, lbscheme, bigipPartitionPerNamespace,
+		bigipCredentialsSecret, netscalerCredentialsSecret, defaultDeviceTypes)
+	if err != nil {
+		panic(err.Error())
+	}
+	shutdownLock.Lock()
+	devices = devicectr
+	shutdownLock.Unlock()
+	devicectr.Run(stopCh)
+	
+	aexctr, err := controller.NewAexController(kubeClient, crdcs, scheme, devicectr)
+	if err != nil {
+		panic(err.Error())
+	}	
+	go aexctr.Run(stopCh)
+	cexctr, err := controller.NewCexController(kubeClient, crdcs, scheme, devicectr)
+	if err != nil {
+		panic(err.Error())
+	}	
+	go cexctr.Run(stopCh)
+	poolctr, err := controller.NewPoolController(kubeClient, crdcs, scheme, devicectr)
+	if err != nil {
+		panic(err.Error())
+	}	
+	go poolctr.Run(stopCh)
+	
+	calbpoolctr, err := controller.NewCALBPoolController(kubeClient, lbcs, lbscheme, devicectr)
+	if err != nil {
+		panic(err.Error())
+	}	
+	go calbpoolctr.Run(stopCh)
+	
+	calbctr, err := controller.NewCALBController(kubeClient, lbcs, lbscheme, devicectr)
+	if err != nil {
+		panic(err.Error())
+	}	
+	go calbctr.Run(stopCh)
+	
+	if enableIngress {
+		ingressctr, err := controller.NewIngressController(kubeClient, crdcs, scheme, lbcs, lbscheme, 
+			ingressClass, ingressProvider)
+		if err != nil {
+			panic(err.Error())
+		}
+		go ingressctr.Run(stopCh)
+	}
+	
+	if enableServices {
+		svcctr, err := controller.NewServiceController(kubeClient, crdcs, scheme, serviceSubnet)
+		if err != nil {
+			panic(err.Error())
+		}
+		go svcctr.Run(stopCh)
+	}
+	
+	if enableGateway {
+		// without the CRDs the informers would never sync.
+		served, err := utils.ResourceServed(kubeClient, gwv1.SchemeGroupVersion.String(), gwv1.GatewayPlural)
+		if err != nil {
+			panic(err.Error())
+		}
+		if !served {
+			glog.Warningf("The Gateway API CRDs are not installed, the gateway controller is not started")
+			return
+		}
+		gwctr, err := controller.NewGatewayController(kubeClient, crdcs, scheme, lbcs, lbscheme,
+			gwcs, gwscheme, gatewaySubnet, devicectr)
+		if err != nil {
+			panic(err.Error())
+		}
+		go gwctr.Run(stopCh)
+	}
+}
+
+
+// shutdown stops the controllers and logs out of the devices before exiting,
+// the sessions of the BIG-IPs would stay open until they expire otherwise.
+func shutdown(code int) {
+	shutdownLock.Lock()
+	close(stopCh)
+	if devices != nil {
+		devices.Stop()
+	}
+	glog.Flush()
+	os.Exit(code)
+}
+
+func main() {
+	http.Handle(metricsPath, promhttp.Handler())
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html>
+			<head><title>YH Gateway&LB Controller</title></head>
+			<body>
+			<h1>Hello YGW</h1>
+			<p><a href='` + metricsPath + `'>Metrics</a></p>
+			</body>
+			</html>`))
+	})
+	http.HandleFunc(healthzPath, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte("ok"))
+	})
+	listenAddress := net.JoinHostPort("0.0.0.0", strconv.Itoa(metricsPort))
+	go http.ListenAndServe(listenAddress, nil)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		glog.Infof("Got %v, shutting down", sig)
+		shutdown(0)
+	}()
+	
+	kubeclient := utils.MustNewKubeClient()
+	glog.V(2).Infof("Begin leaderejection %s %s", electionName, electionId)
+
+	rl, err := resourcelock.New(resourcelock.EndpointsResourceLock,
+		electionNamespace,
+		electionKey,
+		kubeclient.Core(),
+		resourcelock.ResourceLockConfig{
+			Identity:      electionId,
+			EventRecorder: createRecorder(kubeclient, electionName, electionNamespace),
+		})
+	if err != nil {
+		glog.Fatalf("error creating lock: %v", err)
+		panic(err)
+	}
+
+	leaderelection.RunOrDie(leaderelection.LeaderElectionConfig{
+		Lock:          rl,
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: run,
+			OnStoppedLeading: func() {
+				glog.Errorf("leader election lost")
+				shutdown(1)
+			},
+		},
+	})	
+}
+
+func createRecorder(kubecli kubernetes.Interface, name, namespace string) record.EventRecorder {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(glog.Infof)
+	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: v1core.New(kubecli.Core().RESTClient()).Events(namespace)})
+	return eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: name})
+}
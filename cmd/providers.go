@@ -0,0 +1,9 @@
+package main
+
+// The drivers of the devices register their provider when their package is
+// imported, the in-tree ones with pkg/drivers. An out-of-tree provider is
+// compiled in by importing its package here, its name is then a valid type
+// of LoadBalancerDevice and of -default-device-types.
+import (
+	_ "github.com/sak0/ygw/pkg/drivers"
+)
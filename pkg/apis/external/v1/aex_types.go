@@ -1,36 +1,83 @@
-package v1
-
-import (
-	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-)
-
-// Definition of our CRD AppExternalNat 
-type AppExternalNat struct {
-	meta_v1.TypeMeta   `json:",inline"`
-	meta_v1.ObjectMeta `json:"metadata"`
-	Spec               AppExternalNatSpec   `json:"spec"`
-	Status             AppExternalNatStatus `json:"status,omitempty"`
-}
-
-type AppExternalNatSpec struct {
-	IP			string	`json:"ip"`
-	Port		string	`json:"port"`
-	Protocol	string	`json:"protocol"`
-	Rules		[]AppExternalNatRule	`json:"rules"`
-}
-
-type AppExternalNatRule struct {
-	Host		string	`json:"host"`
-	PoolName	string	`json:"pool"`
-}
-
-type AppExternalNatStatus struct {
-	State   string `json:"state,omitempty"`
-	Message string `json:"message,omitempty"`
-}
-
-type AppExternalNatList struct {
-	meta_v1.TypeMeta `json:",inline"`
-	meta_v1.ListMeta `json:"metadata"`
-	Items            []AppExternalNat `json:"items"`
+package v1
+
+import (
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Definition of our CRD AppExternalNat 
+type AppExternalNat struct {
+	meta_v1.TypeMeta   `json:",inline"`
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               AppExternalNatSpec   `json:"spec"`
+	Status             AppExternalNatStatus `json:"status,omitempty"`
+}
+
+type AppExternalNatSpec struct {
+	IP			string	`json:"ip"`
+	Port		string	`json:"port"`
+	Protocol	string	`json:"protocol"`
+	Rules		[]AppExternalNatRule	`json:"rules"`
+	
+	// DefaultPool receives the requests no rule matches. Without it they
+	// get DefaultResponse, when set.
+	DefaultPool		string			`json:"defaultPool,omitempty"`
+	DefaultResponse	StaticResponse	`json:"defaultResponse,omitempty"`
+	
+	// TLS terminates https on the virtual server with the certificates of
+	// kubernetes.io/tls Secrets in the namespace of the AppExternalNat.
+	TLS				[]AppExternalNatTLS	`json:"tls,omitempty"`
+	
+	// DeviceRef is the name of the LoadBalancerDevice to configure, the device
+	// of the environment when empty.
+	DeviceRef	string	`json:"deviceRef,omitempty"`
+}
+
+type AppExternalNatTLS struct {
+	Hosts		[]string	`json:"hosts,omitempty"`
+	SecretName	string		`json:"secretName"`
+}
+
+type AppExternalNatRule struct {
+	Host		string			`json:"host"`
+	// Path limits the rule to request paths with this prefix, the longest
+	// matching path of a host wins.
+	Path		string			`json:"path,omitempty"`
+	PoolName	string			`json:"pool,omitempty"`
+	Redirect	HTTPRedirect	`json:"redirect,omitempty"`
+	Rewrite		HTTPRewrite		`json:"rewrite,omitempty"`
+}
+
+// HTTPRedirect answers matching requests with a redirect instead of
+// forwarding them to a pool. Empty Scheme defaults to http, empty Host
+// keeps the host of the request and Code defaults to 302.
+type HTTPRedirect struct {
+	Scheme		string	`json:"scheme,omitempty"`
+	Host		string	`json:"host,omitempty"`
+	Code		int		`json:"code,omitempty"`
+}
+
+// HTTPRewrite replaces the leading PathPrefix of the request uri with
+// Replacement before the request is sent to the pool.
+type HTTPRewrite struct {
+	PathPrefix	string	`json:"pathPrefix,omitempty"`
+	Replacement	string	`json:"replacement,omitempty"`
+}
+
+// StaticResponse is answered by the device itself, e.g. a maintenance page.
+// Code defaults to 503 and ContentType to text/html.
+type StaticResponse struct {
+	Code		int		`json:"code,omitempty"`
+	ContentType	string	`json:"contentType,omitempty"`
+	Body		string	`json:"body,omitempty"`
+}
+
+type AppExternalNatStatus struct {
+	State   string `json:"state,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type AppExternalNatList struct {
+	meta_v1.TypeMeta `json:",inline"`
+	meta_v1.ListMeta `json:"metadata"`
+	Items            []AppExternalNat `json:"items"`
 }
\ No newline at end of file
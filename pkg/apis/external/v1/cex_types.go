@@ -1,35 +1,54 @@
-package v1
-
-import (
-	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-)
-
-// Definition of our CRD ClassicExternalNat 
-type ClassicExternalNat struct {
-	meta_v1.TypeMeta   `json:",inline"`
-	meta_v1.ObjectMeta `json:"metadata"`
-	Spec               ClassicExternalNatSpec   `json:"spec"`
-	Status             ClassicExternalNatStatus `json:"status,omitempty"`
-}
-
-type ClassicExternalNatSpec struct {
-	IP			string	`json:"ip"`
-	Port		string	`json:"port"`
-	Protocol	string	`json:"protocol"`
-	Backends	[]ClassicExternalNatBackend	`json:"backends"`
-}
-
-type ClassicExternalNatBackend struct {
-	PoolName	string	`json:"poolName"`
-}
-
-type ClassicExternalNatStatus struct {
-	State   string `json:"state,omitempty"`
-	Message string `json:"message,omitempty"`
-}
-
-type ClassicExternalNatList struct {
-	meta_v1.TypeMeta `json:",inline"`
-	meta_v1.ListMeta `json:"metadata"`
-	Items            []ClassicExternalNat `json:"items"`
+package v1
+
+import (
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Definition of our CRD ClassicExternalNat 
+type ClassicExternalNat struct {
+	meta_v1.TypeMeta   `json:",inline"`
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               ClassicExternalNatSpec   `json:"spec"`
+	Status             ClassicExternalNatStatus `json:"status,omitempty"`
+}
+
+type ClassicExternalNatSpec struct {
+	IP			string	`json:"ip"`
+	Port		string	`json:"port"`
+	Protocol	string	`json:"protocol"`
+	Backends	[]ClassicExternalNatBackend	`json:"backends"`
+	// Listeners serves several ports and protocols on IP. Port and Protocol
+	// are ignored when it is set.
+	Listeners	[]ClassicExternalNatListener	`json:"listeners,omitempty"`
+	
+	// SourceRanges limits the clients to these CIDRs, empty allows all.
+	SourceRanges	[]string	`json:"sourceRanges,omitempty"`
+	
+	// DeviceRef is the name of the LoadBalancerDevice to configure, the device
+	// of the environment when empty.
+	DeviceRef	string	`json:"deviceRef,omitempty"`
+}
+
+type ClassicExternalNatListener struct {
+	// Port is a port or a range like "5060-5070".
+	Port		string	`json:"port"`
+	// Protocol is tcp, udp or sctp.
+	Protocol	string	`json:"protocol"`
+	// PoolName is the pool of this listener, defaults to the backends.
+	PoolName	string	`json:"poolName,omitempty"`
+}
+
+type ClassicExternalNatBackend struct {
+	PoolName	string	`json:"poolName"`
+}
+
+type ClassicExternalNatStatus struct {
+	State   string `json:"state,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type ClassicExternalNatList struct {
+	meta_v1.TypeMeta `json:",inline"`
+	meta_v1.ListMeta `json:"metadata"`
+	Items            []ClassicExternalNat `json:"items"`
 }
\ No newline at end of file
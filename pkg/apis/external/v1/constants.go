@@ -1,15 +1,20 @@
-package v1
-
-const (
-	POOLSTATUSAVAILABLE 	= "Available"
-	POOLSTATUSERROR 		= "Error"
-
-	CEXSTATUSAVAILABLE 		= "Available"
-	CEXSTATUSERROR 			= "Error"	
-	
-	AEXSTATUSAVAILABLE 		= "Available"
-	AEXSTATUSERROR 			= "Error"	
-	
-	ALBPOOLSTATUSAVAILABLE 	= "Available"
-	ALBPOOLSTATUSERROR 		= "Error"		
+package v1
+
+const (
+	POOLSTATUSAVAILABLE 	= "Available"
+	POOLSTATUSERROR 		= "Error"
+
+	CEXSTATUSAVAILABLE 		= "Available"
+	CEXSTATUSERROR 			= "Error"	
+	
+	AEXSTATUSAVAILABLE 		= "Available"
+	AEXSTATUSERROR 			= "Error"	
+	
+	ALBPOOLSTATUSAVAILABLE 	= "Available"
+	ALBPOOLSTATUSERROR 		= "Error"		
+	
+	SERVICEREFMODEENDPOINTS	= "Endpoints"
+	SERVICEREFMODENODEPORT	= "NodePort"
+	
+	DEFAULTDRAINTIMEOUT		= "5m"
 )
\ No newline at end of file
@@ -1,34 +1,88 @@
-package v1
-
-import (
-	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-)
-
-// Definition of our CRD AppLoadBalance class
-type ExternalNatPool struct {
-	meta_v1.TypeMeta   `json:",inline"`
-	meta_v1.ObjectMeta `json:"metadata"`
-	Spec               ExternalNatPoolSpec   `json:"spec"`
-	Status             ExternalNatPoolStatus `json:"status,omitempty"`
-}
-
-type ExternalNatPoolSpec struct {
-	Method		string						`json:"lb_method,omitempty"`
-	Members		[]ExternalNatPoolMember		`json:"members"`
-}
-
-type ExternalNatPoolMember struct {
-	IP		string	`json:"ip,omitempty"`
-	Port	string	`json:"port"`
-}
-
-type ExternalNatPoolStatus struct {
-	State   string `json:"state,omitempty"`
-	Message string `json:"message,omitempty"`
-}
-
-type ExternalNatPoolList struct {
-	meta_v1.TypeMeta `json:",inline"`
-	meta_v1.ListMeta `json:"metadata"`
-	Items            []ExternalNatPool `json:"items"`
+package v1
+
+import (
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Definition of our CRD AppLoadBalance class
+type ExternalNatPool struct {
+	meta_v1.TypeMeta   `json:",inline"`
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               ExternalNatPoolSpec   `json:"spec"`
+	Status             ExternalNatPoolStatus `json:"status,omitempty"`
+}
+
+type ExternalNatPoolSpec struct {
+	// Method is one of the METHOD* lb methods of pkg/drivers, RoundRobin
+	// when empty.
+	Method		string						`json:"lb_method,omitempty"`
+	// Protocol is the service type of the members on a NetScaler: HTTP
+	// (default) for the pools of AppExternalNats, TCP or UDP for the ones of
+	// ClassicExternalNats, whose listeners reject a pool of another protocol.
+	// The BIG-IP ignores it. It can't be changed once the pool exists.
+	Protocol	string						`json:"protocol,omitempty"`
+	Members		[]ExternalNatPoolMember		`json:"members"`
+	// ServiceRef keeps the members in sync with the endpoints of a Service,
+	// Members is ignored when it is set.
+	ServiceRef	*ServiceRef					`json:"serviceRef,omitempty"`
+	// DrainTimeout is how long removed members may finish their connections,
+	// like "2m". Defaults to 5m, "0s" removes them at once.
+	DrainTimeout	string	`json:"drainTimeout,omitempty"`
+	// MinActiveMembers fails over to lower priority members when less than
+	// this many higher priority members are up, zero disables it.
+	MinActiveMembers	int	`json:"minActiveMembers,omitempty"`
+	// ConnectionLimit caps the connections of each member, zero is no limit.
+	ConnectionLimit	int	`json:"connectionLimit,omitempty"`
+	// SlowStart ramps up the traffic of new members over this time, like "30s".
+	SlowStart		string	`json:"slowStart,omitempty"`
+	
+	// DeviceRef is the name of the LoadBalancerDevice to configure, the device
+	// of the environment when empty.
+	DeviceRef	string	`json:"deviceRef,omitempty"`
+}
+
+type ServiceRef struct {
+	Name		string	`json:"name"`
+	// Namespace defaults to the namespace of the pool.
+	Namespace	string	`json:"namespace,omitempty"`
+	// Port is the name or number of the service port, optional when the
+	// service has a single port.
+	Port		string	`json:"port,omitempty"`
+	// Mode is Endpoints (default) for pod addresses on the target port, or
+	// NodePort for the InternalIP of schedulable nodes on the node port.
+	Mode		string	`json:"mode,omitempty"`
+	// NodeSelector limits the nodes used in NodePort mode.
+	NodeSelector	map[string]string	`json:"nodeSelector,omitempty"`
+}
+
+type ExternalNatPoolMember struct {
+	IP		string	`json:"ip,omitempty"`
+	Port	string	`json:"port"`
+	// Priority orders the members when minActiveMembers is set, higher
+	// priorities take the traffic first.
+	Priority	string	`json:"priority,omitempty"`
+	// Weight is the ratio of the member, used by the ratio methods.
+	Weight		string	`json:"weight,omitempty"`
+	// ConnectionLimit overrides the connectionLimit of the pool.
+	ConnectionLimit	string	`json:"connectionLimit,omitempty"`
+}
+
+type ExternalNatPoolStatus struct {
+	State   string `json:"state,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Draining lists the removed members still finishing their connections.
+	Draining	[]DrainingMember	`json:"draining,omitempty"`
+}
+
+type DrainingMember struct {
+	Member		string			`json:"member"`
+	Connections	int				`json:"connections"`
+	// Deadline is when the member is removed even with open connections.
+	Deadline	meta_v1.Time	`json:"deadline"`
+}
+
+type ExternalNatPoolList struct {
+	meta_v1.TypeMeta `json:",inline"`
+	meta_v1.ListMeta `json:"metadata"`
+	Items            []ExternalNatPool `json:"items"`
 }
\ No newline at end of file
@@ -0,0 +1,38 @@
+package gwv1alpha2
+
+const (
+	// GatewayClass controllerNames served by ygw, they select the driver.
+	CONTROLLERF5				= "ygw.yonghui.cn/f5"
+	CONTROLLERCITRIX			= "ygw.yonghui.cn/citrix"
+
+	PROTOCOLHTTP				= "HTTP"
+	PROTOCOLHTTPS				= "HTTPS"
+	PROTOCOLTCP					= "TCP"
+
+	ADDRESSTYPEIP				= "IPAddress"
+
+	PATHMATCHPREFIX				= "PathPrefix"
+	PATHMATCHEXACT				= "Exact"
+
+	CONDITIONACCEPTED			= "Accepted"
+	CONDITIONPROGRAMMED			= "Programmed"
+	CONDITIONRESOLVEDREFS		= "ResolvedRefs"
+
+	CONDITIONTRUE				= "True"
+	CONDITIONFALSE				= "False"
+
+	REASONACCEPTED				= "Accepted"
+	REASONPROGRAMMED			= "Programmed"
+	REASONRESOLVEDREFS			= "ResolvedRefs"
+	REASONINVALID				= "Invalid"
+	REASONUNSUPPORTEDPROTOCOL	= "UnsupportedProtocol"
+	REASONNOMATCHINGPARENT		= "NoMatchingParent"
+	REASONREFNOTPERMITTED		= "RefNotPermitted"
+	REASONINVALIDCERTIFICATEREF	= "InvalidCertificateRef"
+	REASONADDRESSNOTASSIGNED	= "AddressNotAssigned"
+	REASONPROTOCOLCONFLICT		= "ProtocolConflict"
+	REASONNOTALLOWEDBYLISTENERS	= "NotAllowedByListeners"
+	REASONINVALIDKIND			= "InvalidKind"
+	REASONPENDING				= "Pending"
+	REASONINVALIDPARAMETERS		= "InvalidParameters"
+)
@@ -0,0 +1,108 @@
+package gwv1alpha2
+
+import (
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GatewayClass is cluster scoped, its ControllerName selects the driver.
+type GatewayClass struct {
+	meta_v1.TypeMeta   `json:",inline"`
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               GatewayClassSpec   `json:"spec"`
+	Status             GatewayClassStatus `json:"status,omitempty"`
+}
+
+type GatewayClassSpec struct {
+	ControllerName	string	`json:"controllerName"`
+	Description		string	`json:"description,omitempty"`
+	// ParametersRef is the LoadBalancerDevice (group loadbalance.yonghui.cn)
+	// the Gateways of the class are programmed on, the device of the
+	// environment when empty.
+	ParametersRef	*ParametersReference	`json:"parametersRef,omitempty"`
+}
+
+type ParametersReference struct {
+	Group		string	`json:"group"`
+	Kind		string	`json:"kind"`
+	Name		string	`json:"name"`
+	Namespace	string	`json:"namespace,omitempty"`
+}
+
+type GatewayClassStatus struct {
+	Conditions	[]Condition	`json:"conditions,omitempty"`
+}
+
+type GatewayClassList struct {
+	meta_v1.TypeMeta `json:",inline"`
+	meta_v1.ListMeta `json:"metadata"`
+	Items            []GatewayClass `json:"items"`
+}
+
+// Gateway is a vip with its listeners, each listener is a virtual server or
+// csvserver on the device.
+type Gateway struct {
+	meta_v1.TypeMeta   `json:",inline"`
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               GatewaySpec   `json:"spec"`
+	Status             GatewayStatus `json:"status,omitempty"`
+}
+
+type GatewaySpec struct {
+	GatewayClassName	string				`json:"gatewayClassName"`
+	Listeners			[]Listener			`json:"listeners"`
+	// Addresses selects the vip, it is allocated when empty.
+	Addresses			[]GatewayAddress	`json:"addresses,omitempty"`
+}
+
+type Listener struct {
+	Name		string				`json:"name"`
+	Hostname	string				`json:"hostname,omitempty"`
+	Port		int32				`json:"port"`
+	Protocol	string				`json:"protocol"`
+	TLS			*GatewayTLSConfig	`json:"tls,omitempty"`
+}
+
+type GatewayTLSConfig struct {
+	Mode			string						`json:"mode,omitempty"`
+	CertificateRefs	[]SecretObjectReference		`json:"certificateRefs,omitempty"`
+}
+
+type SecretObjectReference struct {
+	Group		string	`json:"group,omitempty"`
+	Kind		string	`json:"kind,omitempty"`
+	Name		string	`json:"name"`
+	Namespace	string	`json:"namespace,omitempty"`
+}
+
+type GatewayAddress struct {
+	Type	string	`json:"type,omitempty"`
+	Value	string	`json:"value"`
+}
+
+type GatewayStatus struct {
+	Addresses	[]GatewayAddress	`json:"addresses,omitempty"`
+	Conditions	[]Condition			`json:"conditions,omitempty"`
+	Listeners	[]ListenerStatus	`json:"listeners,omitempty"`
+}
+
+type ListenerStatus struct {
+	Name			string		`json:"name"`
+	AttachedRoutes	int32		`json:"attachedRoutes"`
+	Conditions		[]Condition	`json:"conditions"`
+}
+
+type GatewayList struct {
+	meta_v1.TypeMeta `json:",inline"`
+	meta_v1.ListMeta `json:"metadata"`
+	Items            []Gateway `json:"items"`
+}
+
+// Condition is the metav1.Condition of newer apimachinery releases.
+type Condition struct {
+	Type				string			`json:"type"`
+	Status				string			`json:"status"`
+	ObservedGeneration	int64			`json:"observedGeneration,omitempty"`
+	LastTransitionTime	meta_v1.Time	`json:"lastTransitionTime"`
+	Reason				string			`json:"reason"`
+	Message				string			`json:"message"`
+}
@@ -0,0 +1,42 @@
+package gwv1alpha2
+
+import (
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The upstream Gateway API CRDs are installed in the cluster, only the
+// fields ygw understands are defined here.
+const (
+	GWGroup				string = "gateway.networking.k8s.io"
+	GWVersion			string = "v1alpha2"
+
+	GatewayClassPlural	string = "gatewayclasses"
+	GatewayPlural		string = "gateways"
+	HTTPRoutePlural		string = "httproutes"
+	TCPRoutePlural		string = "tcproutes"
+)
+
+var (
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+	AddToScheme   = SchemeBuilder.AddToScheme
+)
+
+// Create a Rest client with the new CRD Schema
+var SchemeGroupVersion = schema.GroupVersion{Group: GWGroup, Version: GWVersion}
+
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion,
+		&GatewayClass{},
+		&GatewayClassList{},
+		&Gateway{},
+		&GatewayList{},
+		&HTTPRoute{},
+		&HTTPRouteList{},
+		&TCPRoute{},
+		&TCPRouteList{},
+	)
+	meta_v1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
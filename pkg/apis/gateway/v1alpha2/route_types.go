@@ -0,0 +1,92 @@
+package gwv1alpha2
+
+import (
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type HTTPRoute struct {
+	meta_v1.TypeMeta   `json:",inline"`
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               HTTPRouteSpec `json:"spec"`
+	Status             RouteStatus   `json:"status,omitempty"`
+}
+
+type HTTPRouteSpec struct {
+	ParentRefs	[]ParentReference	`json:"parentRefs,omitempty"`
+	Hostnames	[]string			`json:"hostnames,omitempty"`
+	Rules		[]HTTPRouteRule		`json:"rules,omitempty"`
+}
+
+type HTTPRouteRule struct {
+	Matches		[]HTTPRouteMatch	`json:"matches,omitempty"`
+	// only the first backend of a rule is used.
+	BackendRefs	[]BackendRef		`json:"backendRefs,omitempty"`
+}
+
+type HTTPRouteMatch struct {
+	Path	*HTTPPathMatch	`json:"path,omitempty"`
+}
+
+type HTTPPathMatch struct {
+	Type	string	`json:"type,omitempty"`
+	Value	string	`json:"value,omitempty"`
+}
+
+type HTTPRouteList struct {
+	meta_v1.TypeMeta `json:",inline"`
+	meta_v1.ListMeta `json:"metadata"`
+	Items            []HTTPRoute `json:"items"`
+}
+
+type TCPRoute struct {
+	meta_v1.TypeMeta   `json:",inline"`
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               TCPRouteSpec `json:"spec"`
+	Status             RouteStatus  `json:"status,omitempty"`
+}
+
+type TCPRouteSpec struct {
+	ParentRefs	[]ParentReference	`json:"parentRefs,omitempty"`
+	Rules		[]TCPRouteRule		`json:"rules"`
+}
+
+type TCPRouteRule struct {
+	// only the first backend of a listener is used.
+	BackendRefs	[]BackendRef	`json:"backendRefs,omitempty"`
+}
+
+type TCPRouteList struct {
+	meta_v1.TypeMeta `json:",inline"`
+	meta_v1.ListMeta `json:"metadata"`
+	Items            []TCPRoute `json:"items"`
+}
+
+// ParentReference attaches a route to a Gateway, or to one of its listeners
+// with SectionName.
+type ParentReference struct {
+	Group		string	`json:"group,omitempty"`
+	Kind		string	`json:"kind,omitempty"`
+	Namespace	string	`json:"namespace,omitempty"`
+	Name		string	`json:"name"`
+	SectionName	string	`json:"sectionName,omitempty"`
+}
+
+// BackendRef is a Service port in the namespace of the route.
+type BackendRef struct {
+	Group		string	`json:"group,omitempty"`
+	Kind		string	`json:"kind,omitempty"`
+	Name		string	`json:"name"`
+	Namespace	string	`json:"namespace,omitempty"`
+	Port		int32	`json:"port,omitempty"`
+	Weight		*int32	`json:"weight,omitempty"`
+}
+
+type RouteStatus struct {
+	Parents	[]RouteParentStatus	`json:"parents,omitempty"`
+}
+
+type RouteParentStatus struct {
+	ParentRef		ParentReference	`json:"parentRef"`
+	ControllerName	string			`json:"controllerName"`
+	Conditions		[]Condition		`json:"conditions,omitempty"`
+}
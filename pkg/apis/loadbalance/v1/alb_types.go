@@ -1,41 +1,91 @@
-package lbv1
-
-import (
-	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-)
-
-// Definition of our CRD CAppLoadBalance class
-type CAppLoadBalance struct {
-	meta_v1.TypeMeta   `json:",inline"`
-	meta_v1.ObjectMeta `json:"metadata"`
-	Spec               CAppLoadBalanceSpec   `json:"spec"`
-	Status             CAppLoadBalanceStatus `json:"status,omitempty"`
-}
-
-type CAppLoadBalanceSpec struct {
-	IP		string					`json:"ip,omitempty"`
-	Port	string					`json:"port,omitempty"`
-	Subnet	string					`json:"subnet"`
-	Rules	[]CAppLoadBalanceRule	`json:"rules,omitempty"`
-}
-
-type CAppLoadBalanceRule struct {
-	Host	string					`json:"host,omitempty"`
-	Paths	[]CAppLoadBalancePath	`json:"paths,omitempty"`
-}
-
-type CAppLoadBalancePath struct {
-	Path	string	`json:"path,omitempty"`
-	Pool	string	`json:"pool"`
-}
-
-type CAppLoadBalanceStatus struct {
-	State   string `json:"state,omitempty"`
-	Message string `json:"message,omitempty"`
-}
-
-type CAppLoadBalanceList struct {
-	meta_v1.TypeMeta `json:",inline"`
-	meta_v1.ListMeta `json:"metadata"`
-	Items            []CAppLoadBalance `json:"items"`
+package lbv1
+
+import (
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Definition of our CRD CAppLoadBalance class
+type CAppLoadBalance struct {
+	meta_v1.TypeMeta   `json:",inline"`
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               CAppLoadBalanceSpec   `json:"spec"`
+	Status             CAppLoadBalanceStatus `json:"status,omitempty"`
+}
+
+type CAppLoadBalanceSpec struct {
+	IP		string					`json:"ip,omitempty"`
+	Port	string					`json:"port,omitempty"`
+	Subnet	string					`json:"subnet"`
+	// Protocol is the service type of the virtual server: HTTP, SSL, TCP,
+	// SSL_TCP, SSL_BRIDGE or UDP. Defaults to SSL with tls and HTTP without,
+	// rules need HTTP or SSL. A BIG-IP can't terminate SSL_TCP.
+	Protocol	string				`json:"protocol,omitempty"`
+	Rules	[]CAppLoadBalanceRule	`json:"rules,omitempty"`
+	
+	// DefaultPool receives the requests no rule matches. Without it they
+	// get DefaultResponse, when set. The pools of the rules and DefaultPool
+	// are CAppLoadBalancePools of the default namespace.
+	DefaultPool		string			`json:"defaultPool,omitempty"`
+	DefaultResponse	StaticResponse	`json:"defaultResponse,omitempty"`
+	
+	// TLS terminates https on the virtual server with the certificates of
+	// kubernetes.io/tls Secrets in the namespace of the CAppLoadBalance.
+	TLS				[]CAppLoadBalanceTLS	`json:"tls,omitempty"`
+	
+	// DeviceRef is the name of the LoadBalancerDevice to configure, the device
+	// of the environment when empty.
+	DeviceRef	string	`json:"deviceRef,omitempty"`
+}
+
+type CAppLoadBalanceTLS struct {
+	Hosts		[]string	`json:"hosts,omitempty"`
+	SecretName	string		`json:"secretName"`
+}
+
+type CAppLoadBalanceRule struct {
+	Host	string					`json:"host,omitempty"`
+	Paths	[]CAppLoadBalancePath	`json:"paths,omitempty"`
+}
+
+type CAppLoadBalancePath struct {
+	Path		string			`json:"path,omitempty"`
+	Pool		string			`json:"pool,omitempty"`
+	Redirect	HTTPRedirect	`json:"redirect,omitempty"`
+	Rewrite		HTTPRewrite		`json:"rewrite,omitempty"`
+}
+
+// HTTPRedirect answers matching requests with a redirect instead of
+// forwarding them to a pool. Empty Scheme defaults to http, empty Host
+// keeps the host of the request and Code defaults to 302.
+type HTTPRedirect struct {
+	Scheme		string	`json:"scheme,omitempty"`
+	Host		string	`json:"host,omitempty"`
+	Code		int		`json:"code,omitempty"`
+}
+
+// HTTPRewrite replaces the leading PathPrefix of the request url with
+// Replacement before the request is sent to the pool. PathPrefix defaults
+// to the path of the rule.
+type HTTPRewrite struct {
+	PathPrefix	string	`json:"pathPrefix,omitempty"`
+	Replacement	string	`json:"replacement,omitempty"`
+}
+
+// StaticResponse is answered by the device itself, e.g. a maintenance page.
+// Code defaults to 503 and ContentType to text/html.
+type StaticResponse struct {
+	Code		int		`json:"code,omitempty"`
+	ContentType	string	`json:"contentType,omitempty"`
+	Body		string	`json:"body,omitempty"`
+}
+
+type CAppLoadBalanceStatus struct {
+	State   string `json:"state,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type CAppLoadBalanceList struct {
+	meta_v1.TypeMeta `json:",inline"`
+	meta_v1.ListMeta `json:"metadata"`
+	Items            []CAppLoadBalance `json:"items"`
 }
\ No newline at end of file
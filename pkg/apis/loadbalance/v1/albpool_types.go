@@ -1,35 +1,89 @@
-package lbv1
-
-import (
-	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-)
-
-// Definition of our CRD CAppLoadBalancePool class
-type CAppLoadBalancePool struct {
-	meta_v1.TypeMeta   `json:",inline"`
-	meta_v1.ObjectMeta `json:"metadata"`
-	Spec               CAppLoadBalancePoolSpec   `json:"spec"`
-	Status             CAppLoadBalancePoolStatus `json:"status,omitempty"`
-}
-
-type CAppLoadBalancePoolSpec struct {
-	Method		string							`json:"method"`
-	Members		[]CAppLoadBalancePoolMember		`json:"members"`
-}
-
-type CAppLoadBalancePoolMember struct {
-	IP		string	`json:"ip"`
-	Port	string	`json:"port"`
-	Weight	string	`json:"weight,omitempty"`
-}
-
-type CAppLoadBalancePoolStatus struct {
-	State   string `json:"state,omitempty"`
-	Message string `json:"message,omitempty"`
-}
-
-type CAppLoadBalancePoolList struct {
-	meta_v1.TypeMeta `json:",inline"`
-	meta_v1.ListMeta `json:"metadata"`
-	Items            []CAppLoadBalancePool `json:"items"`
+package lbv1
+
+import (
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Definition of our CRD CAppLoadBalancePool class
+type CAppLoadBalancePool struct {
+	meta_v1.TypeMeta   `json:",inline"`
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               CAppLoadBalancePoolSpec   `json:"spec"`
+	Status             CAppLoadBalancePoolStatus `json:"status,omitempty"`
+}
+
+type CAppLoadBalancePoolSpec struct {
+	// Method is the lb method of the members, see Method of ExternalNatPool.
+	Method		string							`json:"method,omitempty"`
+	// Protocol is the service type of the members: HTTP (default), SSL to
+	// encrypt the traffic toward them, TCP, SSL_TCP, SSL_BRIDGE or UDP. It
+	// can't be changed once the pool exists. A BIG-IP doesn't encrypt it, so
+	// SSL and SSL_TCP are NetScaler only.
+	Protocol	string							`json:"protocol,omitempty"`
+	Members		[]CAppLoadBalancePoolMember		`json:"members"`
+	// ServiceRef keeps the members in sync with the endpoints of a Service,
+	// Members is ignored when it is set.
+	ServiceRef	*ServiceRef						`json:"serviceRef,omitempty"`
+	// DrainTimeout is how long removed members may finish their connections,
+	// like "2m". Defaults to 5m, "0s" removes them at once.
+	DrainTimeout	string	`json:"drainTimeout,omitempty"`
+	// MinActiveMembers fails over to lower priority members when less than
+	// this many higher priority members are up, zero disables it. A NetScaler
+	// keeps the standby members in a backup lbvserver, a BIG-IP in lower
+	// priority groups of the pool.
+	MinActiveMembers	int	`json:"minActiveMembers,omitempty"`
+	// ConnectionLimit caps the client connections of each member, zero is no
+	// limit.
+	ConnectionLimit	int	`json:"connectionLimit,omitempty"`
+	// SlowStart ramps up the traffic of new members over this time, like "30s".
+	SlowStart		string	`json:"slowStart,omitempty"`
+	
+	// DeviceRef is the name of the LoadBalancerDevice to configure, the device
+	// of the environment when empty.
+	DeviceRef	string	`json:"deviceRef,omitempty"`
+}
+
+type ServiceRef struct {
+	Name		string	`json:"name"`
+	// Namespace defaults to the namespace of the pool.
+	Namespace	string	`json:"namespace,omitempty"`
+	// Port is the name or number of the service port, optional when the
+	// service has a single port.
+	Port		string	`json:"port,omitempty"`
+	// Mode is Endpoints (default) for pod addresses on the target port, or
+	// NodePort for the InternalIP of schedulable nodes on the node port.
+	Mode		string	`json:"mode,omitempty"`
+	// NodeSelector limits the nodes used in NodePort mode.
+	NodeSelector	map[string]string	`json:"nodeSelector,omitempty"`
+}
+
+type CAppLoadBalancePoolMember struct {
+	IP		string	`json:"ip"`
+	Port	string	`json:"port"`
+	Weight	string	`json:"weight,omitempty"`
+	// Priority orders the members when minActiveMembers is set, the highest
+	// priority members are primary and the others standby.
+	Priority	string	`json:"priority,omitempty"`
+}
+
+type CAppLoadBalancePoolStatus struct {
+	State   string `json:"state,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Draining lists the removed members still finishing their connections.
+	Draining	[]DrainingMember	`json:"draining,omitempty"`
+}
+
+type DrainingMember struct {
+	Member		string			`json:"member"`
+	// Pool is the device pool the member drains from, the pool or its backup.
+	Pool		string			`json:"pool,omitempty"`
+	Connections	int				`json:"connections"`
+	// Deadline is when the member is removed even with open connections.
+	Deadline	meta_v1.Time	`json:"deadline"`
+}
+
+type CAppLoadBalancePoolList struct {
+	meta_v1.TypeMeta `json:",inline"`
+	meta_v1.ListMeta `json:"metadata"`
+	Items            []CAppLoadBalancePool `json:"items"`
 }
\ No newline at end of file
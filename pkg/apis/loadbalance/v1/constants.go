@@ -1,8 +1,36 @@
-package lbv1
-
-const (
-	CALBPOOLSTATUSAVAILABLE 	= "Available"
-	CALBPOOLSTATUSERROR 		= "Error"
-	CALBSTATUSAVAILABLE 		= "Available"
-	CALBSTATUSERROR 			= "Error"
+package lbv1
+
+const (
+	CALBPOOLSTATUSAVAILABLE 	= "Available"
+	CALBPOOLSTATUSERROR 		= "Error"
+	CALBSTATUSAVAILABLE 		= "Available"
+	CALBSTATUSERROR 			= "Error"
+	DEVICESTATUSAVAILABLE		= "Available"
+	DEVICESTATUSERROR			= "Error"
+	
+	DEVICETYPEF5				= "f5"
+	// DEVICETYPEF5AS3 drives a BIG-IP with AS3 declarations.
+	DEVICETYPEF5AS3				= "f5-as3"
+	DEVICETYPECITRIX			= "citrix"
+	// DEVICEKIND is the kind of the parametersRef of a GatewayClass.
+	DEVICEKIND					= "LoadBalancerDevice"
+	
+	DEVICECONDITIONAUTHENTICATED	= "Authenticated"
+	DEVICECONDITIONTRUE			= "True"
+	DEVICECONDITIONFALSE		= "False"
+	DEVICEREASONLOGGEDIN		= "LoggedIn"
+	DEVICEREASONLOGINFAILED		= "LoginFailed"
+	DEVICEREASONINVALIDCREDENTIALS	= "InvalidCredentials"
+	
+	SERVICEREFMODEENDPOINTS		= "Endpoints"
+	SERVICEREFMODENODEPORT		= "NodePort"
+	
+	DEFAULTDRAINTIMEOUT		= "5m"
+	
+	PROTOCOLHTTP			= "HTTP"
+	PROTOCOLSSL				= "SSL"
+	PROTOCOLTCP				= "TCP"
+	PROTOCOLSSLTCP			= "SSL_TCP"
+	PROTOCOLSSLBRIDGE		= "SSL_BRIDGE"
+	PROTOCOLUDP				= "UDP"
 )
\ No newline at end of file
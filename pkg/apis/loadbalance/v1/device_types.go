@@ -0,0 +1,64 @@
+package lbv1
+
+import (
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Definition of our CRD LoadBalancerDevice class, a cluster scoped load
+// balancer the other resources select with their deviceRef.
+type LoadBalancerDevice struct {
+	meta_v1.TypeMeta   `json:",inline"`
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               LoadBalancerDeviceSpec   `json:"spec"`
+	Status             LoadBalancerDeviceStatus `json:"status,omitempty"`
+}
+
+type LoadBalancerDeviceSpec struct {
+	// Type is the provider of the device, like f5, f5-as3 or citrix.
+	Type		string	`json:"type"`
+	// Address is the url of the management interface, like https://10.0.0.1.
+	Address		string	`json:"address"`
+	// CredentialsSecret holds the username and password keys of the login,
+	// the sessions of the device are rebuilt when it changes.
+	CredentialsSecret	SecretReference	`json:"credentialsSecret"`
+	// Partition is the BIG-IP partition of the objects whose namespace selects
+	// none, defaults to Common. On f5-as3 devices it is the AS3 tenant, ygw
+	// instead of Common.
+	Partition	string	`json:"partition,omitempty"`
+	// InsecureSkipVerify accepts any certificate of the management interface.
+	InsecureSkipVerify	bool	`json:"insecureSkipVerify,omitempty"`
+	// CABundle are the PEM certificates trusted for the management interface,
+	// the system ones when empty.
+	CABundle	string	`json:"caBundle,omitempty"`
+	// LoginProvider is the BIG-IP login provider of the user, like tmos or a
+	// remote LDAP one, defaults to tmos.
+	LoginProvider	string	`json:"loginProvider,omitempty"`
+}
+
+type SecretReference struct {
+	Name		string	`json:"name"`
+	Namespace	string	`json:"namespace"`
+}
+
+type LoadBalancerDeviceStatus struct {
+	State   string `json:"state,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Conditions has the Authenticated condition, false while the device
+	// refuses the login of the credentials Secret.
+	Conditions	[]DeviceCondition	`json:"conditions,omitempty"`
+}
+
+type DeviceCondition struct {
+	Type				string			`json:"type"`
+	// Status is True or False.
+	Status				string			`json:"status"`
+	Reason				string			`json:"reason,omitempty"`
+	Message				string			`json:"message,omitempty"`
+	LastTransitionTime	meta_v1.Time	`json:"lastTransitionTime,omitempty"`
+}
+
+type LoadBalancerDeviceList struct {
+	meta_v1.TypeMeta `json:",inline"`
+	meta_v1.ListMeta `json:"metadata"`
+	Items            []LoadBalancerDevice `json:"items"`
+}
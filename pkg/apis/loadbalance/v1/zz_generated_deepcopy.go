@@ -1,212 +1,272 @@
-// +build !ignore_autogenerated
-
-/*
-Copyright 2018 CuiHaozhi@gmail.com.
-
-Licensed under the Apache License, Version 2.0 (the "License");
-you may not use this file except in compliance with the License.
-You may obtain a copy of the License at
-
-    http://www.apache.org/licenses/LICENSE-2.0
-
-Unless required by applicable law or agreed to in writing, software
-distributed under the License is distributed on an "AS IS" BASIS,
-WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-See the License for the specific language governing permissions and
-limitations under the License.
-*/
-// Code generated by main. DO NOT EDIT.
-
-package lbv1
-
-import (
-	runtime "k8s.io/apimachinery/pkg/runtime"
-)
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CAppLoadBalancePool) DeepCopyInto(out *CAppLoadBalancePool) {
-	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
-	return
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePool.
-func (in *CAppLoadBalancePool) DeepCopy() *CAppLoadBalancePool {
-	if in == nil {
-		return nil
-	}
-	out := new(CAppLoadBalancePool)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *CAppLoadBalancePool) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CAppLoadBalancePoolList) DeepCopyInto(out *CAppLoadBalancePoolList) {
-	*out = *in
-	out.TypeMeta = in.TypeMeta
-	out.ListMeta = in.ListMeta
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]CAppLoadBalancePool, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-	return
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolList.
-func (in *CAppLoadBalancePoolList) DeepCopy() *CAppLoadBalancePoolList {
-	if in == nil {
-		return nil
-	}
-	out := new(CAppLoadBalancePoolList)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *CAppLoadBalancePoolList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CAppLoadBalancePoolSpec) DeepCopyInto(out *CAppLoadBalancePoolSpec) {
-	*out = *in
-	return
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolSpec.
-func (in *CAppLoadBalancePoolSpec) DeepCopy() *CAppLoadBalancePoolSpec {
-	if in == nil {
-		return nil
-	}
-	out := new(CAppLoadBalancePoolSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CAppLoadBalancePoolStatus) DeepCopyInto(out *CAppLoadBalancePoolStatus) {
-	*out = *in
-	return
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolStatus.
-func (in *CAppLoadBalancePoolStatus) DeepCopy() *CAppLoadBalancePoolStatus {
-	if in == nil {
-		return nil
-	}
-	out := new(CAppLoadBalancePoolStatus)
-	in.DeepCopyInto(out)
-	return out
-}
-
-
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CAppLoadBalance) DeepCopyInto(out *CAppLoadBalance) {
-	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
-	return
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePool.
-func (in *CAppLoadBalance) DeepCopy() *CAppLoadBalance {
-	if in == nil {
-		return nil
-	}
-	out := new(CAppLoadBalance)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *CAppLoadBalance) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CAppLoadBalanceList) DeepCopyInto(out *CAppLoadBalanceList) {
-	*out = *in
-	out.TypeMeta = in.TypeMeta
-	out.ListMeta = in.ListMeta
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]CAppLoadBalance, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-	return
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolList.
-func (in *CAppLoadBalanceList) DeepCopy() *CAppLoadBalanceList {
-	if in == nil {
-		return nil
-	}
-	out := new(CAppLoadBalanceList)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *CAppLoadBalanceList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CAppLoadBalanceSpec) DeepCopyInto(out *CAppLoadBalanceSpec) {
-	*out = *in
-	return
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolSpec.
-func (in *CAppLoadBalanceSpec) DeepCopy() *CAppLoadBalanceSpec {
-	if in == nil {
-		return nil
-	}
-	out := new(CAppLoadBalanceSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CAppLoadBalanceStatus) DeepCopyInto(out *CAppLoadBalanceStatus) {
-	*out = *in
-	return
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolStatus.
-func (in *CAppLoadBalanceStatus) DeepCopy() *CAppLoadBalanceStatus {
-	if in == nil {
-		return nil
-	}
-	out := new(CAppLoadBalanceStatus)
-	in.DeepCopyInto(out)
-	return out
-}
\ No newline at end of file
+// +build !ignore_autogenerated
+
+/*
+Copyright 2018 CuiHaozhi@gmail.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by main. DO NOT EDIT.
+
+package lbv1
+
+import (
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAppLoadBalancePool) DeepCopyInto(out *CAppLoadBalancePool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	out.Status = in.Status
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePool.
+func (in *CAppLoadBalancePool) DeepCopy() *CAppLoadBalancePool {
+	if in == nil {
+		return nil
+	}
+	out := new(CAppLoadBalancePool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CAppLoadBalancePool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAppLoadBalancePoolList) DeepCopyInto(out *CAppLoadBalancePoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CAppLoadBalancePool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolList.
+func (in *CAppLoadBalancePoolList) DeepCopy() *CAppLoadBalancePoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(CAppLoadBalancePoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CAppLoadBalancePoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAppLoadBalancePoolSpec) DeepCopyInto(out *CAppLoadBalancePoolSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolSpec.
+func (in *CAppLoadBalancePoolSpec) DeepCopy() *CAppLoadBalancePoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CAppLoadBalancePoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAppLoadBalancePoolStatus) DeepCopyInto(out *CAppLoadBalancePoolStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolStatus.
+func (in *CAppLoadBalancePoolStatus) DeepCopy() *CAppLoadBalancePoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CAppLoadBalancePoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAppLoadBalance) DeepCopyInto(out *CAppLoadBalance) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	out.Status = in.Status
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePool.
+func (in *CAppLoadBalance) DeepCopy() *CAppLoadBalance {
+	if in == nil {
+		return nil
+	}
+	out := new(CAppLoadBalance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CAppLoadBalance) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAppLoadBalanceList) DeepCopyInto(out *CAppLoadBalanceList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CAppLoadBalance, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolList.
+func (in *CAppLoadBalanceList) DeepCopy() *CAppLoadBalanceList {
+	if in == nil {
+		return nil
+	}
+	out := new(CAppLoadBalanceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CAppLoadBalanceList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAppLoadBalanceSpec) DeepCopyInto(out *CAppLoadBalanceSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolSpec.
+func (in *CAppLoadBalanceSpec) DeepCopy() *CAppLoadBalanceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CAppLoadBalanceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAppLoadBalanceStatus) DeepCopyInto(out *CAppLoadBalanceStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAppLoadBalancePoolStatus.
+func (in *CAppLoadBalanceStatus) DeepCopy() *CAppLoadBalanceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CAppLoadBalanceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerDevice) DeepCopyInto(out *LoadBalancerDevice) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	out.Status = in.Status
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerDevice.
+func (in *LoadBalancerDevice) DeepCopy() *LoadBalancerDevice {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerDevice)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LoadBalancerDevice) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerDeviceList) DeepCopyInto(out *LoadBalancerDeviceList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]LoadBalancerDevice, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerDeviceList.
+func (in *LoadBalancerDeviceList) DeepCopy() *LoadBalancerDeviceList {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerDeviceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LoadBalancerDeviceList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	gwv1 "github.com/sak0/ygw/pkg/apis/gateway/v1alpha2"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+)
+
+// GatewayClass is cluster scoped.
+func GatewayClassClient(cl *rest.RESTClient, scheme *runtime.Scheme) *gwcclient {
+	return &gwcclient{cl: cl, plural: gwv1.GatewayClassPlural,
+		codec: runtime.NewParameterCodec(scheme)}
+}
+
+type gwcclient struct {
+	cl		*rest.RESTClient
+	ns		string
+	plural	string
+	codec	runtime.ParameterCodec
+}
+
+// UpdateStatus writes the status subresource, the Gateway API CRDs ignore
+// status changes sent with Update.
+func (f *gwcclient) UpdateStatus(obj *gwv1.GatewayClass, name string) (*gwv1.GatewayClass, error) {
+	var result gwv1.GatewayClass
+	err := f.cl.Put().
+		Namespace(f.ns).Resource(f.plural).
+		Name(name).SubResource("status").
+		Body(obj).Do().Into(&result)
+	return &result, err
+}
+
+func (f *gwcclient) Get(name string) (*gwv1.GatewayClass, error) {
+	var result gwv1.GatewayClass
+	err := f.cl.Get().
+		Namespace(f.ns).Resource(f.plural).
+		Name(name).Do().Into(&result)
+	return &result, err
+}
+
+func (f *gwcclient) List(opts meta_v1.ListOptions) (*gwv1.GatewayClassList, error) {
+	var result gwv1.GatewayClassList
+	err := f.cl.Get().
+		Namespace(f.ns).Resource(f.plural).
+		VersionedParams(&opts, f.codec).
+		Do().Into(&result)
+	return &result, err
+}
+
+func (f *gwcclient) NewListWatch() *cache.ListWatch {
+	return cache.NewListWatchFromClient(f.cl, f.plural, meta_v1.NamespaceAll, fields.Everything())
+}
+
+
+func GatewayClient(cl *rest.RESTClient, scheme *runtime.Scheme, namespace string) *gwclient {
+	return &gwclient{cl: cl, ns: namespace, plural: gwv1.GatewayPlural,
+		codec: runtime.NewParameterCodec(scheme)}
+}
+
+type gwclient struct {
+	cl		*rest.RESTClient
+	ns		string
+	plural	string
+	codec	runtime.ParameterCodec
+}
+
+func (f *gwclient) Update(obj *gwv1.Gateway, name string) (*gwv1.Gateway, error) {
+	var result gwv1.Gateway
+	err := f.cl.Put().
+		Namespace(f.ns).Resource(f.plural).
+		Name(name).
+		Body(obj).Do().Into(&result)
+	return &result, err
+}
+
+// UpdateStatus writes the status subresource, the Gateway API CRDs ignore
+// status changes sent with Update.
+func (f *gwclient) UpdateStatus(obj *gwv1.Gateway, name string) (*gwv1.Gateway, error) {
+	var result gwv1.Gateway
+	err := f.cl.Put().
+		Namespace(f.ns).Resource(f.plural).
+		Name(name).SubResource("status").
+		Body(obj).Do().Into(&result)
+	return &result, err
+}
+
+func (f *gwclient) Get(name string) (*gwv1.Gateway, error) {
+	var result gwv1.Gateway
+	err := f.cl.Get().
+		Namespace(f.ns).Resource(f.plural).
+		Name(name).Do().Into(&result)
+	return &result, err
+}
+
+func (f *gwclient) List(opts meta_v1.ListOptions) (*gwv1.GatewayList, error) {
+	var result gwv1.GatewayList
+	err := f.cl.Get().
+		Namespace(f.ns).Resource(f.plural).
+		VersionedParams(&opts, f.codec).
+		Do().Into(&result)
+	return &result, err
+}
+
+func (f *gwclient) NewListWatch() *cache.ListWatch {
+	return cache.NewListWatchFromClient(f.cl, f.plural, meta_v1.NamespaceAll, fields.Everything())
+}
+
+
+func HTTPRouteClient(cl *rest.RESTClient, scheme *runtime.Scheme, namespace string) *httprouteclient {
+	return &httprouteclient{cl: cl, ns: namespace, plural: gwv1.HTTPRoutePlural,
+		codec: runtime.NewParameterCodec(scheme)}
+}
+
+type httprouteclient struct {
+	cl		*rest.RESTClient
+	ns		string
+	plural	string
+	codec	runtime.ParameterCodec
+}
+
+// UpdateStatus writes the status subresource, the Gateway API CRDs ignore
+// status changes sent with Update.
+func (f *httprouteclient) UpdateStatus(obj *gwv1.HTTPRoute, name string) (*gwv1.HTTPRoute, error) {
+	var result gwv1.HTTPRoute
+	err := f.cl.Put().
+		Namespace(f.ns).Resource(f.plural).
+		Name(name).SubResource("status").
+		Body(obj).Do().Into(&result)
+	return &result, err
+}
+
+func (f *httprouteclient) Get(name string) (*gwv1.HTTPRoute, error) {
+	var result gwv1.HTTPRoute
+	err := f.cl.Get().
+		Namespace(f.ns).Resource(f.plural).
+		Name(name).Do().Into(&result)
+	return &result, err
+}
+
+func (f *httprouteclient) List(opts meta_v1.ListOptions) (*gwv1.HTTPRouteList, error) {
+	var result gwv1.HTTPRouteList
+	err := f.cl.Get().
+		Namespace(f.ns).Resource(f.plural).
+		VersionedParams(&opts, f.codec).
+		Do().Into(&result)
+	return &result, err
+}
+
+func (f *httprouteclient) NewListWatch() *cache.ListWatch {
+	return cache.NewListWatchFromClient(f.cl, f.plural, meta_v1.NamespaceAll, fields.Everything())
+}
+
+
+func TCPRouteClient(cl *rest.RESTClient, scheme *runtime.Scheme, namespace string) *tcprouteclient {
+	return &tcprouteclient{cl: cl, ns: namespace, plural: gwv1.TCPRoutePlural,
+		codec: runtime.NewParameterCodec(scheme)}
+}
+
+type tcprouteclient struct {
+	cl		*rest.RESTClient
+	ns		string
+	plural	string
+	codec	runtime.ParameterCodec
+}
+
+// UpdateStatus writes the status subresource, the Gateway API CRDs ignore
+// status changes sent with Update.
+func (f *tcprouteclient) UpdateStatus(obj *gwv1.TCPRoute, name string) (*gwv1.TCPRoute, error) {
+	var result gwv1.TCPRoute
+	err := f.cl.Put().
+		Namespace(f.ns).Resource(f.plural).
+		Name(name).SubResource("status").
+		Body(obj).Do().Into(&result)
+	return &result, err
+}
+
+func (f *tcprouteclient) Get(name string) (*gwv1.TCPRoute, error) {
+	var result gwv1.TCPRoute
+	err := f.cl.Get().
+		Namespace(f.ns).Resource(f.plural).
+		Name(name).Do().Into(&result)
+	return &result, err
+}
+
+func (f *tcprouteclient) List(opts meta_v1.ListOptions) (*gwv1.TCPRouteList, error) {
+	var result gwv1.TCPRouteList
+	err := f.cl.Get().
+		Namespace(f.ns).Resource(f.plural).
+		VersionedParams(&opts, f.codec).
+		Do().Into(&result)
+	return &result, err
+}
+
+func (f *tcprouteclient) NewListWatch() *cache.ListWatch {
+	return cache.NewListWatchFromClient(f.cl, f.plural, meta_v1.NamespaceAll, fields.Everything())
+}
+
+
+func NewGatewayClient(cfg *rest.Config) (*rest.RESTClient, *runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := gwv1.AddToScheme(scheme); err != nil {
+		return nil, nil, err
+	}
+	
+	config := *cfg
+	config.GroupVersion = &gwv1.SchemeGroupVersion
+	config.APIPath = "/apis"
+	config.ContentType = runtime.ContentTypeJSON
+	config.NegotiatedSerializer = serializer.DirectCodecFactory{
+		CodecFactory: serializer.NewCodecFactory(scheme)}
+
+	client, err := rest.RESTClientFor(&config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, scheme, nil
+}
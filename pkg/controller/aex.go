@@ -1,163 +1,436 @@
-package controller
-
-import (
-	"time"
-	"os"
-	"reflect"
-	
-	"github.com/golang/glog"
-	
-	"k8s.io/client-go/kubernetes"	
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
-	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-	
-	crdclient 	"github.com/sak0/ygw/pkg/client"
-	crdv1 		"github.com/sak0/ygw/pkg/apis/external/v1"
-	driver 		"github.com/sak0/ygw/pkg/drivers"
-	"github.com/sak0/ygw/pkg/utils"
-)
-
-type AexController struct {
-	crdClient		*rest.RESTClient
-	crdScheme		*runtime.Scheme
-	client			kubernetes.Interface
-	
-	aexController	cache.Controller
-	driver			driver.GwProvider
-}
-
-func NewAexController(client kubernetes.Interface, crdClient *rest.RESTClient, 
-					crdScheme *runtime.Scheme)(*AexController, error) {
-	aexctr := &AexController{
-		crdClient 	: crdClient,
-		crdScheme 	: crdScheme,
-		client		: client,
-	}
-	driver, err := driver.New("f5")
-	if err != nil {
-		glog.Errorf("Intialization bigip connection faild: %v", err)
-		return nil, err
-	}
-	aexctr.driver = driver	
-	
-	aexListWatch := cache.NewListWatchFromClient(aexctr.crdClient, 
-		crdv1.AEXPlural, meta_v1.NamespaceAll, fields.Everything())
-	
-	_, aexcontroller := cache.NewInformer(
-		aexListWatch,
-		&crdv1.AppExternalNat{},
-		time.Minute*10,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: aexctr.onAexAdd,
-			DeleteFunc: aexctr.onAexDel,
-			UpdateFunc: aexctr.onAexUpdate,
-		},
-	)
-	aexctr.aexController = aexcontroller
-	
-	return aexctr, nil
-}
-
-func (c *AexController)Run(ctx <-chan struct{}) {
-	glog.V(2).Infof("Aex Controller starting...")
-	go c.aexController.Run(ctx)
-	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
-		return c.aexController.HasSynced(), nil
-	})
-	if !c.aexController.HasSynced() {
-		glog.Errorf("aex informer initial sync timeout")
-		os.Exit(1)
-	}
-}
-
-func (c *AexController)onAexAdd(obj interface{}) {
-	glog.V(3).Infof("Add-Aex: %v", obj)
-	aex := obj.(*crdv1.AppExternalNat)
-	aexName := utils.GenerateAexName(aex.Namespace, aex.Name)
-	err := c.driver.CreateVirtualServer("url", aexName, aex.Spec.IP, aex.Spec.Port, aex.Spec.Protocol)
-	if err != nil {
-		glog.Errorf("CreateVirtualServer failed: %+v\n", err)
-		c.updateError(err.Error(), aex)
-		return				
-	}
-	
-	for _, rule := range aex.Spec.Rules {
-		host := rule.Host
-		pool := rule.PoolName
-		poolName := utils.GeneratePoolNameEXP(aex.Namespace, pool)
-		err := c.driver.VirtualServerBindURL(aexName, host, poolName)
-		if err != nil {
-			glog.Errorf("VirtualServerBindURL %s(%s) to %s failed: %+v\n", 
-				poolName, host, aexName, err)
-			c.updateError(err.Error(), aex)
-			return			
-		}
-	}	
-}
-
-func (c *AexController)onAexUpdate(oldObj, newObj interface{}) {
-	glog.V(3).Infof("Update-Aex: %v -> %v", oldObj, newObj)
-
-	if !reflect.DeepEqual(oldObj, newObj) {
-		newAex := newObj.(*crdv1.AppExternalNat)
-		oldAex := oldObj.(*crdv1.AppExternalNat)
-		
-		rulesNew := utils.GetRulesMap(newAex)
-		rulesOld := utils.GetRulesMap(oldAex)
-		glog.V(2).Infof("rulesNew: %v", rulesNew)
-		glog.V(2).Infof("rulesOld: %v", rulesOld)
-		if !reflect.DeepEqual(rulesNew, rulesOld) {
-			glog.V(2).Infof("Need update Pool configurations.")
-			c.updateAex(newAex, rulesOld, rulesNew)
-		}					
-	}	
-}
-
-func (c *AexController)updateAex(aex *crdv1.AppExternalNat, rulesOld, rulesNew map[crdv1.AppExternalNatRule]int){
-	vsName := utils.GenerateAexName(aex.Namespace, aex.Name)
-	
-	for ruleNew, _ := range rulesNew {
-		if _, ok := rulesOld[ruleNew]; !ok {
-			glog.V(2).Infof("need add rule %v on %s", ruleNew, vsName)
-			poolName := utils.GeneratePoolNameEXP(aex.Namespace, ruleNew.PoolName)
-			err := c.driver.VirtualServerBindURL(vsName, ruleNew.Host, poolName)
-			if err != nil {
-				glog.Errorf("VirtualServerBindURL failed %v", err)
-			}
-		}
-	}
-	
-	for ruleOld, _ := range rulesOld {
-		if _, ok := rulesNew[ruleOld]; !ok {
-			glog.V(2).Infof("need remove rule %v from %s", ruleOld, vsName)
-			poolName := utils.GeneratePoolNameEXP(aex.Namespace, ruleOld.PoolName)
-			err := c.driver.VirtualServerUnbindURL(vsName, ruleOld.Host, poolName)
-			if err != nil {
-				glog.Errorf("VirtualServerUnbindURL failed %v", err)
-			}			
-		}
-	}
-}
-
-func (c *AexController)onAexDel(obj interface{}) {
-	glog.V(3).Infof("Del-Aex: %v", obj)
-
-	aex := obj.(*crdv1.AppExternalNat)
-	
-	aexName := utils.GenerateAexName(aex.Namespace, aex.Name)
-	err := c.driver.DeleteVirtualServer(aexName)
-	if err != nil {
-		glog.Errorf("DeleteVirtualServer failed: %+v\n", err)
-	}	
-}
-
-func (c *AexController)updateError(msg string, aex *crdv1.AppExternalNat) {
-	aex.Status.State = crdv1.AEXSTATUSERROR
-	aex.Status.Message = msg
-	aexclient := crdclient.AexClient(c.crdClient, c.crdScheme, aex.Namespace)
-	_, _ = aexclient.Update(aex, aex.Name)
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"os"
+	"reflect"
+	
+	"github.com/golang/glog"
+	
+	"k8s.io/client-go/kubernetes"	
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	
+	crdclient 	"github.com/sak0/ygw/pkg/client"
+	crdv1 		"github.com/sak0/ygw/pkg/apis/external/v1"
+	driver 		"github.com/sak0/ygw/pkg/drivers"
+	"github.com/sak0/ygw/pkg/utils"
+)
+
+type AexController struct {
+	crdClient		*rest.RESTClient
+	crdScheme		*runtime.Scheme
+	client			kubernetes.Interface
+	
+	aexController	cache.Controller
+	devices			*DeviceController
+}
+
+func NewAexController(client kubernetes.Interface, crdClient *rest.RESTClient, 
+					crdScheme *runtime.Scheme, devices *DeviceController)(*AexController, error) {
+	aexctr := &AexController{
+		crdClient 	: crdClient,
+		crdScheme 	: crdScheme,
+		client		: client,
+		devices		: devices,
+	}
+	
+	aexListWatch := cache.NewListWatchFromClient(aexctr.crdClient, 
+		crdv1.AEXPlural, meta_v1.NamespaceAll, fields.Everything())
+	
+	_, aexcontroller := cache.NewInformer(
+		aexListWatch,
+		&crdv1.AppExternalNat{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: aexctr.onAexAdd,
+			DeleteFunc: aexctr.onAexDel,
+			UpdateFunc: aexctr.onAexUpdate,
+		},
+	)
+	aexctr.aexController = aexcontroller
+	
+	return aexctr, nil
+}
+
+func (c *AexController)Run(ctx <-chan struct{}) {
+	glog.V(2).Infof("Aex Controller starting...")
+	go c.aexController.Run(ctx)
+	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
+		return c.aexController.HasSynced(), nil
+	})
+	if !c.aexController.HasSynced() {
+		glog.Errorf("aex informer initial sync timeout")
+		os.Exit(1)
+	}
+}
+
+// provider returns the driver for the device and BIG-IP partition of aex,
+// collecting the calls of a sync, see batch.
+func (c *AexController)provider(aex *crdv1.AppExternalNat)(driver.Batch, error){
+	drv, err := c.devices.Provider(crdv1.AEXPlural, aex.Spec.DeviceRef, aex)
+	if err != nil {
+		return nil, err
+	}
+	return batch(drv), nil
+}
+
+// recordPartition saves on aex the BIG-IP partition its objects are created
+// in and returns the saved aex.
+func (c *AexController)recordPartition(aex *crdv1.AppExternalNat)*crdv1.AppExternalNat{
+	aex = aex.DeepCopy()
+	if !c.devices.RecordPartition(crdv1.AEXPlural, aex.Spec.DeviceRef, aex) {
+		return aex
+	}
+	aexclient := crdclient.AexClient(c.crdClient, c.crdScheme, aex.Namespace)
+	saved, err := aexclient.Update(aex, aex.Name)
+	if err != nil {
+		glog.Errorf("Record partition of aex %s failed: %v", aex.Name, err)
+		return aex
+	}
+	return saved
+}
+
+// checkPoolDevices checks that the pools of aex are on its device, a virtual
+// server only reaches the pools of its own device. The pools not created yet
+// are left to the device to report.
+func (c *AexController)checkPoolDevices(aex *crdv1.AppExternalNat)error{
+	refs := []string{}
+	if aex.Spec.DefaultPool != "" {
+		refs = append(refs, aex.Spec.DefaultPool)
+	}
+	for _, rule := range aex.Spec.Rules {
+		if rule.PoolName != "" {
+			refs = append(refs, rule.PoolName)
+		}
+	}
+	device := c.devices.DeviceOf(crdv1.AEXPlural, aex.Spec.DeviceRef)
+	poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, aex.Namespace)
+	for _, ref := range refs {
+		pool, err := poolclient.Get(ref)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		poolDevice := c.devices.DeviceOf(crdv1.EXPPlural, pool.Spec.DeviceRef)
+		if poolDevice != device {
+			return fmt.Errorf("pool %s is on device %s, aex %s is on %s", ref, poolDevice, aex.Name, device)
+		}
+	}
+	return nil
+}
+
+func (c *AexController)onAexAdd(obj interface{}) {
+	glog.V(3).Infof("Add-Aex: %v", obj)
+	aex := obj.(*crdv1.AppExternalNat)
+	aex = c.recordPartition(aex)
+	aexName := utils.GenerateAexName(aex.Namespace, aex.Name)
+	drv, err := c.provider(aex)
+	if err != nil {
+		glog.Errorf("Get driver of %s failed: %v", aexName, err)
+		c.updateError(err.Error(), aex)
+		return
+	}
+	err = c.checkPoolDevices(aex)
+	if err != nil {
+		glog.Errorf("Check pools of %s failed: %v", aexName, err)
+		c.updateError(err.Error(), aex)
+		return
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	defer commit(ctx, drv)
+	err = retryDevice(func()error{
+		return drv.CreateVirtualServer(ctx, driver.VirtualServer{
+			Name		: aexName,
+			Mode		: driver.MODEHTTP,
+			IP			: aex.Spec.IP,
+			Port		: aex.Spec.Port,
+			Protocol	: aex.Spec.Protocol,
+			TLS			: len(aex.Spec.TLS) > 0,
+		})
+	})
+	if err != nil {
+		glog.Errorf("CreateVirtualServer failed: %+v\n", err)
+		c.updateError(err.Error(), aex)
+		return				
+	}
+	
+	for _, rule := range aex.Spec.Rules {
+		err := c.bindRule(ctx, drv, aexName, aex.Namespace, rule)
+		if err != nil {
+			glog.Errorf("Bind rule %v to %s failed: %+v\n", rule, aexName, err)
+			c.updateError(err.Error(), aex)
+			return			
+		}
+	}
+	
+	err = c.bindDefault(ctx, drv, aexName, aex.Namespace, aex.Spec)
+	if err != nil {
+		glog.Errorf("Bind default backend to %s failed: %+v\n", aexName, err)
+		c.updateError(err.Error(), aex)
+		return
+	}
+	
+	err = c.bindTLS(ctx, drv, aexName, aex.Namespace, aex.Spec.TLS)
+	if err != nil {
+		glog.Errorf("Bind tls to %s failed: %+v\n", aexName, err)
+		c.updateError(err.Error(), aex)
+		return
+	}
+	err = drv.Commit(ctx)
+	if err != nil {
+		glog.Errorf("Commit %s failed: %+v\n", aexName, err)
+		c.updateError(err.Error(), aex)
+	}
+}
+
+// bindTLS installs the certificate of every tls entry on the virtual server.
+// The first entry is the one served to clients without a matching SNI name.
+func (c *AexController)bindTLS(ctx context.Context, drv driver.Provider, vsName string, namespace string, tlsList []crdv1.AppExternalNatTLS)error{
+	for i, tls := range tlsList {
+		cert, key, err := utils.GetTLSSecret(c.client, namespace, tls.SecretName)
+		if err != nil {
+			return err
+		}
+		serverName := ""
+		if len(tls.Hosts) > 0 {
+			serverName = tls.Hosts[0]
+		}
+		err = drv.AddCert(ctx, vsName, driver.Cert{
+			Name		: utils.GenerateCertName(vsName, tls.SecretName),
+			ServerName	: serverName,
+			Default		: i == 0,
+			Cert		: cert,
+			Key			: key,
+			Namespace	: namespace,
+			Secret		: tls.SecretName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *AexController)unbindTLS(ctx context.Context, drv driver.Provider, vsName string, namespace string, tlsList []crdv1.AppExternalNatTLS)error{
+	for _, tls := range tlsList {
+		err := drv.RemoveCert(ctx, vsName, driver.Cert{Name : utils.GenerateCertName(vsName, tls.SecretName)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindDefault sets up the fallback for requests no rule matches: the default
+// pool of the virtual server or, without one, the static response.
+func (c *AexController)bindDefault(ctx context.Context, drv driver.Provider, vsName string, namespace string, spec crdv1.AppExternalNatSpec)error{
+	if spec.DefaultPool != "" {
+		poolName := utils.GeneratePoolNameEXP(namespace, spec.DefaultPool)
+		return drv.SetDefaultPool(ctx, vsName, poolName)
+	}
+	if spec.DefaultResponse != (crdv1.StaticResponse{}) {
+		resp := spec.DefaultResponse
+		return drv.SetDefaultResponse(ctx, vsName, driver.Response{
+			Code		: resp.Code,
+			ContentType	: resp.ContentType,
+			Body		: resp.Body,
+		})
+	}
+	return nil
+}
+
+func (c *AexController)unbindDefault(ctx context.Context, drv driver.Provider, vsName string, namespace string, spec crdv1.AppExternalNatSpec)error{
+	if spec.DefaultPool != "" {
+		poolName := utils.GeneratePoolNameEXP(namespace, spec.DefaultPool)
+		return drv.UnsetDefaultPool(ctx, vsName, poolName)
+	}
+	if spec.DefaultResponse != (crdv1.StaticResponse{}) {
+		return drv.UnsetDefaultResponse(ctx, vsName)
+	}
+	return nil
+}
+
+// providerRule returns the rule of the driver for one host rule: a redirect
+// answers the request on the device, a rewrite changes the uri before
+// forwarding it to the pool and a plain rule only selects the pool.
+func providerRule(namespace string, rule crdv1.AppExternalNatRule)driver.Rule{
+	r := driver.Rule{
+		Host	: rule.Host,
+		Path	: rule.Path,
+	}
+	if rule.Redirect != (crdv1.HTTPRedirect{}) {
+		r.Redirect = &driver.Redirect{
+			Scheme	: rule.Redirect.Scheme,
+			Host	: rule.Redirect.Host,
+			Code	: rule.Redirect.Code,
+		}
+		return r
+	}
+	
+	r.Pool = utils.GeneratePoolNameEXP(namespace, rule.PoolName)
+	if rule.Rewrite != (crdv1.HTTPRewrite{}) {
+		r.Rewrite = &driver.Rewrite{
+			Prefix		: rule.Rewrite.PathPrefix,
+			Replacement	: rule.Rewrite.Replacement,
+		}
+	}
+	return r
+}
+
+func (c *AexController)bindRule(ctx context.Context, drv driver.Provider, vsName string, namespace string, rule crdv1.AppExternalNatRule)error{
+	return drv.AddRule(ctx, vsName, providerRule(namespace, rule))
+}
+
+func (c *AexController)unbindRule(ctx context.Context, drv driver.Provider, vsName string, namespace string, rule crdv1.AppExternalNatRule)error{
+	return drv.RemoveRule(ctx, vsName, providerRule(namespace, rule))
+}
+
+func (c *AexController)onAexUpdate(oldObj, newObj interface{}) {
+	glog.V(3).Infof("Update-Aex: %v -> %v", oldObj, newObj)
+
+	if !reflect.DeepEqual(oldObj, newObj) {
+		newAex := newObj.(*crdv1.AppExternalNat)
+		oldAex := oldObj.(*crdv1.AppExternalNat)
+		
+		// a NetScaler can't turn TLS on or off on its virtual server.
+		if oldAex.Spec.DeviceRef != newAex.Spec.DeviceRef || 
+			(len(oldAex.Spec.TLS) > 0) != (len(newAex.Spec.TLS) > 0) {
+			glog.V(2).Infof("Need recreate %s/%s.", newAex.Namespace, newAex.Name)
+			c.onAexDel(oldAex)
+			c.onAexAdd(newAex)
+			return
+		}
+		drv, err := c.provider(newAex)
+		if err != nil {
+			glog.Errorf("Get driver of %s failed: %v", newAex.Name, err)
+			c.updateError(err.Error(), newAex)
+			return
+		}
+		err = c.checkPoolDevices(newAex)
+		if err != nil {
+			glog.Errorf("Check pools of %s failed: %v", newAex.Name, err)
+			c.updateError(err.Error(), newAex)
+			return
+		}
+		ctx, cancel := deviceContext()
+		defer cancel()
+		defer commit(ctx, drv)
+		
+		rulesNew := utils.GetRulesMap(newAex)
+		rulesOld := utils.GetRulesMap(oldAex)
+		glog.V(2).Infof("rulesNew: %v", rulesNew)
+		glog.V(2).Infof("rulesOld: %v", rulesOld)
+		if !reflect.DeepEqual(rulesNew, rulesOld) {
+			glog.V(2).Infof("Need update Pool configurations.")
+			c.updateAex(ctx, drv, newAex, rulesOld, rulesNew)
+		}
+		
+		if oldAex.Spec.DefaultPool != newAex.Spec.DefaultPool || 
+			oldAex.Spec.DefaultResponse != newAex.Spec.DefaultResponse {
+			glog.V(2).Infof("Need update default backend.")
+			vsName := utils.GenerateAexName(newAex.Namespace, newAex.Name)
+			err := c.unbindDefault(ctx, drv, vsName, oldAex.Namespace, oldAex.Spec)
+			if err != nil {
+				glog.Errorf("Unbind default backend failed %v", err)
+			}
+			err = c.bindDefault(ctx, drv, vsName, newAex.Namespace, newAex.Spec)
+			if err != nil {
+				glog.Errorf("Bind default backend failed %v", err)
+				c.updateError(err.Error(), newAex)
+			}
+		}
+		
+		if !reflect.DeepEqual(oldAex.Spec.TLS, newAex.Spec.TLS) {
+			glog.V(2).Infof("Need update tls certificates.")
+			vsName := utils.GenerateAexName(newAex.Namespace, newAex.Name)
+			err := c.unbindTLS(ctx, drv, vsName, oldAex.Namespace, oldAex.Spec.TLS)
+			if err != nil {
+				glog.Errorf("Unbind tls failed %v", err)
+			}
+			err = c.bindTLS(ctx, drv, vsName, newAex.Namespace, newAex.Spec.TLS)
+			if err != nil {
+				glog.Errorf("Bind tls failed %v", err)
+				c.updateError(err.Error(), newAex)
+			}
+		}
+		err = drv.Commit(ctx)
+		if err != nil {
+			glog.Errorf("Commit %s failed %v", newAex.Name, err)
+			c.updateError(err.Error(), newAex)
+		}
+	}	
+}
+
+func (c *AexController)updateAex(ctx context.Context, drv driver.Provider, aex *crdv1.AppExternalNat, rulesOld, rulesNew map[crdv1.AppExternalNatRule]int){
+	vsName := utils.GenerateAexName(aex.Namespace, aex.Name)
+	
+	for ruleNew, _ := range rulesNew {
+		if _, ok := rulesOld[ruleNew]; !ok {
+			glog.V(2).Infof("need add rule %v on %s", ruleNew, vsName)
+			err := c.bindRule(ctx, drv, vsName, aex.Namespace, ruleNew)
+			if err != nil {
+				glog.Errorf("Bind rule failed %v", err)
+			}
+		}
+	}
+	
+	for ruleOld, _ := range rulesOld {
+		if _, ok := rulesNew[ruleOld]; !ok {
+			glog.V(2).Infof("need remove rule %v from %s", ruleOld, vsName)
+			err := c.unbindRule(ctx, drv, vsName, aex.Namespace, ruleOld)
+			if err != nil {
+				glog.Errorf("Unbind rule failed %v", err)
+			}			
+		}
+	}
+}
+
+func (c *AexController)onAexDel(obj interface{}) {
+	glog.V(3).Infof("Del-Aex: %v", obj)
+
+	aex := obj.(*crdv1.AppExternalNat)
+	
+	aexName := utils.GenerateAexName(aex.Namespace, aex.Name)
+	drv, err := c.provider(aex)
+	if err != nil {
+		glog.Errorf("Get driver of %s failed: %v", aexName, err)
+		return
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	defer commit(ctx, drv)
+	if aex.Spec.DefaultResponse != (crdv1.StaticResponse{}) {
+		err = drv.UnsetDefaultResponse(ctx, aexName)
+		if err != nil && !driver.IsNotFound(err) {
+			glog.Errorf("UnsetDefaultResponse failed: %+v\n", err)
+		}
+	}
+	err = retryDevice(func()error{
+		return drv.DeleteVirtualServer(ctx, aexName)
+	})
+	if err != nil && !driver.IsNotFound(err) {
+		glog.Errorf("DeleteVirtualServer failed: %+v\n", err)
+	}
+	err = c.unbindTLS(ctx, drv, aexName, aex.Namespace, aex.Spec.TLS)
+	if err != nil {
+		glog.Errorf("Remove tls certificates failed: %+v\n", err)
+	}	
+}
+
+func (c *AexController)updateError(msg string, aex *crdv1.AppExternalNat) {
+	aex.Status.State = crdv1.AEXSTATUSERROR
+	aex.Status.Message = msg
+	aexclient := crdclient.AexClient(c.crdClient, c.crdScheme, aex.Namespace)
+	_, _ = aexclient.Update(aex, aex.Name)
 }
\ No newline at end of file
@@ -1,217 +1,513 @@
-package controller
-
-import (
-	"time"
-	"os"
-	"reflect"
-	"strconv"
-	
-	"github.com/golang/glog"
-	
-	"k8s.io/client-go/kubernetes"	
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
-	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-	
-	crdclient 	"github.com/sak0/ygw/pkg/client"
-	lbv1 		"github.com/sak0/ygw/pkg/apis/loadbalance/v1"
-	driver 		"github.com/sak0/ygw/pkg/drivers"
-	"github.com/sak0/ygw/pkg/utils"
-)
-
-type CALBController struct {
-	crdClient		*rest.RESTClient
-	crdScheme		*runtime.Scheme
-	client			kubernetes.Interface
-	
-	calbController	cache.Controller
-	driver				driver.LbProvider
-}
-
-func NewCALBController(client kubernetes.Interface, crdClient *rest.RESTClient, 
-					crdScheme *runtime.Scheme)(*CALBController, error) {
-	calbctr := &CALBController{
-		crdClient 	: crdClient,
-		crdScheme 	: crdScheme,
-		client		: client,
-	}
-	driver, _ := driver.NewLBer("citrix")
-	calbctr.driver = driver	
-	
-	calbListWatch := cache.NewListWatchFromClient(calbctr.crdClient, 
-		lbv1.CALBPlural, meta_v1.NamespaceAll, fields.Everything())
-	
-	_, calbController := cache.NewInformer(
-		calbListWatch,
-		&lbv1.CAppLoadBalance{},
-		time.Minute*10,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: calbctr.onCAlbAdd,
-			DeleteFunc: calbctr.onCAlbDel,
-			UpdateFunc: calbctr.onCAlbUpdate,
-		},
-	)
-	calbctr.calbController = calbController
-	
-	return calbctr, nil
-}
-
-func (c *CALBController)Run(ctx <-chan struct{}) {
-	glog.V(2).Infof("CALB Controller starting...")
-	go c.calbController.Run(ctx)
-	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
-		return c.calbController.HasSynced(), nil
-	})
-	if !c.calbController.HasSynced() {
-		glog.Errorf("CALB informer initial sync timeout")
-		os.Exit(1)
-	}
-}
-
-func (c *CALBController)addRuleToCALB(lbName string, rule lbv1.CAppLoadBalanceRule)error{
-	domainName := rule.Host
-	var pathStr string
-	for _, path := range rule.Paths {
-		if path.Path == "/" {
-			pathStr = ""
-		} else {
-			pathStr = path.Path
-		}
-		policyName := utils.GeneratePolicyName(lbName, domainName, pathStr)
-		actionName := policyName
-		poolName := utils.GeneratePoolNameCALBP("default", path.Pool)
-		c.driver.AddRuleToLB(lbName, domainName, pathStr, poolName, actionName, policyName)
-	} 
-	
-	return nil
-}
-
-func (c *CALBController)removeRuleToCALB(lbName string, rule lbv1.CAppLoadBalanceRule)error{
-	domainName := rule.Host
-	var pathStr string
-	for _, path := range rule.Paths {
-		if path.Path == "/" {
-			pathStr = ""
-		} else {
-			pathStr = path.Path
-		}		
-		policyName := utils.GeneratePolicyName(lbName, domainName, pathStr)
-		actionName := policyName
-		poolName := path.Pool
-		c.driver.RemoveRuleToLB(lbName, domainName, pathStr, poolName, actionName, policyName)
-	} 
-	
-	return nil
-}
-
-func (c *CALBController)ensureVip(calb *lbv1.CAppLoadBalance)(string, error){
-	if calb.Status.State == lbv1.CALBSTATUSAVAILABLE {
-		return calb.Spec.IP, nil
-	}
-	
-	var vip string
-	var err error
-	if calb.Spec.IP != "" {
-		vip = calb.Spec.IP
-		err = utils.CreatePortFromIp(calb.Namespace, vip, calb.Spec.Subnet)
-		if err != nil {
-			glog.Errorf("Create port from ip failed: %v", err)
-			return vip, err			
-		}
-	} else {
-		vip, err = utils.AllocIpAddrFromSubnet(calb.Namespace, calb.Spec.Subnet)
-		if err != nil {
-			glog.Errorf("Alloc ip failed: %v", err)
-			return "", err
-		} else {
-			glog.V(2).Infof("CreateCLB with vip: %s", vip)	
-		}
-	}
-	
-	return vip, nil
-}
-
-func (c *CALBController)onCAlbAdd(obj interface{}) {
-	glog.V(3).Infof("Add-CALB: %v", obj)
-	calb := obj.(*lbv1.CAppLoadBalance)
-
-	vip, err := c.ensureVip(calb)
-	if err != nil {
-		c.updateError(err.Error(), calb)
-		return		
-	}
-	calb.Spec.IP = vip	
-	
-	lbName := utils.GenerateCALBName(calb.Name)
-	//TODO: Allocate IP from neutron
-	iPort, _ := strconv.Atoi(calb.Spec.Port)
-	err = c.driver.CreateLB(lbName, calb.Spec.IP, iPort)
-	if err != nil {
-		glog.Errorf("CreateLB Failed: %v", err)
-	}
-	
-	for _, rule := range calb.Spec.Rules {
-		c.addRuleToCALB(lbName, rule)
-	}
-	
-	c.updateAvailable("", calb)
-}
-
-func (c *CALBController)refreshRules(oldCALB *lbv1.CAppLoadBalance, newCALB *lbv1.CAppLoadBalance)error{
-	lbName := utils.GenerateCALBName(newCALB.Name)
-	for _, rule := range oldCALB.Spec.Rules {
-		c.removeRuleToCALB(lbName, rule)
-	}	
-	for _, rule := range newCALB.Spec.Rules {
-		c.addRuleToCALB(lbName, rule)
-	}
-	
-	return nil	
-}
-
-func (c *CALBController)onCAlbUpdate(oldObj, newObj interface{}) {
-	glog.V(3).Infof("Update-CALB: %v -> %v", oldObj, newObj)
-	if !reflect.DeepEqual(oldObj, newObj) {
-		newCAlb := newObj.(*lbv1.CAppLoadBalance)
-		oldCAlb := oldObj.(*lbv1.CAppLoadBalance)
-		
-		pathsNew := utils.GetCALBPathsMap(newCAlb)
-		pathsOld := utils.GetCALBPathsMap(oldCAlb)
-		glog.V(2).Infof("pathsNew: %v", pathsNew)
-		glog.V(2).Infof("pathsOld: %v", pathsOld)
-		if !reflect.DeepEqual(pathsNew, pathsOld) {
-			glog.V(2).Infof("Need update Pool configurations.")
-			//TODO: update rules graceful
-			c.refreshRules(oldCAlb, newCAlb)
-		}					
-	}	
-}
-
-func (c *CALBController)onCAlbDel(obj interface{}) {
-	glog.V(3).Infof("Del-CALB: %v", obj)
-	calb := obj.(*lbv1.CAppLoadBalance)
-	lbName := utils.GenerateCALBName(calb.Name)
-	
-	for _, rule := range calb.Spec.Rules {
-		c.removeRuleToCALB(lbName, rule)
-	}
-	c.driver.DeleteLB(lbName)
-	utils.ReleaseIpAddr(calb.Namespace, calb.Spec.IP)		
-}
-
-func (c *CALBController)updateAvailable(msg string, calb *lbv1.CAppLoadBalance) {
-	calb.Status.State = lbv1.CALBSTATUSAVAILABLE
-	calb.Status.Message = msg
-	calbclient := crdclient.CALBClient(c.crdClient, c.crdScheme, calb.Namespace)
-	_, _ = calbclient.Update(calb, calb.Name)
-}
-
-func (c *CALBController)updateError(msg string, calb *lbv1.CAppLoadBalance) {
-	calb.Status.State = lbv1.CALBSTATUSERROR
-	calb.Status.Message = msg
-	calbclient := crdclient.CALBClient(c.crdClient, c.crdScheme, calb.Namespace)
-	_, _ = calbclient.Update(calb, calb.Name)
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"os"
+	"reflect"
+	
+	"github.com/golang/glog"
+	
+	"k8s.io/client-go/kubernetes"	
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	
+	crdclient 	"github.com/sak0/ygw/pkg/client"
+	lbv1 		"github.com/sak0/ygw/pkg/apis/loadbalance/v1"
+	driver 		"github.com/sak0/ygw/pkg/drivers"
+	"github.com/sak0/ygw/pkg/utils"
+)
+
+// calbPoolNamespace is the namespace of the pools of every CAppLoadBalance.
+const calbPoolNamespace = "default"
+
+type CALBController struct {
+	crdClient		*rest.RESTClient
+	crdScheme		*runtime.Scheme
+	client			kubernetes.Interface
+	
+	calbController	cache.Controller
+	devices			*DeviceController
+}
+
+func NewCALBController(client kubernetes.Interface, crdClient *rest.RESTClient, 
+					crdScheme *runtime.Scheme, devices *DeviceController)(*CALBController, error) {
+	calbctr := &CALBController{
+		crdClient 	: crdClient,
+		crdScheme 	: crdScheme,
+		client		: client,
+		devices		: devices,
+	}
+	
+	calbListWatch := cache.NewListWatchFromClient(calbctr.crdClient, 
+		lbv1.CALBPlural, meta_v1.NamespaceAll, fields.Everything())
+	
+	_, calbController := cache.NewInformer(
+		calbListWatch,
+		&lbv1.CAppLoadBalance{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: calbctr.onCAlbAdd,
+			DeleteFunc: calbctr.onCAlbDel,
+			UpdateFunc: calbctr.onCAlbUpdate,
+		},
+	)
+	calbctr.calbController = calbController
+	
+	return calbctr, nil
+}
+
+func (c *CALBController)Run(ctx <-chan struct{}) {
+	glog.V(2).Infof("CALB Controller starting...")
+	go c.calbController.Run(ctx)
+	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
+		return c.calbController.HasSynced(), nil
+	})
+	if !c.calbController.HasSynced() {
+		glog.Errorf("CALB informer initial sync timeout")
+		os.Exit(1)
+	}
+}
+
+// provider returns the driver for the device and BIG-IP partition of calb,
+// collecting the calls of a sync, see batch.
+func (c *CALBController)provider(calb *lbv1.CAppLoadBalance)(driver.Batch, error){
+	drv, err := c.devices.Provider(lbv1.CALBPlural, calb.Spec.DeviceRef, calb)
+	if err != nil {
+		return nil, err
+	}
+	return batch(drv), nil
+}
+
+// recordPartition saves on calb the BIG-IP partition its objects are created
+// in and returns the saved calb.
+func (c *CALBController)recordPartition(calb *lbv1.CAppLoadBalance)*lbv1.CAppLoadBalance{
+	calb = calb.DeepCopy()
+	if !c.devices.RecordPartition(lbv1.CALBPlural, calb.Spec.DeviceRef, calb) {
+		return calb
+	}
+	calbclient := crdclient.CALBClient(c.crdClient, c.crdScheme, calb.Namespace)
+	saved, err := calbclient.Update(calb, calb.Name)
+	if err != nil {
+		glog.Errorf("Record partition of calb %s failed: %v", calb.Name, err)
+		return calb
+	}
+	return saved
+}
+
+// calbRule returns the rule of the driver for a path of a rule, the policies
+// keep the names of GeneratePolicyName.
+func calbRule(host string, path lbv1.CAppLoadBalancePath)driver.Rule{
+	rule := driver.Rule{
+		Host	: host,
+		Path	: path.Path,
+		Pool	: utils.GeneratePoolNameCALBP(calbPoolNamespace, path.Pool),
+	}
+	if path.Redirect != (lbv1.HTTPRedirect{}) {
+		rule.Redirect = &driver.Redirect{
+			Scheme	: path.Redirect.Scheme,
+			Host	: path.Redirect.Host,
+			Code	: path.Redirect.Code,
+		}
+	} else if path.Rewrite != (lbv1.HTTPRewrite{}) {
+		rule.Rewrite = &driver.Rewrite{
+			Prefix		: path.Rewrite.PathPrefix,
+			Replacement	: path.Rewrite.Replacement,
+		}
+	}
+	return rule
+}
+
+// addRuleToCALB adds the policies of all the paths of rule, it returns the
+// first failure.
+func (c *CALBController)addRuleToCALB(ctx context.Context, drv driver.Provider, lbName string, rule lbv1.CAppLoadBalanceRule)error{
+	var firstErr error
+	for _, path := range rule.Paths {
+		err := drv.AddRule(ctx, lbName, calbRule(rule.Host, path))
+		if err != nil {
+			glog.Errorf("AddRule %s%s to %s failed: %v", rule.Host, path.Path, lbName, err)
+			firstErr = keepFirst(firstErr, err)
+		}
+	} 
+	
+	return firstErr
+}
+
+func (c *CALBController)removeRuleToCALB(ctx context.Context, drv driver.Provider, lbName string, rule lbv1.CAppLoadBalanceRule)error{
+	var firstErr error
+	for _, path := range rule.Paths {
+		err := drv.RemoveRule(ctx, lbName, calbRule(rule.Host, path))
+		if err != nil {
+			glog.Errorf("RemoveRule %s%s from %s failed: %v", rule.Host, path.Path, lbName, err)
+			firstErr = keepFirst(firstErr, err)
+		}
+	} 
+	
+	return firstErr
+}
+
+// keepFirst returns the first of the errors of a loop.
+func keepFirst(first error, err error)error{
+	if first != nil {
+		return first
+	}
+	return err
+}
+
+func (c *CALBController)ensureVip(calb *lbv1.CAppLoadBalance)(string, error){
+	if calb.Status.State == lbv1.CALBSTATUSAVAILABLE {
+		return calb.Spec.IP, nil
+	}
+	
+	var vip string
+	var err error
+	if calb.Spec.IP != "" {
+		vip = calb.Spec.IP
+		err = utils.CreatePortFromIp(calb.Namespace, vip, calb.Spec.Subnet)
+		if err != nil {
+			glog.Errorf("Create port from ip failed: %v", err)
+			return vip, err			
+		}
+	} else {
+		vip, err = utils.AllocIpAddrFromSubnet(calb.Namespace, calb.Spec.Subnet)
+		if err != nil {
+			glog.Errorf("Alloc ip failed: %v", err)
+			return "", err
+		} else {
+			glog.V(2).Infof("CreateCLB with vip: %s", vip)	
+		}
+	}
+	
+	return vip, nil
+}
+
+// checkProtocol rejects the specs the virtual server of their protocol can't
+// serve.
+func checkProtocol(calb *lbv1.CAppLoadBalance)error{
+	protocol := utils.GetCALBProtocol(calb)
+	switch protocol {
+	case lbv1.PROTOCOLHTTP, lbv1.PROTOCOLSSL:
+		return nil
+	case lbv1.PROTOCOLTCP, lbv1.PROTOCOLSSLTCP, lbv1.PROTOCOLSSLBRIDGE, lbv1.PROTOCOLUDP:
+		if len(calb.Spec.Rules) > 0 {
+			return fmt.Errorf("rules need protocol HTTP or SSL, not %s", protocol)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported protocol %s", protocol)
+}
+
+func isTLSProtocol(protocol string)bool{
+	return protocol == lbv1.PROTOCOLSSL || protocol == lbv1.PROTOCOLSSLTCP
+}
+
+// calbVirtualServer returns the virtual server of calb, HTTP and SSL route
+// by the rules and the other protocols forward to the default pool.
+func calbVirtualServer(lbName string, calb *lbv1.CAppLoadBalance)driver.VirtualServer{
+	protocol := utils.GetCALBProtocol(calb)
+	vs := driver.VirtualServer{
+		Name	: lbName,
+		Mode	: driver.MODEL4,
+		IP		: calb.Spec.IP,
+		Port	: calb.Spec.Port,
+		TLS		: isTLSProtocol(protocol),
+	}
+	switch protocol {
+	case lbv1.PROTOCOLHTTP, lbv1.PROTOCOLSSL:
+		vs.Mode = driver.MODEHTTP
+	case lbv1.PROTOCOLUDP:
+		vs.Protocol = "udp"
+	case lbv1.PROTOCOLSSLBRIDGE:
+		vs.Protocol = "tls"
+	default:
+		vs.Protocol = "tcp"
+	}
+	return vs
+}
+
+func (c *CALBController)onCAlbAdd(obj interface{}) {
+	glog.V(3).Infof("Add-CALB: %v", obj)
+	calb := obj.(*lbv1.CAppLoadBalance)
+	calb = c.recordPartition(calb)
+
+	err := checkProtocol(calb)
+	if err != nil {
+		c.updateError(err.Error(), calb)
+		return
+	}
+	protocol := utils.GetCALBProtocol(calb)
+	if isTLSProtocol(protocol) && len(calb.Spec.TLS) == 0 {
+		c.updateError(fmt.Sprintf("protocol %s needs tls", protocol), calb)
+		return
+	}
+
+	vip, err := c.ensureVip(calb)
+	if err != nil {
+		c.updateError(err.Error(), calb)
+		return		
+	}
+	calb.Spec.IP = vip	
+	
+	lbName := utils.GenerateCALBName(calb.Name)
+	drv, err := c.provider(calb)
+	if err != nil {
+		glog.Errorf("Get driver of %s failed: %v", lbName, err)
+		c.updateError(err.Error(), calb)
+		return
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	defer commit(ctx, drv)
+	err = retryDevice(func()error{
+		return drv.CreateVirtualServer(ctx, calbVirtualServer(lbName, calb))
+	})
+	// the virtual server of a previous run is reused.
+	if err != nil && !driver.IsAlreadyExists(err) {
+		glog.Errorf("CreateVirtualServer %s failed: %v", lbName, err)
+		c.updateError(err.Error(), calb)
+		return
+	}
+	
+	for _, rule := range calb.Spec.Rules {
+		err = c.addRuleToCALB(ctx, drv, lbName, rule)
+		if err != nil {
+			c.updateError(err.Error(), calb)
+			return
+		}
+	}
+	
+	err = c.addCerts(ctx, drv, lbName, calb.Namespace, calb.Spec.TLS)
+	if err != nil {
+		glog.Errorf("Add certificates to %s failed: %v", lbName, err)
+		c.updateError(err.Error(), calb)
+		return
+	}
+	
+	err = c.setDefault(ctx, drv, lbName, calb.Spec)
+	if err != nil {
+		glog.Errorf("Set default backend of %s failed: %v", lbName, err)
+		c.updateError(err.Error(), calb)
+		return
+	}
+	err = drv.Commit(ctx)
+	if err != nil {
+		glog.Errorf("Commit %s failed: %v", lbName, err)
+		c.updateError(err.Error(), calb)
+		return
+	}
+	
+	c.updateAvailable("", calb)
+}
+
+// addCerts binds the certificate of every tls entry to the virtual server,
+// the first one is served to clients without a matching SNI name.
+func (c *CALBController)addCerts(ctx context.Context, drv driver.Provider, lbName string, namespace string, tlsList []lbv1.CAppLoadBalanceTLS)error{
+	for i, tls := range tlsList {
+		cert, key, err := utils.GetTLSSecret(c.client, namespace, tls.SecretName)
+		if err != nil {
+			return err
+		}
+		var serverName string
+		if len(tls.Hosts) > 0 {
+			serverName = tls.Hosts[0]
+		}
+		err = drv.AddCert(ctx, lbName, driver.Cert{
+			Name		: utils.GenerateCertName(lbName, tls.SecretName),
+			ServerName	: serverName,
+			Default		: i == 0,
+			Cert		: cert,
+			Key			: key,
+			Namespace	: namespace,
+			Secret		: tls.SecretName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CALBController)removeCerts(ctx context.Context, drv driver.Provider, lbName string, tlsList []lbv1.CAppLoadBalanceTLS)error{
+	for _, tls := range tlsList {
+		cert := driver.Cert{Name : utils.GenerateCertName(lbName, tls.SecretName)}
+		err := drv.RemoveCert(ctx, lbName, cert)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDefault sets up the fallback for requests no rule matches: the default
+// pool of the virtual server or, without one, the static response.
+func (c *CALBController)setDefault(ctx context.Context, drv driver.Provider, lbName string, spec lbv1.CAppLoadBalanceSpec)error{
+	if spec.DefaultPool != "" {
+		poolName := utils.GeneratePoolNameCALBP(calbPoolNamespace, spec.DefaultPool)
+		return drv.SetDefaultPool(ctx, lbName, poolName)
+	}
+	if spec.DefaultResponse != (lbv1.StaticResponse{}) {
+		resp := spec.DefaultResponse
+		return drv.SetDefaultResponse(ctx, lbName, driver.Response{
+			Code		: resp.Code,
+			ContentType	: resp.ContentType,
+			Body		: resp.Body,
+		})
+	}
+	return nil
+}
+
+func (c *CALBController)unsetDefault(ctx context.Context, drv driver.Provider, lbName string, spec lbv1.CAppLoadBalanceSpec)error{
+	if spec.DefaultPool != "" {
+		poolName := utils.GeneratePoolNameCALBP(calbPoolNamespace, spec.DefaultPool)
+		return drv.UnsetDefaultPool(ctx, lbName, poolName)
+	}
+	if spec.DefaultResponse != (lbv1.StaticResponse{}) {
+		return drv.UnsetDefaultResponse(ctx, lbName)
+	}
+	return nil
+}
+
+func (c *CALBController)refreshRules(ctx context.Context, drv driver.Provider, oldCALB *lbv1.CAppLoadBalance, newCALB *lbv1.CAppLoadBalance)error{
+	lbName := utils.GenerateCALBName(newCALB.Name)
+	for _, rule := range oldCALB.Spec.Rules {
+		err := c.removeRuleToCALB(ctx, drv, lbName, rule)
+		if err != nil {
+			return err
+		}
+	}	
+	for _, rule := range newCALB.Spec.Rules {
+		err := c.addRuleToCALB(ctx, drv, lbName, rule)
+		if err != nil {
+			return err
+		}
+	}
+	
+	return nil	
+}
+
+func (c *CALBController)onCAlbUpdate(oldObj, newObj interface{}) {
+	glog.V(3).Infof("Update-CALB: %v -> %v", oldObj, newObj)
+	if !reflect.DeepEqual(oldObj, newObj) {
+		newCAlb := newObj.(*lbv1.CAppLoadBalance)
+		oldCAlb := oldObj.(*lbv1.CAppLoadBalance)
+		
+		if utils.GetCALBProtocol(oldCAlb) != utils.GetCALBProtocol(newCAlb) {
+			glog.Errorf("Protocol of %s/%s can't be changed.", newCAlb.Namespace, newCAlb.Name)
+			c.updateError("protocol can't be changed, recreate the CAppLoadBalance", newCAlb)
+			return
+		}
+		if oldCAlb.Spec.DeviceRef != newCAlb.Spec.DeviceRef {
+			glog.Errorf("Device of %s/%s can't be changed.", newCAlb.Namespace, newCAlb.Name)
+			c.updateError("deviceRef can't be changed, recreate the CAppLoadBalance", newCAlb)
+			return
+		}
+		drv, err := c.provider(newCAlb)
+		if err != nil {
+			glog.Errorf("Get driver of %s/%s failed: %v", newCAlb.Namespace, newCAlb.Name, err)
+			c.updateError(err.Error(), newCAlb)
+			return
+		}
+		ctx, cancel := deviceContext()
+		defer cancel()
+		defer commit(ctx, drv)
+		err = checkProtocol(newCAlb)
+		if err != nil {
+			c.updateError(err.Error(), newCAlb)
+			return
+		}
+		
+		pathsNew := utils.GetCALBPathsMap(newCAlb)
+		pathsOld := utils.GetCALBPathsMap(oldCAlb)
+		glog.V(2).Infof("pathsNew: %v", pathsNew)
+		glog.V(2).Infof("pathsOld: %v", pathsOld)
+		if !reflect.DeepEqual(pathsNew, pathsOld) {
+			glog.V(2).Infof("Need update Pool configurations.")
+			//TODO: update rules graceful
+			err := c.refreshRules(ctx, drv, oldCAlb, newCAlb)
+			if err != nil {
+				glog.Errorf("Refresh rules of %s/%s failed: %v", newCAlb.Namespace, newCAlb.Name, err)
+				c.updateError(err.Error(), newCAlb)
+			}
+		}
+		
+		if oldCAlb.Spec.DefaultPool != newCAlb.Spec.DefaultPool || 
+			oldCAlb.Spec.DefaultResponse != newCAlb.Spec.DefaultResponse {
+			glog.V(2).Infof("Need update default backend.")
+			lbName := utils.GenerateCALBName(newCAlb.Name)
+			err := c.unsetDefault(ctx, drv, lbName, oldCAlb.Spec)
+			if err != nil {
+				glog.Errorf("Unset default backend failed: %v", err)
+			}
+			err = c.setDefault(ctx, drv, lbName, newCAlb.Spec)
+			if err != nil {
+				glog.Errorf("Set default backend failed: %v", err)
+				c.updateError(err.Error(), newCAlb)
+			}
+		}
+		
+		if !reflect.DeepEqual(oldCAlb.Spec.TLS, newCAlb.Spec.TLS) {
+			glog.V(2).Infof("Need update tls certificates.")
+			lbName := utils.GenerateCALBName(newCAlb.Name)
+			err := c.removeCerts(ctx, drv, lbName, oldCAlb.Spec.TLS)
+			if err != nil {
+				glog.Errorf("Remove certificates failed: %v", err)
+			}
+			err = c.addCerts(ctx, drv, lbName, newCAlb.Namespace, newCAlb.Spec.TLS)
+			if err != nil {
+				glog.Errorf("Add certificates failed: %v", err)
+				c.updateError(err.Error(), newCAlb)
+			}
+		}
+		err = drv.Commit(ctx)
+		if err != nil {
+			glog.Errorf("Commit %s/%s failed: %v", newCAlb.Namespace, newCAlb.Name, err)
+			c.updateError(err.Error(), newCAlb)
+		}
+	}	
+}
+
+func (c *CALBController)onCAlbDel(obj interface{}) {
+	glog.V(3).Infof("Del-CALB: %v", obj)
+	calb := obj.(*lbv1.CAppLoadBalance)
+	lbName := utils.GenerateCALBName(calb.Name)
+	drv, err := c.provider(calb)
+	if err != nil {
+		glog.Errorf("Get driver of %s failed: %v", lbName, err)
+		return
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	
+	for _, rule := range calb.Spec.Rules {
+		c.removeRuleToCALB(ctx, drv, lbName, rule)
+	}
+	c.unsetDefault(ctx, drv, lbName, calb.Spec)
+	c.removeCerts(ctx, drv, lbName, calb.Spec.TLS)
+	err = retryDevice(func()error{
+		return drv.DeleteVirtualServer(ctx, lbName)
+	})
+	if err != nil && !driver.IsNotFound(err) {
+		glog.Errorf("DeleteVirtualServer %s failed: %v", lbName, err)
+	}
+	commit(ctx, drv)
+	utils.ReleaseIpAddr(calb.Namespace, calb.Spec.IP)		
+}
+
+func (c *CALBController)updateAvailable(msg string, calb *lbv1.CAppLoadBalance) {
+	calb.Status.State = lbv1.CALBSTATUSAVAILABLE
+	calb.Status.Message = msg
+	calbclient := crdclient.CALBClient(c.crdClient, c.crdScheme, calb.Namespace)
+	_, _ = calbclient.Update(calb, calb.Name)
+}
+
+func (c *CALBController)updateError(msg string, calb *lbv1.CAppLoadBalance) {
+	calb.Status.State = lbv1.CALBSTATUSERROR
+	calb.Status.Message = msg
+	calbclient := crdclient.CALBClient(c.crdClient, c.crdScheme, calb.Namespace)
+	_, _ = calbclient.Update(calb, calb.Name)
 }
\ No newline at end of file
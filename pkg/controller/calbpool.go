@@ -1,157 +1,778 @@
-package controller
-
-import (
-	"time"
-	"os"
-	"reflect"
-	"strconv"
-	"strings"
-	
-	"github.com/golang/glog"
-	
-	"k8s.io/client-go/kubernetes"	
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
-	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-	
-	crdclient 	"github.com/sak0/ygw/pkg/client"
-	lbv1 		"github.com/sak0/ygw/pkg/apis/loadbalance/v1"
-	driver 		"github.com/sak0/ygw/pkg/drivers"
-	"github.com/sak0/ygw/pkg/utils"
-)
-
-type CALBPoolController struct {
-	crdClient		*rest.RESTClient
-	crdScheme		*runtime.Scheme
-	client			kubernetes.Interface
-	
-	calbPoolController	cache.Controller
-	driver				driver.LbProvider
-}
-
-func NewCALBPoolController(client kubernetes.Interface, crdClient *rest.RESTClient, 
-					crdScheme *runtime.Scheme)(*CALBPoolController, error) {
-	calbpctr := &CALBPoolController{
-		crdClient 	: crdClient,
-		crdScheme 	: crdScheme,
-		client		: client,
-	}
-	driver, _ := driver.NewLBer("citrix")
-	calbpctr.driver = driver	
-	
-	poolListWatch := cache.NewListWatchFromClient(calbpctr.crdClient, 
-		lbv1.CALBPPlural, meta_v1.NamespaceAll, fields.Everything())
-	
-	_, calbpoolcontroller := cache.NewInformer(
-		poolListWatch,
-		&lbv1.CAppLoadBalancePool{},
-		time.Minute*10,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: calbpctr.onPoolAdd,
-			DeleteFunc: calbpctr.onPoolDel,
-			UpdateFunc: calbpctr.onPoolUpdate,
-		},
-	)
-	calbpctr.calbPoolController = calbpoolcontroller
-	
-	return calbpctr, nil
-}
-
-func (c *CALBPoolController)Run(ctx <-chan struct{}) {
-	glog.V(2).Infof("CALB Pool Controller starting...")
-	go c.calbPoolController.Run(ctx)
-	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
-		return c.calbPoolController.HasSynced(), nil
-	})
-	if !c.calbPoolController.HasSynced() {
-		glog.Errorf("CALB pool informer initial sync timeout")
-		os.Exit(1)
-	}
-}
-
-func (c *CALBPoolController)onPoolAdd(obj interface{}) {
-	glog.V(3).Infof("Add-Pool: %v", obj)
-	pool := obj.(*lbv1.CAppLoadBalancePool)
-	poolName := utils.GeneratePoolNameCALBP(pool.Namespace, pool.Name)
-	
-	c.driver.CreatePool(poolName, pool.Spec.Method)
-	var iWeight int
-	for _, member := range pool.Spec.Members {
-		iWeight = 1
-		iPort, _ := strconv.Atoi(member.Port)
-		if member.Weight != "" {
-			iWeight, _ = strconv.Atoi(member.Weight)
-		}
-		
-		c.driver.AddMemberToPool(poolName, member.IP, iPort, iWeight)
-	}
-}
-
-func (c *CALBPoolController)updatePool(namespace string, poolName string, 
-	membersNew map[string]int, membersOld map[string]int)error{
-	for memberNew, _ := range membersNew {
-		if _, ok := membersOld[memberNew]; !ok {
-			glog.V(2).Infof("Pool Update: need add member %v to %s", memberNew, poolName)
-			ip := strings.Split(memberNew, ":")[0]
-			port := strings.Split(memberNew, ":")[1]
-			iPort, _ := strconv.Atoi(port)
-			weight := strings.Split(memberNew, ":")[2]
-			iWeight, _ := strconv.Atoi(weight)
-			err := c.driver.AddMemberToPool(poolName, ip, iPort, iWeight)
-			if err != nil {
-				glog.Errorf("Pool Update: add pool member failed.\n", err)
-			}
-		}
-	}
-	
-	for memberOld, _ := range membersOld {
-		if _, ok := membersNew[memberOld]; !ok {
-			glog.V(2).Infof("Pool Update: need remove member %v from %s", memberOld, poolName)
-			ip := strings.Split(memberOld, ":")[0]
-			port := strings.Split(memberOld, ":")[1]
-			iPort, _ := strconv.Atoi(port)
-			err := c.driver.RemoveMemberFromPool(poolName, ip, iPort)
-			if err != nil {
-				glog.Errorf("Pool Update: remove pool member failed.\n", err)
-			}			
-		}
-	}
-	
-	return nil
-}
-
-func (c *CALBPoolController)onPoolUpdate(oldObj, newObj interface{}) {
-	glog.V(3).Infof("Update-Pool: %v -> %v", oldObj, newObj)
-	if !reflect.DeepEqual(oldObj, newObj) {
-		newPool := newObj.(*lbv1.CAppLoadBalancePool)
-		oldPool := oldObj.(*lbv1.CAppLoadBalancePool)
-		
-		membersNew := utils.GetCALBMembersMap(newPool)
-		membersOld := utils.GetCALBMembersMap(oldPool)
-		glog.V(2).Infof("membersNew: %v", membersNew)
-		glog.V(2).Infof("membersOld: %v", membersOld)
-		if !reflect.DeepEqual(membersNew, membersOld) {
-			glog.V(2).Infof("Need update Pool configurations.")
-			poolName := utils.GeneratePoolNameCALBP(oldPool.Namespace, oldPool.Name)
-			c.updatePool(newPool.Namespace, poolName, membersNew, membersOld)
-		}					
-	}	
-}
-
-func (c *CALBPoolController)onPoolDel(obj interface{}) {
-	glog.V(3).Infof("Del-Pool: %v", obj)
-	pool := obj.(*lbv1.CAppLoadBalancePool)
-	poolName := utils.GeneratePoolNameCALBP(pool.Namespace, pool.Name)
-	
-	c.driver.DeletePool(poolName)	
-}
-
-func (c *CALBPoolController)updateError(msg string, pool *lbv1.CAppLoadBalancePool) {
-	pool.Status.State = lbv1.CALBPOOLSTATUSERROR
-	pool.Status.Message = msg
-	poolclient := crdclient.CALBPoolClient(c.crdClient, c.crdScheme, pool.Namespace)
-	_, _ = poolclient.Update(pool, pool.Name)
+package controller
+
+import (
+	"context"
+	"time"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	
+	"github.com/golang/glog"
+	
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"	
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	
+	crdclient 	"github.com/sak0/ygw/pkg/client"
+	lbv1 		"github.com/sak0/ygw/pkg/apis/loadbalance/v1"
+	driver 		"github.com/sak0/ygw/pkg/drivers"
+	"github.com/sak0/ygw/pkg/utils"
+)
+
+type CALBPoolController struct {
+	crdClient		*rest.RESTClient
+	crdScheme		*runtime.Scheme
+	client			kubernetes.Interface
+	
+	calbPoolController	cache.Controller
+	calbPoolStore		cache.Store
+	epController		cache.Controller
+	epStore				cache.Store
+	svcController		cache.Controller
+	svcStore			cache.Store
+	nodeController		cache.Controller
+	nodeStore			cache.Store
+	devices				*DeviceController
+	
+	*memberSync
+}
+
+func NewCALBPoolController(client kubernetes.Interface, crdClient *rest.RESTClient, 
+					crdScheme *runtime.Scheme, devices *DeviceController)(*CALBPoolController, error) {
+	calbpctr := &CALBPoolController{
+		crdClient 	: crdClient,
+		crdScheme 	: crdScheme,
+		client		: client,
+		devices		: devices,
+		memberSync	: newMemberSync(),
+	}
+	
+	poolListWatch := cache.NewListWatchFromClient(calbpctr.crdClient, 
+		lbv1.CALBPPlural, meta_v1.NamespaceAll, fields.Everything())
+	
+	calbpoolstore, calbpoolcontroller := cache.NewInformer(
+		poolListWatch,
+		&lbv1.CAppLoadBalancePool{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: calbpctr.onPoolAdd,
+			DeleteFunc: calbpctr.onPoolDel,
+			UpdateFunc: calbpctr.onPoolUpdate,
+		},
+	)
+	calbpctr.calbPoolController = calbpoolcontroller
+	calbpctr.calbPoolStore = calbpoolstore
+	
+	epListWatch := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), 
+		"endpoints", meta_v1.NamespaceAll, fields.Everything())
+	
+	epstore, epcontroller := cache.NewInformer(
+		epListWatch,
+		&v1.Endpoints{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: calbpctr.onEndpointsAdd,
+			DeleteFunc: calbpctr.onEndpointsDel,
+			UpdateFunc: calbpctr.onEndpointsUpdate,
+		},
+	)
+	calbpctr.epController = epcontroller
+	calbpctr.epStore = epstore
+	
+	svcListWatch := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), 
+		"services", meta_v1.NamespaceAll, fields.Everything())
+	
+	svcstore, svccontroller := cache.NewInformer(
+		svcListWatch,
+		&v1.Service{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: calbpctr.onServiceAdd,
+			DeleteFunc: calbpctr.onServiceDel,
+			UpdateFunc: calbpctr.onServiceUpdate,
+		},
+	)
+	calbpctr.svcController = svccontroller
+	calbpctr.svcStore = svcstore
+	
+	nodeListWatch := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), 
+		"nodes", meta_v1.NamespaceAll, fields.Everything())
+	
+	nodestore, nodecontroller := cache.NewInformer(
+		nodeListWatch,
+		&v1.Node{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: calbpctr.onNodeAdd,
+			DeleteFunc: calbpctr.onNodeDel,
+			UpdateFunc: calbpctr.onNodeUpdate,
+		},
+	)
+	calbpctr.nodeController = nodecontroller
+	calbpctr.nodeStore = nodestore
+	
+	return calbpctr, nil
+}
+
+func (c *CALBPoolController)Run(ctx <-chan struct{}) {
+	glog.V(2).Infof("CALB Pool Controller starting...")
+	go c.epController.Run(ctx)
+	go c.svcController.Run(ctx)
+	go c.nodeController.Run(ctx)
+	// serviceRef pools need the services, endpoints and nodes on their first sync.
+	cache.WaitForCacheSync(ctx, c.epController.HasSynced, c.svcController.HasSynced, c.nodeController.HasSynced)
+	go c.calbPoolController.Run(ctx)
+	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
+		return c.hasSynced(), nil
+	})
+	if !c.hasSynced() {
+		glog.Errorf("CALB pool informer initial sync timeout")
+		os.Exit(1)
+	}
+	for _, obj := range c.calbPoolStore.List() {
+		pool := obj.(*lbv1.CAppLoadBalancePool)
+		for _, member := range pool.Status.Draining {
+			poolName := member.Pool
+			if poolName == "" {
+				poolName = utils.GeneratePoolNameCALBP(pool.Namespace, pool.Name)
+			}
+			c.restoreDraining(pool.Namespace + "/" + pool.Name, poolName, member.Member, member.Deadline.Time)
+		}
+	}
+	go wait.Until(c.processDraining, 5*time.Second, ctx)
+}
+
+func (c *CALBPoolController)hasSynced()bool{
+	return c.calbPoolController.HasSynced() && c.epController.HasSynced() && 
+		c.svcController.HasSynced() && c.nodeController.HasSynced()
+}
+
+// provider returns the driver for the device and BIG-IP partition of pool,
+// collecting the calls of a sync, see batch.
+func (c *CALBPoolController)provider(pool *lbv1.CAppLoadBalancePool)(driver.Batch, error){
+	drv, err := c.devices.Provider(lbv1.CALBPPlural, pool.Spec.DeviceRef, pool)
+	if err != nil {
+		return nil, err
+	}
+	return batch(drv), nil
+}
+
+// recordPartition saves on pool the BIG-IP partition its objects are created
+// in and returns the saved pool.
+func (c *CALBPoolController)recordPartition(pool *lbv1.CAppLoadBalancePool)*lbv1.CAppLoadBalancePool{
+	pool = pool.DeepCopy()
+	if !c.devices.RecordPartition(lbv1.CALBPPlural, pool.Spec.DeviceRef, pool) {
+		return pool
+	}
+	poolclient := crdclient.CALBPoolClient(c.crdClient, c.crdScheme, pool.Namespace)
+	saved, err := poolclient.Update(pool, pool.Name)
+	if err != nil {
+		glog.Errorf("Record partition of calb pool %s failed: %v", pool.Name, err)
+		return pool
+	}
+	return saved
+}
+
+// priorityMembers splits the static members of pool like
+// GetCALBPriorityMembersMap, the devices without backup pools keep the
+// standby members in the pool and fail over by their priority.
+func priorityMembers(drv driver.Provider, pool *lbv1.CAppLoadBalancePool)(map[string]int, map[string]int){
+	primary, backup := utils.GetCALBPriorityMembersMap(pool)
+	if drv.Capabilities().BackupPool {
+		return primary, backup
+	}
+	for member, _ := range backup {
+		primary[member] = 1
+	}
+	return primary, make(map[string]int)
+}
+
+// calbMember returns the member of the driver for a key of
+// GetCALBPriorityMembersMap or "ip:port" with the settings of pool, the
+// connection limit is the one of the member on the devices without pool
+// limits.
+func calbMember(drv driver.Provider, pool *lbv1.CAppLoadBalancePool, member string)driver.Member{
+	ip, port, weight := utils.SplitMemberWeight(member)
+	m := poolMember(net.JoinHostPort(ip, port))
+	m.Weight, _ = strconv.Atoi(weight)
+	caps := drv.Capabilities()
+	if !caps.PoolConnectionLimit {
+		m.ConnectionLimit = pool.Spec.ConnectionLimit
+	}
+	if caps.BackupPool || pool.Spec.ServiceRef != nil {
+		return m
+	}
+	for _, spec := range pool.Spec.Members {
+		if spec.IP == ip && spec.Port == port {
+			m.Priority, _ = strconv.Atoi(spec.Priority)
+		}
+	}
+	return m
+}
+
+func (c *CALBPoolController)onPoolAdd(obj interface{}) {
+	glog.V(3).Infof("Add-Pool: %v", obj)
+	pool := obj.(*lbv1.CAppLoadBalancePool)
+	pool = c.recordPartition(pool)
+	poolName := utils.GeneratePoolNameCALBP(pool.Namespace, pool.Name)
+	drv, err := c.provider(pool)
+	if err != nil {
+		glog.Errorf("Get driver of %s failed: %v", poolName, err)
+		c.updateError(err.Error(), pool)
+		return
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	defer commit(ctx, drv)
+	
+	err = retryDevice(func()error{
+		return drv.CreatePool(ctx, driver.Pool{
+			Name		: poolName,
+			Method		: pool.Spec.Method,
+			Protocol	: utils.GetCALBPoolProtocol(pool),
+		})
+	})
+	if err != nil {
+		glog.Errorf("CreatePool %s failed: %v", poolName, err)
+		c.updateError(err.Error(), pool)
+		return
+	}
+	if pool.Spec.ConnectionLimit > 0 || pool.Spec.SlowStart != "" || pool.Spec.MinActiveMembers > 0 {
+		err := c.setPoolLimits(ctx, drv, poolName, pool)
+		if err != nil {
+			glog.Errorf("Set limits of %s failed: %v", poolName, err)
+			c.updateError(err.Error(), pool)
+		}
+	}
+	if pool.Spec.ServiceRef != nil {
+		err := c.syncServiceMembers(ctx, drv, pool)
+		if err != nil {
+			glog.Errorf("Sync members of %s from service failed: %v", poolName, err)
+			c.updateError(err.Error(), pool)
+		}
+		return
+	}
+	primary, _ := priorityMembers(drv, pool)
+	c.updatePool(ctx, drv, pool, poolName, primary, nil)
+	c.syncBackupPool(ctx, drv, nil, pool)
+	c.commitPool(ctx, drv, pool)
+}
+
+// commitPool applies the calls of a sync of pool, see batch.
+func (c *CALBPoolController)commitPool(ctx context.Context, drv driver.Batch, pool *lbv1.CAppLoadBalancePool) {
+	err := drv.Commit(ctx)
+	if err != nil {
+		glog.Errorf("Commit pool %s/%s failed: %v", pool.Namespace, pool.Name, err)
+		c.updateError(err.Error(), pool.DeepCopy())
+	}
+}
+
+func (c *CALBPoolController)updatePool(ctx context.Context, drv driver.Provider, pool *lbv1.CAppLoadBalancePool, poolName string, 
+	membersNew map[string]int, membersOld map[string]int)error{
+	key := pool.Namespace + "/" + pool.Name
+	timeout := utils.GetDuration(pool.Spec.DrainTimeout, lbv1.DEFAULTDRAINTIMEOUT)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	bound := make(map[string]bool)
+	for memberOld, _ := range membersOld {
+		ip, port, _ := utils.SplitMemberWeight(memberOld)
+		bound[net.JoinHostPort(ip, port)] = true
+	}
+	for memberNew, _ := range membersNew {
+		if _, ok := membersOld[memberNew]; !ok {
+			ip, port, _ := utils.SplitMemberWeight(memberNew)
+			member := calbMember(drv, pool, memberNew)
+			if bound[net.JoinHostPort(ip, port)] {
+				glog.V(2).Infof("Pool Update: need set weight of member %v in %s", memberNew, poolName)
+				err := drv.UpdateMember(ctx, poolName, member)
+				if err != nil {
+					glog.Errorf("Pool Update: set weight of pool member failed: %v", err)
+				}
+				continue
+			}
+			glog.V(2).Infof("Pool Update: need add member %v to %s", memberNew, poolName)
+			var err error
+			if c.undrainMember(key, poolName, net.JoinHostPort(ip, port)) {
+				err = drv.EnableMember(ctx, poolName, member)
+			} else {
+				err = drv.AddMember(ctx, poolName, member)
+			}
+			if err != nil && !driver.IsAlreadyExists(err) {
+				glog.Errorf("Pool Update: add pool member failed: %v", err)
+			}
+		}
+	}
+	
+	// a member whose weight changed stays in the pool.
+	kept := make(map[string]bool)
+	for memberNew, _ := range membersNew {
+		ip, port, _ := utils.SplitMemberWeight(memberNew)
+		kept[net.JoinHostPort(ip, port)] = true
+	}
+	for memberOld, _ := range membersOld {
+		ip, port, _ := utils.SplitMemberWeight(memberOld)
+		if !kept[net.JoinHostPort(ip, port)] {
+			glog.V(2).Infof("Pool Update: need remove member %v from %s", memberOld, poolName)
+			err := c.removeMember(ctx, drv, key, poolName, net.JoinHostPort(ip, port), timeout)
+			if err != nil {
+				glog.Errorf("Pool Update: remove pool member failed.\n", err)
+			}			
+		}
+	}
+	
+	return nil
+}
+
+// syncBackupPool moves the standby members of the pool to its backup pool,
+// which takes over when less than minActiveMembers primary members are up.
+// old is nil for a new pool. The devices without backup pools have none.
+func (c *CALBPoolController)syncBackupPool(ctx context.Context, drv driver.Provider, old, pool *lbv1.CAppLoadBalancePool) {
+	poolName := utils.GeneratePoolNameCALBP(pool.Namespace, pool.Name)
+	backupName := utils.GenerateBackupPoolNameCALBP(pool.Namespace, pool.Name)
+	backupOld := make(map[string]int)
+	if old != nil && old.Spec.ServiceRef == nil {
+		_, backupOld = priorityMembers(drv, old)
+	}
+	primary, backup := priorityMembers(drv, pool)
+	if pool.Spec.ServiceRef != nil {
+		backup = make(map[string]int)
+	}
+	
+	if len(backup) == 0 {
+		if len(backupOld) > 0 {
+			glog.V(2).Infof("Pool %s: no standby members, remove backup %s.", poolName, backupName)
+			err := drv.UnsetBackupPool(ctx, poolName)
+			if err != nil {
+				glog.Errorf("UnsetBackupPool %s failed: %v", poolName, err)
+				c.updateError(err.Error(), pool.DeepCopy())
+				return
+			}
+			err = retryDevice(func()error{
+				return drv.DeletePool(ctx, backupName)
+			})
+			if err != nil && !driver.IsNotFound(err) {
+				glog.Errorf("DeletePool %s failed: %v", backupName, err)
+				c.updateError(err.Error(), pool.DeepCopy())
+			}
+		}
+		return
+	}
+	
+	if len(backupOld) == 0 {
+		err := retryDevice(func()error{
+			return drv.CreatePool(ctx, driver.Pool{
+				Name		: backupName,
+				Method		: pool.Spec.Method,
+				Protocol	: utils.GetCALBPoolProtocol(pool),
+			})
+		})
+		if err != nil && !driver.IsAlreadyExists(err) {
+			glog.Errorf("CreatePool %s failed: %v", backupName, err)
+			c.updateError(err.Error(), pool.DeepCopy())
+			return
+		}
+		if pool.Spec.ConnectionLimit > 0 || pool.Spec.SlowStart != "" {
+			err := c.setPoolLimits(ctx, drv, backupName, pool)
+			if err != nil {
+				glog.Errorf("Set limits of %s failed: %v", backupName, err)
+				c.updateError(err.Error(), pool.DeepCopy())
+			}
+		}
+	}
+	c.updatePool(ctx, drv, pool, backupName, backup, backupOld)
+	
+	threshold := 100
+	if len(primary) > 0 {
+		threshold = (pool.Spec.MinActiveMembers * 100 + len(primary) - 1) / len(primary)
+		if threshold > 100 {
+			threshold = 100
+		}
+	}
+	err := drv.SetBackupPool(ctx, poolName, backupName, threshold)
+	if err != nil {
+		glog.Errorf("SetBackupPool %s failed: %v", poolName, err)
+		c.updateError(err.Error(), pool.DeepCopy())
+	}
+}
+
+func (c *CALBPoolController)onPoolUpdate(oldObj, newObj interface{}) {
+	glog.V(3).Infof("Update-Pool: %v -> %v", oldObj, newObj)
+	newPool := newObj.(*lbv1.CAppLoadBalancePool)
+	oldPool := oldObj.(*lbv1.CAppLoadBalancePool)
+	if utils.GetCALBPoolProtocol(oldPool) != utils.GetCALBPoolProtocol(newPool) {
+		glog.Errorf("Protocol of pool %s/%s can't be changed.", newPool.Namespace, newPool.Name)
+		c.updateError("protocol can't be changed, recreate the pool", newPool.DeepCopy())
+		return
+	}
+	if oldPool.Spec.DeviceRef != newPool.Spec.DeviceRef {
+		glog.V(2).Infof("Need move pool %s/%s to another device.", newPool.Namespace, newPool.Name)
+		c.onPoolDel(oldPool)
+		c.onPoolAdd(newPool)
+		return
+	}
+	drv, err := c.provider(newPool)
+	if err != nil {
+		glog.Errorf("Get driver of %s/%s failed: %v", newPool.Namespace, newPool.Name, err)
+		c.updateError(err.Error(), newPool.DeepCopy())
+		return
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	if newPool.Spec.ServiceRef != nil || oldPool.Spec.ServiceRef != nil {
+		c.updateServiceRef(ctx, drv, oldPool, newPool)
+		c.syncBackupPool(ctx, drv, oldPool, newPool)
+		c.updatePoolLimits(ctx, drv, oldPool, newPool)
+		c.commitPool(ctx, drv, newPool)
+		return
+	}
+	
+	if !reflect.DeepEqual(oldObj, newObj) {
+		membersNew, _ := priorityMembers(drv, newPool)
+		membersOld, _ := priorityMembers(drv, oldPool)
+		glog.V(2).Infof("membersNew: %v", membersNew)
+		glog.V(2).Infof("membersOld: %v", membersOld)
+		if !reflect.DeepEqual(membersNew, membersOld) {
+			glog.V(2).Infof("Need update Pool configurations.")
+			poolName := utils.GeneratePoolNameCALBP(newPool.Namespace, newPool.Name)
+			c.updatePool(ctx, drv, newPool, poolName, membersNew, membersOld)
+		}					
+	}	
+	if !reflect.DeepEqual(oldPool.Spec, newPool.Spec) {
+		c.syncBackupPool(ctx, drv, oldPool, newPool)
+	}
+	c.updatePoolLimits(ctx, drv, oldPool, newPool)
+	c.commitPool(ctx, drv, newPool)
+}
+
+// setPoolLimits applies the slow start of pool to the pool poolName, the
+// pool or its backup, along with its connection limit on the devices with
+// pool limits and its minActiveMembers on the ones without backup pools.
+func (c *CALBPoolController)setPoolLimits(ctx context.Context, drv driver.Provider, poolName string, pool *lbv1.CAppLoadBalancePool)error{
+	caps := drv.Capabilities()
+	settings := driver.Pool{
+		Name		: poolName,
+		SlowStart	: int(utils.GetDuration(pool.Spec.SlowStart, "0s").Seconds()),
+	}
+	if caps.PoolConnectionLimit {
+		settings.ConnectionLimit = pool.Spec.ConnectionLimit
+	}
+	if !caps.BackupPool {
+		settings.MinActiveMembers = pool.Spec.MinActiveMembers
+	}
+	return drv.UpdatePool(ctx, settings)
+}
+
+func (c *CALBPoolController)updatePoolLimits(ctx context.Context, drv driver.Provider, oldPool, newPool *lbv1.CAppLoadBalancePool) {
+	err := c.updateMemberSettings(ctx, drv, oldPool, newPool)
+	if err != nil {
+		glog.Errorf("Set members of %s/%s failed: %v", newPool.Namespace, newPool.Name, err)
+		c.updateError(err.Error(), newPool.DeepCopy())
+	}
+	if oldPool.Spec.ConnectionLimit == newPool.Spec.ConnectionLimit && 
+		oldPool.Spec.SlowStart == newPool.Spec.SlowStart &&
+		oldPool.Spec.MinActiveMembers == newPool.Spec.MinActiveMembers {
+		return
+	}
+	poolNames := []string{utils.GeneratePoolNameCALBP(newPool.Namespace, newPool.Name)}
+	if _, backup := priorityMembers(drv, newPool); len(backup) > 0 && newPool.Spec.ServiceRef == nil {
+		poolNames = append(poolNames, utils.GenerateBackupPoolNameCALBP(newPool.Namespace, newPool.Name))
+	}
+	for _, poolName := range poolNames {
+		err := c.setPoolLimits(ctx, drv, poolName, newPool)
+		if err != nil {
+			glog.Errorf("Set limits of %s failed: %v", poolName, err)
+			c.updateError(err.Error(), newPool.DeepCopy())
+		}
+	}
+}
+
+// updateMemberSettings applies a changed connection limit of the pool member
+// by member on the devices without pool limits, and the priorities of the
+// static members on the ones without backup pools.
+func (c *CALBPoolController)updateMemberSettings(ctx context.Context, drv driver.Provider, oldPool, newPool *lbv1.CAppLoadBalancePool)error{
+	caps := drv.Capabilities()
+	limitChanged := !caps.PoolConnectionLimit && oldPool.Spec.ConnectionLimit != newPool.Spec.ConnectionLimit
+	membersChanged := !caps.BackupPool && !reflect.DeepEqual(oldPool.Spec.Members, newPool.Spec.Members)
+	if !limitChanged && !membersChanged {
+		return nil
+	}
+	poolName := utils.GeneratePoolNameCALBP(newPool.Namespace, newPool.Name)
+	var members []string
+	if newPool.Spec.ServiceRef != nil {
+		if !limitChanged {
+			return nil
+		}
+		c.lock.Lock()
+		for member, _ := range c.svcMembers[poolName] {
+			members = append(members, member)
+		}
+		c.lock.Unlock()
+	} else {
+		primary, _ := priorityMembers(drv, newPool)
+		for member, _ := range primary {
+			members = append(members, member)
+		}
+	}
+	for _, member := range members {
+		err := drv.UpdateMember(ctx, poolName, calbMember(drv, newPool, member))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CALBPoolController)onPoolDel(obj interface{}) {
+	glog.V(3).Infof("Del-Pool: %v", obj)
+	pool := obj.(*lbv1.CAppLoadBalancePool)
+	poolName := utils.GeneratePoolNameCALBP(pool.Namespace, pool.Name)
+	drv, err := c.provider(pool)
+	if err != nil {
+		glog.Errorf("Get driver of %s failed: %v", poolName, err)
+	} else {
+		ctx, cancel := deviceContext()
+		defer cancel()
+		err = retryDevice(func()error{
+			return drv.DeletePool(ctx, poolName)
+		})
+		if err != nil {
+			glog.Errorf("DeletePool %s failed: %v", poolName, err)
+		}
+		if _, backup := priorityMembers(drv, pool); len(backup) > 0 && pool.Spec.ServiceRef == nil {
+			// the pool is gone, so there is no status to report to.
+			backupName := utils.GenerateBackupPoolNameCALBP(pool.Namespace, pool.Name)
+			err = retryDevice(func()error{
+				return drv.DeletePool(ctx, backupName)
+			})
+			if err != nil && !driver.IsNotFound(err) {
+				glog.Errorf("DeletePool %s failed: %v", backupName, err)
+			}
+		}
+		commit(ctx, drv)
+	}
+	
+	c.forgetPool(pool.Namespace + "/" + pool.Name, poolName)
+}
+
+// processDraining removes the members done draining, see
+// memberSync.processDraining.
+func (c *CALBPoolController)processDraining() {
+	c.memberSync.processDraining(func(key string)driver.Provider{
+		obj, exists, _ := c.calbPoolStore.GetByKey(key)
+		if !exists {
+			return nil
+		}
+		drv, err := c.provider(obj.(*lbv1.CAppLoadBalancePool))
+		if err != nil {
+			glog.Errorf("Pool Drain: get driver of %s failed: %v", key, err)
+			return nil
+		}
+		return drv
+	}, c.updateDrainStatus)
+}
+
+func (c *CALBPoolController)updateDrainStatus(key string, members []drainingMember) {
+	obj, exists, err := c.calbPoolStore.GetByKey(key)
+	if err != nil || !exists {
+		return
+	}
+	var draining []lbv1.DrainingMember
+	for _, member := range members {
+		draining = append(draining, lbv1.DrainingMember{
+			Member		: member.Member,
+			Pool		: member.Pool,
+			Connections	: member.Connections,
+			Deadline	: meta_v1.NewTime(member.Deadline),
+		})
+	}
+	pool := obj.(*lbv1.CAppLoadBalancePool)
+	if reflect.DeepEqual(pool.Status.Draining, draining) {
+		return
+	}
+	newPool := pool.DeepCopy()
+	newPool.Status.Draining = draining
+	poolclient := crdclient.CALBPoolClient(c.crdClient, c.crdScheme, pool.Namespace)
+	_, err = poolclient.Update(newPool, pool.Name)
+	if err != nil {
+		glog.Errorf("Update draining status of pool %s failed: %v", key, err)
+	}
+}
+
+// updateServiceRef handles pools whose members come from a Service, also when
+// a pool switches between static members and a serviceRef.
+func (c *CALBPoolController)updateServiceRef(ctx context.Context, drv driver.Provider, oldPool, newPool *lbv1.CAppLoadBalancePool){
+	poolName := utils.GeneratePoolNameCALBP(newPool.Namespace, newPool.Name)
+	
+	if newPool.Spec.ServiceRef == nil {
+		glog.V(2).Infof("Pool %s: serviceRef removed, use static members.", poolName)
+		membersOld := make(map[string]int)
+		c.lock.Lock()
+		for member, _ := range c.svcMembers[poolName] {
+			membersOld[member + "/1"] = 1
+		}
+		delete(c.svcMembers, poolName)
+		c.lock.Unlock()
+		primary, _ := priorityMembers(drv, newPool)
+		c.updatePool(ctx, drv, newPool, poolName, primary, membersOld)
+		return
+	}
+	
+	if oldPool.Spec.ServiceRef == nil {
+		glog.V(2).Infof("Pool %s: static members replaced by serviceRef.", poolName)
+		// let the sync remove the static members.
+		c.lock.Lock()
+		members := make(map[string]bool)
+		primary, _ := priorityMembers(drv, oldPool)
+		for member, _ := range primary {
+			ip, port, _ := utils.SplitMemberWeight(member)
+			members[net.JoinHostPort(ip, port)] = true
+		}
+		c.svcMembers[poolName] = members
+		c.lock.Unlock()
+	}
+	
+	err := c.syncServiceMembers(ctx, drv, newPool)
+	if err != nil {
+		glog.Errorf("Sync members of %s from service failed: %v", poolName, err)
+		c.updateError(err.Error(), newPool)
+	}
+}
+
+// syncServiceMembers makes the device pool match the endpoints of the Service
+// referenced by pool. Ready addresses are enabled members, not ready ones are
+// kept in the pool but disabled. The calls of drv are committed with the
+// members.
+func (c *CALBPoolController)syncServiceMembers(ctx context.Context, drv driver.Provider, pool *lbv1.CAppLoadBalancePool)error{
+	ref := pool.Spec.ServiceRef
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = pool.Namespace
+	}
+	poolName := utils.GeneratePoolNameCALBP(pool.Namespace, pool.Name)
+	
+	// the members of a deleted service are removed, its error is reported.
+	membersNew, svcErr := utils.GetServiceRefMembers(c.svcStore, c.epStore, c.nodeStore, 
+		namespace, ref.Name, ref.Port, ref.Mode, ref.NodeSelector)
+	if membersNew == nil {
+		return svcErr
+	}
+	
+	timeout := utils.GetDuration(pool.Spec.DrainTimeout, lbv1.DEFAULTDRAINTIMEOUT)
+	
+	c.syncMembers(ctx, drv, pool.Namespace + "/" + pool.Name, poolName, membersNew, func(member string)driver.Member{
+		return calbMember(drv, pool, member)
+	}, timeout)
+	
+	return svcErr
+}
+
+func (c *CALBPoolController)onEndpointsAdd(obj interface{}) {
+	c.syncServiceObj(obj)
+}
+
+func (c *CALBPoolController)onEndpointsUpdate(oldObj, newObj interface{}) {
+	if !reflect.DeepEqual(oldObj, newObj) {
+		c.syncServiceObj(newObj)
+	}
+}
+
+func (c *CALBPoolController)onEndpointsDel(obj interface{}) {
+	c.syncServiceObj(obj)
+}
+
+func (c *CALBPoolController)onServiceAdd(obj interface{}) {
+	c.syncServiceObj(obj)
+}
+
+func (c *CALBPoolController)onServiceUpdate(oldObj, newObj interface{}) {
+	oldSvc := oldObj.(*v1.Service)
+	newSvc := newObj.(*v1.Service)
+	if !reflect.DeepEqual(oldSvc.Spec, newSvc.Spec) {
+		c.syncServiceObj(newObj)
+	}
+}
+
+func (c *CALBPoolController)onServiceDel(obj interface{}) {
+	c.syncServiceObj(obj)
+}
+
+func (c *CALBPoolController)onNodeAdd(obj interface{}) {
+	c.syncNodePortPools()
+}
+
+func (c *CALBPoolController)onNodeUpdate(oldObj, newObj interface{}) {
+	if utils.NodeMembershipChanged(oldObj.(*v1.Node), newObj.(*v1.Node)) {
+		c.syncNodePortPools()
+	}
+}
+
+func (c *CALBPoolController)onNodeDel(obj interface{}) {
+	c.syncNodePortPools()
+}
+
+// syncServiceObj resyncs every pool referencing the Service of obj, which is
+// either the Service itself or its Endpoints.
+func (c *CALBPoolController)syncServiceObj(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		glog.Errorf("Get service key failed: %v", err)
+		return
+	}
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	
+	for _, obj := range c.calbPoolStore.List() {
+		pool := obj.(*lbv1.CAppLoadBalancePool)
+		ref := pool.Spec.ServiceRef
+		if ref == nil || ref.Name != name {
+			continue
+		}
+		refNamespace := ref.Namespace
+		if refNamespace == "" {
+			refNamespace = pool.Namespace
+		}
+		if refNamespace != namespace {
+			continue
+		}
+		glog.V(3).Infof("Service %s changed, sync pool %s/%s", key, pool.Namespace, pool.Name)
+		c.syncPool(pool)
+	}
+}
+
+// syncNodePortPools resyncs every pool in NodePort mode after a node change.
+func (c *CALBPoolController)syncNodePortPools() {
+	for _, obj := range c.calbPoolStore.List() {
+		pool := obj.(*lbv1.CAppLoadBalancePool)
+		ref := pool.Spec.ServiceRef
+		if ref == nil || ref.Mode != lbv1.SERVICEREFMODENODEPORT {
+			continue
+		}
+		glog.V(3).Infof("Nodes changed, sync pool %s/%s", pool.Namespace, pool.Name)
+		c.syncPool(pool)
+	}
+}
+
+func (c *CALBPoolController)syncPool(pool *lbv1.CAppLoadBalancePool) {
+	drv, err := c.provider(pool)
+	if err == nil {
+		ctx, cancel := deviceContext()
+		defer cancel()
+		err = c.syncServiceMembers(ctx, drv, pool)
+	}
+	if err != nil {
+		glog.Errorf("Sync members of %s/%s from service failed: %v", pool.Namespace, pool.Name, err)
+		c.updateError(err.Error(), pool.DeepCopy())
+	}
+}
+
+func (c *CALBPoolController)updateError(msg string, pool *lbv1.CAppLoadBalancePool) {
+	pool.Status.State = lbv1.CALBPOOLSTATUSERROR
+	pool.Status.Message = msg
+	poolclient := crdclient.CALBPoolClient(c.crdClient, c.crdScheme, pool.Namespace)
+	_, _ = poolclient.Update(pool, pool.Name)
 }
\ No newline at end of file
@@ -1,117 +1,304 @@
-package controller
-
-import (
-	"time"
-	"os"
-	
-	"github.com/golang/glog"
-	
-	"k8s.io/client-go/kubernetes"	
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
-	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-	
-	crdclient 	"github.com/sak0/ygw/pkg/client"
-	crdv1 		"github.com/sak0/ygw/pkg/apis/external/v1"
-	driver 		"github.com/sak0/ygw/pkg/drivers"
-	"github.com/sak0/ygw/pkg/utils"
-)
-
-type CexController struct {
-	crdClient		*rest.RESTClient
-	crdScheme		*runtime.Scheme
-	client			kubernetes.Interface
-	
-	cexController	cache.Controller
-	driver			driver.GwProvider
-}
-
-func NewCexController(client kubernetes.Interface, crdClient *rest.RESTClient, 
-					crdScheme *runtime.Scheme)(*CexController, error) {
-	cexctr := &CexController{
-		crdClient 	: crdClient,
-		crdScheme 	: crdScheme,
-		client		: client,
-	}
-	driver, _ := driver.New("f5")
-	cexctr.driver = driver	
-	
-	cexListWatch := cache.NewListWatchFromClient(cexctr.crdClient, 
-		crdv1.CEXPlural, meta_v1.NamespaceAll, fields.Everything())
-	
-	_, cexcontroller := cache.NewInformer(
-		cexListWatch,
-		&crdv1.ClassicExternalNat{},
-		time.Minute*10,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: cexctr.onCexAdd,
-			DeleteFunc: cexctr.onCexDel,
-			UpdateFunc: cexctr.onCexUpdate,
-		},
-	)
-	cexctr.cexController = cexcontroller
-	
-	return cexctr, nil
-}
-
-func (c *CexController)Run(ctx <-chan struct{}) {
-	glog.V(2).Infof("Cex Controller starting...")
-	go c.cexController.Run(ctx)
-	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
-		return c.cexController.HasSynced(), nil
-	})
-	if !c.cexController.HasSynced() {
-		glog.Errorf("cex informer initial sync timeout")
-		os.Exit(1)
-	}
-}
-
-func (c *CexController)onCexAdd(obj interface{}) {
-	glog.V(3).Infof("Add-Cex: %v", obj)
-	cex := obj.(*crdv1.ClassicExternalNat)
-	
-	cexName := utils.GenerateCexName(cex.Namespace, cex.Name)
-	err := c.driver.CreateVirtualServer("nat", cexName, cex.Spec.IP, cex.Spec.Port, cex.Spec.Protocol)
-	if err != nil {
-		glog.Errorf("CreateVirtualServer failed: %+v\n", err)
-		c.updateError(err.Error(), cex)
-		return				
-	}
-	
-	if len(cex.Spec.Backends) > 0 {
-		for _, backend := range cex.Spec.Backends {
-			poolName := utils.GeneratePoolNameEXP(cex.Namespace, backend.PoolName)
-			err := c.driver.VirtualServerBindPool(cexName, poolName)
-			if err != nil {
-				glog.Errorf("VirtualServerBindPool failed: %+v\n", err)
-				c.updateError(err.Error(), cex)
-				return				
-			}
-		}
-	}
-}
-
-func (c *CexController)onCexUpdate(oldObj, newObj interface{}) {
-	glog.V(3).Infof("Update-Cex: %v -> %v", oldObj, newObj)	
-}
-
-func (c *CexController)onCexDel(obj interface{}) {
-	glog.V(3).Infof("Del-Cex: %v", obj)
-	cex := obj.(*crdv1.ClassicExternalNat)
-	
-	cexName := utils.GenerateCexName(cex.Namespace, cex.Name)
-	err := c.driver.DeleteVirtualServer(cexName)
-	if err != nil {
-		glog.Errorf("DeleteVirtualServer failed: %+v\n", err)
-	}
-}
-
-func (c *CexController)updateError(msg string, cex *crdv1.ClassicExternalNat) {
-	cex.Status.State = crdv1.CEXSTATUSERROR
-	cex.Status.Message = msg
-	cexclient := crdclient.CexClient(c.crdClient, c.crdScheme, cex.Namespace)
-	_, _ = cexclient.Update(cex, cex.Name)
+package controller
+
+import (
+	"fmt"
+	"time"
+	"os"
+	"reflect"
+	"strings"
+	
+	"github.com/golang/glog"
+	
+	"k8s.io/client-go/kubernetes"	
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	
+	crdclient 	"github.com/sak0/ygw/pkg/client"
+	crdv1 		"github.com/sak0/ygw/pkg/apis/external/v1"
+	driver 		"github.com/sak0/ygw/pkg/drivers"
+	"github.com/sak0/ygw/pkg/utils"
+)
+
+type CexController struct {
+	crdClient		*rest.RESTClient
+	crdScheme		*runtime.Scheme
+	client			kubernetes.Interface
+	
+	cexController	cache.Controller
+	devices			*DeviceController
+}
+
+func NewCexController(client kubernetes.Interface, crdClient *rest.RESTClient, 
+					crdScheme *runtime.Scheme, devices *DeviceController)(*CexController, error) {
+	cexctr := &CexController{
+		crdClient 	: crdClient,
+		crdScheme 	: crdScheme,
+		client		: client,
+		devices		: devices,
+	}
+	
+	cexListWatch := cache.NewListWatchFromClient(cexctr.crdClient, 
+		crdv1.CEXPlural, meta_v1.NamespaceAll, fields.Everything())
+	
+	_, cexcontroller := cache.NewInformer(
+		cexListWatch,
+		&crdv1.ClassicExternalNat{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: cexctr.onCexAdd,
+			DeleteFunc: cexctr.onCexDel,
+			UpdateFunc: cexctr.onCexUpdate,
+		},
+	)
+	cexctr.cexController = cexcontroller
+	
+	return cexctr, nil
+}
+
+func (c *CexController)Run(ctx <-chan struct{}) {
+	glog.V(2).Infof("Cex Controller starting...")
+	go c.cexController.Run(ctx)
+	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
+		return c.cexController.HasSynced(), nil
+	})
+	if !c.cexController.HasSynced() {
+		glog.Errorf("cex informer initial sync timeout")
+		os.Exit(1)
+	}
+}
+
+// provider returns the driver for the device and BIG-IP partition of cex,
+// collecting the calls of a sync, see batch.
+func (c *CexController)provider(cex *crdv1.ClassicExternalNat)(driver.Batch, error){
+	drv, err := c.devices.Provider(crdv1.CEXPlural, cex.Spec.DeviceRef, cex)
+	if err != nil {
+		return nil, err
+	}
+	return batch(drv), nil
+}
+
+// recordPartition saves on cex the BIG-IP partition its objects are created
+// in and returns the saved cex.
+func (c *CexController)recordPartition(cex *crdv1.ClassicExternalNat)*crdv1.ClassicExternalNat{
+	cex = cex.DeepCopy()
+	if !c.devices.RecordPartition(crdv1.CEXPlural, cex.Spec.DeviceRef, cex) {
+		return cex
+	}
+	cexclient := crdclient.CexClient(c.crdClient, c.crdScheme, cex.Namespace)
+	saved, err := cexclient.Update(cex, cex.Name)
+	if err != nil {
+		glog.Errorf("Record partition of cex %s failed: %v", cex.Name, err)
+		return cex
+	}
+	return saved
+}
+
+type cexListener struct {
+	Name		string
+	Port		string
+	Protocol	string
+	Pools		[]string
+	// PoolRefs are the ExternalNatPools of Pools.
+	PoolRefs	[]string
+}
+
+// cexListeners returns a virtual server per listener, a CEX without listeners
+// keeps the single one named after it.
+func cexListeners(cex *crdv1.ClassicExternalNat)[]cexListener{
+	pools := []string{}
+	refs := []string{}
+	for _, backend := range cex.Spec.Backends {
+		pools = append(pools, utils.GeneratePoolNameEXP(cex.Namespace, backend.PoolName))
+		refs = append(refs, backend.PoolName)
+	}
+	if len(cex.Spec.Listeners) == 0 {
+		return []cexListener{cexListener{
+			Name		: utils.GenerateCexName(cex.Namespace, cex.Name),
+			Port		: cex.Spec.Port,
+			Protocol	: cex.Spec.Protocol,
+			Pools		: pools,
+			PoolRefs	: refs,
+		}}
+	}
+	
+	listeners := []cexListener{}
+	for _, l := range cex.Spec.Listeners {
+		listener := cexListener{
+			Name		: utils.GenerateCexListenerName(cex.Namespace, cex.Name, l.Protocol, l.Port),
+			Port		: l.Port,
+			Protocol	: l.Protocol,
+			Pools		: pools,
+			PoolRefs	: refs,
+		}
+		if l.PoolName != "" {
+			listener.Pools = []string{utils.GeneratePoolNameEXP(cex.Namespace, l.PoolName)}
+			listener.PoolRefs = []string{l.PoolName}
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners
+}
+
+// checkPoolProtocols rejects the pools whose protocol is not the one of the
+// listener using them. The members of a NetScaler pool are services of the
+// protocol of the pool, HTTP by default, whatever the listener forwards.
+func (c *CexController)checkPoolProtocols(cex *crdv1.ClassicExternalNat)error{
+	poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, cex.Namespace)
+	for _, listener := range cexListeners(cex) {
+		for _, ref := range listener.PoolRefs {
+			pool, err := poolclient.Get(ref)
+			if err != nil {
+				return err
+			}
+			protocol := strings.ToUpper(pool.Spec.Protocol)
+			if protocol == "" {
+				protocol = "HTTP"
+			}
+			if protocol != strings.ToUpper(listener.Protocol) {
+				return fmt.Errorf("pool %s has protocol %s, listener %s/%s needs a %s pool", 
+					ref, protocol, listener.Protocol, listener.Port, strings.ToUpper(listener.Protocol))
+			}
+		}
+	}
+	return nil
+}
+
+func (c *CexController)onCexAdd(obj interface{}) {
+	glog.V(3).Infof("Add-Cex: %v", obj)
+	cex := obj.(*crdv1.ClassicExternalNat)
+	cex = c.recordPartition(cex)
+	drv, err := c.provider(cex)
+	if err != nil {
+		glog.Errorf("Get driver of %s/%s failed: %v", cex.Namespace, cex.Name, err)
+		c.updateError(err.Error(), cex)
+		return
+	}
+	if drv.Type() == driver.CITRIXLBPROVIDER {
+		err = c.checkPoolProtocols(cex)
+		if err != nil {
+			glog.Errorf("Check pools of %s/%s failed: %v", cex.Namespace, cex.Name, err)
+			c.updateError(err.Error(), cex)
+			return
+		}
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	defer commit(ctx, drv)
+	
+	for _, listener := range cexListeners(cex) {
+		err := retryDevice(func()error{
+			return drv.CreateVirtualServer(ctx, driver.VirtualServer{
+				Name		: listener.Name,
+				Mode		: driver.MODEL4,
+				IP			: cex.Spec.IP,
+				Port		: listener.Port,
+				Protocol	: listener.Protocol,
+			})
+		})
+		if err != nil {
+			glog.Errorf("CreateVirtualServer failed: %+v\n", err)
+			c.updateError(err.Error(), cex)
+			return				
+		}
+		
+		for _, poolName := range listener.Pools {
+			err := drv.SetDefaultPool(ctx, listener.Name, poolName)
+			if err != nil {
+				glog.Errorf("SetDefaultPool failed: %+v\n", err)
+				c.updateError(err.Error(), cex)
+				return				
+			}
+		}
+		
+		if len(cex.Spec.SourceRanges) > 0 {
+			err = drv.SetSourceRanges(ctx, listener.Name, cex.Spec.SourceRanges)
+			if err != nil {
+				glog.Errorf("SetSourceRanges failed: %+v\n", err)
+				c.updateError(err.Error(), cex)
+				return
+			}
+		}
+	}
+	err = drv.Commit(ctx)
+	if err != nil {
+		glog.Errorf("Commit %s/%s failed: %+v\n", cex.Namespace, cex.Name, err)
+		c.updateError(err.Error(), cex)
+	}
+}
+
+func (c *CexController)onCexUpdate(oldObj, newObj interface{}) {
+	glog.V(3).Infof("Update-Cex: %v -> %v", oldObj, newObj)
+	oldCex := oldObj.(*crdv1.ClassicExternalNat)
+	newCex := newObj.(*crdv1.ClassicExternalNat)
+	if reflect.DeepEqual(oldCex.Spec, newCex.Spec) {
+		return
+	}
+	
+	if oldCex.Spec.IP != newCex.Spec.IP || oldCex.Spec.DeviceRef != newCex.Spec.DeviceRef ||
+		!reflect.DeepEqual(cexListeners(oldCex), cexListeners(newCex)) {
+		glog.V(2).Infof("Need recreate virtual server of %s/%s.", newCex.Namespace, newCex.Name)
+		c.onCexDel(oldCex)
+		c.onCexAdd(newCex)
+		return
+	}
+	
+	drv, err := c.provider(newCex)
+	if err != nil {
+		glog.Errorf("Get driver of %s/%s failed: %v", newCex.Namespace, newCex.Name, err)
+		c.updateError(err.Error(), newCex)
+		return
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	for _, listener := range cexListeners(newCex) {
+		err := drv.SetSourceRanges(ctx, listener.Name, newCex.Spec.SourceRanges)
+		if err != nil {
+			glog.Errorf("SetSourceRanges failed: %+v\n", err)
+			c.updateError(err.Error(), newCex)
+		}
+	}
+	err = drv.Commit(ctx)
+	if err != nil {
+		glog.Errorf("Commit %s/%s failed: %+v\n", newCex.Namespace, newCex.Name, err)
+		c.updateError(err.Error(), newCex)
+	}
+}
+
+func (c *CexController)onCexDel(obj interface{}) {
+	glog.V(3).Infof("Del-Cex: %v", obj)
+	cex := obj.(*crdv1.ClassicExternalNat)
+	drv, err := c.provider(cex)
+	if err != nil {
+		glog.Errorf("Get driver of %s/%s failed: %v", cex.Namespace, cex.Name, err)
+		return
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	defer commit(ctx, drv)
+	
+	for _, listener := range cexListeners(cex) {
+		if len(cex.Spec.SourceRanges) > 0 {
+			err := drv.SetSourceRanges(ctx, listener.Name, nil)
+			if err != nil {
+				glog.Errorf("Remove source ranges failed: %+v\n", err)
+			}
+		}
+		err := retryDevice(func()error{
+			return drv.DeleteVirtualServer(ctx, listener.Name)
+		})
+		if err != nil && !driver.IsNotFound(err) {
+			glog.Errorf("DeleteVirtualServer failed: %+v\n", err)
+		}
+	}
+}
+
+func (c *CexController)updateError(msg string, cex *crdv1.ClassicExternalNat) {
+	cex.Status.State = crdv1.CEXSTATUSERROR
+	cex.Status.Message = msg
+	cexclient := crdclient.CexClient(c.crdClient, c.crdScheme, cex.Namespace)
+	_, _ = cexclient.Update(cex, cex.Name)
 }
\ No newline at end of file
@@ -0,0 +1,777 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	crdclient 	"github.com/sak0/ygw/pkg/client"
+	lbv1 		"github.com/sak0/ygw/pkg/apis/loadbalance/v1"
+	driver 		"github.com/sak0/ygw/pkg/drivers"
+	"github.com/sak0/ygw/pkg/utils"
+)
+
+const (
+	// a call answered with a transient error is retried this often.
+	deviceRetryInterval	= 2 * time.Second
+	deviceRetries		= 3
+	// a sync gives up on its device after this long.
+	deviceSyncTimeout	= 5 * time.Minute
+)
+
+// DeviceController keeps a driver per LoadBalancerDevice for the other
+// controllers, built by the provider registered for its type. An empty
+// deviceRef is the device of the environment of the type chosen for the kind
+// of the object. The drivers are rebuilt when the credentials Secret of their
+// device changes and the login of every device is checked periodically.
+type DeviceController struct {
+	crdClient		*rest.RESTClient
+	crdScheme		*runtime.Scheme
+	client			kubernetes.Interface
+	// partitionPerNamespace puts the f5 objects of a namespace in the BIG-IP
+	// partition named after it instead of the one of the device.
+	partitionPerNamespace	bool
+
+	// envSecrets are the "namespace/name" of the Secrets with the login of
+	// the devices of the environment, by device type. Without one the login
+	// comes from the environment too.
+	envSecrets		map[string]string
+	// defaultTypes are the device types of the objects without a deviceRef,
+	// by the plural of their kind.
+	defaultTypes	map[string]string
+
+	// devicesServed is false when the LoadBalancerDevice CRD is not
+	// installed, only the devices of the environment are served then.
+	devicesServed		bool
+	deviceController	cache.Controller
+	deviceStore			cache.Store
+	// secrets watches the credentials Secrets in use by "namespace/name",
+	// each on its own so that no other Secret is cached.
+	secretLock		sync.Mutex
+	secrets			map[string]*secretWatch
+	// queue holds the deviceKeys of the devices whose login is to be
+	// checked, off the event handlers since it goes to the device.
+	queue			workqueue.RateLimitingInterface
+
+	// drivers built so far, keyed by deviceKey.
+	lock			sync.Mutex
+	providers		map[string]driver.Provider
+	// forgotten counts the drivers dropped, a driver built meanwhile may
+	// have the old login and is not kept.
+	forgotten		int
+	// retired are the drivers dropped whose session is ended once the syncs
+	// still using them have timed out.
+	retired			map[driver.Provider]*time.Timer
+}
+
+func NewDeviceController(client kubernetes.Interface, crdClient *rest.RESTClient,
+					crdScheme *runtime.Scheme, partitionPerNamespace bool,
+					f5Secret string, citrixSecret string, defaultTypes string)(*DeviceController, error) {
+	defaults, err := parseDefaultTypes(defaultTypes)
+	if err != nil {
+		return nil, err
+	}
+	devicectr := &DeviceController{
+		crdClient	: crdClient,
+		crdScheme	: crdScheme,
+		client		: client,
+		partitionPerNamespace	: partitionPerNamespace,
+		envSecrets	: map[string]string{
+			lbv1.DEVICETYPEF5		: f5Secret,
+			lbv1.DEVICETYPEF5AS3	: f5Secret,
+			lbv1.DEVICETYPECITRIX	: citrixSecret,
+		},
+		defaultTypes	: defaults,
+		providers	: make(map[string]driver.Provider),
+		retired		: make(map[driver.Provider]*time.Timer),
+		secrets		: make(map[string]*secretWatch),
+		queue		: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "devices"),
+	}
+
+	devicestore, devicecontroller := cache.NewInformer(
+		crdclient.DeviceClient(crdClient, crdScheme).NewListWatch(),
+		&lbv1.LoadBalancerDevice{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: devicectr.onDeviceAdd,
+			DeleteFunc: devicectr.onDeviceDel,
+			UpdateFunc: devicectr.onDeviceUpdate,
+		},
+	)
+	devicectr.deviceStore = devicestore
+	devicectr.deviceController = devicecontroller
+
+	return devicectr, nil
+}
+
+// Run returns once the devices are synced, so it is called before the
+// controllers using them are started.
+func (c *DeviceController)Run(ctx <-chan struct{}) {
+	glog.V(2).Infof("Device Controller starting...")
+	// the devices read their credentials from the synced Secrets.
+	for _, key := range c.envSecrets {
+		c.watchSecret(key)
+	}
+	served, err := utils.ResourceServed(c.client, lbv1.SchemeGroupVersion.String(), lbv1.DevicePlural)
+	if err != nil {
+		glog.Errorf("Discover %s failed, watch it anyway: %v", lbv1.FullDeviceName, err)
+		served = true
+	}
+	c.devicesServed = served
+	if served {
+		go c.deviceController.Run(ctx)
+	} else {
+		glog.Warningf("%s is not installed, only the devices of the environment are served", lbv1.FullDeviceName)
+	}
+	go wait.Until(c.worker, time.Second, ctx)
+	go func() {
+		<-ctx
+		c.queue.ShutDown()
+	}()
+	// the event handlers only queue the logins, so this waits for the
+	// lists alone.
+	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
+		return c.hasSynced(), nil
+	})
+	if !c.hasSynced() {
+		glog.Errorf("device informer initial sync timeout")
+		os.Exit(1)
+	}
+	go wait.Until(c.checkDevices, time.Minute, ctx)
+}
+
+// worker checks the logins of the queued devices until the queue is shut
+// down.
+func (c *DeviceController)worker() {
+	for c.processNext() {
+	}
+}
+
+func (c *DeviceController)processNext()bool{
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+	if c.checkKey(key.(string)) {
+		c.queue.Forget(key)
+	} else {
+		c.queue.AddRateLimited(key)
+	}
+	return true
+}
+
+// checkKey checks the login of the device of key, see deviceKey. It returns
+// false when the credentials Secret of the device is not listed yet.
+func (c *DeviceController)checkKey(key string)bool{
+	if strings.HasPrefix(key, "env/") {
+		deviceType := strings.TrimPrefix(key, "env/")
+		if !c.secretListed(c.envSecrets[deviceType]) {
+			return false
+		}
+		c.checkEnvDevice(deviceType)
+		return true
+	}
+	obj, exists, err := c.deviceStore.GetByKey(key)
+	if err != nil || !exists {
+		return true
+	}
+	device := obj.(*lbv1.LoadBalancerDevice)
+	if !c.secretListed(secretKey(device.Spec.CredentialsSecret)) {
+		return false
+	}
+	c.checkDevice(device)
+	return true
+}
+
+// Stop ends the sessions of the devices, like the tokens of the BIG-IPs, and
+// stops watching their Secrets. It is called on shutdown, after the stop
+// channel of Run is closed.
+func (c *DeviceController)Stop() {
+	c.stopSecrets()
+	c.logoutAll()
+}
+
+// parseDefaultTypes parses the device types of the kinds, like
+// externalnatpool=f5,capploadbalance=citrix.
+func parseDefaultTypes(value string)(map[string]string, error){
+	defaults := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid default device type %s, want kind=type", item)
+		}
+		if !driver.Registered(kv[1]) {
+			return nil, fmt.Errorf("unknown device type %s of %s, the providers are %s", 
+				kv[1], kv[0], strings.Join(driver.Providers(), ", "))
+		}
+		defaults[strings.ToLower(kv[0])] = kv[1]
+	}
+	return defaults, nil
+}
+
+// deviceKey is the key of the driver of deviceRef, or of the device of the
+// environment of deviceType, whose name cannot hold a slash.
+func deviceKey(deviceRef string, deviceType string)string{
+	if deviceRef != "" {
+		return deviceRef
+	}
+	return "env/" + deviceType
+}
+
+// deviceContext bounds the calls of a sync to its device.
+func deviceContext()(context.Context, context.CancelFunc){
+	return context.WithTimeout(context.Background(), deviceSyncTimeout)
+}
+
+// batch returns a Batch of drv, so that a sync applies its calls at once
+// when the provider can, see driver.Batcher.
+func batch(drv driver.Provider)driver.Batch{
+	if batcher, ok := drv.(driver.Batcher); ok {
+		return batcher.Batch()
+	}
+	return unbatched{drv}
+}
+
+// unbatched is the Batch of a provider applying every call when it is made.
+type unbatched struct {
+	driver.Provider
+}
+
+func (unbatched)Commit(ctx context.Context)error{
+	return nil
+}
+
+// commit applies the calls left in drv by a sync, a sync committing its
+// calls itself defers it for the ones returning early.
+func commit(ctx context.Context, drv driver.Batch){
+	err := drv.Commit(ctx)
+	if err != nil {
+		glog.Errorf("Commit to the device failed: %v", err)
+	}
+}
+
+// retryDevice calls f again while the device answers with a transient error,
+// other errors are returned at once.
+func retryDevice(f func()error)error{
+	var err error
+	rerr := utils.Retry(deviceRetryInterval, deviceRetries, func()(bool, error){
+		err = f()
+		if driver.IsTransient(err) {
+			glog.Warningf("Device unavailable, retry: %v", err)
+			return false, nil
+		}
+		return true, err
+	})
+	if utils.IsRetryFailure(rerr) {
+		return err
+	}
+	return rerr
+}
+
+func (c *DeviceController)hasSynced()bool{
+	return (!c.devicesServed || c.deviceController.HasSynced()) && c.secretsSynced()
+}
+
+// secretWatch caches one credentials Secret.
+type secretWatch struct {
+	store		cache.Store
+	controller	cache.Controller
+	stop		chan struct{}
+}
+
+// secretKey is the "namespace/name" of the Secret of ref.
+func secretKey(ref lbv1.SecretReference)string{
+	return ref.Namespace + "/" + ref.Name
+}
+
+// watchSecret starts watching the Secret key, unless it is watched already.
+// The watch lists only this Secret, so that it needs no access to the others.
+// It does not wait for the list, the devices using the Secret are checked
+// again when it is added to the watch.
+func (c *DeviceController)watchSecret(key string) {
+	if key == "" {
+		return
+	}
+	c.secretLock.Lock()
+	w, ok := c.secrets[key]
+	if !ok {
+		namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+		listWatch := cache.NewListWatchFromClient(c.client.CoreV1().RESTClient(),
+			"secrets", namespace, fields.OneTermEqualSelector("metadata.name", name))
+		w = &secretWatch{stop : make(chan struct{})}
+		w.store, w.controller = cache.NewInformer(
+			listWatch,
+			&v1.Secret{},
+			time.Minute*10,
+			cache.ResourceEventHandlerFuncs{
+				AddFunc: c.onSecretChange,
+				DeleteFunc: c.onSecretChange,
+				UpdateFunc: c.onSecretUpdate,
+			},
+		)
+		c.secrets[key] = w
+		go w.controller.Run(w.stop)
+	}
+	c.secretLock.Unlock()
+}
+
+// pruneSecrets stops watching the Secrets no device uses anymore.
+func (c *DeviceController)pruneSecrets() {
+	used := make(map[string]bool)
+	for _, key := range c.envSecrets {
+		used[key] = true
+	}
+	for _, obj := range c.deviceStore.List() {
+		used[secretKey(obj.(*lbv1.LoadBalancerDevice).Spec.CredentialsSecret)] = true
+	}
+	c.secretLock.Lock()
+	defer c.secretLock.Unlock()
+	for key, w := range c.secrets {
+		if !used[key] {
+			glog.V(2).Infof("Stop watching Secret %s.", key)
+			close(w.stop)
+			delete(c.secrets, key)
+		}
+	}
+}
+
+func (c *DeviceController)stopSecrets() {
+	c.secretLock.Lock()
+	defer c.secretLock.Unlock()
+	for key, w := range c.secrets {
+		close(w.stop)
+		delete(c.secrets, key)
+	}
+}
+
+// secretListed tells whether the watch of the Secret key has listed it, an
+// empty key or a Secret not watched has nothing to wait for.
+func (c *DeviceController)secretListed(key string)bool{
+	c.secretLock.Lock()
+	w, ok := c.secrets[key]
+	c.secretLock.Unlock()
+	return !ok || w.controller.HasSynced()
+}
+
+func (c *DeviceController)secretsSynced()bool{
+	c.secretLock.Lock()
+	defer c.secretLock.Unlock()
+	for _, w := range c.secrets {
+		if !w.controller.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *DeviceController)onDeviceAdd(obj interface{}) {
+	glog.V(3).Infof("Add-Device: %v", obj)
+	device := obj.(*lbv1.LoadBalancerDevice)
+	c.watchSecret(secretKey(device.Spec.CredentialsSecret))
+	c.queue.Add(device.Name)
+}
+
+func (c *DeviceController)onDeviceUpdate(oldObj, newObj interface{}) {
+	glog.V(3).Infof("Update-Device: %v -> %v", oldObj, newObj)
+	oldDevice := oldObj.(*lbv1.LoadBalancerDevice)
+	newDevice := newObj.(*lbv1.LoadBalancerDevice)
+	if reflect.DeepEqual(oldDevice.Spec, newDevice.Spec) {
+		return
+	}
+	c.forget(newDevice.Name)
+	if oldDevice.Spec.CredentialsSecret != newDevice.Spec.CredentialsSecret {
+		c.watchSecret(secretKey(newDevice.Spec.CredentialsSecret))
+		c.pruneSecrets()
+	}
+	c.queue.Add(newDevice.Name)
+}
+
+func (c *DeviceController)onDeviceDel(obj interface{}) {
+	glog.V(3).Infof("Del-Device: %v", obj)
+	device, ok := obj.(*lbv1.LoadBalancerDevice)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		device, ok = tombstone.Obj.(*lbv1.LoadBalancerDevice)
+		if !ok {
+			return
+		}
+	}
+	c.forget(device.Name)
+	c.pruneSecrets()
+}
+
+func (c *DeviceController)onSecretUpdate(oldObj, newObj interface{}) {
+	oldSecret := oldObj.(*v1.Secret)
+	newSecret := newObj.(*v1.Secret)
+	if reflect.DeepEqual(oldSecret.Data, newSecret.Data) {
+		return
+	}
+	c.onSecretChange(newObj)
+}
+
+// onSecretChange rebuilds the drivers of the devices whose login is in the
+// Secret, the syncs using the old drivers finish with them, see forget.
+func (c *DeviceController)onSecretChange(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	for deviceType, secret := range c.envSecrets {
+		if secret != "" && secret == key {
+			glog.V(2).Infof("Credentials %s of the %s device of the environment changed.", key, deviceType)
+			c.forget(deviceKey("", deviceType))
+			c.queue.Add(deviceKey("", deviceType))
+		}
+	}
+	for _, obj := range c.deviceStore.List() {
+		device := obj.(*lbv1.LoadBalancerDevice)
+		if secretKey(device.Spec.CredentialsSecret) == key {
+			glog.V(2).Infof("Credentials %s of device %s changed.", key, device.Name)
+			c.forget(device.Name)
+			c.queue.Add(device.Name)
+		}
+	}
+}
+
+// checkDevices checks the login of every device, the password may have been
+// changed on the device itself.
+func (c *DeviceController)checkDevices() {
+	for _, obj := range c.deviceStore.List() {
+		c.queue.Add(obj.(*lbv1.LoadBalancerDevice).Name)
+	}
+}
+
+// login builds the driver of deviceType for deviceRef and checks its
+// credentials, the returned reason tells which of both failed.
+func (c *DeviceController)login(deviceRef string, deviceType string)(string, error){
+	p, err := c.provider(deviceRef, deviceType)
+	if err != nil {
+		return lbv1.DEVICEREASONINVALIDCREDENTIALS, err
+	}
+	err = p.Login(context.Background())
+	if err != nil {
+		return lbv1.DEVICEREASONLOGINFAILED, err
+	}
+	return lbv1.DEVICEREASONLOGGEDIN, nil
+}
+
+// checkDevice logs in the device and reports the result in its status.
+func (c *DeviceController)checkDevice(device *lbv1.LoadBalancerDevice) {
+	reason, err := c.login(device.Name, device.Spec.Type)
+	if err != nil {
+		glog.Errorf("Device %s is not usable: %v", device.Name, err)
+		c.updateStatus(lbv1.DEVICESTATUSERROR, reason, err.Error(), device)
+		return
+	}
+	c.updateStatus(lbv1.DEVICESTATUSAVAILABLE, reason, "", device)
+}
+
+// checkEnvDevice logs in the device of the environment, which has no status
+// to report to.
+func (c *DeviceController)checkEnvDevice(deviceType string) {
+	_, err := c.login("", deviceType)
+	if err != nil {
+		glog.Errorf("The %s device of the environment is not usable: %v", deviceType, err)
+	}
+}
+
+// forget drops the driver of key, see deviceKey. Its session is ended once
+// the syncs that got it before have timed out, so that their calls still go
+// through.
+func (c *DeviceController)forget(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.forgotten++
+	p, ok := c.providers[key]
+	if !ok {
+		return
+	}
+	delete(c.providers, key)
+	c.retired[p] = time.AfterFunc(deviceSyncTimeout, func() {
+		c.lock.Lock()
+		_, ok := c.retired[p]
+		delete(c.retired, p)
+		c.lock.Unlock()
+		if ok {
+			p.Logout()
+		}
+	})
+}
+
+// logoutAll ends the sessions of the drivers, the retired ones too.
+func (c *DeviceController)logoutAll() {
+	c.lock.Lock()
+	var providers []driver.Provider
+	for _, p := range c.providers {
+		providers = append(providers, p)
+	}
+	for p, timer := range c.retired {
+		timer.Stop()
+		providers = append(providers, p)
+	}
+	c.providers = make(map[string]driver.Provider)
+	c.retired = make(map[driver.Provider]*time.Timer)
+	c.forgotten++
+	c.lock.Unlock()
+	for _, p := range providers {
+		p.Logout()
+	}
+}
+
+// credentials returns the username and password of the Secret key.
+func (c *DeviceController)credentials(key string)(string, string, error){
+	c.secretLock.Lock()
+	w, ok := c.secrets[key]
+	c.secretLock.Unlock()
+	if !ok {
+		return "", "", fmt.Errorf("credentials Secret %s is not watched", key)
+	}
+	if !w.controller.HasSynced() {
+		return "", "", fmt.Errorf("credentials Secret %s is not listed yet", key)
+	}
+	obj, exists, err := w.store.GetByKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	if !exists {
+		return "", "", fmt.Errorf("credentials Secret %s not found", key)
+	}
+	secret := obj.(*v1.Secret)
+	username, password := string(secret.Data["username"]), string(secret.Data["password"])
+	if username == "" || password == "" {
+		return "", "", fmt.Errorf("credentials Secret %s needs the username and password keys", key)
+	}
+	return username, password, nil
+}
+
+// envDevice returns the device of the environment of deviceType with the
+// login of its Secret.
+func (c *DeviceController)envDevice(deviceType string)(driver.Device, error){
+	device := driver.EnvDevice(deviceType)
+	var err error
+	device.Username, device.Password, err = c.credentials(c.envSecrets[deviceType])
+	return device, err
+}
+
+// device returns the login of the LoadBalancerDevice name of kind deviceType.
+func (c *DeviceController)device(name string, deviceType string)(driver.Device, error){
+	obj, exists, err := c.deviceStore.GetByKey(name)
+	if err != nil {
+		return driver.Device{}, err
+	}
+	if !exists {
+		return driver.Device{}, fmt.Errorf("LoadBalancerDevice %s not found", name)
+	}
+	device := obj.(*lbv1.LoadBalancerDevice)
+	if device.Spec.Type != deviceType {
+		return driver.Device{}, fmt.Errorf("LoadBalancerDevice %s is %s, not %s", name, device.Spec.Type, deviceType)
+	}
+
+	username, password, err := c.credentials(secretKey(device.Spec.CredentialsSecret))
+	if err != nil {
+		return driver.Device{}, err
+	}
+	return driver.Device{
+		Address		: device.Spec.Address,
+		Username	: username,
+		Password	: password,
+		Partition	: device.Spec.Partition,
+		InsecureSkipVerify	: device.Spec.InsecureSkipVerify,
+		CABundle	: []byte(device.Spec.CABundle),
+		LoginProvider	: device.Spec.LoginProvider,
+	}, nil
+}
+
+// provider returns the driver of deviceRef, or of the device of the
+// environment of deviceType when deviceRef is empty. The driver is built out
+// of the lock, since building it may log in the device.
+func (c *DeviceController)provider(deviceRef string, deviceType string)(driver.Provider, error){
+	key := deviceKey(deviceRef, deviceType)
+	c.lock.Lock()
+	p, ok := c.providers[key]
+	forgotten := c.forgotten
+	c.lock.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	var device driver.Device
+	var err error
+	if deviceRef == "" && c.envSecrets[deviceType] == "" {
+		device = driver.EnvDevice(deviceType)
+	} else if deviceRef == "" {
+		device, err = c.envDevice(deviceType)
+	} else {
+		device, err = c.device(deviceRef, deviceType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	device.TLSSecret = func(namespace, name string)([]byte, []byte, error){
+		return utils.GetTLSSecret(c.client, namespace, name)
+	}
+	p, err = driver.NewProvider(deviceType, device)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	if existing, ok := c.providers[key]; ok {
+		// built meanwhile by another call.
+		c.lock.Unlock()
+		p.Logout()
+		return existing, nil
+	}
+	if c.forgotten != forgotten {
+		c.lock.Unlock()
+		p.Logout()
+		return nil, &driver.Error{
+			Reason : driver.ErrorReasonTransient,
+			Err : fmt.Errorf("device %s changed during the login", key),
+		}
+	}
+	c.providers[key] = p
+	c.lock.Unlock()
+	return p, nil
+}
+
+// Partition returns the BIG-IP partition of the objects of obj: the one
+// recorded on it when it was created, else the one of its namespace.
+func (c *DeviceController)Partition(obj meta_v1.Object)string{
+	if partition, ok := obj.GetAnnotations()[utils.F5PartitionAnnotation]; ok {
+		return partition
+	}
+	return utils.GetF5Partition(c.client, obj.GetNamespace(), c.partitionPerNamespace)
+}
+
+// Partitioned tells whether the device of the objects of kind with deviceRef
+// keeps them in partitions, see driver.Partitioned.
+func (c *DeviceController)Partitioned(kind string, deviceRef string)bool{
+	p, err := c.kindProvider(kind, deviceRef)
+	if err != nil {
+		return false
+	}
+	_, ok := p.(driver.Partitioned)
+	return ok
+}
+
+// RecordPartition records on obj the partition of its objects when they are
+// created on a partitioned device, so that they are still found after the
+// annotation of its namespace changes. It returns true when obj was changed
+// and has to be saved.
+func (c *DeviceController)RecordPartition(kind string, deviceRef string, obj meta_v1.Object)bool{
+	if _, ok := obj.GetAnnotations()[utils.F5PartitionAnnotation]; ok {
+		return false
+	}
+	if !c.Partitioned(kind, deviceRef) {
+		return false
+	}
+	annotations := map[string]string{utils.F5PartitionAnnotation : c.Partition(obj)}
+	for k, v := range obj.GetAnnotations() {
+		annotations[k] = v
+	}
+	obj.SetAnnotations(annotations)
+	return true
+}
+
+// DefaultType returns the device type of the objects of kind without a
+// deviceRef, kind is the plural of the resource.
+func (c *DeviceController)DefaultType(kind string)string{
+	return c.defaultTypes[kind]
+}
+
+// DeviceOf names the device of the objects of kind with deviceRef, objects
+// on the same device get the same name.
+func (c *DeviceController)DeviceOf(kind string, deviceRef string)string{
+	return deviceKey(deviceRef, c.DefaultType(kind))
+}
+
+// Provider returns the vendor neutral driver of deviceRef for obj of kind,
+// the device of the environment of the type chosen for kind when deviceRef is
+// empty. On a BIG-IP the driver works in the partition of obj.
+func (c *DeviceController)Provider(kind string, deviceRef string, obj meta_v1.Object)(driver.Provider, error){
+	p, err := c.kindProvider(kind, deviceRef)
+	if err != nil {
+		return nil, err
+	}
+	if partitioned, ok := p.(driver.Partitioned); ok {
+		return partitioned.Partition(c.Partition(obj)), nil
+	}
+	return p, nil
+}
+
+// kindProvider returns the driver of deviceRef for the objects of kind, kind
+// is the plural of the resource.
+func (c *DeviceController)kindProvider(kind string, deviceRef string)(driver.Provider, error){
+	deviceType := c.DefaultType(kind)
+	if deviceRef != "" {
+		obj, exists, err := c.deviceStore.GetByKey(deviceRef)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("LoadBalancerDevice %s not found", deviceRef)
+		}
+		deviceType = obj.(*lbv1.LoadBalancerDevice).Spec.Type
+	} else if deviceType == "" {
+		return nil, fmt.Errorf("no device type for the %s without a deviceRef", kind)
+	}
+	return c.provider(deviceRef, deviceType)
+}
+
+func (c *DeviceController)updateStatus(state string, reason string, msg string, device *lbv1.LoadBalancerDevice) {
+	cond := lbv1.DeviceCondition{
+		Type				: lbv1.DEVICECONDITIONAUTHENTICATED,
+		Status				: lbv1.DEVICECONDITIONTRUE,
+		Reason				: reason,
+		Message				: msg,
+		LastTransitionTime	: meta_v1.Now(),
+	}
+	if state != lbv1.DEVICESTATUSAVAILABLE {
+		cond.Status = lbv1.DEVICECONDITIONFALSE
+	}
+	conditions := []lbv1.DeviceCondition{cond}
+	for _, old := range device.Status.Conditions {
+		if old.Type != cond.Type {
+			conditions = append(conditions, old)
+		} else if old.Status == cond.Status {
+			conditions[0].LastTransitionTime = old.LastTransitionTime
+		}
+	}
+	if device.Status.State == state && device.Status.Message == msg && 
+		reflect.DeepEqual(device.Status.Conditions, conditions) {
+		return
+	}
+	device = device.DeepCopy()
+	device.Status.State = state
+	device.Status.Message = msg
+	device.Status.Conditions = conditions
+	_, err := crdclient.DeviceClient(c.crdClient, c.crdScheme).Update(device, device.Name)
+	if err != nil {
+		glog.Errorf("Update status of device %s failed: %v", device.Name, err)
+	}
+}
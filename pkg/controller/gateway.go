@@ -0,0 +1,1377 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	crdclient 	"github.com/sak0/ygw/pkg/client"
+	crdv1 		"github.com/sak0/ygw/pkg/apis/external/v1"
+	gwv1 		"github.com/sak0/ygw/pkg/apis/gateway/v1alpha2"
+	lbv1 		"github.com/sak0/ygw/pkg/apis/loadbalance/v1"
+	driver 		"github.com/sak0/ygw/pkg/drivers"
+	"github.com/sak0/ygw/pkg/utils"
+)
+
+const (
+	// RouteLabel marks the pools managed for a route, "<kind>.<name>".
+	RouteLabel	= "ygw.yonghui.cn/route"
+
+	// GatewayStateAnnotation keeps on a Gateway what is configured for it on
+	// the device, so that it is cleaned up after a restart too.
+	GatewayStateAnnotation	= "ygw.yonghui.cn/gateway-state"
+	// GatewayFinalizer holds a Gateway with a state until it is torn down.
+	GatewayFinalizer		= "ygw.yonghui.cn/gateway"
+
+	kindHTTPRoute	= "HTTPRoute"
+	kindTCPRoute	= "TCPRoute"
+)
+
+type gatewayRule struct {
+	Host	string	`json:"host,omitempty"`
+	Path	string	`json:"path,omitempty"`
+	Pool	string	`json:"pool"`
+}
+
+type gatewayCert struct {
+	Namespace	string	`json:"namespace"`
+	SecretName	string	`json:"secretName"`
+	// ServerName selects the certificate by SNI, the Default one answers
+	// clients without a matching name.
+	ServerName	string	`json:"serverName,omitempty"`
+	Default		bool	`json:"default,omitempty"`
+}
+
+// listenerState is the configuration of the listeners of a Gateway sharing
+// one port, they are one virtual server or csvserver on the device.
+type listenerState struct {
+	Protocol	string
+	Port		int32
+	Rules		map[gatewayRule]bool
+	Certs		map[string]gatewayCert
+	// Pool is the backend of a TCP listener.
+	Pool		string
+}
+
+func newListenerState(protocol string, port int32)*listenerState{
+	return &listenerState{
+		Protocol	: protocol,
+		Port		: port,
+		Rules		: make(map[gatewayRule]bool),
+		Certs		: make(map[string]gatewayCert),
+	}
+}
+
+func (l *listenerState)copy()*listenerState{
+	c := newListenerState(l.Protocol, l.Port)
+	for rule, _ := range l.Rules {
+		c.Rules[rule] = true
+	}
+	for name, cert := range l.Certs {
+		c.Certs[name] = cert
+	}
+	c.Pool = l.Pool
+	return c
+}
+
+// savedListener is a listenerState in GatewayStateAnnotation, with the rules
+// as a sorted list.
+type savedListener struct {
+	Protocol	string					`json:"protocol"`
+	Port		int32					`json:"port"`
+	Rules		[]gatewayRule			`json:"rules,omitempty"`
+	Certs		map[string]gatewayCert	`json:"certs,omitempty"`
+	Pool		string					`json:"pool,omitempty"`
+}
+
+func (l *listenerState)MarshalJSON()([]byte, error){
+	saved := savedListener{
+		Protocol	: l.Protocol,
+		Port		: l.Port,
+		Certs		: l.Certs,
+		Pool		: l.Pool,
+	}
+	for rule, _ := range l.Rules {
+		saved.Rules = append(saved.Rules, rule)
+	}
+	sort.Slice(saved.Rules, func(i, j int) bool {
+		a, b := saved.Rules[i], saved.Rules[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Pool < b.Pool
+	})
+	return json.Marshal(saved)
+}
+
+func (l *listenerState)UnmarshalJSON(data []byte)error{
+	var saved savedListener
+	err := json.Unmarshal(data, &saved)
+	if err != nil {
+		return err
+	}
+	*l = *newListenerState(saved.Protocol, saved.Port)
+	l.Pool = saved.Pool
+	for _, rule := range saved.Rules {
+		l.Rules[rule] = true
+	}
+	for name, cert := range saved.Certs {
+		l.Certs[name] = cert
+	}
+	return nil
+}
+
+// gatewayState is what is configured on the device for a Gateway, it is kept
+// in GatewayStateAnnotation.
+type gatewayState struct {
+	ControllerName	string		`json:"controllerName"`
+	// Device is the LoadBalancerDevice, empty for the one of the environment.
+	Device			string		`json:"device,omitempty"`
+	// Partition is the BIG-IP partition of the listeners and pools, chosen
+	// when the gateway is first applied on a Partitioned device.
+	Partitioned		bool		`json:"partitioned,omitempty"`
+	Partition		string		`json:"partition,omitempty"`
+	VIP				string		`json:"vip"`
+	Listeners		map[int32]*listenerState	`json:"listeners,omitempty"`
+}
+
+// loadGatewayState returns the state saved on the Gateway, nil without one.
+func loadGatewayState(gw *gwv1.Gateway)*gatewayState{
+	data, ok := gw.Annotations[GatewayStateAnnotation]
+	if !ok {
+		return nil
+	}
+	state := &gatewayState{}
+	err := json.Unmarshal([]byte(data), state)
+	if err != nil {
+		glog.Errorf("Invalid state of gateway %s/%s, ignored: %v", gw.Namespace, gw.Name, err)
+		return nil
+	}
+	if state.Listeners == nil {
+		state.Listeners = make(map[int32]*listenerState)
+	}
+	return state
+}
+
+// saveState saves state on the Gateway with GatewayFinalizer, so that the
+// Gateway is torn down even when it is deleted while ygw is down. A nil state
+// removes both. It returns the saved Gateway.
+func (c *GatewayController)saveState(gw *gwv1.Gateway, state *gatewayState)*gwv1.Gateway{
+	newGw := gw.DeepCopy()
+	finalizers := []string{}
+	for _, finalizer := range newGw.Finalizers {
+		if finalizer != GatewayFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	if state == nil {
+		delete(newGw.Annotations, GatewayStateAnnotation)
+		if len(finalizers) != len(newGw.Finalizers) {
+			newGw.Finalizers = finalizers
+		}
+	} else {
+		data, err := json.Marshal(state)
+		if err != nil {
+			glog.Errorf("Encode state of gateway %s/%s failed: %v", gw.Namespace, gw.Name, err)
+			return gw
+		}
+		if newGw.Annotations == nil {
+			newGw.Annotations = make(map[string]string)
+		}
+		newGw.Annotations[GatewayStateAnnotation] = string(data)
+		if len(finalizers) == len(newGw.Finalizers) {
+			newGw.Finalizers = append(newGw.Finalizers, GatewayFinalizer)
+		}
+	}
+	if reflect.DeepEqual(gw.Annotations, newGw.Annotations) && reflect.DeepEqual(gw.Finalizers, newGw.Finalizers) {
+		return gw
+	}
+	saved, err := crdclient.GatewayClient(c.gwClient, c.gwScheme, gw.Namespace).Update(newGw, gw.Name)
+	if err != nil {
+		glog.Errorf("Save state of gateway %s/%s failed: %v", gw.Namespace, gw.Name, err)
+		return gw
+	}
+	return saved
+}
+
+type listenerResult struct {
+	attachedRoutes	int32
+	// empty reasons mean the condition is true.
+	acceptedReason	string
+	acceptedMsg		string
+	refsReason		string
+	refsMsg			string
+	programErr		error
+}
+
+type routeResult struct {
+	kind		string
+	namespace	string
+	name		string
+	parentRef	gwv1.ParentReference
+	attached	bool
+	reason		string
+	message		string
+	refsReason	string
+	refsMsg		string
+}
+
+// gatewayPlan is the translation of a Gateway and the routes attached to it.
+type gatewayPlan struct {
+	// state has the device and partition of the Gateway.
+	state		*gatewayState
+	ports		map[int32]*listenerState
+	listeners	map[string]*listenerResult
+	routes		[]*routeResult
+	// pools used by the attached routes, by route label.
+	pools		map[string]map[string]bool
+	// device pool names of the pools ensured during this sync.
+	devicePools	map[string]string
+}
+
+// GatewayController implements the Gateway API. The parametersRef of the
+// GatewayClass selects the LoadBalancerDevice, of any type, and its
+// controllerName the kinds of the objects, see gatewayKinds, whose device type
+// is used without one. A Gateway is a vip with a
+// virtual server per listener port and the HTTPRoutes and
+// TCPRoutes become host/path rules and pools. The pools are ExternalNatPool
+// or CAppLoadBalancePool objects owned by the routes.
+type GatewayController struct {
+	client			kubernetes.Interface
+	crdClient		*rest.RESTClient
+	crdScheme		*runtime.Scheme
+	lbClient		*rest.RESTClient
+	lbScheme		*runtime.Scheme
+	gwClient		*rest.RESTClient
+	gwScheme		*runtime.Scheme
+	subnet			string
+	devices			*DeviceController
+
+	classStore		cache.Store
+	gatewayStore	cache.Store
+	httpRouteStore	cache.Store
+	tcpRouteStore	cache.Store
+	controllers		[]cache.Controller
+
+	mutex			sync.Mutex
+	applied			map[string]*gatewayState
+}
+
+func NewGatewayController(client kubernetes.Interface, crdClient *rest.RESTClient, crdScheme *runtime.Scheme,
+					lbClient *rest.RESTClient, lbScheme *runtime.Scheme,
+					gwClient *rest.RESTClient, gwScheme *runtime.Scheme, subnet string,
+					devices *DeviceController)(*GatewayController, error) {
+	gwctr := &GatewayController{
+		client		: client,
+		crdClient	: crdClient,
+		crdScheme	: crdScheme,
+		lbClient	: lbClient,
+		lbScheme	: lbScheme,
+		gwClient	: gwClient,
+		gwScheme	: gwScheme,
+		subnet		: subnet,
+		devices		: devices,
+		applied		: make(map[string]*gatewayState),
+	}
+
+	classStore, classController := cache.NewInformer(
+		crdclient.GatewayClassClient(gwClient, gwScheme).NewListWatch(),
+		&gwv1.GatewayClass{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: gwctr.onClassAdd,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				gwctr.onClassAdd(newObj)
+			},
+		},
+	)
+	gatewayStore, gatewayController := cache.NewInformer(
+		crdclient.GatewayClient(gwClient, gwScheme, meta_v1.NamespaceAll).NewListWatch(),
+		&gwv1.Gateway{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: gwctr.onGatewayAdd,
+			UpdateFunc: gwctr.onGatewayUpdate,
+			DeleteFunc: gwctr.onGatewayDel,
+		},
+	)
+	httpRouteStore, httpRouteController := cache.NewInformer(
+		crdclient.HTTPRouteClient(gwClient, gwScheme, meta_v1.NamespaceAll).NewListWatch(),
+		&gwv1.HTTPRoute{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: gwctr.onRouteAdd,
+			UpdateFunc: gwctr.onRouteUpdate,
+			DeleteFunc: gwctr.onRouteAdd,
+		},
+	)
+	tcpRouteStore, tcpRouteController := cache.NewInformer(
+		crdclient.TCPRouteClient(gwClient, gwScheme, meta_v1.NamespaceAll).NewListWatch(),
+		&gwv1.TCPRoute{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: gwctr.onRouteAdd,
+			UpdateFunc: gwctr.onRouteUpdate,
+			DeleteFunc: gwctr.onRouteAdd,
+		},
+	)
+	gwctr.classStore = classStore
+	gwctr.gatewayStore = gatewayStore
+	gwctr.httpRouteStore = httpRouteStore
+	gwctr.tcpRouteStore = tcpRouteStore
+	gwctr.controllers = []cache.Controller{classController, gatewayController,
+		httpRouteController, tcpRouteController}
+
+	return gwctr, nil
+}
+
+func (c *GatewayController)Run(ctx <-chan struct{}) {
+	glog.V(2).Infof("Gateway Controller starting...")
+	for _, controller := range c.controllers {
+		go controller.Run(ctx)
+	}
+	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
+		return c.hasSynced(), nil
+	})
+	if !c.hasSynced() {
+		glog.Errorf("gateway informer initial sync timeout")
+		os.Exit(1)
+	}
+}
+
+func (c *GatewayController)hasSynced()bool{
+	for _, controller := range c.controllers {
+		if !controller.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// gatewayKinds returns the kinds of the objects of the virtual servers and of
+// the pools of a controllerName, the device type of a Gateway without a
+// device is the one of these kinds.
+func gatewayKinds(controllerName string)(string, string){
+	if controllerName == gwv1.CONTROLLERF5 {
+		return crdv1.AEXPlural, crdv1.EXPPlural
+	}
+	return lbv1.CALBPlural, lbv1.CALBPPlural
+}
+
+// provider returns the driver of the objects of kind of a Gateway, in its
+// partition.
+func (c *GatewayController)provider(state *gatewayState, kind string)(driver.Provider, error){
+	obj := &meta_v1.ObjectMeta{}
+	if state.Partitioned {
+		obj.Annotations = map[string]string{utils.F5PartitionAnnotation : state.Partition}
+	}
+	return c.devices.Provider(kind, state.Device, obj)
+}
+
+func isOurController(controllerName string)bool{
+	return controllerName == gwv1.CONTROLLERF5 || controllerName == gwv1.CONTROLLERCITRIX
+}
+
+// checkParameters returns why the parametersRef of the class is invalid.
+func checkParameters(class *gwv1.GatewayClass)string{
+	ref := class.Spec.ParametersRef
+	if ref == nil {
+		return ""
+	}
+	if ref.Group != lbv1.LBGroup || ref.Kind != lbv1.DEVICEKIND {
+		return fmt.Sprintf("parametersRef must be a %s of %s", lbv1.DEVICEKIND, lbv1.LBGroup)
+	}
+	return ""
+}
+
+// controllerOf returns the controllerName and the device of the class of the
+// Gateway, an empty controllerName when the class is not served by ygw.
+func (c *GatewayController)controllerOf(gw *gwv1.Gateway)(string, string){
+	obj, exists, err := c.classStore.GetByKey(gw.Spec.GatewayClassName)
+	if err != nil || !exists {
+		return "", ""
+	}
+	class := obj.(*gwv1.GatewayClass)
+	if !isOurController(class.Spec.ControllerName) || checkParameters(class) != "" {
+		return "", ""
+	}
+	if class.Spec.ParametersRef == nil {
+		return class.Spec.ControllerName, ""
+	}
+	return class.Spec.ControllerName, class.Spec.ParametersRef.Name
+}
+
+func (c *GatewayController)onClassAdd(obj interface{}) {
+	class := obj.(*gwv1.GatewayClass)
+	if !isOurController(class.Spec.ControllerName) {
+		return
+	}
+	glog.V(3).Infof("Sync-GatewayClass: %v", obj)
+
+	failReason := ""
+	message := checkParameters(class)
+	if message != "" {
+		failReason = gwv1.REASONINVALIDPARAMETERS
+	}
+	newClass := class.DeepCopy()
+	newClass.Status.Conditions = mergeConditions(class.Status.Conditions, []gwv1.Condition{
+		newCondition(gwv1.CONDITIONACCEPTED, failReason, gwv1.REASONACCEPTED, message, class.Generation),
+	})
+	if !reflect.DeepEqual(class.Status, newClass.Status) {
+		_, err := crdclient.GatewayClassClient(c.gwClient, c.gwScheme).UpdateStatus(newClass, class.Name)
+		if err != nil {
+			glog.Errorf("Update status of gatewayclass %s failed: %v", class.Name, err)
+		}
+	}
+
+	for _, gwObj := range c.gatewayStore.List() {
+		gw := gwObj.(*gwv1.Gateway)
+		if gw.Spec.GatewayClassName == class.Name {
+			c.syncGateway(gw.Namespace + "/" + gw.Name)
+		}
+	}
+}
+
+func (c *GatewayController)onGatewayAdd(obj interface{}) {
+	glog.V(3).Infof("Add-Gateway: %v", obj)
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	c.syncGateway(key)
+}
+
+func (c *GatewayController)onGatewayUpdate(oldObj, newObj interface{}) {
+	oldGw := oldObj.(*gwv1.Gateway)
+	newGw := newObj.(*gwv1.Gateway)
+	// skip our own status and state updates, the periodic resync has the
+	// same version.
+	if oldGw.ResourceVersion != newGw.ResourceVersion && reflect.DeepEqual(oldGw.Spec, newGw.Spec) &&
+		newGw.DeletionTimestamp == nil {
+		return
+	}
+	glog.V(3).Infof("Update-Gateway: %v -> %v", oldObj, newObj)
+	c.syncGateway(newGw.Namespace + "/" + newGw.Name)
+}
+
+func (c *GatewayController)onGatewayDel(obj interface{}) {
+	glog.V(3).Infof("Del-Gateway: %v", obj)
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	c.syncGateway(key)
+}
+
+// routeParents returns the keys of the Gateways a route refers to.
+func routeParents(obj interface{})[]string{
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	var namespace string
+	var refs []gwv1.ParentReference
+	switch route := obj.(type) {
+		case *gwv1.HTTPRoute:
+			namespace, refs = route.Namespace, route.Spec.ParentRefs
+		case *gwv1.TCPRoute:
+			namespace, refs = route.Namespace, route.Spec.ParentRefs
+		default:
+			return nil
+	}
+	keys := []string{}
+	for _, ref := range refs {
+		if ref.Kind != "" && ref.Kind != "Gateway" {
+			continue
+		}
+		refNamespace := ref.Namespace
+		if refNamespace == "" {
+			refNamespace = namespace
+		}
+		keys = append(keys, refNamespace + "/" + ref.Name)
+	}
+	return keys
+}
+
+func (c *GatewayController)onRouteAdd(obj interface{}) {
+	glog.V(3).Infof("Sync-Route: %v", obj)
+	for _, key := range routeParents(obj) {
+		c.syncGateway(key)
+	}
+}
+
+func (c *GatewayController)onRouteUpdate(oldObj, newObj interface{}) {
+	oldMeta := oldObj.(meta_v1.Object)
+	newMeta := newObj.(meta_v1.Object)
+	if oldMeta.GetResourceVersion() != newMeta.GetResourceVersion() &&
+		oldMeta.GetGeneration() == newMeta.GetGeneration() {
+		return
+	}
+	glog.V(3).Infof("Update-Route: %v -> %v", oldObj, newObj)
+	keys := make(map[string]bool)
+	for _, key := range append(routeParents(oldObj), routeParents(newObj)...) {
+		keys[key] = true
+	}
+	for key, _ := range keys {
+		c.syncGateway(key)
+	}
+}
+
+func (c *GatewayController)syncGateway(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	obj, exists, err := c.gatewayStore.GetByKey(key)
+	if err != nil {
+		glog.Errorf("Get gateway %s failed: %v", key, err)
+		return
+	}
+	var gw *gwv1.Gateway
+	controllerName, device := "", ""
+	if exists {
+		gw = obj.(*gwv1.Gateway)
+		// a deleted Gateway waits for the teardown in GatewayFinalizer.
+		if gw.DeletionTimestamp == nil {
+			controllerName, device = c.controllerOf(gw)
+		}
+	}
+
+	applied := c.applied[key]
+	if applied == nil && exists {
+		applied = loadGatewayState(gw)
+		if applied != nil {
+			glog.V(2).Infof("Loaded the state of gateway %s", key)
+			c.applied[key] = applied
+		}
+	}
+	if applied != nil && (applied.ControllerName != controllerName || applied.Device != device) {
+		c.teardown(key, applied)
+		applied = nil
+	}
+	if controllerName == "" {
+		if exists {
+			c.saveState(gw, nil)
+		}
+		return
+	}
+
+	vip, err := c.ensureVip(gw, applied)
+	if err != nil {
+		glog.Errorf("Alloc vip for gateway %s failed: %v", key, err)
+		gw = c.saveState(gw, applied)
+		c.updateGatewayStatus(gw, "", gwv1.REASONADDRESSNOTASSIGNED, err.Error(), nil)
+		return
+	}
+	if applied != nil && applied.VIP != vip {
+		glog.V(2).Infof("Vip of gateway %s changed %s -> %s", key, applied.VIP, vip)
+		c.teardown(key, applied)
+		applied = nil
+	}
+	vsKind, _ := gatewayKinds(controllerName)
+	if applied == nil {
+		applied = &gatewayState{
+			ControllerName	: controllerName,
+			Device			: device,
+			VIP				: vip,
+			Listeners		: make(map[int32]*listenerState),
+		}
+		if c.devices.Partitioned(vsKind, device) {
+			applied.Partitioned = true
+			applied.Partition = c.devices.Partition(gw)
+		}
+		c.applied[key] = applied
+	}
+
+	drv, err := c.provider(applied, vsKind)
+	if err != nil {
+		glog.Errorf("Get driver of gateway %s failed: %v", key, err)
+		gw = c.saveState(gw, applied)
+		c.updateGatewayStatus(gw, vip, gwv1.REASONPENDING, err.Error(), nil)
+		return
+	}
+	plan := c.plan(gw, applied, drv.Capabilities().L4)
+	ctx, cancel := deviceContext()
+	defer cancel()
+	listeners := batch(drv)
+	// the listeners are committed at once, they are back to these when
+	// the commit fails.
+	before := make(map[int32]*listenerState)
+	for port, cur := range applied.Listeners {
+		before[port] = cur.copy()
+	}
+	for port, cur := range applied.Listeners {
+		if want, ok := plan.ports[port]; !ok || want.Protocol != cur.Protocol {
+			err = c.deleteListener(ctx, listeners, gw.Namespace, gw.Name, cur)
+			if err != nil {
+				glog.Errorf("Delete listener %d of gateway %s failed: %v", port, key, err)
+			}
+			delete(applied.Listeners, port)
+		}
+	}
+	for port, want := range plan.ports {
+		err = c.applyListener(ctx, listeners, gw, applied, want)
+		if err != nil {
+			glog.Errorf("Apply listener %d of gateway %s failed: %v", port, key, err)
+			for _, l := range gw.Spec.Listeners {
+				if l.Port == port && plan.listeners[l.Name].acceptedReason == "" {
+					plan.listeners[l.Name].programErr = err
+				}
+			}
+		}
+	}
+
+	err = listeners.Commit(ctx)
+	if err != nil {
+		glog.Errorf("Commit listeners of gateway %s failed: %v", key, err)
+		applied.Listeners = before
+		for _, l := range gw.Spec.Listeners {
+			if res := plan.listeners[l.Name]; res != nil && res.acceptedReason == "" {
+				res.programErr = err
+			}
+		}
+	}
+
+	c.cleanupRoutePools(gw.Namespace, controllerName, plan)
+	gw = c.saveState(gw, applied)
+	c.updateGatewayStatus(gw, vip, "", "", plan)
+	c.updateRouteStatus(controllerName, plan)
+}
+
+func (c *GatewayController)teardown(key string, state *gatewayState) {
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	vsKind, _ := gatewayKinds(state.ControllerName)
+	drv, err := c.provider(state, vsKind)
+	if err != nil {
+		glog.Errorf("Get driver of gateway %s failed: %v", key, err)
+	} else {
+		ctx, cancel := deviceContext()
+		defer cancel()
+		listeners := batch(drv)
+		for port, cur := range state.Listeners {
+			err := c.deleteListener(ctx, listeners, namespace, name, cur)
+			if err != nil {
+				glog.Errorf("Delete listener %d of gateway %s failed: %v", port, key, err)
+			}
+		}
+		commit(ctx, listeners)
+	}
+	utils.ReleaseIpAddr(namespace, state.VIP)
+	delete(c.applied, key)
+}
+
+// ensureVip returns the vip of the Gateway: the IPAddress of spec.addresses,
+// the address published in the status or a new one from the ipam.
+func (c *GatewayController)ensureVip(gw *gwv1.Gateway, applied *gatewayState)(string, error){
+	want := ""
+	for _, addr := range gw.Spec.Addresses {
+		if addr.Type == "" || addr.Type == gwv1.ADDRESSTYPEIP {
+			want = addr.Value
+			break
+		}
+	}
+	if applied != nil && (want == "" || want == applied.VIP) {
+		return applied.VIP, nil
+	}
+	for _, addr := range gw.Status.Addresses {
+		if addr.Value != "" && (want == "" || want == addr.Value) {
+			return addr.Value, nil
+		}
+	}
+
+	subnet := c.subnet
+	if annotation, ok := gw.Annotations[ServiceSubnetAnnotation]; ok {
+		subnet = annotation
+	}
+	if want != "" {
+		return want, utils.CreatePortFromIp(gw.Namespace, want, subnet)
+	}
+	return utils.AllocIpAddrFromSubnet(gw.Namespace, subnet)
+}
+
+func supportsProtocol(l4 bool, protocol string)bool{
+	switch protocol {
+		case gwv1.PROTOCOLHTTP, gwv1.PROTOCOLHTTPS:
+			return true
+		case gwv1.PROTOCOLTCP:
+			return l4
+	}
+	return false
+}
+
+// plan translates the listeners of the Gateway and the routes attached to it,
+// the pools of the routes are created on the way.
+func (c *GatewayController)plan(gw *gwv1.Gateway, state *gatewayState, l4 bool)*gatewayPlan{
+	plan := &gatewayPlan{
+		state		: state,
+		ports		: make(map[int32]*listenerState),
+		listeners	: make(map[string]*listenerResult),
+		pools		: make(map[string]map[string]bool),
+		devicePools	: make(map[string]string),
+	}
+
+	for _, l := range gw.Spec.Listeners {
+		res := &listenerResult{}
+		plan.listeners[l.Name] = res
+		if !supportsProtocol(l4, l.Protocol) {
+			res.acceptedReason = gwv1.REASONUNSUPPORTEDPROTOCOL
+			res.acceptedMsg = fmt.Sprintf("protocol %s is not supported by %s", l.Protocol, state.ControllerName)
+			continue
+		}
+		ls, ok := plan.ports[l.Port]
+		if ok && ls.Protocol != l.Protocol {
+			res.acceptedReason = gwv1.REASONPROTOCOLCONFLICT
+			res.acceptedMsg = fmt.Sprintf("port %d is already used with protocol %s", l.Port, ls.Protocol)
+			continue
+		}
+		if !ok {
+			ls = newListenerState(l.Protocol, l.Port)
+			plan.ports[l.Port] = ls
+		}
+		if l.Protocol == gwv1.PROTOCOLHTTPS {
+			certName, cert, reason, msg := listenerCert(gw, l, len(ls.Certs) == 0)
+			if reason != "" {
+				res.refsReason, res.refsMsg = reason, msg
+				continue
+			}
+			ls.Certs[certName] = cert
+		}
+	}
+
+	for _, obj := range c.httpRouteStore.List() {
+		route := obj.(*gwv1.HTTPRoute)
+		c.planRoute(plan, gw, kindHTTPRoute, &route.ObjectMeta, route.Spec.ParentRefs,
+			func(l gwv1.Listener, ls *listenerState, result *routeResult) {
+				hosts := routeHosts(l.Hostname, route.Spec.Hostnames)
+				for _, rule := range route.Spec.Rules {
+					pool, reason, err := c.routePool(plan, kindHTTPRoute, &route.ObjectMeta, rule.BackendRefs)
+					if err != nil {
+						result.refsReason, result.refsMsg = reason, err.Error()
+						continue
+					}
+					for _, path := range rulePaths(rule) {
+						for _, host := range hosts {
+							ls.Rules[gatewayRule{Host : host, Path : path, Pool : pool}] = true
+						}
+					}
+				}
+			}, func(l gwv1.Listener)bool{
+				return (l.Protocol == gwv1.PROTOCOLHTTP || l.Protocol == gwv1.PROTOCOLHTTPS) &&
+					len(routeHosts(l.Hostname, route.Spec.Hostnames)) > 0
+			})
+	}
+
+	for _, obj := range c.tcpRouteStore.List() {
+		route := obj.(*gwv1.TCPRoute)
+		c.planRoute(plan, gw, kindTCPRoute, &route.ObjectMeta, route.Spec.ParentRefs,
+			func(l gwv1.Listener, ls *listenerState, result *routeResult) {
+				for _, rule := range route.Spec.Rules {
+					pool, reason, err := c.routePool(plan, kindTCPRoute, &route.ObjectMeta, rule.BackendRefs)
+					if err != nil {
+						result.refsReason, result.refsMsg = reason, err.Error()
+						continue
+					}
+					if ls.Pool == "" {
+						ls.Pool = pool
+					} else if ls.Pool != pool {
+						glog.Warningf("Listener %s of gateway %s/%s already has pool %s, ignore %s",
+							l.Name, gw.Namespace, gw.Name, ls.Pool, pool)
+					}
+				}
+			}, func(l gwv1.Listener)bool{
+				return l.Protocol == gwv1.PROTOCOLTCP
+			})
+	}
+
+	return plan
+}
+
+// planRoute attaches a route to the matching listeners of the Gateway, attach
+// adds its rules to the listener.
+func (c *GatewayController)planRoute(plan *gatewayPlan, gw *gwv1.Gateway, kind string,
+	route *meta_v1.ObjectMeta, parentRefs []gwv1.ParentReference,
+	attach func(gwv1.Listener, *listenerState, *routeResult), matches func(gwv1.Listener)bool) {
+	for _, ref := range parentRefs {
+		refNamespace := ref.Namespace
+		if refNamespace == "" {
+			refNamespace = route.Namespace
+		}
+		if (ref.Kind != "" && ref.Kind != "Gateway") || refNamespace != gw.Namespace || ref.Name != gw.Name {
+			continue
+		}
+		result := &routeResult{
+			kind		: kind,
+			namespace	: route.Namespace,
+			name		: route.Name,
+			parentRef	: ref,
+			reason		: gwv1.REASONNOMATCHINGPARENT,
+			message		: "no listener matches the route",
+		}
+		plan.routes = append(plan.routes, result)
+		// listeners only allow routes of their own namespace.
+		if route.Namespace != gw.Namespace {
+			result.reason = gwv1.REASONNOTALLOWEDBYLISTENERS
+			result.message = "routes of other namespaces are not allowed"
+			continue
+		}
+		for _, l := range gw.Spec.Listeners {
+			if ref.SectionName != "" && ref.SectionName != l.Name {
+				continue
+			}
+			lres := plan.listeners[l.Name]
+			if lres.acceptedReason != "" || !matches(l) {
+				continue
+			}
+			result.attached = true
+			lres.attachedRoutes++
+			attach(l, plan.ports[l.Port], result)
+		}
+		if result.attached {
+			label := routeLabel(kind, route.Name)
+			if _, ok := plan.pools[label]; !ok {
+				plan.pools[label] = make(map[string]bool)
+			}
+		}
+	}
+}
+
+func routeLabel(kind, name string)string{
+	return strings.ToLower(kind) + "." + name
+}
+
+// listenerCert validates the certificate of an HTTPS listener.
+func listenerCert(gw *gwv1.Gateway, l gwv1.Listener, isDefault bool)(string, gatewayCert, string, string){
+	if l.TLS == nil || len(l.TLS.CertificateRefs) == 0 {
+		return "", gatewayCert{}, gwv1.REASONINVALIDCERTIFICATEREF, "HTTPS listener needs a certificateRef"
+	}
+	ref := l.TLS.CertificateRefs[0]
+	if (ref.Kind != "" && ref.Kind != "Secret") || ref.Group != "" {
+		return "", gatewayCert{}, gwv1.REASONINVALIDCERTIFICATEREF, fmt.Sprintf("%s is not a Secret", ref.Name)
+	}
+	if ref.Namespace != "" && ref.Namespace != gw.Namespace {
+		return "", gatewayCert{}, gwv1.REASONREFNOTPERMITTED, "secrets of other namespaces are not allowed"
+	}
+	deviceName := utils.GenerateGatewayListenerName(gw.Namespace, gw.Name, l.Port)
+	certName := utils.GenerateCertName(deviceName, gw.Namespace + "/" + ref.Name)
+	return certName, gatewayCert{
+		Namespace	: gw.Namespace,
+		SecretName	: ref.Name,
+		ServerName	: l.Hostname,
+		Default		: isDefault,
+	}, "", ""
+}
+
+// routeHosts intersects the hostname of a listener with the hostnames of a
+// route, "" stands for any host.
+func routeHosts(listenerHost string, hostnames []string)[]string{
+	if len(hostnames) == 0 {
+		return []string{listenerHost}
+	}
+	hosts := []string{}
+	seen := make(map[string]bool)
+	for _, host := range hostnames {
+		match := ""
+		switch {
+			case listenerHost == "" || host == listenerHost:
+				match = host
+			case strings.HasPrefix(listenerHost, "*.") && strings.HasSuffix(host, listenerHost[1:]):
+				match = host
+			case strings.HasPrefix(host, "*.") && strings.HasSuffix(listenerHost, host[1:]):
+				match = listenerHost
+		}
+		if match != "" && !seen[match] {
+			seen[match] = true
+			hosts = append(hosts, match)
+		}
+	}
+	return hosts
+}
+
+// rulePaths returns the path prefixes of a rule, "" matches every path.
+func rulePaths(rule gwv1.HTTPRouteRule)[]string{
+	if len(rule.Matches) == 0 {
+		return []string{""}
+	}
+	paths := []string{}
+	for _, match := range rule.Matches {
+		if match.Path == nil || match.Path.Value == "/" {
+			paths = append(paths, "")
+			continue
+		}
+		paths = append(paths, match.Path.Value)
+	}
+	return paths
+}
+
+// routePool ensures the pool of the first backend of a rule and returns its
+// name on the device, or the ResolvedRefs reason of the failure.
+func (c *GatewayController)routePool(plan *gatewayPlan, kind string,
+	route *meta_v1.ObjectMeta, refs []gwv1.BackendRef)(string, string, error){
+	if len(refs) == 0 {
+		return "", gwv1.REASONINVALIDKIND, fmt.Errorf("rule has no backendRefs")
+	}
+	ref := refs[0]
+	if (ref.Kind != "" && ref.Kind != "Service") || ref.Group != "" {
+		return "", gwv1.REASONINVALIDKIND, fmt.Errorf("backend %s is not a Service", ref.Name)
+	}
+	if ref.Namespace != "" && ref.Namespace != route.Namespace {
+		return "", gwv1.REASONREFNOTPERMITTED, fmt.Errorf("services of other namespaces are not allowed")
+	}
+	if ref.Port == 0 {
+		return "", gwv1.REASONINVALIDKIND, fmt.Errorf("backend %s has no port", ref.Name)
+	}
+
+	label := routeLabel(kind, route.Name)
+	name := strings.ToLower(route.Name + "-" + ref.Name + "-" + strconv.Itoa(int(ref.Port)))
+	if _, ok := plan.pools[label]; !ok {
+		plan.pools[label] = make(map[string]bool)
+	}
+	plan.pools[label][name] = true
+
+	key := route.Namespace + "/" + name
+	if poolName, ok := plan.devicePools[key]; ok {
+		return poolName, "", nil
+	}
+	poolName, err := c.ensurePool(plan.state, kind, route, name, ref)
+	if err != nil {
+		return "", gwv1.REASONPENDING, err
+	}
+	plan.devicePools[key] = poolName
+	return poolName, "", nil
+}
+
+// ensurePool creates the pool object of a backend and the pool on the device,
+// so rules can use it before the pool controllers catch up. The pools are in
+// the partition of the Gateway.
+func (c *GatewayController)ensurePool(state *gatewayState, kind string, route *meta_v1.ObjectMeta,
+	name string, ref gwv1.BackendRef)(string, error){
+	meta := meta_v1.ObjectMeta{
+		Name		: name,
+		Namespace	: route.Namespace,
+		Labels		: map[string]string{RouteLabel : routeLabel(kind, route.Name)},
+		OwnerReferences	: []meta_v1.OwnerReference{
+			*meta_v1.NewControllerRef(route, gwv1.SchemeGroupVersion.WithKind(kind)),
+		},
+	}
+	if state.Partitioned {
+		meta.Annotations = map[string]string{utils.F5PartitionAnnotation : state.Partition}
+	}
+	protocol := ""
+	if kind == kindTCPRoute {
+		protocol = lbv1.PROTOCOLTCP
+	}
+
+	var poolName string
+	if state.ControllerName == gwv1.CONTROLLERF5 {
+		poolName = utils.GeneratePoolNameEXP(route.Namespace, name)
+		poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, route.Namespace)
+		_, err := poolclient.Get(name)
+		if err == nil {
+			return poolName, nil
+		}
+		if !errors.IsNotFound(err) {
+			return "", err
+		}
+		_, err = poolclient.Create(&crdv1.ExternalNatPool{
+			ObjectMeta	: meta,
+			Spec		: crdv1.ExternalNatPoolSpec{
+				Method		: driver.METHODROUNDROBIN,
+				Protocol	: protocol,
+				ServiceRef	: &crdv1.ServiceRef{
+					Name	: ref.Name,
+					Port	: strconv.Itoa(int(ref.Port)),
+				},
+				DeviceRef	: state.Device,
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+	} else {
+		poolName = utils.GeneratePoolNameCALBP(route.Namespace, name)
+		poolclient := crdclient.CALBPoolClient(c.lbClient, c.lbScheme, route.Namespace)
+		_, err := poolclient.Get(name)
+		if err == nil {
+			return poolName, nil
+		}
+		if !errors.IsNotFound(err) {
+			return "", err
+		}
+		_, err = poolclient.Create(&lbv1.CAppLoadBalancePool{
+			ObjectMeta	: meta,
+			Spec		: lbv1.CAppLoadBalancePoolSpec{
+				Method		: driver.METHODROUNDROBIN,
+				Protocol	: protocol,
+				ServiceRef	: &lbv1.ServiceRef{
+					Name	: ref.Name,
+					Port	: strconv.Itoa(int(ref.Port)),
+				},
+				DeviceRef	: state.Device,
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	_, poolKind := gatewayKinds(state.ControllerName)
+	drv, err := c.provider(state, poolKind)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	err = retryDevice(func()error{
+		return drv.CreatePool(ctx, driver.Pool{
+			Name		: poolName,
+			Method		: driver.METHODROUNDROBIN,
+			Protocol	: protocol,
+		})
+	})
+	if driver.IsAlreadyExists(err) {
+		err = nil
+	}
+	return poolName, err
+}
+
+// cleanupRoutePools removes the pools the attached routes no longer use, the
+// rules using them are already gone.
+func (c *GatewayController)cleanupRoutePools(namespace string, controllerName string, plan *gatewayPlan) {
+	for label, used := range plan.pools {
+		opts := meta_v1.ListOptions{
+			LabelSelector : labels.SelectorFromSet(labels.Set{RouteLabel : label}).String(),
+		}
+		names := []string{}
+		if controllerName == gwv1.CONTROLLERF5 {
+			poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, namespace)
+			pools, err := poolclient.List(opts)
+			if err != nil {
+				glog.Errorf("List pools of %s failed: %v", label, err)
+				continue
+			}
+			for _, pool := range pools.Items {
+				names = append(names, pool.Name)
+			}
+		} else {
+			poolclient := crdclient.CALBPoolClient(c.lbClient, c.lbScheme, namespace)
+			pools, err := poolclient.List(opts)
+			if err != nil {
+				glog.Errorf("List pools of %s failed: %v", label, err)
+				continue
+			}
+			for _, pool := range pools.Items {
+				names = append(names, pool.Name)
+			}
+		}
+
+		for _, name := range names {
+			if used[name] {
+				continue
+			}
+			glog.V(2).Infof("Remove pool %s/%s of %s", namespace, name, label)
+			var err error
+			if controllerName == gwv1.CONTROLLERF5 {
+				err = crdclient.PoolClient(c.crdClient, c.crdScheme, namespace).Delete(name, &meta_v1.DeleteOptions{})
+			} else {
+				err = crdclient.CALBPoolClient(c.lbClient, c.lbScheme, namespace).Delete(name, &meta_v1.DeleteOptions{})
+			}
+			if err != nil && !errors.IsNotFound(err) {
+				glog.Errorf("Delete pool %s/%s failed: %v", namespace, name, err)
+			}
+		}
+	}
+}
+
+// applyListener brings the virtual server of a port to want.
+func (c *GatewayController)applyListener(ctx context.Context, drv driver.Provider, gw *gwv1.Gateway, state *gatewayState, want *listenerState)error{
+	vsName := utils.GenerateGatewayListenerName(gw.Namespace, gw.Name, want.Port)
+	cur, ok := state.Listeners[want.Port]
+	if !ok {
+		vs := driver.VirtualServer{
+			Name	: vsName,
+			Mode	: driver.MODEHTTP,
+			IP		: state.VIP,
+			Port	: strconv.Itoa(int(want.Port)),
+			TLS		: want.Protocol == gwv1.PROTOCOLHTTPS,
+		}
+		if want.Protocol == gwv1.PROTOCOLTCP {
+			vs.Mode, vs.Protocol = driver.MODEL4, "tcp"
+		}
+		err := retryDevice(func()error{
+			return drv.CreateVirtualServer(ctx, vs)
+		})
+		if err != nil && !driver.IsAlreadyExists(err) {
+			return err
+		}
+		cur = newListenerState(want.Protocol, want.Port)
+		state.Listeners[want.Port] = cur
+	}
+	return c.applyListenerConfig(ctx, drv, vsName, cur, want)
+}
+
+// applyListenerConfig changes the certificates, rules and pool of the virtual
+// server vsName from cur to want, cur follows what is done.
+func (c *GatewayController)applyListenerConfig(ctx context.Context, drv driver.Provider, vsName string, cur, want *listenerState)error{
+	for certName, cert := range cur.Certs {
+		if wantCert, ok := want.Certs[certName]; !ok || wantCert != cert {
+			err := drv.RemoveCert(ctx, vsName, driver.Cert{Name : certName})
+			if err != nil && !driver.IsNotFound(err) {
+				return err
+			}
+			delete(cur.Certs, certName)
+		}
+	}
+	for certName, cert := range want.Certs {
+		if _, ok := cur.Certs[certName]; ok {
+			continue
+		}
+		crt, key, err := utils.GetTLSSecret(c.client, cert.Namespace, cert.SecretName)
+		if err != nil {
+			return err
+		}
+		err = drv.AddCert(ctx, vsName, driver.Cert{
+			Name		: certName,
+			ServerName	: cert.ServerName,
+			Default		: cert.Default,
+			Cert		: crt,
+			Key			: key,
+			Namespace	: cert.Namespace,
+			Secret		: cert.SecretName,
+		})
+		if err != nil {
+			return err
+		}
+		cur.Certs[certName] = cert
+	}
+
+	for rule, _ := range cur.Rules {
+		if !want.Rules[rule] {
+			err := drv.RemoveRule(ctx, vsName, providerGatewayRule(rule))
+			if err != nil && !driver.IsNotFound(err) {
+				return err
+			}
+			delete(cur.Rules, rule)
+		}
+	}
+	for rule, _ := range want.Rules {
+		if !cur.Rules[rule] {
+			err := drv.AddRule(ctx, vsName, providerGatewayRule(rule))
+			if err != nil {
+				return err
+			}
+			cur.Rules[rule] = true
+		}
+	}
+
+	if cur.Pool != want.Pool {
+		if cur.Pool != "" {
+			err := drv.UnsetDefaultPool(ctx, vsName, cur.Pool)
+			if err != nil && !driver.IsNotFound(err) {
+				return err
+			}
+			cur.Pool = ""
+		}
+		if want.Pool != "" {
+			err := drv.SetDefaultPool(ctx, vsName, want.Pool)
+			if err != nil {
+				return err
+			}
+			cur.Pool = want.Pool
+		}
+	}
+	return nil
+}
+
+func providerGatewayRule(rule gatewayRule)driver.Rule{
+	return driver.Rule{
+		Host	: rule.Host,
+		Path	: rule.Path,
+		Pool	: rule.Pool,
+	}
+}
+
+func (c *GatewayController)deleteListener(ctx context.Context, drv driver.Provider, namespace string, name string, cur *listenerState)error{
+	vsName := utils.GenerateGatewayListenerName(namespace, name, cur.Port)
+	err := c.applyListenerConfig(ctx, drv, vsName, cur, newListenerState(cur.Protocol, cur.Port))
+	if err != nil {
+		glog.Errorf("Clean virtual server %s failed: %v", vsName, err)
+	}
+	err = retryDevice(func()error{
+		return drv.DeleteVirtualServer(ctx, vsName)
+	})
+	if driver.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func newCondition(condType string, failReason string, okReason string, message string, generation int64)gwv1.Condition{
+	status := gwv1.CONDITIONTRUE
+	reason := okReason
+	if failReason != "" {
+		status = gwv1.CONDITIONFALSE
+		reason = failReason
+	}
+	return gwv1.Condition{
+		Type				: condType,
+		Status				: status,
+		ObservedGeneration	: generation,
+		LastTransitionTime	: meta_v1.Now(),
+		Reason				: reason,
+		Message				: message,
+	}
+}
+
+// mergeConditions keeps the transition time of the conditions whose status
+// did not change, so that unchanged statuses are not written again.
+func mergeConditions(old, conds []gwv1.Condition)[]gwv1.Condition{
+	for i, cond := range conds {
+		for _, oldCond := range old {
+			if oldCond.Type == cond.Type && oldCond.Status == cond.Status {
+				conds[i].LastTransitionTime = oldCond.LastTransitionTime
+			}
+		}
+	}
+	return conds
+}
+
+func (c *GatewayController)updateGatewayStatus(gw *gwv1.Gateway, vip string, failReason string, message string,
+	plan *gatewayPlan) {
+	newGw := gw.DeepCopy()
+	newGw.Status = gwv1.GatewayStatus{}
+	if vip != "" {
+		newGw.Status.Addresses = []gwv1.GatewayAddress{gwv1.GatewayAddress{Type : gwv1.ADDRESSTYPEIP, Value : vip}}
+	}
+
+	programmedReason := ""
+	programmedMsg := ""
+	if plan != nil {
+		for _, l := range gw.Spec.Listeners {
+			res := plan.listeners[l.Name]
+			old := []gwv1.Condition{}
+			for _, oldStatus := range gw.Status.Listeners {
+				if oldStatus.Name == l.Name {
+					old = oldStatus.Conditions
+				}
+			}
+			programmed := ""
+			programMsg := ""
+			if res.acceptedReason != "" {
+				programmed, programMsg = res.acceptedReason, res.acceptedMsg
+			} else if res.programErr != nil {
+				programmed, programMsg = gwv1.REASONINVALID, res.programErr.Error()
+				programmedReason, programmedMsg = gwv1.REASONINVALID, res.programErr.Error()
+			}
+			newGw.Status.Listeners = append(newGw.Status.Listeners, gwv1.ListenerStatus{
+				Name			: l.Name,
+				AttachedRoutes	: res.attachedRoutes,
+				Conditions		: mergeConditions(old, []gwv1.Condition{
+					newCondition(gwv1.CONDITIONACCEPTED, res.acceptedReason, gwv1.REASONACCEPTED, res.acceptedMsg, gw.Generation),
+					newCondition(gwv1.CONDITIONRESOLVEDREFS, res.refsReason, gwv1.REASONRESOLVEDREFS, res.refsMsg, gw.Generation),
+					newCondition(gwv1.CONDITIONPROGRAMMED, programmed, gwv1.REASONPROGRAMMED, programMsg, gw.Generation),
+				}),
+			})
+		}
+	} else {
+		programmedReason, programmedMsg = failReason, message
+	}
+	newGw.Status.Conditions = mergeConditions(gw.Status.Conditions, []gwv1.Condition{
+		newCondition(gwv1.CONDITIONACCEPTED, failReason, gwv1.REASONACCEPTED, message, gw.Generation),
+		newCondition(gwv1.CONDITIONPROGRAMMED, programmedReason, gwv1.REASONPROGRAMMED, programmedMsg, gw.Generation),
+	})
+
+	if reflect.DeepEqual(gw.Status, newGw.Status) {
+		return
+	}
+	_, err := crdclient.GatewayClient(c.gwClient, c.gwScheme, gw.Namespace).UpdateStatus(newGw, gw.Name)
+	if err != nil {
+		glog.Errorf("Update status of gateway %s/%s failed: %v", gw.Namespace, gw.Name, err)
+	}
+}
+
+// updateRouteStatus writes the parent status of the routes for this Gateway,
+// the entries of other parents are kept.
+func (c *GatewayController)updateRouteStatus(controllerName string, plan *gatewayPlan) {
+	for _, result := range plan.routes {
+		store := c.httpRouteStore
+		if result.kind == kindTCPRoute {
+			store = c.tcpRouteStore
+		}
+		obj, exists, err := store.GetByKey(result.namespace + "/" + result.name)
+		if err != nil || !exists {
+			continue
+		}
+
+		var status gwv1.RouteStatus
+		var generation int64
+		switch route := obj.(type) {
+			case *gwv1.HTTPRoute:
+				status, generation = route.Status, route.Generation
+			case *gwv1.TCPRoute:
+				status, generation = route.Status, route.Generation
+		}
+
+		acceptedReason := ""
+		if !result.attached {
+			acceptedReason = result.reason
+		}
+		message := ""
+		if !result.attached {
+			message = result.message
+		}
+		parent := gwv1.RouteParentStatus{
+			ParentRef		: result.parentRef,
+			ControllerName	: controllerName,
+		}
+		parents := []gwv1.RouteParentStatus{}
+		for _, old := range status.Parents {
+			if old.ControllerName == controllerName && reflect.DeepEqual(old.ParentRef, result.parentRef) {
+				parent.Conditions = old.Conditions
+				continue
+			}
+			parents = append(parents, old)
+		}
+		parent.Conditions = mergeConditions(parent.Conditions, []gwv1.Condition{
+			newCondition(gwv1.CONDITIONACCEPTED, acceptedReason, gwv1.REASONACCEPTED, message, generation),
+			newCondition(gwv1.CONDITIONRESOLVEDREFS, result.refsReason, gwv1.REASONRESOLVEDREFS, result.refsMsg, generation),
+		})
+		parents = append(parents, parent)
+		newStatus := gwv1.RouteStatus{Parents : parents}
+		if reflect.DeepEqual(status, newStatus) {
+			continue
+		}
+
+		switch route := obj.(type) {
+			case *gwv1.HTTPRoute:
+				newRoute := route.DeepCopy()
+				newRoute.Status = newStatus
+				_, err = crdclient.HTTPRouteClient(c.gwClient, c.gwScheme, route.Namespace).UpdateStatus(newRoute, route.Name)
+			case *gwv1.TCPRoute:
+				newRoute := route.DeepCopy()
+				newRoute.Status = newStatus
+				_, err = crdclient.TCPRouteClient(c.gwClient, c.gwScheme, route.Namespace).UpdateStatus(newRoute, route.Name)
+		}
+		if err != nil {
+			glog.Errorf("Update status of %s %s/%s failed: %v", result.kind, result.namespace, result.name, err)
+		}
+	}
+}
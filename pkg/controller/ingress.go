@@ -0,0 +1,543 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	crdclient 	"github.com/sak0/ygw/pkg/client"
+	crdv1 		"github.com/sak0/ygw/pkg/apis/external/v1"
+	lbv1 		"github.com/sak0/ygw/pkg/apis/loadbalance/v1"
+	driver 		"github.com/sak0/ygw/pkg/drivers"
+)
+
+const (
+	IngressClassAnnotation			= "kubernetes.io/ingress.class"
+	// IngressVipAnnotation is required on f5, on citrix the vip is allocated
+	// from IngressSubnetAnnotation when it is not set.
+	IngressVipAnnotation			= "ygw.yonghui.cn/vip"
+	IngressSubnetAnnotation			= "ygw.yonghui.cn/subnet"
+	// IngressServiceModeAnnotation selects the serviceRef mode of the pools,
+	// Endpoints or NodePort.
+	IngressServiceModeAnnotation	= "ygw.yonghui.cn/service-mode"
+	// IngressDeviceAnnotation is the LoadBalancerDevice of the objects, the
+	// device of the environment without it.
+	IngressDeviceAnnotation			= "ygw.yonghui.cn/device"
+	// IngressLabel marks the objects managed for an Ingress with its name.
+	IngressLabel					= "ygw.yonghui.cn/ingress"
+	// IngressNamespaceLabel marks the CAppLoadBalancePools, which live in the
+	// default namespace, with the namespace of their Ingress.
+	IngressNamespaceLabel			= "ygw.yonghui.cn/ingress-namespace"
+)
+
+// IngressController translates the Ingresses of its class into
+// CAppLoadBalance/CAppLoadBalancePool objects, or AppExternalNat/
+// ExternalNatPool on f5, owned by the Ingress. The controllers of those
+// objects configure the device. The CAppLoadBalancePools are in the default
+// namespace, where the CAppLoadBalances look for them, and are removed with
+// the Ingress by this controller.
+type IngressController struct {
+	client			kubernetes.Interface
+	crdClient		*rest.RESTClient
+	crdScheme		*runtime.Scheme
+	lbClient		*rest.RESTClient
+	lbScheme		*runtime.Scheme
+
+	ingressClass	string
+	provider		string
+
+	ingressStore		cache.Store
+	ingressController	cache.Controller
+	calbController		cache.Controller
+}
+
+func NewIngressController(client kubernetes.Interface, crdClient *rest.RESTClient, crdScheme *runtime.Scheme,
+					lbClient *rest.RESTClient, lbScheme *runtime.Scheme,
+					ingressClass string, provider string)(*IngressController, error) {
+	if provider != driver.CITRIXLBPROVIDER && provider != driver.F5GWPROVIDER {
+		return nil, fmt.Errorf("unknown ingress provider %s", provider)
+	}
+	ingctr := &IngressController{
+		client		: client,
+		crdClient	: crdClient,
+		crdScheme	: crdScheme,
+		lbClient	: lbClient,
+		lbScheme	: lbScheme,
+		ingressClass	: ingressClass,
+		provider		: provider,
+	}
+
+	ingressListWatch := cache.NewListWatchFromClient(client.ExtensionsV1beta1().RESTClient(),
+		"ingresses", meta_v1.NamespaceAll, fields.Everything())
+	ingressStore, ingressController := cache.NewInformer(
+		ingressListWatch,
+		&extensions.Ingress{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: ingctr.onIngressAdd,
+			UpdateFunc: ingctr.onIngressUpdate,
+			DeleteFunc: ingctr.onIngressDel,
+		},
+	)
+	ingctr.ingressStore = ingressStore
+	ingctr.ingressController = ingressController
+
+	// the vip of a CAppLoadBalance is known once its controller allocated it.
+	calbListWatch := cache.NewListWatchFromClient(lbClient,
+		lbv1.CALBPlural, meta_v1.NamespaceAll, fields.Everything())
+	_, calbController := cache.NewInformer(
+		calbListWatch,
+		&lbv1.CAppLoadBalance{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: ingctr.onCALBChange,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				ingctr.onCALBChange(newObj)
+			},
+		},
+	)
+	ingctr.calbController = calbController
+
+	return ingctr, nil
+}
+
+func (c *IngressController)Run(ctx <-chan struct{}) {
+	glog.V(2).Infof("Ingress Controller starting...")
+	go c.ingressController.Run(ctx)
+	if c.provider == driver.CITRIXLBPROVIDER {
+		go c.calbController.Run(ctx)
+	}
+	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
+		return c.hasSynced(), nil
+	})
+	if !c.hasSynced() {
+		glog.Errorf("ingress informer initial sync timeout")
+		os.Exit(1)
+	}
+}
+
+func (c *IngressController)hasSynced()bool{
+	if c.provider == driver.CITRIXLBPROVIDER && !c.calbController.HasSynced() {
+		return false
+	}
+	return c.ingressController.HasSynced()
+}
+
+func (c *IngressController)isOurs(ing *extensions.Ingress)bool{
+	return ing.Annotations[IngressClassAnnotation] == c.ingressClass
+}
+
+func (c *IngressController)onIngressAdd(obj interface{}) {
+	glog.V(3).Infof("Add-Ingress: %v", obj)
+	ing := obj.(*extensions.Ingress)
+	if !c.isOurs(ing) {
+		return
+	}
+	c.syncIngress(ing)
+}
+
+func (c *IngressController)onIngressUpdate(oldObj, newObj interface{}) {
+	glog.V(3).Infof("Update-Ingress: %v -> %v", oldObj, newObj)
+	oldIng := oldObj.(*extensions.Ingress)
+	newIng := newObj.(*extensions.Ingress)
+	if !c.isOurs(newIng) {
+		if c.isOurs(oldIng) {
+			glog.V(2).Infof("Ingress %s/%s left class %s", newIng.Namespace, newIng.Name, c.ingressClass)
+			c.deleteManaged(oldIng)
+		}
+		return
+	}
+	if reflect.DeepEqual(oldIng.Spec, newIng.Spec) &&
+		reflect.DeepEqual(oldIng.Annotations, newIng.Annotations) {
+		return
+	}
+	c.syncIngress(newIng)
+}
+
+// onIngressDel removes the objects of the Ingress, the garbage collector
+// can't for the CAppLoadBalancePools in another namespace.
+func (c *IngressController)onIngressDel(obj interface{}) {
+	glog.V(3).Infof("Del-Ingress: %v", obj)
+	ing := obj.(*extensions.Ingress)
+	if !c.isOurs(ing) {
+		return
+	}
+	c.deleteManaged(ing)
+}
+
+func (c *IngressController)syncIngress(ing *extensions.Ingress) {
+	var err error
+	switch c.provider {
+		case driver.CITRIXLBPROVIDER:
+			err = c.syncCALB(ing)
+		case driver.F5GWPROVIDER:
+			err = c.syncAEX(ing)
+	}
+	if err != nil {
+		glog.Errorf("Sync ingress %s/%s failed: %v", ing.Namespace, ing.Name, err)
+	}
+}
+
+// ingressPoolName names the pool of one Service port of the Ingress.
+func ingressPoolName(ing *extensions.Ingress, backend extensions.IngressBackend)string{
+	return strings.ToLower(ing.Name + "-" + backend.ServiceName + "-" + backend.ServicePort.String())
+}
+
+// ingressCALBName names the CAppLoadBalance of the Ingress, the virtual
+// servers of Ingresses of the same name in other namespaces must not collide.
+func ingressCALBName(ing *extensions.Ingress)string{
+	return ing.Namespace + "-" + ing.Name
+}
+
+// ingressCALBPoolName names a CAppLoadBalancePool of the Ingress in the
+// default namespace.
+func ingressCALBPoolName(ing *extensions.Ingress, backend extensions.IngressBackend)string{
+	return ing.Namespace + "-" + ingressPoolName(ing, backend)
+}
+
+func ingressPort(ing *extensions.Ingress)string{
+	if len(ing.Spec.TLS) > 0 {
+		return "443"
+	}
+	return "80"
+}
+
+func (c *IngressController)objectMeta(ing *extensions.Ingress, name string)meta_v1.ObjectMeta{
+	return meta_v1.ObjectMeta{
+		Name		: name,
+		Namespace	: ing.Namespace,
+		Labels		: map[string]string{IngressLabel : ing.Name},
+		OwnerReferences	: []meta_v1.OwnerReference{
+			*meta_v1.NewControllerRef(ing, extensions.SchemeGroupVersion.WithKind("Ingress")),
+		},
+	}
+}
+
+// ingressBackends returns the backends of the Ingress by pool name.
+func ingressBackends(ing *extensions.Ingress)map[string]extensions.IngressBackend{
+	backends := make(map[string]extensions.IngressBackend)
+	if ing.Spec.Backend != nil {
+		backends[ingressPoolName(ing, *ing.Spec.Backend)] = *ing.Spec.Backend
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			backends[ingressPoolName(ing, path.Backend)] = path.Backend
+		}
+	}
+	return backends
+}
+
+// calbPoolMeta returns the metadata of a CAppLoadBalancePool of the Ingress,
+// it has no owner as it is in another namespace.
+func (c *IngressController)calbPoolMeta(ing *extensions.Ingress, name string)meta_v1.ObjectMeta{
+	return meta_v1.ObjectMeta{
+		Name		: name,
+		Namespace	: calbPoolNamespace,
+		Labels		: map[string]string{
+			IngressLabel			: ing.Name,
+			IngressNamespaceLabel	: ing.Namespace,
+		},
+	}
+}
+
+// ingressCALBPools returns the backends of the Ingress by the name of their
+// CAppLoadBalancePool.
+func ingressCALBPools(ing *extensions.Ingress)map[string]extensions.IngressBackend{
+	pools := make(map[string]extensions.IngressBackend)
+	for _, backend := range ingressBackends(ing) {
+		pools[ingressCALBPoolName(ing, backend)] = backend
+	}
+	return pools
+}
+
+func (c *IngressController)syncCALB(ing *extensions.Ingress)error{
+	backends := ingressCALBPools(ing)
+	poolclient := crdclient.CALBPoolClient(c.lbClient, c.lbScheme, calbPoolNamespace)
+	for poolName, backend := range backends {
+		pool := &lbv1.CAppLoadBalancePool{
+			ObjectMeta	: c.calbPoolMeta(ing, poolName),
+			Spec		: lbv1.CAppLoadBalancePoolSpec{
+				Method		: driver.METHODROUNDROBIN,
+				ServiceRef	: &lbv1.ServiceRef{
+					Name		: backend.ServiceName,
+					Namespace	: ing.Namespace,
+					Port		: backend.ServicePort.String(),
+					Mode		: ing.Annotations[IngressServiceModeAnnotation],
+				},
+				DeviceRef	: ing.Annotations[IngressDeviceAnnotation],
+			},
+		}
+		old, err := poolclient.Get(poolName)
+		if errors.IsNotFound(err) {
+			_, err = poolclient.Create(pool)
+		} else if err == nil && !reflect.DeepEqual(old.Spec, pool.Spec) {
+			old.Spec = pool.Spec
+			_, err = poolclient.Update(old, poolName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	calbName := ingressCALBName(ing)
+	calb := &lbv1.CAppLoadBalance{
+		ObjectMeta	: c.objectMeta(ing, calbName),
+		Spec		: lbv1.CAppLoadBalanceSpec{
+			IP		: ing.Annotations[IngressVipAnnotation],
+			Port	: ingressPort(ing),
+			Subnet	: ing.Annotations[IngressSubnetAnnotation],
+			DeviceRef	: ing.Annotations[IngressDeviceAnnotation],
+		},
+	}
+	if ing.Spec.Backend != nil {
+		calb.Spec.DefaultPool = ingressCALBPoolName(ing, *ing.Spec.Backend)
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		calbRule := lbv1.CAppLoadBalanceRule{Host : rule.Host}
+		for _, path := range rule.HTTP.Paths {
+			pathStr := path.Path
+			if pathStr == "" {
+				pathStr = "/"
+			}
+			calbRule.Paths = append(calbRule.Paths, lbv1.CAppLoadBalancePath{
+				Path	: pathStr,
+				Pool	: ingressCALBPoolName(ing, path.Backend),
+			})
+		}
+		calb.Spec.Rules = append(calb.Spec.Rules, calbRule)
+	}
+	for _, tls := range ing.Spec.TLS {
+		calb.Spec.TLS = append(calb.Spec.TLS, lbv1.CAppLoadBalanceTLS{
+			Hosts		: tls.Hosts,
+			SecretName	: tls.SecretName,
+		})
+	}
+
+	calbclient := crdclient.CALBClient(c.lbClient, c.lbScheme, ing.Namespace)
+	old, err := calbclient.Get(calbName)
+	if errors.IsNotFound(err) {
+		_, err = calbclient.Create(calb)
+	} else if err == nil {
+		// keep the vip allocated by the CAppLoadBalance controller.
+		if calb.Spec.IP == "" {
+			calb.Spec.IP = old.Spec.IP
+		}
+		if !reflect.DeepEqual(old.Spec, calb.Spec) {
+			old.Spec = calb.Spec
+			_, err = calbclient.Update(old, calbName)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.cleanupCALBPools(ing, backends)
+}
+
+func (c *IngressController)cleanupCALBPools(ing *extensions.Ingress, backends map[string]extensions.IngressBackend)error{
+	poolclient := crdclient.CALBPoolClient(c.lbClient, c.lbScheme, calbPoolNamespace)
+	selector := labels.SelectorFromSet(labels.Set{
+		IngressLabel			: ing.Name,
+		IngressNamespaceLabel	: ing.Namespace,
+	}).String()
+	pools, err := poolclient.List(meta_v1.ListOptions{LabelSelector : selector})
+	if err != nil {
+		return err
+	}
+	for _, pool := range pools.Items {
+		if _, ok := backends[pool.Name]; ok {
+			continue
+		}
+		glog.V(2).Infof("Remove stale pool %s/%s of ingress %s", pool.Namespace, pool.Name, ing.Name)
+		err = poolclient.Delete(pool.Name, &meta_v1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *IngressController)syncAEX(ing *extensions.Ingress)error{
+	vip := ing.Annotations[IngressVipAnnotation]
+	if vip == "" {
+		return fmt.Errorf("annotation %s is required on f5", IngressVipAnnotation)
+	}
+
+	backends := ingressBackends(ing)
+	poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, ing.Namespace)
+	for poolName, backend := range backends {
+		pool := &crdv1.ExternalNatPool{
+			ObjectMeta	: c.objectMeta(ing, poolName),
+			Spec		: crdv1.ExternalNatPoolSpec{
+				Method		: driver.METHODROUNDROBIN,
+				ServiceRef	: &crdv1.ServiceRef{
+					Name	: backend.ServiceName,
+					Port	: backend.ServicePort.String(),
+					Mode	: ing.Annotations[IngressServiceModeAnnotation],
+				},
+				DeviceRef	: ing.Annotations[IngressDeviceAnnotation],
+			},
+		}
+		old, err := poolclient.Get(poolName)
+		if errors.IsNotFound(err) {
+			_, err = poolclient.Create(pool)
+		} else if err == nil && !reflect.DeepEqual(old.Spec, pool.Spec) {
+			old.Spec = pool.Spec
+			_, err = poolclient.Update(old, poolName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	aex := &crdv1.AppExternalNat{
+		ObjectMeta	: c.objectMeta(ing, ing.Name),
+		Spec		: crdv1.AppExternalNatSpec{
+			IP			: vip,
+			Port		: ingressPort(ing),
+			Protocol	: "tcp",
+			DeviceRef	: ing.Annotations[IngressDeviceAnnotation],
+		},
+	}
+	if ing.Spec.Backend != nil {
+		aex.Spec.DefaultPool = ingressPoolName(ing, *ing.Spec.Backend)
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		if rule.Host == "" {
+			glog.Warningf("Ingress %s/%s: rules without host are not supported on f5, use the default backend",
+				ing.Namespace, ing.Name)
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			pathStr := path.Path
+			if pathStr == "/" {
+				pathStr = ""
+			}
+			aex.Spec.Rules = append(aex.Spec.Rules, crdv1.AppExternalNatRule{
+				Host		: rule.Host,
+				Path		: pathStr,
+				PoolName	: ingressPoolName(ing, path.Backend),
+			})
+		}
+	}
+	for _, tls := range ing.Spec.TLS {
+		aex.Spec.TLS = append(aex.Spec.TLS, crdv1.AppExternalNatTLS{
+			Hosts		: tls.Hosts,
+			SecretName	: tls.SecretName,
+		})
+	}
+
+	aexclient := crdclient.AexClient(c.crdClient, c.crdScheme, ing.Namespace)
+	old, err := aexclient.Get(ing.Name)
+	if errors.IsNotFound(err) {
+		_, err = aexclient.Create(aex)
+	} else if err == nil && !reflect.DeepEqual(old.Spec, aex.Spec) {
+		old.Spec = aex.Spec
+		_, err = aexclient.Update(old, ing.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = c.cleanupEXPools(ing, backends)
+	if err != nil {
+		return err
+	}
+	return c.updateIngressStatus(ing, vip)
+}
+
+func (c *IngressController)cleanupEXPools(ing *extensions.Ingress, backends map[string]extensions.IngressBackend)error{
+	poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, ing.Namespace)
+	selector := labels.SelectorFromSet(labels.Set{IngressLabel : ing.Name}).String()
+	pools, err := poolclient.List(meta_v1.ListOptions{LabelSelector : selector})
+	if err != nil {
+		return err
+	}
+	for _, pool := range pools.Items {
+		if _, ok := backends[pool.Name]; ok {
+			continue
+		}
+		glog.V(2).Infof("Remove stale pool %s/%s of ingress %s", pool.Namespace, pool.Name, ing.Name)
+		err = poolclient.Delete(pool.Name, &meta_v1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteManaged removes the objects of an Ingress that was deleted or moved
+// to another class.
+func (c *IngressController)deleteManaged(ing *extensions.Ingress) {
+	var err error
+	switch c.provider {
+		case driver.CITRIXLBPROVIDER:
+			err = crdclient.CALBClient(c.lbClient, c.lbScheme, ing.Namespace).Delete(ingressCALBName(ing), &meta_v1.DeleteOptions{})
+			if err == nil || errors.IsNotFound(err) {
+				err = c.cleanupCALBPools(ing, nil)
+			}
+		case driver.F5GWPROVIDER:
+			err = crdclient.AexClient(c.crdClient, c.crdScheme, ing.Namespace).Delete(ing.Name, &meta_v1.DeleteOptions{})
+			if err == nil || errors.IsNotFound(err) {
+				err = c.cleanupEXPools(ing, nil)
+			}
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		glog.Errorf("Delete objects of ingress %s/%s failed: %v", ing.Namespace, ing.Name, err)
+	}
+}
+
+func (c *IngressController)onCALBChange(obj interface{}) {
+	calb := obj.(*lbv1.CAppLoadBalance)
+	if calb.Status.State != lbv1.CALBSTATUSAVAILABLE || calb.Spec.IP == "" {
+		return
+	}
+	owner := meta_v1.GetControllerOf(calb)
+	if owner == nil || owner.Kind != "Ingress" {
+		return
+	}
+	ingObj, exists, err := c.ingressStore.GetByKey(calb.Namespace + "/" + owner.Name)
+	if err != nil || !exists {
+		return
+	}
+	err = c.updateIngressStatus(ingObj.(*extensions.Ingress), calb.Spec.IP)
+	if err != nil {
+		glog.Errorf("Update status of ingress %s/%s failed: %v", calb.Namespace, owner.Name, err)
+	}
+}
+
+func (c *IngressController)updateIngressStatus(ing *extensions.Ingress, vip string)error{
+	lbIngress := []v1.LoadBalancerIngress{v1.LoadBalancerIngress{IP : vip}}
+	if reflect.DeepEqual(ing.Status.LoadBalancer.Ingress, lbIngress) {
+		return nil
+	}
+	newIng := ing.DeepCopy()
+	newIng.Status.LoadBalancer.Ingress = lbIngress
+	_, err := c.client.ExtensionsV1beta1().Ingresses(ing.Namespace).UpdateStatus(newIng)
+	return err
+}
@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	driver 		"github.com/sak0/ygw/pkg/drivers"
+)
+
+// memberSync keeps the members of the pools of a pool controller on the
+// device: the members of its serviceRef pools and the removed members
+// draining their connections.
+type memberSync struct {
+	lock			sync.Mutex
+	// members of serviceRef pools programmed on the device, keyed by pool
+	// name, then "ip:port" -> enabled.
+	svcMembers		map[string]map[string]bool
+	// disabled members waiting for their connections to finish, keyed by
+	// namespace/name of the pool, then "ip:port".
+	draining		map[string]map[string]drainEntry
+}
+
+type drainEntry struct {
+	// Pool is the pool the member drains from.
+	Pool		string
+	Deadline	time.Time
+}
+
+// drainingMember is a member left draining, for the status of its pool.
+type drainingMember struct {
+	Member		string
+	Pool		string
+	Connections	int
+	Deadline	time.Time
+}
+
+func newMemberSync()*memberSync{
+	return &memberSync{
+		svcMembers	: make(map[string]map[string]bool),
+		draining	: make(map[string]map[string]drainEntry),
+	}
+}
+
+// poolMember returns the member of the driver for "ip:port", the port of
+// any port is zero.
+func poolMember(member string)driver.Member{
+	ip, port, _ := net.SplitHostPort(member)
+	iPort, _ := strconv.Atoi(port)
+	return driver.Member{IP : ip, Port : iPort}
+}
+
+// memberLister returns the MemberLister of drv, the providers without batches
+// are one behind their unbatched wrapper.
+func memberLister(drv driver.Provider)(driver.MemberLister, bool){
+	if u, ok := drv.(unbatched); ok {
+		drv = u.Provider
+	}
+	lister, ok := drv.(driver.MemberLister)
+	return lister, ok
+}
+
+// forgetPool drops the members of a deleted pool.
+func (s *memberSync)forgetPool(key, poolName string) {
+	s.lock.Lock()
+	delete(s.svcMembers, poolName)
+	delete(s.draining, key)
+	s.lock.Unlock()
+}
+
+// restoreDraining resumes draining a member found in the status of its pool
+// after a restart.
+func (s *memberSync)restoreDraining(key, poolName, member string, deadline time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.draining[key] == nil {
+		s.draining[key] = make(map[string]drainEntry)
+	}
+	glog.V(2).Infof("Pool Drain: member %v of %s still draining until %v", member, poolName, deadline)
+	s.draining[key][member] = drainEntry{Pool : poolName, Deadline : deadline}
+}
+
+// removeMember disables the member of the pool poolName gracefully and
+// leaves its removal to processDraining, without a drain timeout it is
+// removed at once. Callers hold s.lock.
+func (s *memberSync)removeMember(ctx context.Context, drv driver.Provider, key, poolName, member string, timeout time.Duration)error{
+	if timeout <= 0 {
+		return drv.RemoveMember(ctx, poolName, poolMember(member))
+	}
+
+	err := drv.DisableMember(ctx, poolName, poolMember(member))
+	if err != nil {
+		return err
+	}
+	if s.draining[key] == nil {
+		s.draining[key] = make(map[string]drainEntry)
+	}
+	if _, ok := s.draining[key][member]; !ok {
+		glog.V(2).Infof("Pool Drain: member %v of %s draining for %v", member, poolName, timeout)
+		s.draining[key][member] = drainEntry{Pool : poolName, Deadline : time.Now().Add(timeout)}
+	}
+	return nil
+}
+
+// undrainMember stops draining a member of poolName that is wanted again, the
+// caller enables it. Callers hold s.lock.
+func (s *memberSync)undrainMember(key, poolName, member string)bool{
+	entry, ok := s.draining[key][member]
+	if !ok || entry.Pool != poolName {
+		return false
+	}
+	glog.V(2).Infof("Pool Drain: member %v of %s is back", member, poolName)
+	delete(s.draining[key], member)
+	return true
+}
+
+// syncMembers makes the members of the serviceRef pool poolName match
+// membersNew. Ready members are enabled, not ready ones are kept in the pool
+// but disabled and the ones gone drain for timeout. newMember returns the
+// member to add for "ip:port". The members of a pool without state, after a
+// restart or a failed sync, are read from the device when it can list them.
+// A batch of drv is committed with the members.
+func (s *memberSync)syncMembers(ctx context.Context, drv driver.Provider, key, poolName string, membersNew map[string]bool,
+	newMember func(member string)driver.Member, timeout time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	membersOld, known := s.svcMembers[poolName]
+	lister, canList := memberLister(drv)
+	if !known && canList {
+		members, err := lister.PoolMembers(ctx, poolName)
+		if err != nil {
+			glog.Errorf("Pool Sync: get members of %s failed: %v", poolName, err)
+		} else {
+			glog.V(2).Infof("Pool Sync: %s has %d members on the device", poolName, len(members))
+			membersOld = members
+		}
+	}
+	failed := false
+	applied := make(map[string]bool)
+	for member, ready := range membersNew {
+		var err error
+		enabled, ok := membersOld[member]
+		if s.undrainMember(key, poolName, member) {
+			// still disabled on the device.
+			ok, enabled = true, false
+		}
+		if !ok {
+			glog.V(2).Infof("Pool Sync: need add member %v to %s", member, poolName)
+			err = drv.AddMember(ctx, poolName, newMember(member))
+			enabled = true
+			if driver.IsAlreadyExists(err) {
+				// bound before a restart, set its state whatever it is.
+				err, enabled = nil, !ready
+			}
+			if err != nil {
+				glog.Errorf("Pool Sync: add pool member failed: %v", err)
+				failed = true
+				continue
+			}
+		}
+		if ready && !enabled {
+			err = drv.EnableMember(ctx, poolName, poolMember(member))
+		} else if !ready && enabled {
+			err = drv.DisableMember(ctx, poolName, poolMember(member))
+		}
+		if err != nil {
+			glog.Errorf("Pool Sync: set member %s ready=%v failed: %v", member, ready, err)
+			failed = true
+			applied[member] = enabled
+			continue
+		}
+		applied[member] = ready
+	}
+
+	for member, enabled := range membersOld {
+		if _, ok := membersNew[member]; !ok {
+			if _, ok := s.draining[key][member]; ok {
+				continue
+			}
+			glog.V(2).Infof("Pool Sync: need remove member %v from %s", member, poolName)
+			err := s.removeMember(ctx, drv, key, poolName, member, timeout)
+			if err != nil {
+				glog.Errorf("Pool Sync: remove pool member failed: %v", err)
+				failed = true
+				applied[member] = enabled
+			}
+		}
+	}
+	if batch, ok := drv.(driver.Batch); ok {
+		err := batch.Commit(ctx)
+		if err != nil {
+			glog.Errorf("Pool Sync: commit members of %s failed: %v", poolName, err)
+			delete(s.svcMembers, poolName)
+			return
+		}
+	}
+	if failed && canList {
+		delete(s.svcMembers, poolName)
+		return
+	}
+	s.svcMembers[poolName] = applied
+}
+
+// processDraining removes the draining members without connections or past
+// their deadline and reports the others of each pool to report. provider
+// returns the driver of the pool of a key, nil when the pool is gone. The
+// connections are read and the status updated without s.lock.
+func (s *memberSync)processDraining(provider func(key string)driver.Provider,
+	report func(key string, draining []drainingMember)) {
+	s.lock.Lock()
+	pending := make(map[string]map[string]drainEntry)
+	for key, members := range s.draining {
+		pending[key] = make(map[string]drainEntry)
+		for member, entry := range members {
+			pending[key][member] = entry
+		}
+	}
+	s.lock.Unlock()
+
+	ctx, cancel := deviceContext()
+	defer cancel()
+	for key, members := range pending {
+		drv := provider(key)
+		if drv == nil {
+			continue
+		}
+		var draining []drainingMember
+		for member, entry := range members {
+			conns, err := drv.MemberConnections(ctx, entry.Pool, poolMember(member))
+			if err != nil {
+				glog.Errorf("Pool Drain: get connections of %v in %s failed: %v", member, entry.Pool, err)
+			}
+			if (err == nil && conns == 0) || time.Now().After(entry.Deadline) {
+				glog.V(2).Infof("Pool Drain: remove member %v from %s, %d connections left", member, entry.Pool, conns)
+				if s.finishDrain(ctx, drv, key, member, entry) {
+					continue
+				}
+			}
+			draining = append(draining, drainingMember{
+				Member		: member,
+				Pool		: entry.Pool,
+				Connections	: conns,
+				Deadline	: entry.Deadline,
+			})
+		}
+		sort.Slice(draining, func(i, j int) bool {
+			return draining[i].Member < draining[j].Member
+		})
+		report(key, draining)
+	}
+}
+
+// finishDrain removes a drained member unless it came back meanwhile, it
+// returns false when the member is still draining. The removal holds s.lock,
+// so that the member is not wanted again while it is removed.
+func (s *memberSync)finishDrain(ctx context.Context, drv driver.Provider, key, member string, entry drainEntry)bool{
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current, ok := s.draining[key][member]
+	if !ok {
+		return true
+	}
+	if current != entry {
+		return false
+	}
+	err := drv.RemoveMember(ctx, entry.Pool, poolMember(member))
+	if batch, ok := drv.(driver.Batch); ok && err == nil {
+		err = batch.Commit(ctx)
+	}
+	if err != nil && !driver.IsNotFound(err) {
+		glog.Errorf("Pool Drain: remove pool member failed: %v", err)
+		return false
+	}
+	delete(s.draining[key], member)
+	if len(s.draining[key]) == 0 {
+		delete(s.draining, key)
+	}
+	return true
+}
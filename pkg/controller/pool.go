@@ -1,157 +1,646 @@
-package controller
-
-import (
-	"time"
-	"os"
-	"reflect"
-	"strings"
-	
-	"github.com/golang/glog"
-	
-	"k8s.io/client-go/kubernetes"	
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
-	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-	
-	crdclient 	"github.com/sak0/ygw/pkg/client"
-	crdv1 		"github.com/sak0/ygw/pkg/apis/external/v1"
-	driver 		"github.com/sak0/ygw/pkg/drivers"
-	"github.com/sak0/ygw/pkg/utils"
-)
-
-type PoolController struct {
-	crdClient		*rest.RESTClient
-	crdScheme		*runtime.Scheme
-	client			kubernetes.Interface
-	
-	poolController	cache.Controller
-	driver			driver.GwProvider
-}
-
-func NewPoolController(client kubernetes.Interface, crdClient *rest.RESTClient, 
-					crdScheme *runtime.Scheme)(*PoolController, error) {
-	poolctr := &PoolController{
-		crdClient 	: crdClient,
-		crdScheme 	: crdScheme,
-		client		: client,
-	}
-	driver, _ := driver.New("f5")
-	poolctr.driver = driver	
-	
-	poolListWatch := cache.NewListWatchFromClient(poolctr.crdClient, 
-		crdv1.EXPPlural, meta_v1.NamespaceAll, fields.Everything())
-	
-	_, poolcontroller := cache.NewInformer(
-		poolListWatch,
-		&crdv1.ExternalNatPool{},
-		time.Minute*10,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: poolctr.onPoolAdd,
-			DeleteFunc: poolctr.onPoolDel,
-			UpdateFunc: poolctr.onPoolUpdate,
-		},
-	)
-	poolctr.poolController = poolcontroller
-	
-	return poolctr, nil
-}
-
-func (c *PoolController)Run(ctx <-chan struct{}) {
-	glog.V(2).Infof("Pool Controller starting...")
-	go c.poolController.Run(ctx)
-	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
-		return c.poolController.HasSynced(), nil
-	})
-	if !c.poolController.HasSynced() {
-		glog.Errorf("pool informer initial sync timeout")
-		os.Exit(1)
-	}
-}
-
-func (c *PoolController)onPoolAdd(obj interface{}) {
-	glog.V(3).Infof("Add-Pool: %v", obj)
-	
-	pool := obj.(*crdv1.ExternalNatPool)
-	
-	poolName := utils.GeneratePoolNameEXP(pool.Namespace, pool.Name)
-	err := c.driver.CreatePool(poolName, pool.Spec.Method)
-	if err != nil {
-		glog.Errorf("CreatePool failed: %+v\n", err)
-		c.updateError(err.Error(), pool)
-		return		
-	}
-	for _, member := range pool.Spec.Members {
-		glog.V(3).Infof("Add member %s:%s to Pool %s", member.IP, member.Port, poolName)
-		err = c.driver.AddPoolMember(poolName, member.IP, member.Port)
-		glog.Errorf("AddPoolMember failed: %+v\n", err)
-	}
-}
-
-func (c *PoolController)onPoolUpdate(oldObj, newObj interface{}) {
-	glog.V(3).Infof("Update-Pool: %v -> %v", oldObj, newObj)
-	
-	if !reflect.DeepEqual(oldObj, newObj) {
-		newExp := newObj.(*crdv1.ExternalNatPool)
-		oldExp := oldObj.(*crdv1.ExternalNatPool)
-		
-		membersNew := utils.GetMembersMap(newExp)
-		membersOld := utils.GetMembersMap(oldExp)
-		glog.V(2).Infof("membersNew: %v", membersNew)
-		glog.V(2).Infof("membersOld: %v", membersOld)
-		if !reflect.DeepEqual(membersNew, membersOld) {
-			glog.V(2).Infof("Need update Pool configurations.")
-			poolName := utils.GeneratePoolNameEXP(oldExp.Namespace, oldExp.Name)
-			c.updateExp(newExp.Namespace, poolName, membersNew, membersOld)
-		}					
-	}	
-}
-
-func (c *PoolController)updateExp(namespace string, poolName string, 
-	membersNew map[string]int, membersOld map[string]int)error{
-	for memberNew, _ := range membersNew {
-		if _, ok := membersOld[memberNew]; !ok {
-			glog.V(2).Infof("Pool Update: need add member %v to %s", memberNew, poolName)
-			ip := strings.Split(memberNew, ":")[0]
-			port := strings.Split(memberNew, ":")[1]
-			err := c.driver.AddPoolMember(poolName, ip, port)
-			if err != nil {
-				glog.Errorf("Pool Update: add pool member failed.\n", err)
-			}
-		}
-	}
-	
-	for memberOld, _ := range membersOld {
-		if _, ok := membersNew[memberOld]; !ok {
-			glog.V(2).Infof("Pool Update: need remove member %v from %s", memberOld, poolName)
-			ip := strings.Split(memberOld, ":")[0]
-			port := strings.Split(memberOld, ":")[1]
-			err := c.driver.DelPoolMember(poolName, ip, port)
-			if err != nil {
-				glog.Errorf("Pool Update: remove pool member failed.\n", err)
-			}			
-		}
-	}
-	
-	return nil
-}
-
-func (c *PoolController)onPoolDel(obj interface{}) {
-	glog.V(3).Infof("Del-Pool: %v", obj)
-	pool := obj.(*crdv1.ExternalNatPool)
-	
-	poolName := utils.GeneratePoolNameEXP(pool.Namespace, pool.Name)
-	err := c.driver.DeletePool(poolName)
-	if err != nil{
-		glog.Errorf("DeletePool failed: %+v\n", err)
-	}
-}
-
-func (c *PoolController)updateError(msg string, pool *crdv1.ExternalNatPool) {
-	pool.Status.State = crdv1.POOLSTATUSERROR
-	pool.Status.Message = msg
-	poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, pool.Namespace)
-	_, _ = poolclient.Update(pool, pool.Name)
+package controller
+
+import (
+	"context"
+	"time"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	
+	"github.com/golang/glog"
+	
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"	
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	
+	crdclient 	"github.com/sak0/ygw/pkg/client"
+	crdv1 		"github.com/sak0/ygw/pkg/apis/external/v1"
+	driver 		"github.com/sak0/ygw/pkg/drivers"
+	"github.com/sak0/ygw/pkg/utils"
+)
+
+type PoolController struct {
+	crdClient		*rest.RESTClient
+	crdScheme		*runtime.Scheme
+	client			kubernetes.Interface
+	
+	poolController	cache.Controller
+	poolStore		cache.Store
+	epController	cache.Controller
+	epStore			cache.Store
+	svcController	cache.Controller
+	svcStore		cache.Store
+	nodeController	cache.Controller
+	nodeStore		cache.Store
+	devices			*DeviceController
+	
+	*memberSync
+}
+
+func NewPoolController(client kubernetes.Interface, crdClient *rest.RESTClient, 
+					crdScheme *runtime.Scheme, devices *DeviceController)(*PoolController, error) {
+	poolctr := &PoolController{
+		crdClient 	: crdClient,
+		crdScheme 	: crdScheme,
+		client		: client,
+		devices		: devices,
+		memberSync	: newMemberSync(),
+	}
+	
+	poolListWatch := cache.NewListWatchFromClient(poolctr.crdClient, 
+		crdv1.EXPPlural, meta_v1.NamespaceAll, fields.Everything())
+	
+	poolstore, poolcontroller := cache.NewInformer(
+		poolListWatch,
+		&crdv1.ExternalNatPool{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: poolctr.onPoolAdd,
+			DeleteFunc: poolctr.onPoolDel,
+			UpdateFunc: poolctr.onPoolUpdate,
+		},
+	)
+	poolctr.poolController = poolcontroller
+	poolctr.poolStore = poolstore
+	
+	epListWatch := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), 
+		"endpoints", meta_v1.NamespaceAll, fields.Everything())
+	
+	epstore, epcontroller := cache.NewInformer(
+		epListWatch,
+		&v1.Endpoints{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: poolctr.onEndpointsAdd,
+			DeleteFunc: poolctr.onEndpointsDel,
+			UpdateFunc: poolctr.onEndpointsUpdate,
+		},
+	)
+	poolctr.epController = epcontroller
+	poolctr.epStore = epstore
+	
+	svcListWatch := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), 
+		"services", meta_v1.NamespaceAll, fields.Everything())
+	
+	svcstore, svccontroller := cache.NewInformer(
+		svcListWatch,
+		&v1.Service{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: poolctr.onServiceAdd,
+			DeleteFunc: poolctr.onServiceDel,
+			UpdateFunc: poolctr.onServiceUpdate,
+		},
+	)
+	poolctr.svcController = svccontroller
+	poolctr.svcStore = svcstore
+	
+	nodeListWatch := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), 
+		"nodes", meta_v1.NamespaceAll, fields.Everything())
+	
+	nodestore, nodecontroller := cache.NewInformer(
+		nodeListWatch,
+		&v1.Node{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: poolctr.onNodeAdd,
+			DeleteFunc: poolctr.onNodeDel,
+			UpdateFunc: poolctr.onNodeUpdate,
+		},
+	)
+	poolctr.nodeController = nodecontroller
+	poolctr.nodeStore = nodestore
+	
+	return poolctr, nil
+}
+
+func (c *PoolController)Run(ctx <-chan struct{}) {
+	glog.V(2).Infof("Pool Controller starting...")
+	go c.epController.Run(ctx)
+	go c.svcController.Run(ctx)
+	go c.nodeController.Run(ctx)
+	// serviceRef pools need the services, endpoints and nodes on their first sync.
+	cache.WaitForCacheSync(ctx, c.epController.HasSynced, c.svcController.HasSynced, c.nodeController.HasSynced)
+	go c.poolController.Run(ctx)
+	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
+		return c.hasSynced(), nil
+	})
+	if !c.hasSynced() {
+		glog.Errorf("pool informer initial sync timeout")
+		os.Exit(1)
+	}
+	for _, obj := range c.poolStore.List() {
+		pool := obj.(*crdv1.ExternalNatPool)
+		poolName := utils.GeneratePoolNameEXP(pool.Namespace, pool.Name)
+		for _, member := range pool.Status.Draining {
+			c.restoreDraining(pool.Namespace + "/" + pool.Name, poolName, member.Member, member.Deadline.Time)
+		}
+	}
+	go wait.Until(c.processDraining, 5*time.Second, ctx)
+}
+
+// provider returns the driver for the device and BIG-IP partition of pool,
+// collecting the calls of a sync, see batch.
+func (c *PoolController)provider(pool *crdv1.ExternalNatPool)(driver.Batch, error){
+	drv, err := c.devices.Provider(crdv1.EXPPlural, pool.Spec.DeviceRef, pool)
+	if err != nil {
+		return nil, err
+	}
+	return batch(drv), nil
+}
+
+// recordPartition saves on pool the BIG-IP partition its objects are created
+// in and returns the saved pool.
+func (c *PoolController)recordPartition(pool *crdv1.ExternalNatPool)*crdv1.ExternalNatPool{
+	pool = pool.DeepCopy()
+	if !c.devices.RecordPartition(crdv1.EXPPlural, pool.Spec.DeviceRef, pool) {
+		return pool
+	}
+	poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, pool.Namespace)
+	saved, err := poolclient.Update(pool, pool.Name)
+	if err != nil {
+		glog.Errorf("Record partition of pool %s failed: %v", pool.Name, err)
+		return pool
+	}
+	return saved
+}
+
+func (c *PoolController)hasSynced()bool{
+	return c.poolController.HasSynced() && c.epController.HasSynced() && 
+		c.svcController.HasSynced() && c.nodeController.HasSynced()
+}
+
+func (c *PoolController)onPoolAdd(obj interface{}) {
+	glog.V(3).Infof("Add-Pool: %v", obj)
+	
+	pool := obj.(*crdv1.ExternalNatPool)
+	pool = c.recordPartition(pool)
+	
+	poolName := utils.GeneratePoolNameEXP(pool.Namespace, pool.Name)
+	drv, err := c.provider(pool)
+	if err != nil {
+		glog.Errorf("Get driver of %s failed: %v", poolName, err)
+		c.updateError(err.Error(), pool)
+		return
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	defer commit(ctx, drv)
+	err = retryDevice(func()error{
+		return drv.CreatePool(ctx, driver.Pool{
+			Name		: poolName,
+			Method		: pool.Spec.Method,
+			Protocol	: pool.Spec.Protocol,
+		})
+	})
+	if err != nil {
+		glog.Errorf("CreatePool failed: %+v\n", err)
+		c.updateError(err.Error(), pool)
+		return		
+	}
+	if pool.Spec.ServiceRef != nil {
+		err = c.syncServiceMembers(ctx, drv, pool)
+		if err != nil {
+			glog.Errorf("Sync members of %s from service failed: %+v\n", poolName, err)
+			c.updateError(err.Error(), pool)
+			return
+		}
+	} else {
+		for _, member := range pool.Spec.Members {
+			glog.V(3).Infof("Add member %s:%s to Pool %s", member.IP, member.Port, poolName)
+			err = drv.AddMember(ctx, poolName, poolMember(net.JoinHostPort(member.IP, member.Port)))
+			if err != nil && !driver.IsAlreadyExists(err) {
+				glog.Errorf("AddMember failed: %+v\n", err)
+			}
+		}
+	}
+	err = c.applyPoolSettings(ctx, drv, nil, pool)
+	if err != nil {
+		glog.Errorf("Set settings of pool %s failed: %+v\n", poolName, err)
+		c.updateError(err.Error(), pool)
+		return
+	}
+	err = drv.Commit(ctx)
+	if err != nil {
+		glog.Errorf("Commit pool %s failed: %+v\n", poolName, err)
+		c.updateError(err.Error(), pool)
+	}
+}
+
+func (c *PoolController)onPoolUpdate(oldObj, newObj interface{}) {
+	glog.V(3).Infof("Update-Pool: %v -> %v", oldObj, newObj)
+	
+	newExp := newObj.(*crdv1.ExternalNatPool)
+	oldExp := oldObj.(*crdv1.ExternalNatPool)
+	if !strings.EqualFold(oldExp.Spec.Protocol, newExp.Spec.Protocol) {
+		glog.Errorf("Protocol of pool %s/%s can't be changed.", newExp.Namespace, newExp.Name)
+		c.updateError("protocol can't be changed, recreate the pool", newExp.DeepCopy())
+		return
+	}
+	if oldExp.Spec.DeviceRef != newExp.Spec.DeviceRef {
+		glog.V(2).Infof("Need move pool %s/%s to another device.", newExp.Namespace, newExp.Name)
+		c.onPoolDel(oldExp)
+		c.onPoolAdd(newExp)
+		return
+	}
+	drv, err := c.provider(newExp)
+	if err != nil {
+		glog.Errorf("Get driver of %s/%s failed: %v", newExp.Namespace, newExp.Name, err)
+		c.updateError(err.Error(), newExp)
+		return
+	}
+	ctx, cancel := deviceContext()
+	defer cancel()
+	defer commit(ctx, drv)
+	
+	if newExp.Spec.ServiceRef != nil || oldExp.Spec.ServiceRef != nil {
+		c.updateServiceRef(ctx, drv, oldExp, newExp)
+	} else if !reflect.DeepEqual(oldObj, newObj) {
+		membersNew := utils.GetMembersMap(newExp)
+		membersOld := utils.GetMembersMap(oldExp)
+		glog.V(2).Infof("membersNew: %v", membersNew)
+		glog.V(2).Infof("membersOld: %v", membersOld)
+		if !reflect.DeepEqual(membersNew, membersOld) {
+			glog.V(2).Infof("Need update Pool configurations.")
+			c.updateExp(ctx, drv, newExp, membersNew, membersOld)
+		}					
+	}	
+	
+	if !reflect.DeepEqual(oldExp.Spec, newExp.Spec) {
+		err := c.applyPoolSettings(ctx, drv, oldExp, newExp)
+		if err != nil {
+			glog.Errorf("Set settings of pool %s/%s failed: %+v\n", newExp.Namespace, newExp.Name, err)
+			c.updateError(err.Error(), newExp)
+			return
+		}
+	}
+	err = drv.Commit(ctx)
+	if err != nil {
+		glog.Errorf("Commit pool %s/%s failed: %+v\n", newExp.Namespace, newExp.Name, err)
+		c.updateError(err.Error(), newExp)
+	}
+}
+
+// applyPoolSettings sets the priority groups, slow start and connection
+// limits of the pool and the settings of its static members, old is nil for a
+// new pool. The connection limit of the pool is the one of each of its members
+// on the devices without pool limits.
+func (c *PoolController)applyPoolSettings(ctx context.Context, drv driver.Provider, old, pool *crdv1.ExternalNatPool)error{
+	poolName := utils.GeneratePoolNameEXP(pool.Namespace, pool.Name)
+	oldSpec := crdv1.ExternalNatPoolSpec{}
+	oldMembers := make(map[string]crdv1.ExternalNatPoolMember)
+	if old != nil {
+		oldSpec = old.Spec
+		if old.Spec.ServiceRef == nil {
+			for _, member := range old.Spec.Members {
+				oldMembers[net.JoinHostPort(member.IP, member.Port)] = member
+			}
+		}
+	}
+	memberLimits := !drv.Capabilities().PoolConnectionLimit
+	limitChanged := pool.Spec.ConnectionLimit != oldSpec.ConnectionLimit
+	
+	if pool.Spec.MinActiveMembers != oldSpec.MinActiveMembers || pool.Spec.SlowStart != oldSpec.SlowStart ||
+		(limitChanged && !memberLimits) {
+		settings := driver.Pool{
+			Name				: poolName,
+			SlowStart			: int(utils.GetDuration(pool.Spec.SlowStart, "0s").Seconds()),
+			MinActiveMembers	: pool.Spec.MinActiveMembers,
+		}
+		if !memberLimits {
+			settings.ConnectionLimit = pool.Spec.ConnectionLimit
+		}
+		err := drv.UpdatePool(ctx, settings)
+		if err != nil {
+			return err
+		}
+	}
+	if !memberLimits {
+		limitChanged = false
+	}
+	
+	if pool.Spec.ServiceRef != nil {
+		if !limitChanged {
+			return nil
+		}
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		for member, _ := range c.svcMembers[poolName] {
+			m := poolMember(member)
+			m.ConnectionLimit = pool.Spec.ConnectionLimit
+			err := drv.UpdateMember(ctx, poolName, m)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	
+	for _, member := range pool.Spec.Members {
+		oldMember, ok := oldMembers[net.JoinHostPort(member.IP, member.Port)]
+		if !ok && member.Priority == "" && member.Weight == "" && member.ConnectionLimit == "" && 
+			(!memberLimits || pool.Spec.ConnectionLimit == 0) {
+			continue
+		}
+		if ok && !limitChanged && oldMember.Priority == member.Priority && oldMember.Weight == member.Weight && 
+			oldMember.ConnectionLimit == member.ConnectionLimit {
+			continue
+		}
+		m := poolMember(net.JoinHostPort(member.IP, member.Port))
+		m.Priority, _ = strconv.Atoi(member.Priority)
+		m.Weight, _ = strconv.Atoi(member.Weight)
+		if memberLimits {
+			m.ConnectionLimit = pool.Spec.ConnectionLimit
+		}
+		if member.ConnectionLimit != "" {
+			m.ConnectionLimit, _ = strconv.Atoi(member.ConnectionLimit)
+		}
+		err := drv.UpdateMember(ctx, poolName, m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *PoolController)updateExp(ctx context.Context, drv driver.Provider, pool *crdv1.ExternalNatPool, 
+	membersNew map[string]int, membersOld map[string]int)error{
+	poolName := utils.GeneratePoolNameEXP(pool.Namespace, pool.Name)
+	timeout := utils.GetDuration(pool.Spec.DrainTimeout, crdv1.DEFAULTDRAINTIMEOUT)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for memberNew, _ := range membersNew {
+		if _, ok := membersOld[memberNew]; !ok {
+			glog.V(2).Infof("Pool Update: need add member %v to %s", memberNew, poolName)
+			var err error
+			if c.undrainMember(pool.Namespace + "/" + pool.Name, poolName, memberNew) {
+				err = drv.EnableMember(ctx, poolName, poolMember(memberNew))
+			} else {
+				err = drv.AddMember(ctx, poolName, poolMember(memberNew))
+			}
+			if err != nil && !driver.IsAlreadyExists(err) {
+				glog.Errorf("Pool Update: add pool member failed.\n", err)
+			}
+		}
+	}
+	
+	for memberOld, _ := range membersOld {
+		if _, ok := membersNew[memberOld]; !ok {
+			glog.V(2).Infof("Pool Update: need remove member %v from %s", memberOld, poolName)
+			err := c.removeMember(ctx, drv, pool.Namespace + "/" + pool.Name, poolName, memberOld, timeout)
+			if err != nil {
+				glog.Errorf("Pool Update: remove pool member failed.\n", err)
+			}			
+		}
+	}
+	
+	return nil
+}
+
+func (c *PoolController)onPoolDel(obj interface{}) {
+	glog.V(3).Infof("Del-Pool: %v", obj)
+	pool := obj.(*crdv1.ExternalNatPool)
+	
+	poolName := utils.GeneratePoolNameEXP(pool.Namespace, pool.Name)
+	drv, err := c.provider(pool)
+	if err == nil {
+		ctx, cancel := deviceContext()
+		defer cancel()
+		err = retryDevice(func()error{
+			return drv.DeletePool(ctx, poolName)
+		})
+		if err == nil {
+			err = drv.Commit(ctx)
+		}
+	}
+	if err != nil{
+		glog.Errorf("DeletePool failed: %+v\n", err)
+	}
+	
+	c.forgetPool(pool.Namespace + "/" + pool.Name, poolName)
+}
+
+// processDraining removes the members done draining, see
+// memberSync.processDraining.
+func (c *PoolController)processDraining() {
+	c.memberSync.processDraining(func(key string)driver.Provider{
+		obj, exists, _ := c.poolStore.GetByKey(key)
+		if !exists {
+			return nil
+		}
+		drv, err := c.provider(obj.(*crdv1.ExternalNatPool))
+		if err != nil {
+			glog.Errorf("Pool Drain: get driver of %s failed: %v", key, err)
+			return nil
+		}
+		return drv
+	}, c.updateDrainStatus)
+}
+
+func (c *PoolController)updateDrainStatus(key string, members []drainingMember) {
+	obj, exists, err := c.poolStore.GetByKey(key)
+	if err != nil || !exists {
+		return
+	}
+	var draining []crdv1.DrainingMember
+	for _, member := range members {
+		draining = append(draining, crdv1.DrainingMember{
+			Member		: member.Member,
+			Connections	: member.Connections,
+			Deadline	: meta_v1.NewTime(member.Deadline),
+		})
+	}
+	pool := obj.(*crdv1.ExternalNatPool)
+	if reflect.DeepEqual(pool.Status.Draining, draining) {
+		return
+	}
+	newPool := pool.DeepCopy()
+	newPool.Status.Draining = draining
+	poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, pool.Namespace)
+	_, err = poolclient.Update(newPool, pool.Name)
+	if err != nil {
+		glog.Errorf("Update draining status of pool %s failed: %v", key, err)
+	}
+}
+
+// updateServiceRef handles pools whose members come from a Service, also when
+// a pool switches between static members and a serviceRef.
+func (c *PoolController)updateServiceRef(ctx context.Context, drv driver.Provider, oldExp, newExp *crdv1.ExternalNatPool){
+	poolName := utils.GeneratePoolNameEXP(newExp.Namespace, newExp.Name)
+	
+	if newExp.Spec.ServiceRef == nil {
+		glog.V(2).Infof("Pool %s: serviceRef removed, use static members.", poolName)
+		membersOld := make(map[string]int)
+		c.lock.Lock()
+		for member, _ := range c.svcMembers[poolName] {
+			membersOld[member] = 1
+		}
+		delete(c.svcMembers, poolName)
+		c.lock.Unlock()
+		c.updateExp(ctx, drv, newExp, utils.GetMembersMap(newExp), membersOld)
+		return
+	}
+	
+	if oldExp.Spec.ServiceRef == nil {
+		glog.V(2).Infof("Pool %s: static members replaced by serviceRef.", poolName)
+		// let the sync remove the static members.
+		c.lock.Lock()
+		members := make(map[string]bool)
+		for member, _ := range utils.GetMembersMap(oldExp) {
+			members[member] = true
+		}
+		c.svcMembers[poolName] = members
+		c.lock.Unlock()
+	}
+	
+	err := c.syncServiceMembers(ctx, drv, newExp)
+	if err != nil {
+		glog.Errorf("Sync members of %s from service failed: %+v\n", poolName, err)
+		c.updateError(err.Error(), newExp)
+	}
+}
+
+// syncServiceMembers makes the device pool match the endpoints of the Service
+// referenced by pool. Ready addresses are enabled members, not ready ones are
+// kept in the pool but disabled. The calls of drv are committed with the
+// members.
+func (c *PoolController)syncServiceMembers(ctx context.Context, drv driver.Provider, pool *crdv1.ExternalNatPool)error{
+	ref := pool.Spec.ServiceRef
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = pool.Namespace
+	}
+	poolName := utils.GeneratePoolNameEXP(pool.Namespace, pool.Name)
+	
+	// the members of a deleted service are removed, its error is reported.
+	membersNew, svcErr := utils.GetServiceRefMembers(c.svcStore, c.epStore, c.nodeStore, 
+		namespace, ref.Name, ref.Port, ref.Mode, ref.NodeSelector)
+	if membersNew == nil {
+		return svcErr
+	}
+	
+	timeout := utils.GetDuration(pool.Spec.DrainTimeout, crdv1.DEFAULTDRAINTIMEOUT)
+	memberLimits := !drv.Capabilities().PoolConnectionLimit
+	
+	c.syncMembers(ctx, drv, pool.Namespace + "/" + pool.Name, poolName, membersNew, func(member string)driver.Member{
+		m := poolMember(member)
+		if memberLimits {
+			m.ConnectionLimit = pool.Spec.ConnectionLimit
+		}
+		return m
+	}, timeout)
+	
+	return svcErr
+}
+
+func (c *PoolController)onEndpointsAdd(obj interface{}) {
+	c.syncServiceObj(obj)
+}
+
+func (c *PoolController)onEndpointsUpdate(oldObj, newObj interface{}) {
+	if !reflect.DeepEqual(oldObj, newObj) {
+		c.syncServiceObj(newObj)
+	}
+}
+
+func (c *PoolController)onEndpointsDel(obj interface{}) {
+	c.syncServiceObj(obj)
+}
+
+func (c *PoolController)onServiceAdd(obj interface{}) {
+	c.syncServiceObj(obj)
+}
+
+func (c *PoolController)onServiceUpdate(oldObj, newObj interface{}) {
+	oldSvc := oldObj.(*v1.Service)
+	newSvc := newObj.(*v1.Service)
+	if !reflect.DeepEqual(oldSvc.Spec, newSvc.Spec) {
+		c.syncServiceObj(newObj)
+	}
+}
+
+func (c *PoolController)onServiceDel(obj interface{}) {
+	c.syncServiceObj(obj)
+}
+
+func (c *PoolController)onNodeAdd(obj interface{}) {
+	c.syncNodePortPools()
+}
+
+func (c *PoolController)onNodeUpdate(oldObj, newObj interface{}) {
+	if utils.NodeMembershipChanged(oldObj.(*v1.Node), newObj.(*v1.Node)) {
+		c.syncNodePortPools()
+	}
+}
+
+func (c *PoolController)onNodeDel(obj interface{}) {
+	c.syncNodePortPools()
+}
+
+// syncServiceObj resyncs every pool referencing the Service of obj, which is
+// either the Service itself or its Endpoints.
+func (c *PoolController)syncServiceObj(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		glog.Errorf("Get service key failed: %v", err)
+		return
+	}
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	
+	for _, obj := range c.poolStore.List() {
+		pool := obj.(*crdv1.ExternalNatPool)
+		ref := pool.Spec.ServiceRef
+		if ref == nil || ref.Name != name {
+			continue
+		}
+		refNamespace := ref.Namespace
+		if refNamespace == "" {
+			refNamespace = pool.Namespace
+		}
+		if refNamespace != namespace {
+			continue
+		}
+		glog.V(3).Infof("Service %s changed, sync pool %s/%s", key, pool.Namespace, pool.Name)
+		c.syncPool(pool)
+	}
+}
+
+// syncNodePortPools resyncs every pool in NodePort mode after a node change.
+func (c *PoolController)syncNodePortPools() {
+	for _, obj := range c.poolStore.List() {
+		pool := obj.(*crdv1.ExternalNatPool)
+		ref := pool.Spec.ServiceRef
+		if ref == nil || ref.Mode != crdv1.SERVICEREFMODENODEPORT {
+			continue
+		}
+		glog.V(3).Infof("Nodes changed, sync pool %s/%s", pool.Namespace, pool.Name)
+		c.syncPool(pool)
+	}
+}
+
+func (c *PoolController)syncPool(pool *crdv1.ExternalNatPool) {
+	drv, err := c.provider(pool)
+	if err == nil {
+		ctx, cancel := deviceContext()
+		defer cancel()
+		err = c.syncServiceMembers(ctx, drv, pool)
+	}
+	if err != nil {
+		glog.Errorf("Sync members of %s/%s from service failed: %v", pool.Namespace, pool.Name, err)
+		c.updateError(err.Error(), pool.DeepCopy())
+	}
+}
+
+func (c *PoolController)updateError(msg string, pool *crdv1.ExternalNatPool) {
+	pool.Status.State = crdv1.POOLSTATUSERROR
+	pool.Status.Message = msg
+	poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, pool.Namespace)
+	_, _ = poolclient.Update(pool, pool.Name)
 }
\ No newline at end of file
@@ -0,0 +1,363 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	crdclient 	"github.com/sak0/ygw/pkg/client"
+	crdv1 		"github.com/sak0/ygw/pkg/apis/external/v1"
+	driver 		"github.com/sak0/ygw/pkg/drivers"
+	"github.com/sak0/ygw/pkg/utils"
+)
+
+const (
+	// ServiceSubnetAnnotation selects the subnet the vip is allocated from,
+	// the subnet of the controller is used without it.
+	ServiceSubnetAnnotation		= "ygw.yonghui.cn/subnet"
+	// ServiceModeAnnotation selects the serviceRef mode of the pools,
+	// Endpoints or NodePort.
+	ServiceModeAnnotation		= "ygw.yonghui.cn/service-mode"
+	// ServiceDeviceAnnotation is the LoadBalancerDevice of the objects, the
+	// device of the environment without it.
+	ServiceDeviceAnnotation		= "ygw.yonghui.cn/device"
+	// ServiceLabel marks the objects managed for a Service with its name.
+	ServiceLabel				= "ygw.yonghui.cn/service"
+)
+
+// ServiceController gives Services of type LoadBalancer a vip on the f5. Each
+// service port gets a ClassicExternalNat and an ExternalNatPool owned by the
+// Service, the vip is published in the Service status.
+type ServiceController struct {
+	crdClient		*rest.RESTClient
+	crdScheme		*runtime.Scheme
+	client			kubernetes.Interface
+	subnet			string
+
+	svcController	cache.Controller
+}
+
+func NewServiceController(client kubernetes.Interface, crdClient *rest.RESTClient,
+					crdScheme *runtime.Scheme, subnet string)(*ServiceController, error) {
+	svcctr := &ServiceController{
+		crdClient	: crdClient,
+		crdScheme	: crdScheme,
+		client		: client,
+		subnet		: subnet,
+	}
+
+	svcListWatch := cache.NewListWatchFromClient(client.CoreV1().RESTClient(),
+		"services", meta_v1.NamespaceAll, fields.Everything())
+	_, svcController := cache.NewInformer(
+		svcListWatch,
+		&v1.Service{},
+		time.Minute*10,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: svcctr.onServiceAdd,
+			UpdateFunc: svcctr.onServiceUpdate,
+			DeleteFunc: svcctr.onServiceDel,
+		},
+	)
+	svcctr.svcController = svcController
+
+	return svcctr, nil
+}
+
+func (c *ServiceController)Run(ctx <-chan struct{}) {
+	glog.V(2).Infof("Service Controller starting...")
+	go c.svcController.Run(ctx)
+	wait.Poll(time.Second, 5*time.Minute, func() (bool, error) {
+		return c.svcController.HasSynced(), nil
+	})
+	if !c.svcController.HasSynced() {
+		glog.Errorf("service informer initial sync timeout")
+		os.Exit(1)
+	}
+}
+
+// isOurs tells whether the Service is a LoadBalancer with a subnet to get its
+// vip from, the others are left to other controllers.
+func (c *ServiceController)isOurs(svc *v1.Service)bool{
+	return svc.Spec.Type == v1.ServiceTypeLoadBalancer && c.serviceSubnet(svc) != ""
+}
+
+func (c *ServiceController)onServiceAdd(obj interface{}) {
+	svc := obj.(*v1.Service)
+	if !c.isOurs(svc) {
+		return
+	}
+	glog.V(3).Infof("Add-Service: %v", obj)
+	c.syncService(svc)
+}
+
+func (c *ServiceController)onServiceUpdate(oldObj, newObj interface{}) {
+	oldSvc := oldObj.(*v1.Service)
+	newSvc := newObj.(*v1.Service)
+	if !c.isOurs(newSvc) {
+		if c.isOurs(oldSvc) {
+			glog.V(2).Infof("Service %s/%s is no more ours", newSvc.Namespace, newSvc.Name)
+			c.cleanup(oldSvc)
+		}
+		return
+	}
+	if reflect.DeepEqual(oldSvc.Spec, newSvc.Spec) &&
+		reflect.DeepEqual(oldSvc.Annotations, newSvc.Annotations) &&
+		len(newSvc.Status.LoadBalancer.Ingress) > 0 {
+		return
+	}
+	glog.V(3).Infof("Update-Service: %v -> %v", oldObj, newObj)
+	c.syncService(newSvc)
+}
+
+func (c *ServiceController)onServiceDel(obj interface{}) {
+	svc, ok := obj.(*v1.Service)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		svc, ok = tombstone.Obj.(*v1.Service)
+		if !ok {
+			return
+		}
+	}
+	if !c.isOurs(svc) {
+		return
+	}
+	glog.V(3).Infof("Del-Service: %v", obj)
+	c.cleanup(svc)
+}
+
+func (c *ServiceController)serviceSubnet(svc *v1.Service)string{
+	if subnet, ok := svc.Annotations[ServiceSubnetAnnotation]; ok {
+		return subnet
+	}
+	return c.subnet
+}
+
+func serviceVip(svc *v1.Service)string{
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			return ingress.IP
+		}
+	}
+	return ""
+}
+
+// ensureVip returns the vip published for the Service, allocating it when
+// there is none yet or when spec.loadBalancerIP asks for another one.
+func (c *ServiceController)ensureVip(svc *v1.Service)(string, error){
+	vip := serviceVip(svc)
+	if vip != "" && (svc.Spec.LoadBalancerIP == "" || svc.Spec.LoadBalancerIP == vip) {
+		return vip, nil
+	}
+
+	if svc.Spec.LoadBalancerIP != "" && net.ParseIP(svc.Spec.LoadBalancerIP) == nil {
+		return "", fmt.Errorf("invalid loadBalancerIP %s", svc.Spec.LoadBalancerIP)
+	}
+
+	subnet := c.serviceSubnet(svc)
+	var err error
+	if vip != "" {
+		glog.V(2).Infof("Service %s/%s asks for vip %s, release %s", svc.Namespace, svc.Name,
+			svc.Spec.LoadBalancerIP, vip)
+		utils.ReleaseIpAddr(svc.Namespace, vip)
+	}
+	if svc.Spec.LoadBalancerIP != "" {
+		vip = svc.Spec.LoadBalancerIP
+		err = utils.CreatePortFromIp(svc.Namespace, vip, subnet)
+	} else {
+		vip, err = utils.AllocIpAddrFromSubnet(svc.Namespace, subnet)
+	}
+	if err != nil {
+		glog.Errorf("Alloc vip for service %s/%s failed: %v", svc.Namespace, svc.Name, err)
+		return "", err
+	}
+	return vip, nil
+}
+
+// servicePortName names the ClassicExternalNat and the pool of one port.
+func servicePortName(svc *v1.Service, port v1.ServicePort)string{
+	return strings.ToLower(svc.Name + "-" + string(port.Protocol) + "-" + strconv.Itoa(int(port.Port)))
+}
+
+func (c *ServiceController)objectMeta(svc *v1.Service, name string)meta_v1.ObjectMeta{
+	return meta_v1.ObjectMeta{
+		Name		: name,
+		Namespace	: svc.Namespace,
+		Labels		: map[string]string{ServiceLabel : svc.Name},
+		OwnerReferences	: []meta_v1.OwnerReference{
+			*meta_v1.NewControllerRef(svc, v1.SchemeGroupVersion.WithKind("Service")),
+		},
+	}
+}
+
+func (c *ServiceController)syncService(svc *v1.Service) {
+	vip, err := c.ensureVip(svc)
+	if err != nil {
+		return
+	}
+
+	names := make(map[string]bool)
+	poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, svc.Namespace)
+	cexclient := crdclient.CexClient(c.crdClient, c.crdScheme, svc.Namespace)
+	for _, port := range svc.Spec.Ports {
+		name := servicePortName(svc, port)
+		names[name] = true
+
+		pool := &crdv1.ExternalNatPool{
+			ObjectMeta	: c.objectMeta(svc, name),
+			Spec		: crdv1.ExternalNatPoolSpec{
+				Method		: driver.METHODROUNDROBIN,
+				Protocol	: string(port.Protocol),
+				ServiceRef	: &crdv1.ServiceRef{
+					Name	: svc.Name,
+					Port	: strconv.Itoa(int(port.Port)),
+					Mode	: svc.Annotations[ServiceModeAnnotation],
+				},
+				DeviceRef	: svc.Annotations[ServiceDeviceAnnotation],
+			},
+		}
+		oldPool, err := poolclient.Get(name)
+		if err == nil {
+			// the protocol of a pool is fixed, the cex reports a wrong one.
+			pool.Spec.Protocol = oldPool.Spec.Protocol
+		}
+		if errors.IsNotFound(err) {
+			_, err = poolclient.Create(pool)
+		} else if err == nil && !reflect.DeepEqual(oldPool.Spec, pool.Spec) {
+			oldPool.Spec = pool.Spec
+			_, err = poolclient.Update(oldPool, name)
+		}
+		if err != nil {
+			glog.Errorf("Sync pool %s/%s failed: %v", svc.Namespace, name, err)
+			return
+		}
+
+		cex := &crdv1.ClassicExternalNat{
+			ObjectMeta	: c.objectMeta(svc, name),
+			Spec		: crdv1.ClassicExternalNatSpec{
+				IP			: vip,
+				Port		: strconv.Itoa(int(port.Port)),
+				Protocol	: strings.ToLower(string(port.Protocol)),
+				Backends	: []crdv1.ClassicExternalNatBackend{
+					crdv1.ClassicExternalNatBackend{PoolName : name},
+				},
+				SourceRanges	: svc.Spec.LoadBalancerSourceRanges,
+				DeviceRef		: svc.Annotations[ServiceDeviceAnnotation],
+			},
+		}
+		oldCex, err := cexclient.Get(name)
+		if errors.IsNotFound(err) {
+			_, err = cexclient.Create(cex)
+		} else if err == nil && !reflect.DeepEqual(oldCex.Spec, cex.Spec) {
+			oldCex.Spec = cex.Spec
+			_, err = cexclient.Update(oldCex, name)
+		}
+		if err != nil {
+			glog.Errorf("Sync cex %s/%s failed: %v", svc.Namespace, name, err)
+			return
+		}
+	}
+
+	err = c.deleteManaged(svc, names)
+	if err != nil {
+		glog.Errorf("Remove stale objects of service %s/%s failed: %v", svc.Namespace, svc.Name, err)
+	}
+
+	err = c.updateServiceStatus(svc, vip)
+	if err != nil {
+		glog.Errorf("Update status of service %s/%s failed: %v", svc.Namespace, svc.Name, err)
+	}
+}
+
+// deleteManaged removes the objects of the Service whose name is not in keep.
+func (c *ServiceController)deleteManaged(svc *v1.Service, keep map[string]bool)error{
+	selector := labels.SelectorFromSet(labels.Set{ServiceLabel : svc.Name}).String()
+	opts := meta_v1.ListOptions{LabelSelector : selector}
+
+	cexclient := crdclient.CexClient(c.crdClient, c.crdScheme, svc.Namespace)
+	cexs, err := cexclient.List(opts)
+	if err != nil {
+		return err
+	}
+	for _, cex := range cexs.Items {
+		if keep[cex.Name] {
+			continue
+		}
+		glog.V(2).Infof("Remove cex %s/%s of service %s", cex.Namespace, cex.Name, svc.Name)
+		err = cexclient.Delete(cex.Name, &meta_v1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	poolclient := crdclient.PoolClient(c.crdClient, c.crdScheme, svc.Namespace)
+	pools, err := poolclient.List(opts)
+	if err != nil {
+		return err
+	}
+	for _, pool := range pools.Items {
+		if keep[pool.Name] {
+			continue
+		}
+		glog.V(2).Infof("Remove pool %s/%s of service %s", pool.Namespace, pool.Name, svc.Name)
+		err = poolclient.Delete(pool.Name, &meta_v1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanup removes the objects of the Service and releases its vip.
+func (c *ServiceController)cleanup(svc *v1.Service) {
+	err := c.deleteManaged(svc, nil)
+	if err != nil {
+		glog.Errorf("Remove objects of service %s/%s failed: %v", svc.Namespace, svc.Name, err)
+	}
+	vip := serviceVip(svc)
+	if vip == "" {
+		return
+	}
+	utils.ReleaseIpAddr(svc.Namespace, vip)
+
+	// the Service may still exist with another type.
+	newSvc, err := c.client.CoreV1().Services(svc.Namespace).Get(svc.Name, meta_v1.GetOptions{})
+	if err != nil || len(newSvc.Status.LoadBalancer.Ingress) == 0 {
+		return
+	}
+	newSvc.Status.LoadBalancer.Ingress = nil
+	_, err = c.client.CoreV1().Services(svc.Namespace).UpdateStatus(newSvc)
+	if err != nil {
+		glog.Errorf("Clear status of service %s/%s failed: %v", svc.Namespace, svc.Name, err)
+	}
+}
+
+func (c *ServiceController)updateServiceStatus(svc *v1.Service, vip string)error{
+	lbIngress := []v1.LoadBalancerIngress{v1.LoadBalancerIngress{IP : vip}}
+	if reflect.DeepEqual(svc.Status.LoadBalancer.Ingress, lbIngress) {
+		return nil
+	}
+	newSvc := svc.DeepCopy()
+	newSvc.Status.LoadBalancer.Ingress = lbIngress
+	_, err := c.client.CoreV1().Services(svc.Namespace).UpdateStatus(newSvc)
+	return err
+}
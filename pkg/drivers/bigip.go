@@ -1,344 +1,1128 @@
-package drivers
-
-import (
-	"bytes"
-	"fmt"
-	"os"
-	"strings"
-	"text/template"	
-	
-	"github.com/golang/glog"
-	"github.com/scottdware/go-bigip"
-	
-//	"github.com/sak0/ygw/pkg/utils"	
-)
-
-const (
-	F5GWPROVIDER	= "f5"
-)
-
-const iRuletmpl = `
-when HTTP_REQUEST {
-    set host_info [string tolower [HTTP::host]]
-    switch -glob $host_info {
-{{range .Rules}}
-        {{.URL}} { pool {{.PoolName}} }
-{{end}}      
-    }
-}	
-`
-type RuleData struct {
-	Rules	[]Rule
-}
-type Rule struct {
-	URL			string
-	PoolName	string
-}
-
-type GwProvider interface {
-	CreatePool(string, string)error
-	AddPoolMember(string, string, string)error
-	DelPoolMember(string, string, string)error
-	DeletePool(string)error
-	CreateVirtualServer(string, string, string, string, string)error
-	DeleteVirtualServer(string)error
-	VirtualServerBindPool(string, string)error
-	VirtualServerBindURL(string, string, string)error
-	VirtualServerUnbindURL(string, string, string)error
-}
-
-type F5er struct{
-	client	*bigip.BigIP
-}
-
-func (f5 *F5er)createVirtualServerNat(name, ip, port, protocol string)error{
-	profiles := []bigip.Profile{
-		bigip.Profile{
-			Name: "fastL4",
-			Context: "all",		
-		},
-	}	
-	dest := ip + ":" + port
-	
-	vsConfig := &bigip.VirtualServer{
-		Name : name,
-		Mask : "255.255.255.255",
-		Destination : dest,
-		IPProtocol : protocol,
-		Profiles : profiles,
-	}
-	return f5.client.AddVirtualServer(vsConfig)
-}
-
-func (f5 *F5er)recreateVirtualServerURL(name, ip, port string)error{
-	err := f5.deleteVirtualServer(name)
-	if err != nil {
-		return err
-	}
-	return f5.createVirtualServerURL(name, ip, port)
-}
-
-func (f5 *F5er)deleteVirtualServer(name string)error{
-	return f5.client.DeleteVirtualServer(name)
-}
-
-func (f5 *F5er)DeleteVirtualServer(name string)error{
-	return f5.deleteVirtualServer(name)
-}
-
-func (f5 *F5er)createVirtualServerURL(name, ip, port string)error{
-	profiles := []bigip.Profile{
-		bigip.Profile{
-			Name: "http",
-			Context: "all",
-		},
-		bigip.Profile{
-			Name: "tcp",
-			Context: "all",		
-		},
-	}
-	
-	dest := ip + ":" + port
-	
-	vsConfig := &bigip.VirtualServer{
-		Name : name,
-		Mask : "255.255.255.255",
-		Destination : dest,
-		IPProtocol : "tcp",
-//		RateLimit : "10240",
-		Profiles: profiles,
-	}
-	return f5.client.AddVirtualServer(vsConfig)
-}
-func (f5 *F5er)CreateVirtualServer(vsType string, name string, ip string, port string, protocol string)error{
-	var err error
-	if port == "*" || protocol == "*" {
-		port = "0"
-		protocol = "any"
-	}	
-	
-	switch vsType {
-		case "nat":
-			err = f5.createVirtualServerNat(name, ip, port, protocol)
-			if err != nil {
-				if strings.Contains(err.Error(), "already exists") {
-					glog.Infof("virtualServer %s Already exists, skip create.", name)
-				} else {
-					return err
-				}					
-			}
-		case "url":
-			err = f5.createVirtualServerURL(name, ip, port)
-			if err != nil {
-				if strings.Contains(err.Error(), "already exists") {
-					fmt.Printf("Already exists, skip create\n")
-				} else {
-					return err
-				}					
-			}
-		default:
-			return fmt.Errorf("Can't support vsType %s", vsType)					
-	}
-	return nil
-}
-
-func (f5 *F5er)VirtualServerBindPool(vsName, poolName string)error{
-	vsConfig := &bigip.VirtualServer{
-		Name : vsName,
-		Pool : poolName,
-	}	
-	return f5.client.ModifyVirtualServer(vsName, vsConfig)	
-}
-func (f5 *F5er)VirtualServerUnbindPool(vsName, poolName string)error{
-	vsConfig := &bigip.VirtualServer{
-		Name : vsName,
-		Pool : "None",
-	}	
-	return f5.client.ModifyVirtualServer(vsName, vsConfig)	
-}
-func (f5 *F5er)VirtualServerBindURL(vsName, URL, poolName string)error{
-    vs, err := f5.client.GetVirtualServer(vsName)
-    if err != nil || vs == nil {
-    	glog.Errorf("GetVirtualServer %s failed.", vsName)
-		return err   
-    }
-    rules := vs.Rules	
-	
-	iRuleName := "iRule_" + vsName + "_" + URL + "_" + poolName
-	buff := bytes.NewBufferString("")
-	ruleTmpl := template.Must(template.New("irule").Parse(iRuletmpl))
-	data := RuleData{
-		Rules : []Rule{
-			Rule{
-				URL : URL,
-				PoolName : poolName,
-			},		
-		},
-	}
-	ruleTmpl.Execute(buff, data)
-	
-    err = f5.client.CreateIRule(iRuleName, buff.String())
-    if err != nil {
-	    if strings.Contains(err.Error(), "already exists") {
-		    glog.Infof("iRule %s Already exists. skip create.", iRuleName)
-	    } else {
-		    return err
-	    }
-    }
-    rules = append(rules, iRuleName)
-
-	vsConfig := &bigip.VirtualServer{
-		Name : vsName,
-		Rules : rules,
-	}	
-	return f5.client.ModifyVirtualServer(vsName, vsConfig) 
-}
-
-func (f5 *F5er)VirtualServerUnbindURL(vsName, URL, poolName string)error{
-    vs, err := f5.client.GetVirtualServer(vsName)
-    if err != nil {
-		return err   
-    }
-    addr := vs.Destination
-    ip := strings.Split(addr, ":")[0]
-    port := strings.Split(addr, ":")[1]
-    rules := vs.Rules
-    
-    iRuleName := "iRule_" + vsName + "_" + URL + "_" + poolName
-    index := -1
-    for i, rule := range rules {
-    	ruleName := strings.Split(rule, "/")[2]
-	    if ruleName == iRuleName {
-		    index = i
-	    }
-    }
-    if index == -1 {
-    	glog.Infof("rule %s is not associate with virtual server.", iRuleName)
-//	    return nil
-    } else {
-	    rules = append(rules[:index], rules[index + 1:]...)
-	    if len(rules) == 0 {
-	    	//TODO : no rest api for clean ruls yet. workaround for Recreate
-	    	glog.Infof("Recreate VirtualServer %s for clean iRules.", vsName) 
-		    return f5.recreateVirtualServerURL(vsName, ip, port)
-	    }
-    
-	 	vsConfig := &bigip.VirtualServer{
-			Name : vsName,
-			Rules : rules,
-		}	
-		err = f5.client.ModifyVirtualServer(vsName, vsConfig)
-		if err != nil {
-			glog.Errorf("configure virtual server failed: %v\n", err)
-		}    
-    }
-    
-	glog.Infof("Delete iRule: %s", iRuleName)
-	err = f5.client.DeleteIRule(iRuleName)
-	if err != nil {
-		if strings.Contains(err.Error(), "was not found") {
-			glog.Warningf("iRule %s is not exists.", iRuleName)
-		} else {
-			return err
-		}
-	}
-	
-	return nil     	
-}
-
-func (f5 *F5er)CreatePool(poolName, lbMethod string)error{
-	err := f5.client.CreatePool(poolName)
-	if err != nil {
-		if strings.Contains(err.Error(), "already exists") {
-			glog.Infof("pool %s Already exists, skip create.", poolName)
-		} else {
-			return err
-		}		
-	}	
-	
-	poolConfig := &bigip.Pool{
-		Name : poolName,
-		LoadBalancingMode : lbMethod,
-	}
-	return f5.client.ModifyPool(poolName, poolConfig)
-}
-
-func (f5 *F5er)DeletePool(poolName string)error{
-	err := f5.client.DeletePool(poolName)
-	if err != nil {
-		if strings.Contains(err.Error(), "was not found") {
-			glog.Warningf("Pool %s is not exists.", poolName)
-		} else {
-			return err
-		}	
-	}
-	
-	return nil
-}
-
-func (f5 *F5er)AddPoolMember(poolName, memberIp, memberPort string)error{
-	if memberPort == "*" {
-		memberPort = "0"
-	}	
-	
-	memberConfig := &bigip.PoolMember {
-		Name : memberIp + ":" + memberPort,
-	}
-	
-	err := f5.client.CreateNode(memberIp, memberIp)
-	if err != nil {
-		if strings.Contains(err.Error(), "already exists") {
-			glog.Infof("node %s Already exists, skip create.", memberIp)
-		} else {
-			return err
-		}		
-	}	
-	
-	err = f5.client.CreatePoolMember(poolName, memberConfig)
-	if err != nil {
-		if strings.Contains(err.Error(), "already exists") {
-			glog.Infof("poolmember %s Already exists, skip create.", memberConfig.Name)
-		} else {
-			return err
-		}		
-	}
-	
-	return nil	
-}
-
-func (f5 *F5er)DelPoolMember(poolName, memberIp, memberPort string)error{
-	if memberPort == "*" {
-		memberPort = "0"
-	}
-	
-	member := memberIp + ":" + memberPort
-	err := f5.client.DeletePoolMember(poolName, member)
-	if err != nil {
-		if strings.Contains(err.Error(), "was not found") {
-			glog.Infof("Already deleted, skip delete.")
-		} else {
-			return err
-		}		
-	}
-	
-	return f5.client.DeleteNode(memberIp)
-}
-
-func New(gwtype string)(GwProvider, error){	
-	switch gwtype {
-		case F5GWPROVIDER:
-			url := os.Getenv("BIGIP_URL")
-			username := os.Getenv("BIGIP_LOGIN")
-			password := os.Getenv("BIGIP_PASSWORD")
-			if url == "" || username == "" || password == "" {
-				return nil, fmt.Errorf("Could not completely determine login parameters from env: BIGIP_URL, BIGIP_LOGIN, BIGIP_PASSWORD")
-			}		
-			client := bigip.NewSession(url, username, password, nil)
-			f5er := &F5er{
-				client : client,
-			}			
-			return f5er, nil
-		default:
-			return nil, fmt.Errorf("Unsupport type: %s", gwtype)
-	}
-}
\ No newline at end of file
+package drivers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"	
+	
+	"github.com/golang/glog"
+	"github.com/scottdware/go-bigip"
+	
+//	"github.com/sak0/ygw/pkg/utils"	
+)
+
+const (
+	F5GWPROVIDER	= "f5"
+	F5DEFAULTPARTITION	= "Common"
+)
+
+const iRuletmpl = `
+when HTTP_REQUEST{{if .Priority}} priority {{.Priority}}{{end}} {
+    set host_info [string tolower [HTTP::host]]
+    switch -glob $host_info {
+{{range .Rules}}
+        {{tcl .URL}} {
+{{- if .Path}}
+          if { [HTTP::path] eq "{{tcl .Path}}" || [HTTP::path] starts_with "{{tcl .Path}}/" } {
+{{- end}}
+{{- if .Location}}
+            {{if eq .Code 302}}HTTP::redirect "{{.Location}}"{{else}}HTTP::respond {{.Code}} Location "{{.Location}}"{{end}}
+{{- else}}
+{{- if .RewriteFrom}}
+            if { [HTTP::path] eq "{{tcl .RewriteFrom}}" || [HTTP::path] starts_with "{{tcl .RewriteFrom}}/" } {
+                set uri "{{tcl .RewriteTo}}[string range [HTTP::uri] {{len .RewriteFrom}} end]"
+                if { [string index $uri 0] ne "/" } { set uri "/$uri" }
+                HTTP::uri $uri
+            }
+{{- end}}
+            pool {{.PoolName}}
+{{- end}}
+{{- if .Path}}
+          }
+{{- end}}
+        }
+{{end}}      
+    }
+}	
+`
+// defaultTmpl answers the requests no host rule sent to a pool. It runs after
+// the host switch of the rule iRules, and the default pool of the virtual
+// server, when there is one, always wins. A redirect rule has answered already.
+const defaultTmpl = `
+when HTTP_REQUEST priority 900 {
+    if { [LB::server pool] eq "" && ![HTTP::has_responded] } {
+        HTTP::respond {{.Code}} content "{{tcl .Body}}" "Content-Type" "{{tcl .ContentType}}" "Connection" "close"
+    }
+}
+`
+// sourceRangesTmpl drops the connections of clients outside the ranges.
+const sourceRangesTmpl = `
+when CLIENT_ACCEPTED {
+    if { !({{range $i, $r := .}}{{if $i}} || {{end}}[IP::addr [IP::client_addr] equals {{$r}}]{{end}}) } {
+        reject
+    }
+}
+`
+type DefaultData struct {
+	Code		int
+	ContentType	string
+	Body		string
+}
+
+type RuleData struct {
+	// rules with a path run after the host only ones, the longest path
+	// last, so that the most specific pool selection wins.
+	Priority	int
+	Rules		[]IRule
+}
+// IRule is a host and path match of an iRule.
+type IRule struct {
+	URL			string
+	Path		string
+	PoolName	string
+	
+	// redirect action, used instead of PoolName when Location is set. It is
+	// Tcl, the user parts of it are escaped already.
+	Location	string
+	Code		int
+	
+	// rewrite action, applied before the request is sent to PoolName.
+	RewriteFrom	string
+	RewriteTo	string
+}
+
+type GwProvider interface {
+	CreatePool(string, string)error
+	AddPoolMember(string, string, string)error
+	DelPoolMember(string, string, string)error
+	EnablePoolMember(string, string, string)error
+	DisablePoolMember(string, string, string)error
+	PoolMemberConnections(string, string, string)(int, error)
+	PoolMembers(string)(map[string]bool, error)
+	DeletePool(string)error
+	SetPoolMinActiveMembers(string, int)error
+	SetPoolMemberPriority(string, string, string, int)error
+	SetPoolSlowStart(string, int)error
+	SetPoolMemberLimits(string, string, string, int, int)error
+	CreateVirtualServer(string, string, string, string, string)error
+	DeleteVirtualServer(string)error
+	VirtualServerBindPool(string, string)error
+	VirtualServerUnbindPool(string, string)error
+	VirtualServerSetSourceRanges(string, []string)error
+	VirtualServerBindDefaultResponse(string, int, string, string)error
+	VirtualServerUnbindDefaultResponse(string)error
+	VirtualServerBindTLS(string, string, string, []byte, []byte)error
+	VirtualServerUnbindTLS(string, string)error
+	VirtualServerBindURL(string, string, string)error
+	VirtualServerUnbindURL(string, string, string)error
+	VirtualServerBindRedirect(string, string, string, string, int)error
+	VirtualServerUnbindRedirect(string, string, string, string, int)error
+	VirtualServerBindRewrite(string, string, string, string, string)error
+	VirtualServerUnbindRewrite(string, string, string, string, string)error
+	Partition(string)GwProvider
+	Login()error
+	Logout()
+}
+
+type F5er struct{
+	session		*f5Session
+	device		Device
+	// partition holds the objects of this driver, the partition of the
+	// device when empty.
+	partition	string
+	partitions	*partitionCache
+}
+
+// partitionCache remembers the partitions already created on the device, it
+// is shared by the drivers of all partitions of a session.
+type partitionCache struct {
+	lock	sync.Mutex
+	created	map[string]bool
+}
+
+// Partition returns a driver for the objects of the BIG-IP partition name,
+// which is created when the first pool or virtual server is. Empty is the
+// partition of the device.
+func (f5 *F5er)Partition(name string)GwProvider{
+	return &F5er{
+		session		: f5.session,
+		device		: f5.device,
+		partition	: name,
+		partitions	: f5.partitions,
+	}
+}
+
+func (f5 *F5er)partitionName()string{
+	if f5.partition != "" {
+		return f5.partition
+	}
+	if f5.device.Partition != "" {
+		return f5.device.Partition
+	}
+	return F5DEFAULTPARTITION
+}
+
+// ensurePartition creates the partition of the driver if needed.
+func (f5 *F5er)ensurePartition()error{
+	name := f5.partitionName()
+	if name == F5DEFAULTPARTITION {
+		return nil
+	}
+	f5.partitions.lock.Lock()
+	defer f5.partitions.lock.Unlock()
+	if f5.partitions.created[name] {
+		return nil
+	}
+	err := f5.apiCall("POST", "auth/partition", map[string]string{"name" : name})
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	glog.V(2).Infof("Partition %s is ready.", name)
+	f5.partitions.created[name] = true
+	return nil
+}
+
+// fullPath returns the /partition/name of an object, names which already
+// are full paths, like pools of other partitions, are kept.
+func (f5 *F5er)fullPath(name string)string{
+	if strings.HasPrefix(name, "/") {
+		return name
+	}
+	return "/" + f5.partitionName() + "/" + name
+}
+
+// uri returns the ~partition~name form of an object used in REST urls.
+func (f5 *F5er)uri(name string)string{
+	return strings.Replace(f5.fullPath(name), "/", "~", -1)
+}
+
+// baseName strips the partition of a full path.
+func baseName(name string)string{
+	return name[strings.LastIndex(name, "/") + 1:]
+}
+
+// joinDestination builds a BIG-IP destination or member name, IPv6 addresses
+// are separated from the port by a dot.
+func joinDestination(ip, port string)string{
+	if strings.Contains(ip, ":") {
+		return ip + "." + port
+	}
+	return ip + ":" + port
+}
+
+func splitDestination(dest string)(string, string){
+	sep := ":"
+	if strings.Count(dest, ":") > 1 {
+		sep = "."
+	}
+	i := strings.LastIndex(dest, sep)
+	if i < 0 {
+		return dest, ""
+	}
+	return dest[:i], dest[i+1:]
+}
+
+func hostMask(ip string)string{
+	if strings.Contains(ip, ":") {
+		return "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"
+	}
+	return "255.255.255.255"
+}
+
+// l4Profile returns the profile of a nat virtual server for protocol.
+func l4Profile(protocol string)string{
+	switch protocol {
+		case "udp":
+			return "udp"
+		case "sctp":
+			return "sctp"
+	}
+	return "fastL4"
+}
+
+func trafficMatchingName(name string)string{
+	return name + "_tmc"
+}
+
+// createVirtualServerRange serves a port range like "5060-5070", BIG-IP
+// matches ranges with a traffic-matching-criteria instead of a destination.
+func (f5 *F5er)createVirtualServerRange(name, ip, port, protocol string)error{
+	source := "0.0.0.0/0"
+	if strings.Contains(ip, ":") {
+		source = "::/0"
+	}
+	tmc := map[string]string{
+		"name" : trafficMatchingName(name),
+		"partition" : f5.partitionName(),
+		"destinationAddressInline" : ip,
+		"destinationPortInline" : port,
+		"sourceAddressInline" : source,
+		"protocol" : protocol,
+	}
+	err := f5.apiCall("POST", "ltm/traffic-matching-criteria", tmc)
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	vs := map[string]interface{}{
+		"name" : name,
+		"partition" : f5.partitionName(),
+		"ipProtocol" : protocol,
+		"trafficMatchingCriteria" : f5.fullPath(trafficMatchingName(name)),
+		"profiles" : []bigip.Profile{
+			bigip.Profile{
+				Name: l4Profile(protocol),
+				Context: "all",
+			},
+		},
+	}
+	return f5.apiCall("POST", "ltm/virtual", vs)
+}
+
+func (f5 *F5er)createVirtualServerNat(name, ip, port, protocol string)error{
+	if strings.Contains(port, "-") {
+		return f5.createVirtualServerRange(name, ip, port, protocol)
+	}
+	profiles := []bigip.Profile{
+		bigip.Profile{
+			Name: l4Profile(protocol),
+			Context: "all",		
+		},
+	}	
+	vsConfig := &bigip.VirtualServer{
+		Name : name,
+		Partition : f5.partitionName(),
+		Mask : hostMask(ip),
+		Destination : f5.fullPath(joinDestination(ip, port)),
+		IPProtocol : protocol,
+		Profiles : profiles,
+	}
+	return f5.call(func(c *bigip.BigIP)error{
+		return c.AddVirtualServer(vsConfig)
+	})
+}
+
+func (f5 *F5er)deleteVirtualServer(name string)error{
+	return f5.call(func(c *bigip.BigIP)error{
+		return c.DeleteVirtualServer(f5.uri(name))
+	})
+}
+
+func (f5 *F5er)DeleteVirtualServer(name string)error{
+	err := f5.deleteVirtualServer(name)
+	if err != nil {
+		return err
+	}
+	// only port range virtual servers have one.
+	err = f5.apiCall("DELETE", "ltm/traffic-matching-criteria/" + f5.uri(trafficMatchingName(name)), nil)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (f5 *F5er)createVirtualServerURL(name, ip, port string)error{
+	profiles := []bigip.Profile{
+		bigip.Profile{
+			Name: "http",
+			Context: "all",
+		},
+		bigip.Profile{
+			Name: "tcp",
+			Context: "all",		
+		},
+	}
+	
+	vsConfig := &bigip.VirtualServer{
+		Name : name,
+		Partition : f5.partitionName(),
+		Mask : hostMask(ip),
+		Destination : f5.fullPath(joinDestination(ip, port)),
+		IPProtocol : "tcp",
+//		RateLimit : "10240",
+		Profiles: profiles,
+	}
+	return f5.call(func(c *bigip.BigIP)error{
+		return c.AddVirtualServer(vsConfig)
+	})
+}
+func (f5 *F5er)CreateVirtualServer(vsType string, name string, ip string, port string, protocol string)error{
+	var err error
+	if port == "*" || protocol == "*" {
+		port = "0"
+		protocol = "any"
+	}	
+	err = f5.ensurePartition()
+	if err != nil {
+		return err
+	}
+	
+	switch vsType {
+		case "nat":
+			err = f5.createVirtualServerNat(name, ip, port, protocol)
+			if err != nil {
+				if IsAlreadyExists(err) {
+					glog.Infof("virtualServer %s Already exists, skip create.", name)
+				} else {
+					return err
+				}					
+			}
+		case "url":
+			err = f5.createVirtualServerURL(name, ip, port)
+			if err != nil {
+				if IsAlreadyExists(err) {
+					glog.Infof("virtualServer %s Already exists, skip create.", name)
+				} else {
+					return err
+				}					
+			}
+		default:
+			return fmt.Errorf("Can't support vsType %s", vsType)					
+	}
+	return nil
+}
+
+func (f5 *F5er)VirtualServerBindPool(vsName, poolName string)error{
+	vsConfig := &bigip.VirtualServer{
+		Name : vsName,
+		Pool : f5.fullPath(poolName),
+	}	
+	return f5.call(func(c *bigip.BigIP)error{
+		return c.ModifyVirtualServer(f5.uri(vsName), vsConfig)
+	})	
+}
+func (f5 *F5er)VirtualServerUnbindPool(vsName, poolName string)error{
+	vsConfig := &bigip.VirtualServer{
+		Name : vsName,
+		Pool : "None",
+	}	
+	return f5.call(func(c *bigip.BigIP)error{
+		return c.ModifyVirtualServer(f5.uri(vsName), vsConfig)
+	})	
+}
+func renderIRule(tmpl string, data interface{})string{
+	buff := bytes.NewBufferString("")
+	// tcl escapes the user values put in Tcl strings.
+	ruleTmpl := template.Must(template.New("irule").Funcs(template.FuncMap{"tcl" : tclEscape}).Parse(tmpl))
+	ruleTmpl.Execute(buff, data)
+	return buff.String()
+}
+
+// hostRule renders the iRule of one host rule. The path matches whole
+// segments, /api does not take /apiv2.
+func hostRule(rule IRule)string{
+	rule.Path = strings.TrimSuffix(rule.Path, "/")
+	data := RuleData{
+		Rules : []IRule{
+			rule,
+		},
+	}
+	if rule.Path != "" {
+		data.Priority = 500 + len(rule.Path)
+		if data.Priority > 899 {
+			data.Priority = 899
+		}
+	}
+	return renderIRule(iRuletmpl, data)
+}
+
+// splitURL splits a rule URL of the form host[/path] into the host pattern and
+// the path prefix.
+func splitURL(URL string)(string, string){
+	i := strings.Index(URL, "/")
+	if i < 0 {
+		return URL, ""
+	}
+	host, path := URL[:i], URL[i:]
+	if path == "/" {
+		path = ""
+	}
+	return host, path
+}
+
+func iRuleBaseName(vsName, URL string)string{
+	name := strings.Replace(strings.TrimSuffix(URL, "/"), "/", "_", -1)
+	return "iRule_" + vsName + "_" + strings.Replace(name, "*", "any", -1)
+}
+
+// getVirtualServer returns the virtual server, go-bigip answers nil without
+// an error for a missing one.
+func (f5 *F5er)getVirtualServer(vsName string)(*bigip.VirtualServer, error){
+	var vs *bigip.VirtualServer
+	err := f5.call(func(c *bigip.BigIP)error{
+		var err error
+		vs, err = c.GetVirtualServer(f5.uri(vsName))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if vs == nil {
+		return nil, &Error{Reason : ErrorReasonNotFound, Err : fmt.Errorf("virtual server %s not found", vsName)}
+	}
+	return vs, nil
+}
+
+func (f5 *F5er)bindIRule(vsName, iRuleName string, content string)error{
+    vs, err := f5.getVirtualServer(vsName)
+    if err != nil {
+    	glog.Errorf("GetVirtualServer %s failed.", vsName)
+		return err   
+    }
+    rules := vs.Rules	
+	
+    err = f5.createIRule(iRuleName, content)
+    if err != nil {
+	    if IsAlreadyExists(err) {
+		    glog.Infof("iRule %s Already exists. skip create.", iRuleName)
+	    } else {
+		    return err
+	    }
+    }
+    rules = append(rules, f5.fullPath(iRuleName))
+
+	vsConfig := &bigip.VirtualServer{
+		Name : vsName,
+		Rules : rules,
+	}	
+	return f5.call(func(c *bigip.BigIP)error{
+		return c.ModifyVirtualServer(f5.uri(vsName), vsConfig)
+	}) 
+}
+
+// createIRule creates the iRule in the partition of the driver, go-bigip
+// only creates them in /Common.
+func (f5 *F5er)createIRule(name, content string)error{
+	rule := map[string]string{
+		"name" : name,
+		"partition" : f5.partitionName(),
+		"apiAnonymous" : content,
+	}
+	return f5.apiCall("POST", "ltm/rule", rule)
+}
+
+// unbindIRule removes the iRule from the virtual server and deletes it. The
+// rules are patched, so the profiles of the virtual server are kept when the
+// last one goes.
+func (f5 *F5er)unbindIRule(vsName, iRuleName string)error{
+	vs, err := f5.getVirtualServer(vsName)
+	if err != nil {
+		return err
+	}
+	rules := []string{}
+	for _, rule := range vs.Rules {
+		if baseName(rule) != iRuleName {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == len(vs.Rules) {
+		glog.Infof("rule %s is not associate with virtual server.", iRuleName)
+	} else {
+		// go-bigip drops an empty rule list, patch it directly.
+		err = f5.apiCall("PATCH", "ltm/virtual/" + f5.uri(vsName), map[string][]string{"rules" : rules})
+		if err != nil {
+			glog.Errorf("configure virtual server failed: %v\n", err)
+			return err
+		}
+	}
+	
+	glog.Infof("Delete iRule: %s", iRuleName)
+	err = f5.call(func(c *bigip.BigIP)error{
+		return c.DeleteIRule(f5.uri(iRuleName))
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			glog.Warningf("iRule %s is not exists.", iRuleName)
+		} else {
+			return err
+		}
+	}
+	
+	return nil     	
+}
+
+func (f5 *F5er)VirtualServerBindURL(vsName, URL, poolName string)error{
+	iRuleName := iRuleBaseName(vsName, URL) + "_" + baseName(poolName)
+	host, path := splitURL(URL)
+	rule := IRule{
+		URL : host,
+		Path : path,
+		PoolName : poolName,
+	}
+	return f5.bindIRule(vsName, iRuleName, hostRule(rule))
+}
+
+func (f5 *F5er)VirtualServerUnbindURL(vsName, URL, poolName string)error{
+    iRuleName := iRuleBaseName(vsName, URL) + "_" + baseName(poolName)
+	return f5.unbindIRule(vsName, iRuleName)
+}
+
+// redirectRule builds the iRule answering requests for URL with a redirect.
+// The name carries a hash of the target so that changing the redirect of a
+// host never collides with the iRule it replaces.
+func redirectRule(vsName, URL, scheme, host string, code int)(string, IRule){
+	if scheme == "" {
+		scheme = "http"
+	}
+	scheme = tclEscape(scheme)
+	if host == "" {
+		host = "[HTTP::host]"
+	} else {
+		host = tclEscape(host)
+	}
+	if code == 0 {
+		code = 302
+	}
+	location := scheme + "://" + host + "[HTTP::uri]"
+	iRuleName := iRuleBaseName(vsName, URL) + "_redirect_" + ruleHash(location, strconv.Itoa(code))
+	host, path := splitURL(URL)
+	return iRuleName, IRule{
+		URL : host,
+		Path : path,
+		Location : location,
+		Code : code,
+	}
+}
+
+// rewriteRule builds the iRule replacing the path prefix of requests for URL
+// before they are sent to poolName.
+func rewriteRule(vsName, URL, prefix, replacement, poolName string)(string, IRule){
+	prefix = strings.TrimSuffix(prefix, "/")
+	replacement = strings.TrimSuffix(replacement, "/")
+	iRuleName := iRuleBaseName(vsName, URL) + "_" + baseName(poolName) + "_rewrite_" + ruleHash(prefix, replacement)
+	host, path := splitURL(URL)
+	return iRuleName, IRule{
+		URL : host,
+		Path : path,
+		PoolName : poolName,
+		RewriteFrom : prefix,
+		RewriteTo : replacement,
+	}
+}
+
+func ruleHash(parts ...string)string{
+	h := fnv.New32()
+	h.Write([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (f5 *F5er)VirtualServerBindRedirect(vsName, URL, scheme, host string, code int)error{
+	iRuleName, rule := redirectRule(vsName, URL, scheme, host, code)
+	return f5.bindIRule(vsName, iRuleName, hostRule(rule))
+}
+
+func (f5 *F5er)VirtualServerUnbindRedirect(vsName, URL, scheme, host string, code int)error{
+	iRuleName, _ := redirectRule(vsName, URL, scheme, host, code)
+	return f5.unbindIRule(vsName, iRuleName)
+}
+
+func (f5 *F5er)VirtualServerBindRewrite(vsName, URL, prefix, replacement, poolName string)error{
+	iRuleName, rule := rewriteRule(vsName, URL, prefix, replacement, poolName)
+	return f5.bindIRule(vsName, iRuleName, hostRule(rule))
+}
+
+func (f5 *F5er)VirtualServerUnbindRewrite(vsName, URL, prefix, replacement, poolName string)error{
+	iRuleName, _ := rewriteRule(vsName, URL, prefix, replacement, poolName)
+	return f5.unbindIRule(vsName, iRuleName)
+}
+
+func (f5 *F5er)VirtualServerBindDefaultResponse(vsName string, code int, contentType, body string)error{
+	if code == 0 {
+		code = 503
+	}
+	if contentType == "" {
+		contentType = "text/html"
+	}
+	data := DefaultData{
+		Code : code,
+		ContentType : contentType,
+		Body : body,
+	}
+	iRuleName := "iRule_" + vsName + "_default"
+	// the body may have changed, so replace any previous response.
+	err := f5.unbindIRule(vsName, iRuleName)
+	if err != nil {
+		return err
+	}
+	return f5.bindIRule(vsName, iRuleName, renderIRule(defaultTmpl, data))
+}
+
+func (f5 *F5er)VirtualServerUnbindDefaultResponse(vsName string)error{
+	return f5.unbindIRule(vsName, "iRule_" + vsName + "_default")
+}
+
+// tclEscape makes s safe inside a double quoted Tcl word.
+func tclEscape(s string)string{
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, `[`, `\[`, `]`, `\]`)
+	return replacer.Replace(s)
+}
+
+// apiCall sends a raw iControl REST request for the objects go-bigip has no
+// helper for. url is relative to /mgmt/tm/.
+func (f5 *F5er)apiCall(method, url string, body interface{})error{
+	req := &bigip.APIRequest{
+		Method : method,
+		URL : url,
+		ContentType : "application/json",
+	}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		req.Body = string(data)
+	}
+	return f5.call(func(c *bigip.BigIP)error{
+		_, err := c.APICall(req)
+		return err
+	})
+}
+
+// apiGet reads an iControl REST object into out.
+func (f5 *F5er)apiGet(url string, out interface{})error{
+	req := &bigip.APIRequest{
+		Method : "GET",
+		URL : url,
+		ContentType : "application/json",
+	}
+	var data []byte
+	err := f5.call(func(c *bigip.BigIP)error{
+		var err error
+		data, err = c.APICall(req)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// VirtualServerSetSourceRanges replaces the client filter of the virtual
+// server, no ranges remove it.
+func (f5 *F5er)VirtualServerSetSourceRanges(vsName string, ranges []string)error{
+	iRuleName := "iRule_" + vsName + "_source_ranges"
+	vs, err := f5.getVirtualServer(vsName)
+	if err != nil {
+		glog.Errorf("GetVirtualServer %s failed.", vsName)
+		return err
+	}
+	rules := []string{}
+	for _, rule := range vs.Rules {
+		if !strings.HasSuffix(rule, "/" + iRuleName) {
+			rules = append(rules, rule)
+		}
+	}
+	
+	if len(ranges) > 0 {
+		content := renderIRule(sourceRangesTmpl, ranges)
+		err = f5.createIRule(iRuleName, content)
+		if err != nil {
+			if !IsAlreadyExists(err) {
+				return err
+			}
+			err = f5.call(func(c *bigip.BigIP)error{
+				return c.ModifyIRule(f5.uri(iRuleName), &bigip.IRule{Name : iRuleName, Rule : content})
+			})
+			if err != nil {
+				return err
+			}
+		}
+		rules = append(rules, f5.fullPath(iRuleName))
+	}
+	
+	// go-bigip drops an empty rule list, patch it directly.
+	err = f5.apiCall("PATCH", "ltm/virtual/" + f5.uri(vsName), map[string][]string{"rules" : rules})
+	if err != nil {
+		return err
+	}
+	if len(ranges) == 0 {
+		err = f5.call(func(c *bigip.BigIP)error{
+			return c.DeleteIRule(f5.uri(iRuleName))
+		})
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// VirtualServerBindTLS installs cert and key and terminates TLS on the virtual
+// server with a client-ssl profile named certName. When several certificates
+// are bound the device selects one by SNI, the profile with an empty
+// serverName answers clients without a matching name.
+func (f5 *F5er)VirtualServerBindTLS(vsName, certName, serverName string, cert, key []byte)error{
+	err := f5.call(func(c *bigip.BigIP)error{
+		_, err := c.UploadBytes(cert, certName + ".crt")
+		if err != nil {
+			return err
+		}
+		_, err = c.UploadBytes(key, certName + ".key")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	files := map[string]string{"cert" : certName + ".crt", "key" : certName + ".key"}
+	for kind, file := range files {
+		install := map[string]string{
+			"command" : "install",
+			"name" : f5.fullPath(certName),
+			"from-local-file" : "/var/config/rest/downloads/" + file,
+		}
+		err = f5.apiCall("POST", "sys/crypto/" + kind, install)
+		if err != nil {
+			return err
+		}
+	}
+	
+	profile := map[string]interface{}{
+		"name" : certName,
+		"partition" : f5.partitionName(),
+		"defaultsFrom" : "/Common/clientssl",
+		"serverName" : serverName,
+		"sniDefault" : serverName == "",
+		"certKeyChain" : []map[string]string{
+			map[string]string{
+				"name" : certName,
+				"cert" : f5.fullPath(certName),
+				"key" : f5.fullPath(certName),
+			},
+		},
+	}
+	err = f5.apiCall("POST", "ltm/profile/client-ssl", profile)
+	if err != nil {
+		if IsAlreadyExists(err) {
+			glog.Infof("client-ssl profile %s Already exists, update it.", certName)
+			err = f5.apiCall("PATCH", "ltm/profile/client-ssl/" + f5.uri(certName), profile)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	
+	vsProfile := map[string]string{
+		"name" : f5.fullPath(certName),
+		"context" : "clientside",
+	}
+	err = f5.apiCall("POST", "ltm/virtual/" + f5.uri(vsName) + "/profiles", vsProfile)
+	if err != nil {
+		if IsAlreadyExists(err) {
+			glog.Infof("profile %s Already bound to %s, skip.", certName, vsName)
+		} else {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f5 *F5er)VirtualServerUnbindTLS(vsName, certName string)error{
+	err := f5.apiCall("DELETE", "ltm/virtual/" + f5.uri(vsName) + "/profiles/" + f5.uri(certName), nil)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	for _, url := range []string{"ltm/profile/client-ssl/", "sys/crypto/cert/", "sys/crypto/key/"} {
+		err = f5.apiCall("DELETE", url + f5.uri(certName), nil)
+		if err != nil {
+			if IsNotFound(err) {
+				glog.Warningf("%s%s is not exists.", url, certName)
+			} else {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// f5Methods translates the neutral lb methods, empty ones are unsupported.
+var f5Methods = map[string]string{
+	METHODROUNDROBIN				: "round-robin",
+	METHODLEASTCONNECTIONS			: "least-connections-member",
+	METHODRATIO						: "ratio-member",
+	METHODRATIOLEASTCONNECTIONS		: "ratio-least-connections-member",
+	METHODFASTESTRESPONSE			: "fastest-app-response",
+	METHODSOURCEIPHASH				: "",
+	METHODLEASTBANDWIDTH			: "",
+	METHODOBSERVED					: "observed-member",
+	METHODPREDICTIVE				: "predictive-member",
+}
+
+func (f5 *F5er)CreatePool(poolName, lbMethod string)error{
+	mode, err := translateMethod(F5GWPROVIDER, f5Methods, lbMethod)
+	if err != nil {
+		return err
+	}
+	
+	err = f5.ensurePartition()
+	if err != nil {
+		return err
+	}
+	
+	err = f5.call(func(c *bigip.BigIP)error{
+		return c.AddPool(&bigip.Pool{Name : baseName(poolName), Partition : f5.partitionName()})
+	})
+	if err != nil {
+		if IsAlreadyExists(err) {
+			glog.Infof("pool %s Already exists, skip create.", poolName)
+		} else {
+			return err
+		}		
+	}	
+	
+	poolConfig := &bigip.Pool{
+		Name : baseName(poolName),
+		LoadBalancingMode : mode,
+	}
+	return f5.call(func(c *bigip.BigIP)error{
+		return c.ModifyPool(f5.uri(poolName), poolConfig)
+	})
+}
+
+// SetPoolMinActiveMembers turns on priority group activation, lower priority
+// members get traffic when less than minActive higher ones are up. Zero
+// turns it off.
+func (f5 *F5er)SetPoolMinActiveMembers(poolName string, minActive int)error{
+	return f5.apiCall("PATCH", "ltm/pool/" + f5.uri(poolName), map[string]int{"minActiveMembers" : minActive})
+}
+
+func (f5 *F5er)SetPoolMemberPriority(poolName, memberIp, memberPort string, priority int)error{
+	if memberPort == "*" {
+		memberPort = "0"
+	}
+	url := "ltm/pool/" + f5.uri(poolName) + "/members/" + f5.uri(joinDestination(memberIp, memberPort))
+	return f5.apiCall("PATCH", url, map[string]int{"priorityGroup" : priority})
+}
+
+// SetPoolSlowStart ramps up new members over seconds, zero turns it off.
+func (f5 *F5er)SetPoolSlowStart(poolName string, seconds int)error{
+	return f5.apiCall("PATCH", "ltm/pool/" + f5.uri(poolName), map[string]int{"slowRampTime" : seconds})
+}
+
+// SetPoolMemberLimits sets the ratio and the connection limit of a member, a
+// zero limit is no limit.
+func (f5 *F5er)SetPoolMemberLimits(poolName, memberIp, memberPort string, ratio, connectionLimit int)error{
+	if memberPort == "*" {
+		memberPort = "0"
+	}
+	url := "ltm/pool/" + f5.uri(poolName) + "/members/" + f5.uri(joinDestination(memberIp, memberPort))
+	return f5.apiCall("PATCH", url, map[string]int{"ratio" : ratio, "connectionLimit" : connectionLimit})
+}
+
+func (f5 *F5er)DeletePool(poolName string)error{
+	err := f5.call(func(c *bigip.BigIP)error{
+		return c.DeletePool(f5.uri(poolName))
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			glog.Warningf("Pool %s is not exists.", poolName)
+		} else {
+			return err
+		}	
+	}
+	
+	return nil
+}
+
+func (f5 *F5er)AddPoolMember(poolName, memberIp, memberPort string)error{
+	if memberPort == "*" {
+		memberPort = "0"
+	}	
+	
+	memberConfig := &bigip.PoolMember {
+		Name : joinDestination(memberIp, memberPort),
+		Partition : f5.partitionName(),
+	}
+	
+	node := map[string]string{
+		"name" : memberIp,
+		"partition" : f5.partitionName(),
+		"address" : memberIp,
+	}
+	err := f5.apiCall("POST", "ltm/node", node)
+	if err != nil {
+		if IsAlreadyExists(err) {
+			glog.Infof("node %s Already exists, skip create.", memberIp)
+		} else {
+			return err
+		}		
+	}	
+	
+	err = f5.call(func(c *bigip.BigIP)error{
+		return c.CreatePoolMember(f5.uri(poolName), memberConfig)
+	})
+	if err != nil {
+		if IsAlreadyExists(err) {
+			glog.Infof("poolmember %s Already exists, skip create.", memberConfig.Name)
+		} else {
+			return err
+		}		
+	}
+	
+	return nil	
+}
+
+func (f5 *F5er)DelPoolMember(poolName, memberIp, memberPort string)error{
+	if memberPort == "*" {
+		memberPort = "0"
+	}
+	
+	member := f5.uri(joinDestination(memberIp, memberPort))
+	err := f5.call(func(c *bigip.BigIP)error{
+		return c.DeletePoolMember(f5.uri(poolName), member)
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			glog.Infof("Already deleted, skip delete.")
+		} else {
+			return err
+		}		
+	}
+	
+	return f5.call(func(c *bigip.BigIP)error{
+		return c.DeleteNode(f5.uri(memberIp))
+	})
+}
+
+// EnablePoolMember lets the member take new connections again.
+func (f5 *F5er)EnablePoolMember(poolName, memberIp, memberPort string)error{
+	if memberPort == "*" {
+		memberPort = "0"
+	}
+	return f5.call(func(c *bigip.BigIP)error{
+		return c.PoolMemberStatus(f5.uri(poolName), f5.uri(joinDestination(memberIp, memberPort)), "enable")
+	})
+}
+
+// DisablePoolMember keeps the member in the pool but stops sending it new
+// connections.
+func (f5 *F5er)DisablePoolMember(poolName, memberIp, memberPort string)error{
+	if memberPort == "*" {
+		memberPort = "0"
+	}
+	return f5.call(func(c *bigip.BigIP)error{
+		return c.PoolMemberStatus(f5.uri(poolName), f5.uri(joinDestination(memberIp, memberPort)), "disable")
+	})
+}
+
+// PoolMembers returns the members of the pool, "ip:port" -> enabled.
+func (f5 *F5er)PoolMembers(poolName string)(map[string]bool, error){
+	var members struct {
+		Items []struct {
+			Name	string	`json:"name"`
+			Session	string	`json:"session"`
+		} `json:"items"`
+	}
+	err := f5.apiGet("ltm/pool/" + f5.uri(poolName) + "/members", &members)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]bool)
+	for _, member := range members.Items {
+		ip, port := splitDestination(member.Name)
+		ret[net.JoinHostPort(ip, port)] = member.Session != "user-disabled"
+	}
+	return ret, nil
+}
+
+// PoolMemberConnections returns the server side connections open on the
+// member, a disabled member drains when it reaches zero.
+func (f5 *F5er)PoolMemberConnections(poolName, memberIp, memberPort string)(int, error){
+	if memberPort == "*" {
+		memberPort = "0"
+	}
+	var stats struct {
+		Entries map[string]struct {
+			NestedStats struct {
+				Entries map[string]struct {
+					Value int `json:"value"`
+				} `json:"entries"`
+			} `json:"nestedStats"`
+		} `json:"entries"`
+	}
+	url := "ltm/pool/" + f5.uri(poolName) + "/members/" + 
+		f5.uri(joinDestination(memberIp, memberPort)) + "/stats"
+	err := f5.apiGet(url, &stats)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range stats.Entries {
+		return entry.NestedStats.Entries["serverside.curConns"].Value, nil
+	}
+	return 0, fmt.Errorf("no stats for member %s of %s", joinDestination(memberIp, memberPort), poolName)
+}
+
+// Login checks the credentials of the driver against the device.
+func (f5 *F5er)Login()error{
+	err := f5.session.ensureLogin()
+	if err != nil {
+		return err
+	}
+	var version map[string]interface{}
+	return f5.apiGet("sys/version", &version)
+}
+
+// Logout revokes the token of the session of the device, the drivers of all
+// its partitions are unusable afterwards.
+func (f5 *F5er)Logout() {
+	f5.session.logout()
+}
+
+// call runs f with the go-bigip client of the current token. A token the
+// device refuses is replaced and f runs once more.
+func (f5 *F5er)call(f func(c *bigip.BigIP)error)error{
+	client, err := f5.session.bigip()
+	if err != nil {
+		return err
+	}
+	err = f5Error(f(client))
+	if !isF5Unauthorized(err) {
+		return err
+	}
+	glog.V(2).Infof("Token of %s refused, log in again.", f5.device.Address)
+	_, err = f5.session.relogin(client.Token)
+	if err != nil {
+		return err
+	}
+	client, err = f5.session.bigip()
+	if err != nil {
+		return err
+	}
+	return f5Error(f(client))
+}
+
+// NewF5 returns a driver for the BIG-IP device, logged in with a token.
+func NewF5(device Device)(GwProvider, error){
+	if device.Address == "" || device.Username == "" || device.Password == "" {
+		return nil, fmt.Errorf("address, username and password of the BIG-IP are required")
+	}
+	session, err := newF5Session(device)
+	if err != nil {
+		return nil, err
+	}
+	f5er := &F5er{
+		session : session,
+		device : device,
+		partitions : &partitionCache{created : make(map[string]bool)},
+	}
+	return f5er, nil
+}
+
+// New returns the driver of the BIG-IP of the environment.
+//
+// Deprecated: use NewProvider with EnvDevice.
+func New(gwtype string)(GwProvider, error){
+	p, err := NewProvider(gwtype, EnvDevice(gwtype))
+	if err != nil {
+		return nil, err
+	}
+	drv, ok := GwProviderOf(p)
+	if !ok {
+		return nil, fmt.Errorf("Unsupport type: %s", gwtype)
+	}
+	return drv, nil
+}
@@ -0,0 +1,1087 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	F5AS3PROVIDER		= "f5-as3"
+	// F5AS3DEFAULTTENANT holds the objects of the devices in Common, AS3
+	// does not declare that partition.
+	F5AS3DEFAULTTENANT	= "ygw"
+	// as3Application is the only application of a tenant.
+	as3Application		= "ygw"
+	// as3State is the Constants object of the application keeping what the
+	// controllers declared, see as3Tenant.
+	as3State			= "ygw_state"
+	as3SchemaVersion	= "3.13.0"
+	as3DeclarePath		= "/mgmt/shared/appsvcs/declare"
+	as3TaskPath			= "/mgmt/shared/appsvcs/task/"
+	as3TaskPoll			= time.Second
+)
+
+func init() {
+	Register(F5AS3PROVIDER, newAS3Provider, f5EnvDevice)
+}
+
+// as3Provider is the Provider of a BIG-IP with AS3. Every partition is an
+// AS3 tenant whose objects are declared at once, so a change is applied
+// entirely or not at all. The tenants belong to the provider, objects
+// declared in them by others are removed by its first declaration.
+type as3Provider struct {
+	session		*f5Session
+	device		Device
+	// tenant holds the objects of this provider, the partition of the
+	// device when empty.
+	tenant		string
+	tenants		*as3Tenants
+	// batch collects the changes of the provider Batch returns, it is nil
+	// on the others.
+	batch		*as3Batch
+}
+
+// as3Batch are the changes of one sync to a tenant, Commit declares them at
+// once. They are replayed on the tenant declared by then, so the ones of
+// other syncs committed meanwhile are kept.
+type as3Batch struct {
+	// tenant is the declared tenant with the changes applied, the calls of
+	// the batch read it. It is nil before the first change.
+	tenant		*as3Tenant
+	changes		[]func(t *as3Tenant)error
+}
+
+// as3Tenants are the tenants declared so far, shared by the providers of all
+// partitions of a session. AS3 handles one declaration at a time, so lock is
+// held for the whole of one.
+type as3Tenants struct {
+	lock		sync.Mutex
+	declared	map[string]*as3Declared
+}
+
+// as3Declared is the last declaration the device took for a tenant.
+type as3Declared struct {
+	tenant		*as3Tenant
+	// document is the rendered tenant, a change rendering the same one is
+	// not sent.
+	document	[]byte
+}
+
+// as3Tenant is what the controllers declared in a tenant, the AS3 objects
+// are rendered from it. It is kept in the declaration too, to be read back
+// after a restart. The certificates are only kept by their Secret, their
+// keys are read at every rendering.
+type as3Tenant struct {
+	Services	map[string]*as3Service	`json:"services,omitempty"`
+	Pools		map[string]*as3Pool		`json:"pools,omitempty"`
+}
+
+type as3Service struct {
+	VirtualServer	VirtualServer	`json:"virtualServer"`
+	Pool			string			`json:"pool,omitempty"`
+	Response		*Response		`json:"response,omitempty"`
+	// Rules are keyed by the name of their iRule, see as3RuleName.
+	Rules			map[string]Rule	`json:"rules,omitempty"`
+	Certs			[]as3Cert		`json:"certs,omitempty"`
+	SourceRanges	[]string		`json:"sourceRanges,omitempty"`
+}
+
+// as3Cert is a Cert without its certificate and key.
+type as3Cert struct {
+	Name		string	`json:"name"`
+	ServerName	string	`json:"serverName,omitempty"`
+	Default		bool	`json:"default,omitempty"`
+	Namespace	string	`json:"namespace"`
+	Secret		string	`json:"secret"`
+}
+
+type as3Pool struct {
+	Pool		Pool			`json:"pool"`
+	Members		[]as3Member		`json:"members,omitempty"`
+}
+
+type as3Member struct {
+	Member		Member		`json:"member"`
+	Disabled	bool		`json:"disabled,omitempty"`
+}
+
+func newAS3Provider(device Device)(Provider, error){
+	if device.Address == "" || device.Username == "" || device.Password == "" {
+		return nil, fmt.Errorf("address, username and password of the BIG-IP are required")
+	}
+	session, err := newF5Session(device)
+	if err != nil {
+		return nil, err
+	}
+	return &as3Provider{
+		session		: session,
+		device		: device,
+		tenants		: &as3Tenants{declared : make(map[string]*as3Declared)},
+	}, nil
+}
+
+// Partition returns the provider of the objects of the tenant name, the one
+// of the device when empty. It declares every call, even on a batch.
+func (p *as3Provider)Partition(name string)Provider{
+	return &as3Provider{
+		session		: p.session,
+		device		: p.device,
+		tenant		: name,
+		tenants		: p.tenants,
+	}
+}
+
+func (p *as3Provider)tenantName()string{
+	name := p.tenant
+	if name == "" {
+		name = p.device.Partition
+	}
+	if name == "" || name == F5DEFAULTPARTITION {
+		return F5AS3DEFAULTTENANT
+	}
+	return name
+}
+
+func (p *as3Provider)Type()string{
+	return F5AS3PROVIDER
+}
+
+// Capabilities are the ones of the f5 provider but the port ranges, which
+// AS3 services lack.
+func (p *as3Provider)Capabilities()Capabilities{
+	return Capabilities{
+		L4					: true,
+		SourceRanges		: true,
+		Redirect			: true,
+		Rewrite				: true,
+		DefaultResponse		: true,
+		MemberConnectionLimit	: true,
+		MemberPriority		: true,
+	}
+}
+
+// Login checks the credentials and that AS3 is installed on the device.
+func (p *as3Provider)Login(ctx context.Context)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := p.session.ensureLogin()
+	if err != nil {
+		return err
+	}
+	var info map[string]interface{}
+	return p.session.request(ctx, "GET", "/mgmt/shared/appsvcs/info", nil, &info)
+}
+
+// Logout revokes the token of the session of the device, the providers of
+// all its tenants are unusable afterwards.
+func (p *as3Provider)Logout(){
+	p.session.logout()
+}
+
+// Batch returns a provider of the tenant of p collecting its changes until
+// Commit, so that a sync declares the tenant once.
+func (p *as3Provider)Batch()Batch{
+	return &as3Provider{
+		session		: p.session,
+		device		: p.device,
+		tenant		: p.tenant,
+		tenants		: p.tenants,
+		batch		: &as3Batch{},
+	}
+}
+
+// Commit declares the changes collected by the batch, a change that fails
+// on the tenant declared by then fails all of them. The batch is empty
+// afterwards, whether they were declared or not.
+func (p *as3Provider)Commit(ctx context.Context)error{
+	if p.batch == nil || len(p.batch.changes) == 0 {
+		return nil
+	}
+	changes := p.batch.changes
+	p.batch.changes = nil
+	p.batch.tenant = nil
+	return p.apply(ctx, changes...)
+}
+
+// update declares change, or adds it to the batch of p.
+func (p *as3Provider)update(ctx context.Context, change func(t *as3Tenant)error)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.batch == nil {
+		return p.apply(ctx, change)
+	}
+	tenant, err := p.batchTenant(ctx)
+	if err != nil {
+		return err
+	}
+	// a failed change is not kept, it may have been applied partly.
+	tenant, err = tenant.copy()
+	if err != nil {
+		return err
+	}
+	err = change(tenant)
+	if err != nil {
+		return err
+	}
+	p.batch.tenant = tenant
+	p.batch.changes = append(p.batch.changes, change)
+	return nil
+}
+
+// batchTenant returns the tenant with the changes of the batch of p applied.
+func (p *as3Provider)batchTenant(ctx context.Context)(*as3Tenant, error){
+	if p.batch.tenant != nil {
+		return p.batch.tenant, nil
+	}
+	p.tenants.lock.Lock()
+	defer p.tenants.lock.Unlock()
+	declared, err := p.declared(ctx, p.tenantName())
+	if err != nil {
+		return nil, err
+	}
+	return declared.tenant.copy()
+}
+
+// apply applies changes to a copy of the tenant and declares the result. The
+// tenant is only replaced once the device took the declaration, so failed
+// changes are retried from the last good one.
+func (p *as3Provider)apply(ctx context.Context, changes ...func(t *as3Tenant)error)error{
+	name := p.tenantName()
+	p.tenants.lock.Lock()
+	defer p.tenants.lock.Unlock()
+	declared, err := p.declared(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	tenant, err := declared.tenant.copy()
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		err = change(tenant)
+		if err != nil {
+			return err
+		}
+	}
+	rendered, err := tenant.render(p.device.TLSSecret)
+	if err != nil {
+		return err
+	}
+	document, err := json.Marshal(rendered)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(document, declared.document) {
+		glog.V(4).Infof("Tenant %s of %s is unchanged.", name, p.device.Address)
+		return nil
+	}
+	err = p.declare(ctx, name, document)
+	if err != nil {
+		// the device may have taken the declaration anyway, the tenant is
+		// read back from it by the next change.
+		delete(p.tenants.declared, name)
+		return err
+	}
+	p.tenants.declared[name] = &as3Declared{tenant : tenant, document : document}
+	return nil
+}
+
+// declared returns the last declaration of the tenant name, read from the
+// device the first time. Callers hold p.tenants.lock.
+func (p *as3Provider)declared(ctx context.Context, name string)(*as3Declared, error){
+	declared, ok := p.tenants.declared[name]
+	if ok {
+		return declared, nil
+	}
+	declared, err := p.load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	p.tenants.declared[name] = declared
+	return declared, nil
+}
+
+// load reads back the tenant from the declaration on the device, a tenant
+// it has none of is empty. It has no document, so that the first change
+// declares it with the keys read again.
+func (p *as3Provider)load(ctx context.Context, name string)(*as3Declared, error){
+	err := p.session.ensureLogin()
+	if err != nil {
+		return nil, err
+	}
+	var adc map[string]json.RawMessage
+	err = p.session.request(ctx, "GET", as3DeclarePath + "/" + name, nil, &adc)
+	if err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+	tenant := &as3Tenant{}
+	if data, ok := adc[name]; ok {
+		tenant, err = readAS3Tenant(data)
+		if err != nil {
+			return nil, fmt.Errorf("read tenant %s of %s: %v", name, p.device.Address, err)
+		}
+	}
+	glog.V(2).Infof("Loaded tenant %s of %s with %d services and %d pools.",
+		name, p.device.Address, len(tenant.Services), len(tenant.Pools))
+	return &as3Declared{tenant : tenant}, nil
+}
+
+// readAS3Tenant returns the tenant kept in the state of a declared tenant.
+func readAS3Tenant(data []byte)(*as3Tenant, error){
+	var tenant map[string]json.RawMessage
+	err := json.Unmarshal(data, &tenant)
+	if err != nil {
+		return nil, err
+	}
+	var app map[string]json.RawMessage
+	if data, ok := tenant[as3Application]; ok {
+		err = json.Unmarshal(data, &app)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var state struct {
+		Model	string	`json:"model"`
+	}
+	if data, ok := app[as3State]; ok {
+		err = json.Unmarshal(data, &state)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t := &as3Tenant{}
+	if state.Model == "" {
+		return t, nil
+	}
+	model, err := base64.StdEncoding.DecodeString(state.Model)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(model, t)
+	return t, err
+}
+
+type as3Task struct {
+	ID			string		`json:"id"`
+	Results		[]as3Result	`json:"results"`
+}
+
+type as3Result struct {
+	Code		int			`json:"code"`
+	Message		string		`json:"message"`
+	Tenant		string		`json:"tenant"`
+	Errors		[]string	`json:"errors"`
+}
+
+// declare posts document as the whole tenant name, the other tenants of the
+// device are left as they are. The declaration runs as a task which is
+// polled until it is done.
+func (p *as3Provider)declare(ctx context.Context, name string, document []byte)error{
+	err := p.session.ensureLogin()
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"class"		: "AS3",
+		"action"	: "deploy",
+		"persist"	: true,
+		"declaration"	: map[string]interface{}{
+			"class"			: "ADC",
+			"schemaVersion"	: as3SchemaVersion,
+			"id"			: "ygw-" + name,
+			name			: json.RawMessage(document),
+		},
+	}
+	var task as3Task
+	err = p.session.request(ctx, "POST", as3DeclarePath + "?async=true", body, &task)
+	if err != nil {
+		return err
+	}
+	glog.V(3).Infof("Declaring tenant %s of %s in task %s.", name, p.device.Address, task.ID)
+
+	for {
+		select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(as3TaskPoll):
+		}
+		task.Results = nil
+		err = p.session.request(ctx, "GET", as3TaskPath + task.ID, nil, &task)
+		if err != nil {
+			return err
+		}
+		if len(task.Results) == 0 || task.Results[0].Message == "in progress" || task.Results[0].Message == "pending" {
+			continue
+		}
+		for _, result := range task.Results {
+			if result.Code >= 300 {
+				return &Error{
+					Reason : httpReason(strconv.Itoa(result.Code)),
+					Code : result.Code,
+					Err : fmt.Errorf("declare tenant %s of %s: %s %s", name, p.device.Address,
+						result.Message, strings.Join(result.Errors, ", ")),
+				}
+			}
+		}
+		glog.V(2).Infof("Declared tenant %s of %s.", name, p.device.Address)
+		return nil
+	}
+}
+
+// copy returns a deep copy of t, the changes of a declaration are made to
+// one.
+func (t *as3Tenant)copy()(*as3Tenant, error){
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	c := &as3Tenant{}
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Services == nil {
+		c.Services = make(map[string]*as3Service)
+	}
+	if c.Pools == nil {
+		c.Pools = make(map[string]*as3Pool)
+	}
+	return c, nil
+}
+
+func as3NotFound(kind, name string)error{
+	return &Error{Reason : ErrorReasonNotFound, Err : fmt.Errorf("%s %s not found", kind, name)}
+}
+
+// service returns the virtual server vsName of t.
+func (t *as3Tenant)service(vsName string)(*as3Service, error){
+	s, ok := t.Services[vsName]
+	if !ok {
+		return nil, as3NotFound("virtual server", vsName)
+	}
+	return s, nil
+}
+
+func (t *as3Tenant)pool(poolName string)(*as3Pool, error){
+	pool, ok := t.Pools[poolName]
+	if !ok {
+		return nil, as3NotFound("pool", poolName)
+	}
+	return pool, nil
+}
+
+// checkPool checks that the pool a virtual server uses is declared, the full
+// paths of pools of other partitions are not checked.
+func (t *as3Tenant)checkPool(poolName string)error{
+	if strings.HasPrefix(poolName, "/") {
+		return nil
+	}
+	_, err := t.pool(poolName)
+	return err
+}
+
+// as3L4Classes are the service classes of the L4 protocols.
+var as3L4Classes = map[string]string{
+	"tcp"	: "Service_TCP",
+	"udp"	: "Service_UDP",
+	"tls"	: "Service_TCP",
+}
+
+func (p *as3Provider)CreateVirtualServer(ctx context.Context, vs VirtualServer)error{
+	if _, err := strconv.Atoi(vs.Port); err != nil {
+		return unsupported(F5AS3PROVIDER, "port %s of %s, only single ports are", vs.Port, vs.Name)
+	}
+	if vs.Mode == MODEL4 {
+		vs.Protocol = strings.ToLower(vs.Protocol)
+		class, ok := as3L4Classes[vs.Protocol]
+		if !ok {
+			return unsupported(F5AS3PROVIDER, "protocol %s of %s", vs.Protocol, vs.Name)
+		}
+		// TLS passed through is TCP, terminating it has no member protocol.
+		if vs.TLS && class != "Service_TCP" {
+			return unsupported(F5AS3PROVIDER, "TLS termination on %s with protocol %s", vs.Name, vs.Protocol)
+		}
+	}
+	return p.update(ctx, func(t *as3Tenant)error{
+		if _, ok := t.Services[vs.Name]; ok {
+			return &Error{Reason : ErrorReasonAlreadyExists, Err : fmt.Errorf("virtual server %s already exists", vs.Name)}
+		}
+		t.Services[vs.Name] = &as3Service{VirtualServer : vs}
+		return nil
+	})
+}
+
+func (p *as3Provider)DeleteVirtualServer(ctx context.Context, name string)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		if _, ok := t.Services[name]; !ok {
+			return as3NotFound("virtual server", name)
+		}
+		delete(t.Services, name)
+		return nil
+	})
+}
+
+func (p *as3Provider)SetDefaultPool(ctx context.Context, vsName string, poolName string)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		s, err := t.service(vsName)
+		if err != nil {
+			return err
+		}
+		if err := t.checkPool(poolName); err != nil {
+			return err
+		}
+		s.Pool = poolName
+		return nil
+	})
+}
+
+func (p *as3Provider)UnsetDefaultPool(ctx context.Context, vsName string, poolName string)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		if s, ok := t.Services[vsName]; ok {
+			s.Pool = ""
+		}
+		return nil
+	})
+}
+
+func (p *as3Provider)SetDefaultResponse(ctx context.Context, vsName string, resp Response)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		s, err := t.service(vsName)
+		if err != nil {
+			return err
+		}
+		s.Response = &resp
+		return nil
+	})
+}
+
+func (p *as3Provider)UnsetDefaultResponse(ctx context.Context, vsName string)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		if s, ok := t.Services[vsName]; ok {
+			s.Response = nil
+		}
+		return nil
+	})
+}
+
+// as3RuleName names the iRule of rule like the f5 provider does, after what
+// it matches and what it does, so rule.Name is not used.
+func as3RuleName(vsName string, rule Rule)string{
+	parts := []string{rule.Host, rule.Path}
+	if rule.Redirect != nil {
+		parts = append(parts, "redirect", rule.Redirect.Scheme, rule.Redirect.Host, strconv.Itoa(rule.Redirect.Code))
+	} else if rule.Rewrite != nil {
+		parts = append(parts, "rewrite", rewritePrefix(rule), rule.Rewrite.Replacement, rule.Pool)
+	} else {
+		parts = append(parts, rule.Pool)
+	}
+	return vsName + "_rule_" + ruleHash(parts...)
+}
+
+func (p *as3Provider)AddRule(ctx context.Context, vsName string, rule Rule)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		s, err := t.service(vsName)
+		if err != nil {
+			return err
+		}
+		if rule.Redirect == nil {
+			if err := t.checkPool(rule.Pool); err != nil {
+				return err
+			}
+		}
+		if s.Rules == nil {
+			s.Rules = make(map[string]Rule)
+		}
+		s.Rules[as3RuleName(vsName, rule)] = rule
+		return nil
+	})
+}
+
+func (p *as3Provider)RemoveRule(ctx context.Context, vsName string, rule Rule)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		if s, ok := t.Services[vsName]; ok {
+			delete(s.Rules, as3RuleName(vsName, rule))
+		}
+		return nil
+	})
+}
+
+// AddCert adds cert to the TLS server of the virtual server, or replaces the
+// one with its name.
+// The key is read from the Secret of cert whenever the tenant is declared.
+func (p *as3Provider)AddCert(ctx context.Context, vsName string, cert Cert)error{
+	if cert.Secret == "" {
+		return fmt.Errorf("certificate %s of %s has no Secret", cert.Name, vsName)
+	}
+	return p.update(ctx, func(t *as3Tenant)error{
+		s, err := t.service(vsName)
+		if err != nil {
+			return err
+		}
+		certs := []as3Cert{}
+		for _, c := range s.Certs {
+			if c.Name != cert.Name {
+				certs = append(certs, c)
+			}
+		}
+		s.Certs = append(certs, as3Cert{
+			Name		: cert.Name,
+			ServerName	: cert.ServerName,
+			Default		: cert.Default,
+			Namespace	: cert.Namespace,
+			Secret		: cert.Secret,
+		})
+		return nil
+	})
+}
+
+func (p *as3Provider)RemoveCert(ctx context.Context, vsName string, cert Cert)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		s, ok := t.Services[vsName]
+		if !ok {
+			return nil
+		}
+		certs := []as3Cert{}
+		for _, c := range s.Certs {
+			if c.Name != cert.Name {
+				certs = append(certs, c)
+			}
+		}
+		s.Certs = certs
+		return nil
+	})
+}
+
+func (p *as3Provider)SetSourceRanges(ctx context.Context, vsName string, ranges []string)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		s, ok := t.Services[vsName]
+		if !ok {
+			if len(ranges) == 0 {
+				return nil
+			}
+			return as3NotFound("virtual server", vsName)
+		}
+		s.SourceRanges = ranges
+		return nil
+	})
+}
+
+func (p *as3Provider)CreatePool(ctx context.Context, pool Pool)error{
+	// a BIG-IP encrypts toward the members with a server SSL profile of the
+	// virtual server, not of the pool, see Capabilities.PoolTLS.
+	if protocol := strings.ToUpper(pool.Protocol); protocol == "SSL" || protocol == "SSL_TCP" {
+		return unsupported(F5AS3PROVIDER, "protocol %s toward the members of %s", pool.Protocol, pool.Name)
+	}
+	if _, err := translateMethod(F5AS3PROVIDER, f5Methods, pool.Method); err != nil {
+		return &Error{Reason : ErrorReasonUnsupported, Err : err}
+	}
+	return p.update(ctx, func(t *as3Tenant)error{
+		if _, ok := t.Pools[pool.Name]; ok {
+			return &Error{Reason : ErrorReasonAlreadyExists, Err : fmt.Errorf("pool %s already exists", pool.Name)}
+		}
+		t.Pools[pool.Name] = &as3Pool{Pool : pool}
+		return nil
+	})
+}
+
+// UpdatePool sets the slow start and the priority group activation of the
+// pool, the connection limits of the BIG-IP are the ones of the members.
+func (p *as3Provider)UpdatePool(ctx context.Context, pool Pool)error{
+	if pool.ConnectionLimit > 0 {
+		return unsupported(F5AS3PROVIDER, "connection limit of pool %s, set the one of its members", pool.Name)
+	}
+	return p.update(ctx, func(t *as3Tenant)error{
+		current, err := t.pool(pool.Name)
+		if err != nil {
+			return err
+		}
+		current.Pool.SlowStart = pool.SlowStart
+		current.Pool.MinActiveMembers = pool.MinActiveMembers
+		return nil
+	})
+}
+
+// DeletePool refuses to delete a pool still used by a virtual server, as
+// the BIG-IP does.
+func (p *as3Provider)DeletePool(ctx context.Context, name string)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		if _, err := t.pool(name); err != nil {
+			return err
+		}
+		for vsName, s := range t.Services {
+			used := s.Pool == name
+			for _, rule := range s.Rules {
+				used = used || (rule.Redirect == nil && rule.Pool == name)
+			}
+			if used {
+				return &Error{Reason : ErrorReasonConflict, Err : fmt.Errorf("pool %s is used by virtual server %s", name, vsName)}
+			}
+		}
+		delete(t.Pools, name)
+		return nil
+	})
+}
+
+// SetBackupPool is unsupported, the pools fail over to their lower priority
+// members instead.
+func (p *as3Provider)SetBackupPool(ctx context.Context, poolName string, backupName string, threshold int)error{
+	return unsupported(F5AS3PROVIDER, "backup pool %s of %s, set the priority of its members", backupName, poolName)
+}
+
+func (p *as3Provider)UnsetBackupPool(ctx context.Context, poolName string)error{
+	return unsupported(F5AS3PROVIDER, "backup pool of %s", poolName)
+}
+
+// member returns the index of member in pool, -1 when it is not there.
+func (pool *as3Pool)member(member Member)int{
+	for i, m := range pool.Members {
+		if m.Member.IP == member.IP && m.Member.Port == member.Port {
+			return i
+		}
+	}
+	return -1
+}
+
+// changeMember applies change to member of poolName.
+func (p *as3Provider)changeMember(ctx context.Context, poolName string, member Member, change func(m *as3Member))error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		pool, err := t.pool(poolName)
+		if err != nil {
+			return err
+		}
+		i := pool.member(member)
+		if i < 0 {
+			return as3NotFound("member", joinDestination(member.IP, strconv.Itoa(member.Port)) + " of pool " + poolName)
+		}
+		change(&pool.Members[i])
+		return nil
+	})
+}
+
+func (p *as3Provider)AddMember(ctx context.Context, poolName string, member Member)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		pool, err := t.pool(poolName)
+		if err != nil {
+			return err
+		}
+		if pool.member(member) >= 0 {
+			return &Error{
+				Reason : ErrorReasonAlreadyExists,
+				Err : fmt.Errorf("member %s of pool %s already exists", joinDestination(member.IP, strconv.Itoa(member.Port)), poolName),
+			}
+		}
+		pool.Members = append(pool.Members, as3Member{Member : member})
+		return nil
+	})
+}
+
+func (p *as3Provider)UpdateMember(ctx context.Context, poolName string, member Member)error{
+	return p.changeMember(ctx, poolName, member, func(m *as3Member){
+		m.Member = member
+	})
+}
+
+func (p *as3Provider)RemoveMember(ctx context.Context, poolName string, member Member)error{
+	return p.update(ctx, func(t *as3Tenant)error{
+		pool, err := t.pool(poolName)
+		if err != nil {
+			return err
+		}
+		i := pool.member(member)
+		if i < 0 {
+			return as3NotFound("member", joinDestination(member.IP, strconv.Itoa(member.Port)) + " of pool " + poolName)
+		}
+		pool.Members = append(pool.Members[:i], pool.Members[i + 1:]...)
+		return nil
+	})
+}
+
+func (p *as3Provider)EnableMember(ctx context.Context, poolName string, member Member)error{
+	return p.changeMember(ctx, poolName, member, func(m *as3Member){
+		m.Disabled = false
+	})
+}
+
+func (p *as3Provider)DisableMember(ctx context.Context, poolName string, member Member)error{
+	return p.changeMember(ctx, poolName, member, func(m *as3Member){
+		m.Disabled = true
+	})
+}
+
+// PoolMembers returns the members declared in poolName.
+func (p *as3Provider)PoolMembers(ctx context.Context, poolName string)(map[string]bool, error){
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tenant, err := p.tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := tenant.pool(poolName)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]bool)
+	for _, m := range pool.Members {
+		members[net.JoinHostPort(m.Member.IP, strconv.Itoa(m.Member.Port))] = !m.Disabled
+	}
+	return members, nil
+}
+
+// tenantOf returns the tenant of p as declared, with the changes of its
+// batch applied. It is read only.
+func (p *as3Provider)tenantOf(ctx context.Context)(*as3Tenant, error){
+	if p.batch != nil {
+		return p.batchTenant(ctx)
+	}
+	p.tenants.lock.Lock()
+	defer p.tenants.lock.Unlock()
+	declared, err := p.declared(ctx, p.tenantName())
+	if err != nil {
+		return nil, err
+	}
+	return declared.tenant, nil
+}
+
+// MemberConnections reads the statistics of the member from iControl REST,
+// AS3 has none. The nodes are shared, so they are in Common.
+func (p *as3Provider)MemberConnections(ctx context.Context, poolName string, member Member)(int, error){
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	err := p.session.ensureLogin()
+	if err != nil {
+		return 0, err
+	}
+	var stats struct {
+		Entries map[string]struct {
+			NestedStats struct {
+				Entries map[string]struct {
+					Value int `json:"value"`
+				} `json:"entries"`
+			} `json:"nestedStats"`
+		} `json:"entries"`
+	}
+	tenant := p.tenantName()
+	dest := joinDestination(member.IP, strconv.Itoa(member.Port))
+	url := "/mgmt/tm/ltm/pool/~" + tenant + "~" + as3Application + "~" + poolName +
+		"/members/~" + F5DEFAULTPARTITION + "~" + dest + "/stats"
+	err = p.session.request(ctx, "GET", url, nil, &stats)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range stats.Entries {
+		return entry.NestedStats.Entries["serverside.curConns"].Value, nil
+	}
+	return 0, fmt.Errorf("no stats for member %s of %s", dest, poolName)
+}
+
+// as3Monitors are the health monitors of the pools of a known protocol.
+var as3Monitors = map[string]string{
+	"HTTP"	: "http",
+	"TCP"	: "tcp",
+}
+
+// render returns the AS3 tenant of t, with t itself in the state of the
+// application. The objects are named after the virtual servers and pools,
+// the certificates and keys are read with secret.
+func (t *as3Tenant)render(secret func(namespace, name string)([]byte, []byte, error))(map[string]interface{}, error){
+	tenant := map[string]interface{}{
+		"class" : "Tenant",
+	}
+	if len(t.Services) == 0 && len(t.Pools) == 0 {
+		return tenant, nil
+	}
+	model, _ := json.Marshal(t)
+	app := map[string]interface{}{
+		"class" : "Application",
+		as3State : map[string]interface{}{
+			"class" : "Constants",
+			"model" : base64.StdEncoding.EncodeToString(model),
+		},
+	}
+	for name, pool := range t.Pools {
+		app[name] = pool.render()
+	}
+	for name, s := range t.Services {
+		err := s.render(name, app, secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tenant[as3Application] = app
+	return tenant, nil
+}
+
+func (pool *as3Pool)render()map[string]interface{}{
+	// CreatePool checked the method.
+	method, _ := translateMethod(F5AS3PROVIDER, f5Methods, pool.Pool.Method)
+	members := []map[string]interface{}{}
+	anyPort := false
+	for _, m := range pool.Members {
+		state := "enable"
+		if m.Disabled {
+			state = "disable"
+		}
+		members = append(members, map[string]interface{}{
+			"servicePort"		: m.Member.Port,
+			"serverAddresses"	: []string{m.Member.IP},
+			// a node is in one partition only, shared ones may be in
+			// the pools of all tenants.
+			"shareNodes"		: true,
+			"ratio"				: memberWeight(m.Member),
+			"connectionLimit"	: m.Member.ConnectionLimit,
+			"priorityGroup"		: m.Member.Priority,
+			"adminState"		: state,
+		})
+		anyPort = anyPort || m.Member.Port == 0
+	}
+	rendered := map[string]interface{}{
+		"class"					: "Pool",
+		"loadBalancingMode"		: method,
+		"slowRampTime"			: pool.Pool.SlowStart,
+		"minimumMembersActive"	: pool.Pool.MinActiveMembers,
+		"members"				: members,
+	}
+	// members of any port can't be monitored.
+	if monitor, ok := as3Monitors[strings.ToUpper(pool.Pool.Protocol)]; ok && !anyPort {
+		rendered["monitors"] = []string{monitor}
+	}
+	return rendered
+}
+
+// render adds the service of s and its iRules and TLS objects to app. A TLS
+// virtual server without certificates is declared disabled.
+func (s *as3Service)render(name string, app map[string]interface{}, secret func(namespace, name string)([]byte, []byte, error))error{
+	vs := s.VirtualServer
+	port, _ := strconv.Atoi(vs.Port)
+	service := map[string]interface{}{
+		"class"				: "Service_HTTP",
+		"virtualAddresses"	: []string{vs.IP},
+		"virtualPort"		: port,
+	}
+	if vs.Mode == MODEL4 {
+		service["class"] = as3L4Classes[vs.Protocol]
+	}
+	if strings.HasPrefix(s.Pool, "/") {
+		service["pool"] = map[string]string{"bigip" : s.Pool}
+	} else if s.Pool != "" {
+		service["pool"] = s.Pool
+	}
+
+	if vs.TLS && len(s.Certs) == 0 {
+		service["enable"] = false
+	} else if vs.TLS {
+		if vs.Mode != MODEL4 {
+			service["class"] = "Service_HTTPS"
+			service["redirect80"] = false
+		}
+		service["serverTLS"] = name + "_tls"
+		certs := []map[string]interface{}{}
+		for _, cert := range s.Certs {
+			if secret == nil {
+				return fmt.Errorf("no Secrets to read certificate %s of %s from", cert.Name, name)
+			}
+			crt, key, err := secret(cert.Namespace, cert.Secret)
+			if err != nil {
+				return fmt.Errorf("read certificate %s of %s: %v", cert.Name, name, err)
+			}
+			app[cert.Name] = map[string]interface{}{
+				"class"			: "Certificate",
+				"certificate"	: string(crt),
+				"privateKey"	: string(key),
+			}
+			c := map[string]interface{}{"certificate" : cert.Name}
+			// the first certificate is served to the clients sending no
+			// known name.
+			if cert.Default {
+				certs = append([]map[string]interface{}{c}, certs...)
+				continue
+			}
+			if cert.ServerName != "" {
+				c["matchToSNI"] = cert.ServerName
+			}
+			certs = append(certs, c)
+		}
+		app[name + "_tls"] = map[string]interface{}{
+			"class"			: "TLS_Server",
+			"certificates"	: certs,
+		}
+	}
+
+	iRules := map[string]string{}
+	for ruleName, rule := range s.Rules {
+		iRules[ruleName] = as3IRule(rule)
+	}
+	if s.Response != nil {
+		iRules[name + "_default"] = as3DefaultIRule(*s.Response)
+	}
+	if len(s.SourceRanges) > 0 {
+		iRules[name + "_source_ranges"] = renderIRule(sourceRangesTmpl, s.SourceRanges)
+	}
+	if len(iRules) > 0 {
+		names := []string{}
+		for ruleName, content := range iRules {
+			app[ruleName] = map[string]interface{}{
+				"class" : "iRule",
+				"iRule" : content,
+			}
+			names = append(names, ruleName)
+		}
+		sort.Strings(names)
+		service["iRules"] = names
+	}
+	app[name] = service
+	return nil
+}
+
+// as3IRule renders rule with the iRule template of the f5 provider, no host
+// matches all of them.
+func as3IRule(rule Rule)string{
+	host := rule.Host
+	if host == "" {
+		host = "*"
+	}
+	path := rule.Path
+	if path == "/" {
+		path = ""
+	}
+	if rule.Redirect != nil {
+		_, r := redirectRule("", host + path, rule.Redirect.Scheme, rule.Redirect.Host, rule.Redirect.Code)
+		return hostRule(r)
+	}
+	if rule.Rewrite != nil {
+		_, r := rewriteRule("", host + path, rewritePrefix(rule), rule.Rewrite.Replacement, rule.Pool)
+		return hostRule(r)
+	}
+	return hostRule(IRule{URL : host, Path : path, PoolName : rule.Pool})
+}
+
+func as3DefaultIRule(resp Response)string{
+	data := DefaultData{
+		Code : resp.Code,
+		ContentType : resp.ContentType,
+		Body : resp.Body,
+	}
+	if data.Code == 0 {
+		data.Code = 503
+	}
+	if data.ContentType == "" {
+		data.ContentType = "text/html"
+	}
+	return renderIRule(defaultTmpl, data)
+}
@@ -0,0 +1,155 @@
+package drivers
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func testAS3Tenant()*as3Tenant{
+	return &as3Tenant{
+		Services : map[string]*as3Service{
+			"web" : &as3Service{
+				VirtualServer : VirtualServer{Name : "web", Mode : MODEHTTP, IP : "10.0.0.1", Port : "443", TLS : true},
+				Pool : "app",
+				Response : &Response{Code : 404, Body : "not here"},
+				Rules : map[string]Rule{
+					"web_api" : Rule{Host : "example.com", Path : "/api", Pool : "api"},
+				},
+				Certs : []as3Cert{
+					{Name : "web_cert", ServerName : "example.com", Default : true, Namespace : "ns", Secret : "tls"},
+				},
+				SourceRanges : []string{"10.0.0.0/8"},
+			},
+			"dns" : &as3Service{
+				VirtualServer : VirtualServer{Name : "dns", Mode : MODEL4, IP : "10.0.0.2", Port : "53", Protocol : "udp"},
+			},
+		},
+		Pools : map[string]*as3Pool{
+			"app" : &as3Pool{
+				Pool : Pool{Name : "app", Method : METHODLEASTCONNECTIONS, Protocol : "HTTP", MinActiveMembers : 1},
+				Members : []as3Member{
+					{Member : Member{IP : "192.168.0.1", Port : 80, Weight : 2, Priority : 10}},
+					{Member : Member{IP : "192.168.0.2", Port : 80}, Disabled : true},
+				},
+			},
+			"api" : &as3Pool{
+				Pool : Pool{Name : "api"},
+			},
+		},
+	}
+}
+
+func testAS3Secret(namespace, name string)([]byte, []byte, error){
+	if namespace != "ns" || name != "tls" {
+		return nil, nil, fmt.Errorf("no Secret %s/%s", namespace, name)
+	}
+	return []byte("CERT"), []byte("KEY"), nil
+}
+
+// TestAS3TenantState checks that the tenant kept in a rendered declaration
+// reads back as it was.
+func TestAS3TenantState(t *testing.T) {
+	cases := []struct {
+		name		string
+		tenant		*as3Tenant
+	}{
+		{"empty", &as3Tenant{}},
+		{"services and pools", testAS3Tenant()},
+	}
+	for _, c := range cases {
+		rendered, err := c.tenant.render(testAS3Secret)
+		if err != nil {
+			t.Errorf("%s: render: %v", c.name, err)
+			continue
+		}
+		data, err := json.Marshal(rendered)
+		if err != nil {
+			t.Errorf("%s: marshal: %v", c.name, err)
+			continue
+		}
+		got, err := readAS3Tenant(data)
+		if err != nil {
+			t.Errorf("%s: read: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.tenant) {
+			t.Errorf("%s: read back %+v, want %+v", c.name, got, c.tenant)
+		}
+	}
+}
+
+func TestReadAS3TenantWithoutState(t *testing.T) {
+	for _, data := range []string{
+		`{"class": "Tenant"}`,
+		`{"class": "Tenant", "ygw": {"class": "Application"}}`,
+	} {
+		tenant, err := readAS3Tenant([]byte(data))
+		if err != nil {
+			t.Errorf("%s: %v", data, err)
+			continue
+		}
+		if len(tenant.Services) != 0 || len(tenant.Pools) != 0 {
+			t.Errorf("%s: read %+v, want an empty tenant", data, tenant)
+		}
+	}
+	if _, err := readAS3Tenant([]byte(`{"ygw": {"ygw_state": {"model": "not base64"}}}`)); err == nil {
+		t.Errorf("broken state read without an error")
+	}
+}
+
+func TestAS3TenantRender(t *testing.T) {
+	rendered, err := testAS3Tenant().render(testAS3Secret)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	app := rendered[as3Application].(map[string]interface{})
+	checks := []struct {
+		name		string
+		object		string
+		key			string
+		want		interface{}
+	}{
+		{"https service", "web", "class", "Service_HTTPS"},
+		{"default pool", "web", "pool", "app"},
+		{"tls server", "web", "serverTLS", "web_tls"},
+		{"iRules sorted", "web", "iRules", []string{"web_api", "web_default", "web_source_ranges"}},
+		{"l4 service", "dns", "class", "Service_UDP"},
+		{"pool method", "app", "loadBalancingMode", "least-connections-member"},
+		{"pool monitor", "app", "monitors", []string{"http"}},
+		{"pool min active", "app", "minimumMembersActive", 1},
+		{"certificate", "web_cert", "certificate", "CERT"},
+		{"key", "web_cert", "privateKey", "KEY"},
+	}
+	for _, c := range checks {
+		object, ok := app[c.object].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: no object %s", c.name, c.object)
+			continue
+		}
+		if got := object[c.key]; !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: %s of %s is %v, want %v", c.name, c.key, c.object, got, c.want)
+		}
+	}
+	members := app["app"].(map[string]interface{})["members"].([]map[string]interface{})
+	if len(members) != 2 || members[0]["ratio"] != 2 || members[1]["ratio"] != 1 || members[1]["adminState"] != "disable" {
+		t.Errorf("members rendered as %v", members)
+	}
+
+	// a certificate without its Secret fails the rendering.
+	if _, err := testAS3Tenant().render(nil); err == nil {
+		t.Errorf("rendered the certificates without their Secrets")
+	}
+	// a TLS virtual server without certificates is disabled.
+	tenant := testAS3Tenant()
+	tenant.Services["web"].Certs = nil
+	rendered, err = tenant.render(testAS3Secret)
+	if err != nil {
+		t.Fatalf("render without certificates: %v", err)
+	}
+	web := rendered[as3Application].(map[string]interface{})["web"].(map[string]interface{})
+	if web["enable"] != false {
+		t.Errorf("TLS virtual server without certificates is enabled: %v", web)
+	}
+}
@@ -0,0 +1,323 @@
+package drivers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+func init() {
+	Register(F5GWPROVIDER, newF5Provider, f5EnvDevice)
+}
+
+// f5Provider is the Provider of a BIG-IP, on top of its GwProvider.
+type f5Provider struct {
+	drv		GwProvider
+}
+
+// NewF5Provider returns the Provider of the BIG-IP driver drv, the objects
+// go to the partition of drv.
+func NewF5Provider(drv GwProvider)Provider{
+	return &f5Provider{drv : drv}
+}
+
+func newF5Provider(device Device)(Provider, error){
+	drv, err := NewF5(device)
+	if err != nil {
+		return nil, err
+	}
+	return NewF5Provider(drv), nil
+}
+
+// f5EnvDevice returns the BIG-IP of BIGIP_URL, it is not verified unless
+// BIGIP_SSL_VERIFY is true, as before it could be.
+func f5EnvDevice()Device{
+	device := Device{
+		Address		: os.Getenv("BIGIP_URL"),
+		Username	: os.Getenv("BIGIP_LOGIN"),
+		Password	: os.Getenv("BIGIP_PASSWORD"),
+		InsecureSkipVerify	: os.Getenv("BIGIP_SSL_VERIFY") != "true",
+		LoginProvider	: os.Getenv("BIGIP_LOGIN_PROVIDER"),
+	}
+	if path := os.Getenv("BIGIP_CA_BUNDLE"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			glog.Errorf("Read BIG-IP CA bundle %s failed: %v", path, err)
+		}
+		device.CABundle = data
+	}
+	return device
+}
+
+// GwProviderOf returns the BIG-IP driver p is built on, for the controllers
+// still using it.
+func GwProviderOf(p Provider)(GwProvider, bool){
+	f5, ok := p.(*f5Provider)
+	if !ok {
+		return nil, false
+	}
+	return f5.drv, true
+}
+
+// Partition returns the provider of the objects of the BIG-IP partition
+// name, the one of the device when empty.
+func (p *f5Provider)Partition(name string)Provider{
+	return &f5Provider{drv : p.drv.Partition(name)}
+}
+
+func (p *f5Provider)Type()string{
+	return F5GWPROVIDER
+}
+
+func (p *f5Provider)Capabilities()Capabilities{
+	return Capabilities{
+		L4					: true,
+		PortRanges			: true,
+		SourceRanges		: true,
+		Redirect			: true,
+		Rewrite				: true,
+		DefaultResponse		: true,
+		MemberConnectionLimit	: true,
+		MemberPriority		: true,
+	}
+}
+
+func (p *f5Provider)Login(ctx context.Context)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.Login()
+}
+
+func (p *f5Provider)Logout(){
+	p.drv.Logout()
+}
+
+func (p *f5Provider)CreateVirtualServer(ctx context.Context, vs VirtualServer)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if vs.Mode == MODEL4 {
+		// the fastL4 profile of L4 virtual servers takes no client-ssl one.
+		if vs.TLS {
+			return unsupported(F5GWPROVIDER, "TLS termination on the L4 virtual server %s", vs.Name)
+		}
+		protocol := vs.Protocol
+		if protocol == "tls" {
+			protocol = "tcp"
+		}
+		return p.drv.CreateVirtualServer("nat", vs.Name, vs.IP, vs.Port, protocol)
+	}
+	// the client-ssl profiles of AddCert turn on TLS.
+	return p.drv.CreateVirtualServer("url", vs.Name, vs.IP, vs.Port, "tcp")
+}
+
+func (p *f5Provider)DeleteVirtualServer(ctx context.Context, name string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.DeleteVirtualServer(name)
+}
+
+func (p *f5Provider)SetDefaultPool(ctx context.Context, vsName string, poolName string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.VirtualServerBindPool(vsName, poolName)
+}
+
+func (p *f5Provider)UnsetDefaultPool(ctx context.Context, vsName string, poolName string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.VirtualServerUnbindPool(vsName, poolName)
+}
+
+func (p *f5Provider)SetDefaultResponse(ctx context.Context, vsName string, resp Response)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.VirtualServerBindDefaultResponse(vsName, resp.Code, resp.ContentType, resp.Body)
+}
+
+func (p *f5Provider)UnsetDefaultResponse(ctx context.Context, vsName string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.VirtualServerUnbindDefaultResponse(vsName)
+}
+
+// AddRule binds the iRule of rule, the iRules are named after the virtual
+// server and the url so rule.Name is not used.
+func (p *f5Provider)AddRule(ctx context.Context, vsName string, rule Rule)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if rule.Redirect != nil {
+		return p.drv.VirtualServerBindRedirect(vsName, rule.Host + rule.Path,
+			rule.Redirect.Scheme, rule.Redirect.Host, rule.Redirect.Code)
+	}
+	if rule.Rewrite != nil {
+		return p.drv.VirtualServerBindRewrite(vsName, rule.Host + rule.Path,
+			rewritePrefix(rule), rule.Rewrite.Replacement, rule.Pool)
+	}
+	return p.drv.VirtualServerBindURL(vsName, rule.Host + rule.Path, rule.Pool)
+}
+
+func (p *f5Provider)RemoveRule(ctx context.Context, vsName string, rule Rule)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if rule.Redirect != nil {
+		return p.drv.VirtualServerUnbindRedirect(vsName, rule.Host + rule.Path,
+			rule.Redirect.Scheme, rule.Redirect.Host, rule.Redirect.Code)
+	}
+	if rule.Rewrite != nil {
+		return p.drv.VirtualServerUnbindRewrite(vsName, rule.Host + rule.Path,
+			rewritePrefix(rule), rule.Rewrite.Replacement, rule.Pool)
+	}
+	return p.drv.VirtualServerUnbindURL(vsName, rule.Host + rule.Path, rule.Pool)
+}
+
+// AddCert adds the client-ssl profile of cert, the default one has no SNI
+// name.
+func (p *f5Provider)AddCert(ctx context.Context, vsName string, cert Cert)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	serverName := cert.ServerName
+	if cert.Default {
+		serverName = ""
+	}
+	return p.drv.VirtualServerBindTLS(vsName, cert.Name, serverName, cert.Cert, cert.Key)
+}
+
+func (p *f5Provider)RemoveCert(ctx context.Context, vsName string, cert Cert)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.VirtualServerUnbindTLS(vsName, cert.Name)
+}
+
+func (p *f5Provider)SetSourceRanges(ctx context.Context, vsName string, ranges []string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.VirtualServerSetSourceRanges(vsName, ranges)
+}
+
+func (p *f5Provider)CreatePool(ctx context.Context, pool Pool)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// a BIG-IP encrypts toward the members with a server SSL profile of the
+	// virtual server, not of the pool, see Capabilities.PoolTLS.
+	if protocol := strings.ToUpper(pool.Protocol); protocol == "SSL" || protocol == "SSL_TCP" {
+		return unsupported(F5GWPROVIDER, "protocol %s toward the members of %s", pool.Protocol, pool.Name)
+	}
+	return p.drv.CreatePool(pool.Name, pool.Method)
+}
+
+// UpdatePool sets the slow start and the priority group activation of the
+// pool, the connection limits of the BIG-IP are the ones of the members.
+func (p *f5Provider)UpdatePool(ctx context.Context, pool Pool)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if pool.ConnectionLimit > 0 {
+		return unsupported(F5GWPROVIDER, "connection limit of pool %s, set the one of its members", pool.Name)
+	}
+	err := p.drv.SetPoolSlowStart(pool.Name, pool.SlowStart)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.SetPoolMinActiveMembers(pool.Name, pool.MinActiveMembers)
+}
+
+func (p *f5Provider)DeletePool(ctx context.Context, name string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.DeletePool(name)
+}
+
+// SetBackupPool is unsupported, the pools fail over to their lower priority
+// members instead.
+func (p *f5Provider)SetBackupPool(ctx context.Context, poolName string, backupName string, threshold int)error{
+	return unsupported(F5GWPROVIDER, "backup pool %s of %s, set the priority of its members", backupName, poolName)
+}
+
+func (p *f5Provider)UnsetBackupPool(ctx context.Context, poolName string)error{
+	return unsupported(F5GWPROVIDER, "backup pool of %s", poolName)
+}
+
+func (p *f5Provider)AddMember(ctx context.Context, poolName string, member Member)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := p.drv.AddPoolMember(poolName, member.IP, strconv.Itoa(member.Port))
+	if err != nil {
+		return err
+	}
+	if member.Weight <= 1 && member.ConnectionLimit == 0 && member.Priority == 0 {
+		return nil
+	}
+	return p.UpdateMember(ctx, poolName, member)
+}
+
+func (p *f5Provider)UpdateMember(ctx context.Context, poolName string, member Member)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	port := strconv.Itoa(member.Port)
+	err := p.drv.SetPoolMemberLimits(poolName, member.IP, port, memberWeight(member), member.ConnectionLimit)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.SetPoolMemberPriority(poolName, member.IP, port, member.Priority)
+}
+
+func (p *f5Provider)RemoveMember(ctx context.Context, poolName string, member Member)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.DelPoolMember(poolName, member.IP, strconv.Itoa(member.Port))
+}
+
+func (p *f5Provider)EnableMember(ctx context.Context, poolName string, member Member)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.EnablePoolMember(poolName, member.IP, strconv.Itoa(member.Port))
+}
+
+func (p *f5Provider)DisableMember(ctx context.Context, poolName string, member Member)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.DisablePoolMember(poolName, member.IP, strconv.Itoa(member.Port))
+}
+
+func (p *f5Provider)PoolMembers(ctx context.Context, poolName string)(map[string]bool, error){
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p.drv.PoolMembers(poolName)
+}
+
+func (p *f5Provider)MemberConnections(ctx context.Context, poolName string, member Member)(int, error){
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return p.drv.PoolMemberConnections(poolName, member.IP, strconv.Itoa(member.Port))
+}
@@ -0,0 +1,312 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/scottdware/go-bigip"
+)
+
+const (
+	F5DEFAULTLOGINPROVIDER	= "tmos"
+	// a token is renewed this long before it expires.
+	f5TokenRefresh			= 2 * time.Minute
+	// a replaced token is revoked this long after, for the requests still
+	// using it.
+	f5TokenGrace			= time.Minute
+)
+
+// f5Session is the token login of a BIG-IP, shared by the drivers of all its
+// partitions. The requests carry the token instead of the password, so a
+// remote authentication server sees one login per token. Without a token no
+// request is sent.
+type f5Session struct {
+	lock		sync.Mutex
+	device		Device
+	// host is the url of the device.
+	host		string
+	// client is replaced on every new token, the requests in flight keep
+	// the one they started with. It has no password, so that go-bigip can't
+	// fall back to basic auth.
+	client		*bigip.BigIP
+	http		*http.Client
+	token		string
+	expires		time.Time
+	// retired are the replaced tokens waiting for their grace period.
+	retired		map[string]bool
+	stop		chan struct{}
+}
+
+type f5Token struct {
+	Token		string	`json:"token"`
+	// Timeout is the lifetime of the token in seconds.
+	Timeout		int		`json:"timeout"`
+}
+
+// newF5Session logs in the device and keeps the token fresh until logout.
+// A failed login is retried by the refresh and by the next request.
+func newF5Session(device Device)(*f5Session, error){
+	tlsConfig := &tls.Config{InsecureSkipVerify : device.InsecureSkipVerify}
+	if len(device.CABundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(device.CABundle) {
+			return nil, fmt.Errorf("no certificate found in the CA bundle of %s", device.Address)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	client := bigip.NewSession(device.Address, "", "", nil)
+	client.Transport = &http.Transport{
+		Proxy			: http.ProxyFromEnvironment,
+		TLSClientConfig	: tlsConfig,
+	}
+	s := &f5Session{
+		device	: device,
+		host	: client.Host,
+		client	: client,
+		http	: &http.Client{Transport : client.Transport, Timeout : 30 * time.Second},
+		retired	: make(map[string]bool),
+		stop	: make(chan struct{}),
+	}
+	err := s.login()
+	if err != nil {
+		glog.Errorf("Login to %s failed: %v", device.Address, err)
+	}
+	go s.run()
+	return s, nil
+}
+
+// bigip returns the client with the current token, logging in when there is
+// none.
+func (s *f5Session)bigip()(*bigip.BigIP, error){
+	_, err := s.currentToken()
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.client, nil
+}
+
+// request sends an iControl REST request with the current token, it is
+// cancelled with ctx. A token the device refuses, revoked or lost by a
+// restart of the device, is replaced and the request sent once more. The
+// logins are not cancelled, they serve the other requests too.
+func (s *f5Session)request(ctx context.Context, method, path string, body interface{}, out interface{})error{
+	token, err := s.currentToken()
+	if err != nil {
+		return err
+	}
+	err = s.do(ctx, method, path, token, body, out)
+	if !isF5Unauthorized(err) {
+		return err
+	}
+	glog.V(2).Infof("Token of %s refused, log in again.", s.device.Address)
+	token, err = s.relogin(token)
+	if err != nil {
+		return err
+	}
+	return s.do(ctx, method, path, token, body, out)
+}
+
+// do sends a request with token, none for the login.
+func (s *f5Session)do(ctx context.Context, method, path string, token string, body interface{}, out interface{})error{
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, s.host + path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("X-F5-Auth-Token", token)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			// given up on, not to be retried.
+			return ctx.Err()
+		}
+		return &Error{Reason : ErrorReasonTransient, Err : err}
+	}
+	defer resp.Body.Close()
+	data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return &Error{Code : resp.StatusCode, Err : fmt.Errorf("unauthorized: %s", data)}
+	}
+	if resp.StatusCode >= 300 {
+		return f5ResponseError(resp.StatusCode, data)
+	}
+	// AS3 answers 204 without a body when there is nothing declared.
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// login gets a new token and revokes the old one after f5TokenGrace.
+func (s *f5Session)login()error{
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.loginLocked()
+}
+
+// relogin replaces the refused token old, unless another request did
+// already, and returns the new one.
+func (s *f5Session)relogin(old string)(string, error){
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.token == old || s.token == "" {
+		err := s.loginLocked()
+		if err != nil {
+			return "", err
+		}
+	}
+	return s.token, nil
+}
+
+// loginLocked is login, callers hold s.lock.
+func (s *f5Session)loginLocked()error{
+	provider := s.device.LoginProvider
+	if provider == "" {
+		provider = F5DEFAULTLOGINPROVIDER
+	}
+	var resp struct {
+		Token	f5Token	`json:"token"`
+	}
+	err := s.do(context.Background(), "POST", "/mgmt/shared/authn/login", "", map[string]string{
+		"username"			: s.device.Username,
+		"password"			: s.device.Password,
+		"loginProviderName"	: provider,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Token.Token == "" {
+		return fmt.Errorf("no token in the login response of %s", s.device.Address)
+	}
+
+	old := s.token
+	client := *s.client
+	client.Token = resp.Token.Token
+	s.client = &client
+	s.token = resp.Token.Token
+	s.expires = time.Now().Add(time.Duration(resp.Token.Timeout) * time.Second)
+	glog.V(3).Infof("Logged in %s, token expires at %v", s.device.Address, s.expires)
+	if old != "" {
+		s.retired[old] = true
+		time.AfterFunc(f5TokenGrace, func() {
+			s.retireToken(old)
+		})
+	}
+	return nil
+}
+
+// retireToken revokes a replaced token, unless logout did already.
+func (s *f5Session)retireToken(token string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.retired[token] {
+		return
+	}
+	delete(s.retired, token)
+	s.deleteToken(token)
+}
+
+// ensureLogin logs in when there is no token yet.
+func (s *f5Session)ensureLogin()error{
+	_, err := s.currentToken()
+	return err
+}
+
+// currentToken returns the token, logging in when there is none yet.
+func (s *f5Session)currentToken()(string, error){
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+		case <-s.stop:
+			return "", fmt.Errorf("logged out of %s", s.device.Address)
+		default:
+	}
+	if s.token == "" {
+		err := s.loginLocked()
+		if err != nil {
+			return "", err
+		}
+	}
+	return s.token, nil
+}
+
+// deleteToken revokes token with the current one, or with itself when it is
+// the current one. Callers hold s.lock.
+func (s *f5Session)deleteToken(token string) {
+	auth := s.token
+	if auth == "" {
+		auth = token
+	}
+	err := s.do(context.Background(), "DELETE", "/mgmt/shared/authz/tokens/" + token, auth, nil, nil)
+	if err != nil {
+		glog.Warningf("Delete token of %s failed: %v", s.device.Address, err)
+	}
+}
+
+// run renews the token before it expires.
+func (s *f5Session)run() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+		}
+		s.lock.Lock()
+		due := s.token == "" || time.Now().Add(f5TokenRefresh).After(s.expires)
+		s.lock.Unlock()
+		if !due {
+			continue
+		}
+		err := s.login()
+		if err != nil {
+			glog.Errorf("Refresh token of %s failed: %v", s.device.Address, err)
+		}
+	}
+}
+
+// logout stops the refresh and revokes the tokens.
+func (s *f5Session)logout() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+		case <-s.stop:
+			return
+		default:
+			close(s.stop)
+	}
+	for token, _ := range s.retired {
+		s.deleteToken(token)
+		delete(s.retired, token)
+	}
+	if s.token != "" {
+		s.deleteToken(s.token)
+		s.token = ""
+	}
+}
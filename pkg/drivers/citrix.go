@@ -1,318 +1,929 @@
-package drivers
-
-import (
-	"fmt"
-	"strconv"
-	"sort"
-	
-	"github.com/golang/glog"
-	
-	"github.com/chiradeep/go-nitro/config/cs"	
-	citrixbasic "github.com/chiradeep/go-nitro/config/basic"
-	/*"github.com/chiradeep/go-nitro/config/cs"*/
-	citrixlb "github.com/chiradeep/go-nitro/config/lb"
-	"github.com/chiradeep/go-nitro/netscaler"
-)
-
-const (
-	CITRIXLBPROVIDER	 = "citrix"
-)
-
-type LbProvider interface {
-	CreatePool(string, string)error
-	AddMemberToPool(string, string, int, int)error
-	RemoveMemberFromPool(string, string, int)error
-	DeletePool(string)error
-	
-	CreateLB(string, string, int)error
-	DeleteLB(string)error
-	AddRuleToLB(string, string, string, string, string, string)error
-	RemoveRuleToLB(string, string, string, string, string, string)error
-}
-
-type CitrixLb struct{}
-
-func (c *CitrixLb)createSvcGroup(groupName string)error{
-	client, _ := netscaler.NewNitroClientFromEnv()
-	nsSvcGrp := citrixbasic.Servicegroup{
-		Servicegroupname	: groupName,
-		Servicetype			: "HTTP",
-	}
-	_, err := client.AddResource(netscaler.Servicegroup.Type(), groupName, &nsSvcGrp)
-	if err != nil {
-		return err
-	}
-	return nil	
-}
-
-func (c *CitrixLb)deleteSvcGroup(groupName string)error{
-	glog.V(2).Infof("Citrix Driver DeleteSvcGroup")
-	client, _ := netscaler.NewNitroClientFromEnv()
-	err := client.DeleteResource(netscaler.Servicegroup.Type(), groupName)
-	if err != nil {
-		return err
-	}
-	return nil	
-}
-
-func (c *CitrixLb)createVs(vsName string, method string)error{
-	client, err := netscaler.NewNitroClientFromEnv()
-	if err != nil {
-		return err
-	}
-	
-	nsLB := citrixlb.Lbvserver{
-		Name			: vsName,
-		Servicetype		: "HTTP",
-		//Lbmethod        : "ROUNDROBIN",
-		Lbmethod        : method,
-	}
-	name, err := client.AddResource(netscaler.Lbvserver.Type(), vsName, &nsLB)
-	if err != nil {
-		glog.Errorf("Citrix create Lbvserver failed %v", err)
-	} else {
-		glog.V(2).Infof("Citrix created Lbvserver %s", name)
-	}
-		
-	return nil
-}
-
-func (c *CitrixLb)deleteVs(vsName string)error{
-	client, _ := netscaler.NewNitroClientFromEnv()
-	err := client.DeleteResource(netscaler.Lbvserver.Type(), vsName)
-	if err != nil {
-		return err
-	}
-	return nil	
-}
-
-func (c *CitrixLb)bindSvcGroupVs(groupName, vsName string)error{
-	glog.V(2).Infof("Citrix Driver BindSvcGroupLb. bind %s to %s", groupName, vsName)
-	client, _ := netscaler.NewNitroClientFromEnv()
-	binding := citrixlb.Lbvserverservicegroupbinding{
-		Servicegroupname	: groupName,
-		Name				: vsName,
-	}
-	err := client.BindResource(netscaler.Lbvserver.Type(), vsName, netscaler.Servicegroup.Type(), groupName, &binding)
-	if err != nil {
-		return err
-	} 
-	return nil	
-}
-
-func (c *CitrixLb)CreatePool(poolName string, method string)error {
-	err := c.createSvcGroup(poolName)
-	if err != nil {
-		return err
-	}
-	
-	err = c.createVs(poolName, method)
-	if err != nil {
-		return err
-	}
-	
-	err = c.bindSvcGroupVs(poolName, poolName)
-	if err != nil {
-		return err
-	}	
-	
-	return nil	
-}
-
-func (c *CitrixLb)DeletePool(poolName string)error {
-	err := c.deleteVs(poolName)
-	if err != nil {
-		return err
-	}
-	
-	err = c.deleteSvcGroup(poolName)
-	if err != nil {
-		return err
-	}
-	
-	return nil	
-}
-
-func (c *CitrixLb)createServer(ip string)error{
-	client, _ := netscaler.NewNitroClientFromEnv()
-	nsServer := citrixbasic.Server{
-		Name			: ip,
-		Ipaddress		: ip,
-	}
-	_, err := client.AddResource(netscaler.Server.Type(), ip, &nsServer)
-	if err != nil {
-		glog.Errorf("createServer failed: %v", err)
-	}	
-	return nil	
-}
-
-func (c *CitrixLb)bindServerToGroup(groupName string, serverName string, port, weight int)error{
-	glog.V(2).Infof("Citrix Driver BindServerToGroup %s->%s", serverName, groupName)
-	
-	client, _ := netscaler.NewNitroClientFromEnv()
-	binding := citrixbasic.Servicegroupservicegroupmemberbinding{
-		Servicegroupname	: groupName,
-		Servername			: serverName,
-		Port				: port,
-		Weight				: weight,
-	}
-	//err := client.BindResource(netscaler.Servicegroup.Type(), groupName, netscaler.Server.Type(), serverName, &binding)
-	_, err := client.AddResource(netscaler.Servicegroup_servicegroupmember_binding.Type(), groupName, &binding)
-	if err != nil {
-		return err
-	} 	
-	
-	return nil	
-}
-
-func (c *CitrixLb)AddMemberToPool(groupName string, ip string, port, weight int)error{
-	err := c.createServer(ip)
-	if err != nil {
-		glog.Errorf("createServer failed: %v", err)
-	}
-	
-	err = c.bindServerToGroup(groupName, ip, port, weight)
-	if err != nil {
-		glog.Errorf("bindServerToGroup failed: %v", err)
-	}
-	
-	return nil
-}
-
-func (c *CitrixLb)unbindServerToGroup(groupName, serverName string, port int)error{
-	glog.V(2).Infof("Citrix Driver UnBindServerFromGroup %s->%s", serverName, groupName)
-
-	client, _ := netscaler.NewNitroClientFromEnv()
-	var args = []string{
-		"servername:" + serverName,
-		"servicegroupname:" + groupName,
-		"port:" + strconv.Itoa(port),
-	}
-	
-	err := client.DeleteResourceWithArgs(netscaler.Servicegroup_servicegroupmember_binding.Type(), groupName, args)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (c *CitrixLb)RemoveMemberFromPool(groupName, serverName string, port int)error{
-	return c.unbindServerToGroup(groupName, serverName, port)
-}
-
-func (c *CitrixLb)createContentVs(csvserverName string, vserverIp string, vserverPort int)error{
-	client, _ := netscaler.NewNitroClientFromEnv()
-	protocol := "HTTP"
-	cs := cs.Csvserver{
-		Name:        csvserverName,
-		Ipv46:       vserverIp,
-		Servicetype: protocol,
-		Port:        vserverPort,
-	}
-	_, _ = client.AddResource(netscaler.Csvserver.Type(), csvserverName, &cs)
-	return nil
-}
-
-func (c *CitrixLb)CreateLB(lbName string, vip string, port int)error{
-	return c.createContentVs(lbName, vip, port)
-}
-
-func (c *CitrixLb)RemoveRuleToLB(lbName string, domainName string, path string, 
-	poolName string, actionName string, policyName string)error{
-	client, _ := netscaler.NewNitroClientFromEnv()
-	
-	err := client.UnbindResource(netscaler.Csvserver.Type(), lbName, netscaler.Cspolicy.Type(), policyName, "policyName")
-	if err != nil {
-		glog.Errorf("UnbindPolicy failed: %v", err)
-	}		
-	err = client.DeleteResource(netscaler.Cspolicy.Type(), policyName)
-	if err != nil {
-		glog.Errorf("DeletePolicy failed: %v", err)
-	}
-	
-	err = client.DeleteResource(netscaler.Csaction.Type(), actionName)
-	if err != nil {
-		glog.Errorf("DeleteAction failed: %v", err)
-	}	
-	
-	return nil
-}
-	
-func (c *CitrixLb)ListBoundPolicies(csvserverName string) ([]string, []int) {
-	ret1 := []string{}
-	ret2 := []int{}
-	client, _ := netscaler.NewNitroClientFromEnv()
-	policies, err := client.FindAllBoundResources(netscaler.Csvserver.Type(), csvserverName, netscaler.Cspolicy.Type())
-	if err != nil {
-		glog.Errorf("No bindings for CS Vserver %s: %v", csvserverName, err)
-		return ret1, ret2
-	}
-	for _, policy := range policies {
-		pname := policy["policyname"].(string)
-		prio, err := strconv.Atoi(policy["priority"].(string))
-		if err != nil {
-			continue
-		}
-		ret1 = append(ret1, pname)
-		ret2 = append(ret2, prio)
-
-	}
-	sort.Ints(ret2)
-	return ret1, ret2
-}	
-
-func (c *CitrixLb)AddRuleToLB(lbName string, domainName string, path string, 
-	poolName string, actionName string, policyName string)error{
-	var priority = 1
-	_, priorities := c.ListBoundPolicies(lbName)
-	if len(priorities) > 0 {
-		priority = priorities[len(priorities)-1] + 1
-	}		
-		
-	client, _ := netscaler.NewNitroClientFromEnv()	
-	csAction := cs.Csaction{
-		Name:            actionName,
-		Targetlbvserver: poolName,
-	}
-	_, _ = client.AddResource(netscaler.Csaction.Type(), actionName, &csAction)
-	
-	var rule string
-	if path != "" {
-		rule = fmt.Sprintf("HTTP.REQ.HOSTNAME.EQ(\"%s\") && HTTP.REQ.URL.PATH.EQ(\"%s\")", domainName, path)
-	} else {
-		rule = fmt.Sprintf("HTTP.REQ.HOSTNAME.EQ(\"%s\")", domainName)
-	}
-	csPolicy := cs.Cspolicy{
-		Policyname: policyName,
-		Rule:       rule,
-		Action:     actionName,
-	}
-	_, _ = client.AddResource(netscaler.Cspolicy.Type(), policyName, &csPolicy)
-
-	binding2 := cs.Csvservercspolicybinding{
-		Name:       lbName,
-		Policyname: policyName,
-		Priority:   priority,
-		Bindpoint:  "REQUEST",
-	}
-	_ = client.BindResource(netscaler.Csvserver.Type(), lbName, netscaler.Cspolicy.Type(), policyName, &binding2)	
-	return nil
-}
-	
-func (c *CitrixLb)DeleteLB(lbName string)error{
-	client, _ := netscaler.NewNitroClientFromEnv()	
-	err := client.DeleteResource(netscaler.Csvserver.Type(), lbName)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func NewLBer(lbtype string)(LbProvider, error){
-	switch lbtype {
-		case CITRIXLBPROVIDER:
-			return &CitrixLb{}, nil
-		default:
-			return nil, fmt.Errorf("Unsupport type: %s", lbtype)
-	}
-}
\ No newline at end of file
+package drivers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sort"
+	
+	"github.com/golang/glog"
+	
+	"github.com/chiradeep/go-nitro/config/cs"	
+	citrixbasic "github.com/chiradeep/go-nitro/config/basic"
+	/*"github.com/chiradeep/go-nitro/config/cs"*/
+	citrixlb "github.com/chiradeep/go-nitro/config/lb"
+	"github.com/chiradeep/go-nitro/config/responder"
+	"github.com/chiradeep/go-nitro/config/rewrite"
+	"github.com/chiradeep/go-nitro/config/ssl"
+	"github.com/chiradeep/go-nitro/config/system"
+	"github.com/chiradeep/go-nitro/netscaler"
+)
+
+const (
+	CITRIXLBPROVIDER	 = "citrix"
+	// dummyServiceIP is the address of the service keeping the default
+	// response lbvserver UP, from TEST-NET-1 so it never reaches a real host.
+	dummyServiceIP		 = "192.0.2.1"
+)
+
+type LbProvider interface {
+	CreatePool(string, string, string)error
+	AddMemberToPool(string, string, int, int)error
+	RemoveMemberFromPool(string, string, int)error
+	EnableMemberInPool(string, string, int)error
+	DisableMemberInPool(string, string, int)error
+	DrainMemberInPool(string, string, int, int)error
+	MemberConnectionsInPool(string, string, int)(int, error)
+	MembersInPool(string)(map[string]bool, error)
+	DeletePool(string)error
+	SetBackupPool(string, string, int)error
+	UnsetBackupPool(string)error
+	SetPoolSlowStart(string, int)error
+	SetPoolConnectionLimit(string, int)error
+	SetMemberWeightInPool(string, string, int, int)error
+	
+	CreateLB(string, string, int, string)error
+	CreateTLSLB(string, string, int, string)error
+	AddCertToLB(string, string, bool, []byte, []byte)error
+	RemoveCertFromLB(string, string)error
+	DeleteLB(string)error
+	AddRuleToLB(string, string, string, string, string, string)error
+	RemoveRuleToLB(string, string, string, string, string, string)error
+	AddRedirectToLB(string, string, string, string, string, int, string, string)error
+	RemoveRedirectFromLB(string, string, string)error
+	AddRewriteToLB(string, string, string, string, string, string, string)error
+	RemoveRewriteFromLB(string, string, string)error
+	SetDefaultPool(string, string)error
+	UnsetDefaultPool(string, string)error
+	SetDefaultResponse(string, int, string, string)error
+	UnsetDefaultResponse(string)error
+	Login()error
+}
+
+// CitrixLb keeps one Nitro client for its device, its methods return the
+// failures of the device as *Error.
+type CitrixLb struct{
+	// device is empty for the NetScaler of the environment.
+	device	Device
+	client	*netscaler.NitroClient
+}
+
+// serviceType returns the service type of protocol, HTTP when it is empty.
+func serviceType(protocol string)string{
+	if protocol == "" {
+		return "HTTP"
+	}
+	return strings.ToUpper(protocol)
+}
+
+// vsServiceType returns the type of the lbvserver in front of a servicegroup
+// of protocol. The ssl toward the members is done by the servicegroup, so
+// the lbvserver behind a csvserver stays HTTP or TCP.
+func vsServiceType(protocol string)string{
+	switch serviceType(protocol) {
+	case "SSL":
+		return "HTTP"
+	case "SSL_TCP":
+		return "TCP"
+	}
+	return serviceType(protocol)
+}
+
+func (c *CitrixLb)createSvcGroup(groupName string, protocol string)error{
+	nsSvcGrp := citrixbasic.Servicegroup{
+		Servicegroupname	: groupName,
+		Servicetype			: serviceType(protocol),
+	}
+	_, err := c.client.AddResource(netscaler.Servicegroup.Type(), groupName, &nsSvcGrp)
+	return nitroError(err)
+}
+
+func (c *CitrixLb)deleteSvcGroup(groupName string)error{
+	glog.V(2).Infof("Citrix Driver DeleteSvcGroup")
+	err := c.client.DeleteResource(netscaler.Servicegroup.Type(), groupName)
+	return nitroError(err)
+}
+
+// citrixMethods translates the neutral lb methods, the ratio ones are the
+// weighted round robin and least connection. Empty ones are unsupported.
+var citrixMethods = map[string]string{
+	METHODROUNDROBIN				: "ROUNDROBIN",
+	METHODLEASTCONNECTIONS			: "LEASTCONNECTION",
+	METHODRATIO						: "ROUNDROBIN",
+	METHODRATIOLEASTCONNECTIONS		: "LEASTCONNECTION",
+	METHODFASTESTRESPONSE			: "LEASTRESPONSETIME",
+	METHODSOURCEIPHASH				: "SOURCEIPHASH",
+	METHODLEASTBANDWIDTH			: "LEASTBANDWIDTH",
+	METHODOBSERVED					: "",
+	METHODPREDICTIVE				: "",
+}
+
+func (c *CitrixLb)createVs(vsName string, method string, protocol string)error{
+	nsLB := citrixlb.Lbvserver{
+		Name			: vsName,
+		Servicetype		: vsServiceType(protocol),
+		Lbmethod        : method,
+	}
+	name, err := c.client.AddResource(netscaler.Lbvserver.Type(), vsName, &nsLB)
+	if err != nil {
+		return nitroError(err)
+	}
+	glog.V(2).Infof("Citrix created Lbvserver %s", name)
+	return nil
+}
+
+func (c *CitrixLb)deleteVs(vsName string)error{
+	err := c.client.DeleteResource(netscaler.Lbvserver.Type(), vsName)
+	return nitroError(err)
+}
+
+func (c *CitrixLb)bindSvcGroupVs(groupName, vsName string)error{
+	glog.V(2).Infof("Citrix Driver BindSvcGroupLb. bind %s to %s", groupName, vsName)
+	binding := citrixlb.Lbvserverservicegroupbinding{
+		Servicegroupname	: groupName,
+		Name				: vsName,
+	}
+	err := c.client.BindResource(netscaler.Lbvserver.Type(), vsName, netscaler.Servicegroup.Type(), groupName, &binding)
+	return nitroError(err)
+}
+
+// CreatePool creates the servicegroup of the members and its lbvserver,
+// protocol SSL or SSL_TCP encrypts the traffic toward the members.
+func (c *CitrixLb)CreatePool(poolName string, method string, protocol string)error {
+	lbMethod, err := translateMethod(CITRIXLBPROVIDER, citrixMethods, method)
+	if err != nil {
+		return err
+	}
+	
+	// the parts left by a previous try are kept.
+	err = c.createSvcGroup(poolName, protocol)
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	
+	err = c.createVs(poolName, lbMethod, protocol)
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	
+	err = c.bindSvcGroupVs(poolName, poolName)
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}	
+	
+	return nil	
+}
+
+func (c *CitrixLb)DeletePool(poolName string)error {
+	err := c.deleteVs(poolName)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	
+	err = c.deleteSvcGroup(poolName)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	
+	return nil	
+}
+
+// SetBackupPool makes backupPool take over when the healthy members of
+// poolName fall under healthThreshold percent.
+func (c *CitrixLb)SetBackupPool(poolName string, backupPool string, healthThreshold int)error{
+	glog.V(2).Infof("Citrix Driver SetBackupPool %s->%s at %d%%", backupPool, poolName, healthThreshold)
+	nsLB := citrixlb.Lbvserver{
+		Name			: poolName,
+		Backupvserver	: backupPool,
+		Healththreshold	: healthThreshold,
+	}
+	_, err := c.client.UpdateResource(netscaler.Lbvserver.Type(), poolName, &nsLB)
+	return nitroError(err)
+}
+
+func (c *CitrixLb)UnsetBackupPool(poolName string)error{
+	glog.V(2).Infof("Citrix Driver UnsetBackupPool %s", poolName)
+	unset := map[string]interface{}{
+		"name"				: poolName,
+		"backupvserver"		: true,
+		"healththreshold"	: true,
+	}
+	return nitroError(c.client.ActOnResource(netscaler.Lbvserver.Type(), &unset, "unset"))
+}
+
+// SetPoolSlowStart ramps up new members by a tenth of the load of the others
+// every seconds/10, zero turns it off.
+func (c *CitrixLb)SetPoolSlowStart(poolName string, seconds int)error{
+	// zero values are left out of the go-nitro structs.
+	nsLB := map[string]interface{}{
+		"name"				: poolName,
+		"newservicerequest"	: 0,
+	}
+	if seconds > 0 {
+		interval := seconds / 10
+		if interval < 1 {
+			interval = 1
+		}
+		nsLB["newservicerequest"] = 10
+		nsLB["newservicerequestunit"] = "PERCENT"
+		nsLB["newservicerequestincrementinterval"] = interval
+	}
+	_, err := c.client.UpdateResource(netscaler.Lbvserver.Type(), poolName, &nsLB)
+	return nitroError(err)
+}
+
+// SetPoolConnectionLimit caps the client connections of every member of the
+// pool, zero is no limit.
+func (c *CitrixLb)SetPoolConnectionLimit(groupName string, connectionLimit int)error{
+	nsSvcGrp := map[string]interface{}{
+		"servicegroupname"	: groupName,
+		"maxclient"			: connectionLimit,
+	}
+	_, err := c.client.UpdateResource(netscaler.Servicegroup.Type(), groupName, &nsSvcGrp)
+	return nitroError(err)
+}
+
+func (c *CitrixLb)SetMemberWeightInPool(groupName, serverName string, port, weight int)error{
+	glog.V(2).Infof("Citrix Driver SetMemberWeightInPool %s:%d->%s weight %d", serverName, port, groupName, weight)
+	member := citrixbasic.Servicegroup{
+		Servicegroupname	: groupName,
+		Servername			: serverName,
+		Port				: port,
+		Weight				: weight,
+	}
+	_, err := c.client.UpdateResource(netscaler.Servicegroup.Type(), groupName, &member)
+	return nitroError(err)
+}
+
+func (c *CitrixLb)createServer(ip string)error{
+	nsServer := citrixbasic.Server{
+		Name			: ip,
+		Ipaddress		: ip,
+	}
+	_, err := c.client.AddResource(netscaler.Server.Type(), ip, &nsServer)
+	return nitroError(err)
+}
+
+func (c *CitrixLb)bindServerToGroup(groupName string, serverName string, port, weight int)error{
+	glog.V(2).Infof("Citrix Driver BindServerToGroup %s->%s", serverName, groupName)
+	
+	binding := citrixbasic.Servicegroupservicegroupmemberbinding{
+		Servicegroupname	: groupName,
+		Servername			: serverName,
+		Port				: port,
+		Weight				: weight,
+	}
+	//err := c.client.BindResource(netscaler.Servicegroup.Type(), groupName, netscaler.Server.Type(), serverName, &binding)
+	_, err := c.client.AddResource(netscaler.Servicegroup_servicegroupmember_binding.Type(), groupName, &binding)
+	return nitroError(err)
+}
+
+// AddMemberToPool binds the server of ip to the pool, the server is shared
+// by all the pools it is a member of.
+func (c *CitrixLb)AddMemberToPool(groupName string, ip string, port, weight int)error{
+	err := c.createServer(ip)
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	
+	return c.bindServerToGroup(groupName, ip, port, weight)
+}
+
+func (c *CitrixLb)unbindServerToGroup(groupName, serverName string, port int)error{
+	glog.V(2).Infof("Citrix Driver UnBindServerFromGroup %s->%s", serverName, groupName)
+
+	var args = []string{
+		"servername:" + serverName,
+		"servicegroupname:" + groupName,
+		"port:" + strconv.Itoa(port),
+	}
+	
+	err := c.client.DeleteResourceWithArgs(netscaler.Servicegroup_servicegroupmember_binding.Type(), groupName, args)
+	return nitroError(err)
+}
+
+func (c *CitrixLb)RemoveMemberFromPool(groupName, serverName string, port int)error{
+	return c.unbindServerToGroup(groupName, serverName, port)
+}
+
+func (c *CitrixLb)EnableMemberInPool(groupName, serverName string, port int)error{
+	glog.V(2).Infof("Citrix Driver EnableMemberInPool %s:%d->%s", serverName, port, groupName)
+	member := citrixbasic.Servicegroup{
+		Servicegroupname	: groupName,
+		Servername			: serverName,
+		Port				: port,
+	}
+	return nitroError(c.client.ActOnResource(netscaler.Servicegroup.Type(), &member, "enable"))
+}
+
+func (c *CitrixLb)DisableMemberInPool(groupName, serverName string, port int)error{
+	glog.V(2).Infof("Citrix Driver DisableMemberInPool %s:%d->%s", serverName, port, groupName)
+	member := citrixbasic.Servicegroup{
+		Servicegroupname	: groupName,
+		Servername			: serverName,
+		Port				: port,
+	}
+	return nitroError(c.client.ActOnResource(netscaler.Servicegroup.Type(), &member, "disable"))
+}
+
+// DrainMemberInPool disables the member gracefully, it finishes its
+// connections for up to delay seconds before the device takes it down.
+func (c *CitrixLb)DrainMemberInPool(groupName, serverName string, port, delay int)error{
+	glog.V(2).Infof("Citrix Driver DrainMemberInPool %s:%d->%s", serverName, port, groupName)
+	member := citrixbasic.Servicegroup{
+		Servicegroupname	: groupName,
+		Servername			: serverName,
+		Port				: port,
+		Graceful			: "YES",
+		Delay				: delay,
+	}
+	return nitroError(c.client.ActOnResource(netscaler.Servicegroup.Type(), &member, "disable"))
+}
+
+// MemberConnectionsInPool returns the client connections open on the member.
+func (c *CitrixLb)MemberConnectionsInPool(groupName, serverName string, port int)(int, error){
+	var args = []string{
+		"servicegroupname:" + groupName,
+		"servername:" + serverName,
+		"port:" + strconv.Itoa(port),
+	}
+	stats, err := c.client.FindStatWithArgs("servicegroupmember", "", args)
+	if err != nil {
+		return 0, nitroError(err)
+	}
+	return strconv.Atoi(fmt.Sprint(stats["curclntconnections"]))
+}
+
+// MembersInPool returns the members bound to the pool, "ip:port" -> enabled.
+func (c *CitrixLb)MembersInPool(groupName string)(map[string]bool, error){
+	bindings, err := c.client.FindAllBoundResources(netscaler.Servicegroup.Type(), groupName, "servicegroupmember")
+	if err != nil {
+		// go-nitro fails as well when nothing is bound.
+		err = nitroError(err)
+		if IsTransient(err) {
+			return nil, err
+		}
+		glog.V(3).Infof("No members bound to %s: %v", groupName, err)
+	}
+	members := make(map[string]bool)
+	for _, binding := range bindings {
+		member := net.JoinHostPort(fmt.Sprint(binding["servername"]), fmt.Sprint(binding["port"]))
+		members[member] = binding["state"] != "DISABLED"
+	}
+	return members, nil
+}
+
+func (c *CitrixLb)createContentVs(csvserverName string, vserverIp string, vserverPort int, protocol string)error{
+	cs := cs.Csvserver{
+		Name:        csvserverName,
+		Ipv46:       vserverIp,
+		Servicetype: protocol,
+		Port:        vserverPort,
+	}
+	_, err := c.client.AddResource(netscaler.Csvserver.Type(), csvserverName, &cs)
+	return nitroError(err)
+}
+
+// CreateLB creates a content switching vserver of protocol, HTTP when empty.
+func (c *CitrixLb)CreateLB(lbName string, vip string, port int, protocol string)error{
+	return c.createContentVs(lbName, vip, port, serviceType(protocol))
+}
+
+// CreateTLSLB creates a content switching vserver terminating TLS, SSL or
+// SSL_TCP, certificates are bound to it with AddCertToLB.
+func (c *CitrixLb)CreateTLSLB(lbName string, vip string, port int, protocol string)error{
+	if protocol == "" {
+		protocol = "SSL"
+	}
+	// the csvserver of a previous try still gets SNI.
+	err := c.createContentVs(lbName, vip, port, serviceType(protocol))
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	sslVs := ssl.Sslvserver{
+		Vservername	: lbName,
+		Snienable	: "ENABLED",
+	}
+	_, err = c.client.UpdateResource(netscaler.Sslvserver.Type(), lbName, &sslVs)
+	return nitroError(err)
+}
+
+func (c *CitrixLb)uploadCertFile(fileName string, data []byte)error{
+	// drop the previous version, systemfile can not be overwritten.
+	err := c.client.DeleteResourceWithArgs(netscaler.Systemfile.Type(), fileName, 
+		[]string{"filelocation:%2Fnsconfig%2Fssl"})
+	err = nitroError(err)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	file := system.Systemfile{
+		Filename		: fileName,
+		Filelocation	: "/nsconfig/ssl",
+		Filecontent		: base64.StdEncoding.EncodeToString(data),
+		Fileencoding	: "BASE64",
+	}
+	_, err = c.client.AddResource(netscaler.Systemfile.Type(), fileName, &file)
+	return nitroError(err)
+}
+
+// AddCertToLB installs cert and key as certName and binds it to the vserver as
+// an SNI certificate, defaultCert also serves clients sending no known name.
+func (c *CitrixLb)AddCertToLB(lbName string, certName string, defaultCert bool, cert, key []byte)error{
+	glog.V(2).Infof("Citrix Driver AddCertToLB %s->%s", certName, lbName)
+	err := c.uploadCertFile(certName + ".crt", cert)
+	if err != nil {
+		return err
+	}
+	err = c.uploadCertFile(certName + ".key", key)
+	if err != nil {
+		return err
+	}
+	
+	certKey := ssl.Sslcertkey{
+		Certkey	: certName,
+		Cert	: certName + ".crt",
+		Key		: certName + ".key",
+	}
+	_, err = c.client.AddResource(netscaler.Sslcertkey.Type(), certName, &certKey)
+	err = nitroError(err)
+	if IsAlreadyExists(err) {
+		glog.V(2).Infof("sslcertkey %s exists, update it.", certName)
+		certKey.Nodomaincheck = true
+		err = nitroError(c.client.ActOnResource(netscaler.Sslcertkey.Type(), &certKey, "update"))
+	}
+	if err != nil {
+		return err
+	}
+	
+	binding := ssl.Sslvserversslcertkeybinding{
+		Vservername	: lbName,
+		Certkeyname	: certName,
+		Snicert		: true,
+	}
+	err = nitroError(c.client.BindResource(netscaler.Sslvserver.Type(), lbName, netscaler.Sslcertkey.Type(), certName, &binding))
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	if defaultCert {
+		binding.Snicert = false
+		err = nitroError(c.client.BindResource(netscaler.Sslvserver.Type(), lbName, netscaler.Sslcertkey.Type(), certName, &binding))
+		if err != nil && !IsAlreadyExists(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CitrixLb)RemoveCertFromLB(lbName string, certName string)error{
+	glog.V(2).Infof("Citrix Driver RemoveCertFromLB %s->%s", certName, lbName)
+	err := nitroError(c.client.UnbindResource(netscaler.Sslvserver.Type(), lbName, netscaler.Sslcertkey.Type(), certName, "certkeyname"))
+	if err != nil && !IsNotFound(err) {
+		glog.Errorf("Unbind sslcertkey %s failed: %v", certName, err)
+	}
+	err = nitroError(c.client.DeleteResource(netscaler.Sslcertkey.Type(), certName))
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	for _, fileName := range []string{certName + ".crt", certName + ".key"} {
+		err = c.client.DeleteResourceWithArgs(netscaler.Systemfile.Type(), fileName, 
+			[]string{"filelocation:%2Fnsconfig%2Fssl"})
+		if err != nil {
+			glog.Errorf("Delete systemfile %s failed: %v", fileName, err)
+		}
+	}
+	return nil
+}
+
+func (c *CitrixLb)RemoveRuleToLB(lbName string, domainName string, path string, 
+	poolName string, actionName string, policyName string)error{
+	err := nitroError(c.client.UnbindResource(netscaler.Csvserver.Type(), lbName, netscaler.Cspolicy.Type(), policyName, "policyName"))
+	if err != nil && !IsNotFound(err) {
+		return err
+	}		
+	return c.deletePolicy(netscaler.Cspolicy.Type(), policyName, netscaler.Csaction.Type(), actionName)
+}
+
+// deletePolicy deletes an unbound policy and then its action, both may be
+// gone already.
+func (c *CitrixLb)deletePolicy(policyType string, policyName string, actionType string, actionName string)error{
+	err := nitroError(c.client.DeleteResource(policyType, policyName))
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	err = nitroError(c.client.DeleteResource(actionType, actionName))
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// addPolicy adds an action and its policy, the ones left by a previous try
+// are kept.
+func (c *CitrixLb)addPolicy(actionType string, actionName string, action interface{}, 
+	policyType string, policyName string, policy interface{})error{
+	_, err := c.client.AddResource(actionType, actionName, action)
+	err = nitroError(err)
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	_, err = c.client.AddResource(policyType, policyName, policy)
+	err = nitroError(err)
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+	
+func (c *CitrixLb)ListBoundPolicies(csvserverName string) ([]string, []int) {
+	return c.listBoundPolicies(csvserverName, netscaler.Cspolicy.Type())
+}
+
+func (c *CitrixLb)listBoundPolicies(csvserverName string, policyType string) ([]string, []int) {
+	ret1 := []string{}
+	ret2 := []int{}
+	policies, err := c.client.FindAllBoundResources(netscaler.Csvserver.Type(), csvserverName, policyType)
+	if err != nil {
+		glog.Errorf("No %s bindings for CS Vserver %s: %v", policyType, csvserverName, err)
+		return ret1, ret2
+	}
+	for _, policy := range policies {
+		pname := policy["policyname"].(string)
+		prio, err := strconv.Atoi(policy["priority"].(string))
+		if err != nil {
+			continue
+		}
+		ret1 = append(ret1, pname)
+		ret2 = append(ret2, prio)
+
+	}
+	sort.Ints(ret2)
+	return ret1, ret2
+}	
+
+func (c *CitrixLb)nextPriority(csvserverName string, policyType string)int{
+	var priority = 1
+	_, priorities := c.listBoundPolicies(csvserverName, policyType)
+	if len(priorities) > 0 {
+		priority = priorities[len(priorities)-1] + 1
+	}
+	return priority
+}
+
+// matchRule builds the expression of a content switching policy, an empty or
+// "*" domainName matches any host and "*.example.com" its subdomains. A path
+// matches itself and the paths below it, /api not /apiv2.
+func matchRule(domainName string, path string)string{
+	conds := []string{}
+	switch {
+		case domainName == "" || domainName == "*":
+		case strings.HasPrefix(domainName, "*."):
+			conds = append(conds, fmt.Sprintf("HTTP.REQ.HOSTNAME.ENDSWITH(\"%s\")", domainName[1:]))
+		default:
+			conds = append(conds, fmt.Sprintf("HTTP.REQ.HOSTNAME.EQ(\"%s\")", domainName))
+	}
+	if path != "" {
+		conds = append(conds, matchPath("HTTP.REQ.URL.PATH", path))
+	}
+	if len(conds) == 0 {
+		return "true"
+	}
+	return strings.Join(conds, " && ")
+}
+
+// matchPath builds the expression of target, a path, being path or below it.
+func matchPath(target string, path string)string{
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		return "true"
+	}
+	return fmt.Sprintf("(%s.EQ(\"%s\") || %s.STARTSWITH(\"%s/\"))", target, path, target, path)
+}
+
+func (c *CitrixLb)AddRuleToLB(lbName string, domainName string, path string, 
+	poolName string, actionName string, policyName string)error{
+	priority := c.nextPriority(lbName, netscaler.Cspolicy.Type())
+		
+	csAction := cs.Csaction{
+		Name:            actionName,
+		Targetlbvserver: poolName,
+	}
+	csPolicy := cs.Cspolicy{
+		Policyname: policyName,
+		Rule:       matchRule(domainName, path),
+		Action:     actionName,
+	}
+	err := c.addPolicy(netscaler.Csaction.Type(), actionName, &csAction, 
+		netscaler.Cspolicy.Type(), policyName, &csPolicy)
+	if err != nil {
+		return err
+	}
+
+	binding2 := cs.Csvservercspolicybinding{
+		Name:       lbName,
+		Policyname: policyName,
+		Priority:   priority,
+		Bindpoint:  "REQUEST",
+	}
+	err = nitroError(c.client.BindResource(netscaler.Csvserver.Type(), lbName, netscaler.Cspolicy.Type(), policyName, &binding2))
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+	
+// AddRedirectToLB answers requests for domainName/path with a redirect through
+// a responder policy bound to the csvserver. Responder policies are evaluated
+// before the content switching policies, so the request never reaches a pool.
+func (c *CitrixLb)AddRedirectToLB(lbName string, domainName string, path string, 
+	scheme string, host string, code int, actionName string, policyName string)error{
+	if scheme == "" {
+		scheme = "http"
+	}
+	target := fmt.Sprintf("\"%s://\" + HTTP.REQ.HOSTNAME.HTTP_URL_SAFE", scheme)
+	if host != "" {
+		target = fmt.Sprintf("\"%s://%s\"", scheme, host)
+	}
+	target = target + " + HTTP.REQ.URL.PATH_AND_QUERY.HTTP_URL_SAFE"
+	if code == 0 {
+		code = 302
+	}
+	
+	action := responder.Responderaction{
+		Name:               actionName,
+		Type:               "redirect",
+		Target:             target,
+		Responsestatuscode: code,
+	}
+	policy := responder.Responderpolicy{
+		Name:   policyName,
+		Rule:   matchRule(domainName, path),
+		Action: actionName,
+	}
+	err := c.addPolicy(netscaler.Responderaction.Type(), actionName, &action, 
+		netscaler.Responderpolicy.Type(), policyName, &policy)
+	if err != nil {
+		return err
+	}
+	
+	binding := cs.Csvserverresponderpolicybinding{
+		Name:                   lbName,
+		Policyname:             policyName,
+		Priority:               c.nextPriority(lbName, netscaler.Responderpolicy.Type()),
+		Gotopriorityexpression: "END",
+		Bindpoint:              "REQUEST",
+	}
+	err = nitroError(c.client.BindResource(netscaler.Csvserver.Type(), lbName, netscaler.Responderpolicy.Type(), policyName, &binding))
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *CitrixLb)RemoveRedirectFromLB(lbName string, actionName string, policyName string)error{
+	err := nitroError(c.client.UnbindResource(netscaler.Csvserver.Type(), lbName, netscaler.Responderpolicy.Type(), policyName, "policyname"))
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	return c.deletePolicy(netscaler.Responderpolicy.Type(), policyName, netscaler.Responderaction.Type(), actionName)
+}
+
+// AddRewriteToLB replaces the leading prefix of the url with replacement for
+// requests to domainName/path. An empty replacement strips the prefix.
+func (c *CitrixLb)AddRewriteToLB(lbName string, domainName string, path string, 
+	prefix string, replacement string, actionName string, policyName string)error{
+	prefix = strings.TrimSuffix(prefix, "/")
+	replacement = strings.TrimSuffix(replacement, "/")
+	
+	expr := fmt.Sprintf("\"%s\" + HTTP.REQ.URL.AFTER_STR(\"%s\")", replacement, prefix)
+	if replacement == "" {
+		// keep a single leading slash of whatever follows the prefix, the
+		// prefix itself becomes the root.
+		expr = fmt.Sprintf("\"/\" + HTTP.REQ.URL.AFTER_STR(\"%s\").STRIP_START_CHARS(\"/\")", prefix)
+	}
+	if prefix == "" {
+		expr = fmt.Sprintf("\"%s\" + HTTP.REQ.URL", replacement)
+	}
+	
+	action := rewrite.Rewriteaction{
+		Name:              actionName,
+		Type:              "replace",
+		Target:            "HTTP.REQ.URL",
+		Stringbuilderexpr: expr,
+	}
+	// the path of the url, not the url itself, so that /api?q=1 matches too.
+	rule := fmt.Sprintf("%s && %s", matchRule(domainName, path), matchPath("HTTP.REQ.URL.PATH", prefix))
+	policy := rewrite.Rewritepolicy{
+		Name:   policyName,
+		Rule:   rule,
+		Action: actionName,
+	}
+	err := c.addPolicy(netscaler.Rewriteaction.Type(), actionName, &action, 
+		netscaler.Rewritepolicy.Type(), policyName, &policy)
+	if err != nil {
+		return err
+	}
+	
+	binding := cs.Csvserverrewritepolicybinding{
+		Name:                   lbName,
+		Policyname:             policyName,
+		Priority:               c.nextPriority(lbName, netscaler.Rewritepolicy.Type()),
+		Gotopriorityexpression: "END",
+		Bindpoint:              "REQUEST",
+	}
+	err = nitroError(c.client.BindResource(netscaler.Csvserver.Type(), lbName, netscaler.Rewritepolicy.Type(), policyName, &binding))
+	if err != nil && !IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *CitrixLb)RemoveRewriteFromLB(lbName string, actionName string, policyName string)error{
+	err := nitroError(c.client.UnbindResource(netscaler.Csvserver.Type(), lbName, netscaler.Rewritepolicy.Type(), policyName, "policyname"))
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	return c.deletePolicy(netscaler.Rewritepolicy.Type(), policyName, netscaler.Rewriteaction.Type(), actionName)
+}
+	
+// SetDefaultPool makes the lbvserver of poolName the target of the requests
+// no content switching policy matches.
+func (c *CitrixLb)SetDefaultPool(lbName string, poolName string)error{
+	binding := cs.Csvserverlbvserverbinding{
+		Name:      lbName,
+		Lbvserver: poolName,
+	}
+	return nitroError(c.client.BindResource(netscaler.Csvserver.Type(), lbName, netscaler.Lbvserver.Type(), poolName, &binding))
+}
+
+func (c *CitrixLb)UnsetDefaultPool(lbName string, poolName string)error{
+	return nitroError(c.client.UnbindResource(netscaler.Csvserver.Type(), lbName, netscaler.Lbvserver.Type(), poolName, "lbvserver"))
+}
+
+// SetDefaultResponse answers unmatched requests with a static response. The
+// response comes from a responder policy on a dedicated lbvserver which is
+// kept UP by a service without health monitoring, and that lbvserver becomes
+// the default target of the csvserver.
+func (c *CitrixLb)SetDefaultResponse(lbName string, code int, contentType string, body string)error{
+	if code == 0 {
+		code = 503
+	}
+	if contentType == "" {
+		contentType = "text/html"
+	}
+	vsName := lbName + "_default"
+	
+	// the body may have changed, so replace any previous response.
+	err := c.UnsetDefaultResponse(lbName)
+	if err != nil {
+		return nitroError(err)
+	}
+	
+	nsLB := citrixlb.Lbvserver{
+		Name:        vsName,
+		Servicetype: "HTTP",
+	}
+	_, err = c.client.AddResource(netscaler.Lbvserver.Type(), vsName, &nsLB)
+	if err != nil {
+		return nitroError(err)
+	}
+	nsSvc := citrixbasic.Service{
+		Name:          vsName,
+		Ip:            dummyServiceIP,
+		Servicetype:   "HTTP",
+		Port:          80,
+		Healthmonitor: "NO",
+	}
+	_, err = c.client.AddResource(netscaler.Service.Type(), vsName, &nsSvc)
+	if err != nil {
+		return nitroError(err)
+	}
+	svcBinding := citrixlb.Lbvserverservicebinding{
+		Name:        vsName,
+		Servicename: vsName,
+	}
+	err = c.client.BindResource(netscaler.Lbvserver.Type(), vsName, netscaler.Service.Type(), vsName, &svcBinding)
+	if err != nil {
+		return nitroError(err)
+	}
+	
+	head := fmt.Sprintf("HTTP/1.1 %d %s\r\nContent-Type: %s\r\nConnection: close\r\n\r\n", 
+		code, http.StatusText(code), contentType)
+	action := responder.Responderaction{
+		Name:   vsName,
+		Type:   "respondwith",
+		Target: nsString(head + body),
+	}
+	_, err = c.client.AddResource(netscaler.Responderaction.Type(), vsName, &action)
+	if err != nil {
+		return nitroError(err)
+	}
+	policy := responder.Responderpolicy{
+		Name:   vsName,
+		Rule:   "true",
+		Action: vsName,
+	}
+	_, err = c.client.AddResource(netscaler.Responderpolicy.Type(), vsName, &policy)
+	if err != nil {
+		return nitroError(err)
+	}
+	policyBinding := citrixlb.Lbvserverresponderpolicybinding{
+		Name:                   vsName,
+		Policyname:             vsName,
+		Priority:               100,
+		Gotopriorityexpression: "END",
+		Bindpoint:              "REQUEST",
+	}
+	err = c.client.BindResource(netscaler.Lbvserver.Type(), vsName, netscaler.Responderpolicy.Type(), vsName, &policyBinding)
+	if err != nil {
+		return nitroError(err)
+	}
+	
+	return c.SetDefaultPool(lbName, vsName)
+}
+
+func (c *CitrixLb)UnsetDefaultResponse(lbName string)error{
+	vsName := lbName + "_default"
+	
+	// the lbvserver may not be bound, deleting it fails if it still is.
+	err := c.UnsetDefaultPool(lbName, vsName)
+	if err != nil {
+		glog.V(3).Infof("Unbind default lbvserver %s failed: %v", vsName, err)
+	}
+	for _, resourceType := range []string{netscaler.Lbvserver.Type(), netscaler.Responderpolicy.Type(), 
+		netscaler.Responderaction.Type(), netscaler.Service.Type()} {
+		err = nitroError(c.client.DeleteResource(resourceType, vsName))
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+// nsString quotes s as a NetScaler expression. Literals are limited to 255
+// characters, so long strings are concatenated from several of them.
+func nsString(s string)string{
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", `\r`, "\n", `\n`).Replace(s)
+	var parts []string
+	for len(s) > 200 {
+		n := 200
+		// do not split an escape sequence.
+		for n > 0 && s[n-1] == '\\' {
+			n--
+		}
+		if n == 0 {
+			n = 200
+		}
+		parts = append(parts, "\"" + s[:n] + "\"")
+		s = s[n:]
+	}
+	parts = append(parts, "\"" + s + "\"")
+	return strings.Join(parts, " + ")
+}
+
+func (c *CitrixLb)DeleteLB(lbName string)error{
+	err := c.client.DeleteResource(netscaler.Csvserver.Type(), lbName)
+	return nitroError(err)
+}
+
+// Login checks the credentials of the driver against the device.
+func (c *CitrixLb)Login()error{
+	_, err := c.client.FindAllResources("nsversion")
+	return nitroError(err)
+}
+
+// NewCitrix returns a driver for the NetScaler device, its client is kept
+// for the life of the driver.
+func NewCitrix(device Device)(LbProvider, error){
+	if device.Address == "" || device.Username == "" || device.Password == "" {
+		return nil, fmt.Errorf("address, username and password of the NetScaler are required")
+	}
+	client, err := netscaler.NewNitroClientFromParams(netscaler.NitroParams{
+		Url			: device.Address,
+		Username	: device.Username,
+		Password	: device.Password,
+		SslVerify	: !device.InsecureSkipVerify,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CitrixLb{device : device, client : client}, nil
+}
+
+// NewLBer returns the driver of the NetScaler of the environment.
+//
+// Deprecated: use NewProvider with EnvDevice.
+func NewLBer(lbtype string)(LbProvider, error){
+	p, err := NewProvider(lbtype, EnvDevice(lbtype))
+	if err != nil {
+		return nil, err
+	}
+	drv, ok := LbProviderOf(p)
+	if !ok {
+		return nil, fmt.Errorf("Unsupport type: %s", lbtype)
+	}
+	return drv, nil
+}
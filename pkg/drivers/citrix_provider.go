@@ -0,0 +1,347 @@
+package drivers
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register(CITRIXLBPROVIDER, newCitrixProvider, citrixEnvDevice)
+}
+
+// citrixProvider is the Provider of a NetScaler, on top of its LbProvider.
+// Virtual servers are csvservers, L4 ones forward to their default pool.
+type citrixProvider struct {
+	drv		LbProvider
+}
+
+// NewCitrixProvider returns the Provider of the NetScaler driver drv.
+func NewCitrixProvider(drv LbProvider)Provider{
+	return &citrixProvider{drv : drv}
+}
+
+func newCitrixProvider(device Device)(Provider, error){
+	drv, err := NewCitrix(device)
+	if err != nil {
+		return nil, err
+	}
+	return NewCitrixProvider(drv), nil
+}
+
+// citrixEnvDevice returns the NetScaler of NS_URL, which is not verified.
+func citrixEnvDevice()Device{
+	return Device{
+		Address		: os.Getenv("NS_URL"),
+		Username	: os.Getenv("NS_LOGIN"),
+		Password	: os.Getenv("NS_PASSWORD"),
+		InsecureSkipVerify	: true,
+	}
+}
+
+// LbProviderOf returns the NetScaler driver p is built on, for the
+// controllers still using it.
+func LbProviderOf(p Provider)(LbProvider, bool){
+	citrix, ok := p.(*citrixProvider)
+	if !ok {
+		return nil, false
+	}
+	return citrix.drv, true
+}
+
+func (p *citrixProvider)Type()string{
+	return CITRIXLBPROVIDER
+}
+
+func (p *citrixProvider)Capabilities()Capabilities{
+	return Capabilities{
+		L4					: true,
+		Redirect			: true,
+		Rewrite				: true,
+		DefaultResponse		: true,
+		PoolTLS				: true,
+		PoolConnectionLimit	: true,
+		BackupPool			: true,
+	}
+}
+
+func (p *citrixProvider)Login(ctx context.Context)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.Login()
+}
+
+// Logout does nothing, every NITRO call carries the login.
+func (p *citrixProvider)Logout(){
+}
+
+// citrixL4Types are the csvserver types of the L4 protocols. TLS passed
+// through would be an SSL_BRIDGE lbvserver, a csvserver has no such type.
+var citrixL4Types = map[string]string{
+	"tcp"	: "TCP",
+	"udp"	: "UDP",
+}
+
+func (p *citrixProvider)CreateVirtualServer(ctx context.Context, vs VirtualServer)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(vs.Port)
+	if err != nil {
+		return unsupported(CITRIXLBPROVIDER, "port %s of %s, only single ports are", vs.Port, vs.Name)
+	}
+	if vs.Mode == MODEL4 {
+		serviceType, ok := citrixL4Types[strings.ToLower(vs.Protocol)]
+		if !ok {
+			return unsupported(CITRIXLBPROVIDER, "protocol %s of %s", vs.Protocol, vs.Name)
+		}
+		if vs.TLS && serviceType == "TCP" {
+			return p.drv.CreateTLSLB(vs.Name, vs.IP, port, "SSL_TCP")
+		}
+		if vs.TLS {
+			return unsupported(CITRIXLBPROVIDER, "TLS termination on %s with protocol %s", vs.Name, vs.Protocol)
+		}
+		return p.drv.CreateLB(vs.Name, vs.IP, port, serviceType)
+	}
+	if vs.TLS {
+		return p.drv.CreateTLSLB(vs.Name, vs.IP, port, "SSL")
+	}
+	return p.drv.CreateLB(vs.Name, vs.IP, port, "HTTP")
+}
+
+func (p *citrixProvider)DeleteVirtualServer(ctx context.Context, name string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.DeleteLB(name)
+}
+
+func (p *citrixProvider)SetDefaultPool(ctx context.Context, vsName string, poolName string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.SetDefaultPool(vsName, poolName)
+}
+
+func (p *citrixProvider)UnsetDefaultPool(ctx context.Context, vsName string, poolName string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.UnsetDefaultPool(vsName, poolName)
+}
+
+func (p *citrixProvider)SetDefaultResponse(ctx context.Context, vsName string, resp Response)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.SetDefaultResponse(vsName, resp.Code, resp.ContentType, resp.Body)
+}
+
+func (p *citrixProvider)UnsetDefaultResponse(ctx context.Context, vsName string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.UnsetDefaultResponse(vsName)
+}
+
+// citrixRule returns the name of the policies of rule and its path, the root
+// path matches all of them. The * of a wildcard host, which a NetScaler name
+// cannot hold, is named any.
+func citrixRule(vsName string, rule Rule)(string, string){
+	path := rule.Path
+	if path == "/" {
+		path = ""
+	}
+	if rule.Name != "" {
+		return rule.Name, path
+	}
+	name := path
+	if name == "" {
+		name = "nilpath"
+	}
+	host := strings.Replace(rule.Host, "*", "any", -1)
+	return vsName + "_" + host + "_" + strings.Replace(name, "/", "_", -1), path
+}
+
+// AddRule adds the policies of rule, a rewrite runs before the content
+// switching policy selecting the pool.
+func (p *citrixProvider)AddRule(ctx context.Context, vsName string, rule Rule)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name, path := citrixRule(vsName, rule)
+	if rule.Redirect != nil {
+		return p.drv.AddRedirectToLB(vsName, rule.Host, path, rule.Redirect.Scheme, rule.Redirect.Host,
+			rule.Redirect.Code, name + "_redirect", name + "_redirect")
+	}
+	if rule.Rewrite != nil {
+		err := p.drv.AddRewriteToLB(vsName, rule.Host, path, rewritePrefix(rule), rule.Rewrite.Replacement,
+			name + "_rewrite", name + "_rewrite")
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return p.drv.AddRuleToLB(vsName, rule.Host, path, rule.Pool, name, name)
+}
+
+func (p *citrixProvider)RemoveRule(ctx context.Context, vsName string, rule Rule)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name, path := citrixRule(vsName, rule)
+	if rule.Redirect != nil {
+		return p.drv.RemoveRedirectFromLB(vsName, name + "_redirect", name + "_redirect")
+	}
+	if rule.Rewrite != nil {
+		err := p.drv.RemoveRewriteFromLB(vsName, name + "_rewrite", name + "_rewrite")
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return p.drv.RemoveRuleToLB(vsName, rule.Host, path, rule.Pool, name, name)
+}
+
+func (p *citrixProvider)AddCert(ctx context.Context, vsName string, cert Cert)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.AddCertToLB(vsName, cert.Name, cert.Default, cert.Cert, cert.Key)
+}
+
+func (p *citrixProvider)RemoveCert(ctx context.Context, vsName string, cert Cert)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.RemoveCertFromLB(vsName, cert.Name)
+}
+
+// SetSourceRanges only accepts removing the ranges, which there are none of.
+func (p *citrixProvider)SetSourceRanges(ctx context.Context, vsName string, ranges []string)error{
+	if len(ranges) > 0 {
+		return unsupported(CITRIXLBPROVIDER, "source ranges of %s", vsName)
+	}
+	return nil
+}
+
+func (p *citrixProvider)CreatePool(ctx context.Context, pool Pool)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.CreatePool(pool.Name, pool.Method, pool.Protocol)
+}
+
+func (p *citrixProvider)UpdatePool(ctx context.Context, pool Pool)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if pool.MinActiveMembers > 0 {
+		return unsupported(CITRIXLBPROVIDER, "min active members of %s", pool.Name)
+	}
+	err := p.drv.SetPoolSlowStart(pool.Name, pool.SlowStart)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.SetPoolConnectionLimit(pool.Name, pool.ConnectionLimit)
+}
+
+func (p *citrixProvider)DeletePool(ctx context.Context, name string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.DeletePool(name)
+}
+
+func (p *citrixProvider)SetBackupPool(ctx context.Context, poolName string, backupName string, threshold int)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.SetBackupPool(poolName, backupName, threshold)
+}
+
+func (p *citrixProvider)UnsetBackupPool(ctx context.Context, poolName string)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.UnsetBackupPool(poolName)
+}
+
+// checkMember rejects the member settings of the BIG-IP.
+func (p *citrixProvider)checkMember(poolName string, member Member)error{
+	if member.ConnectionLimit > 0 {
+		return unsupported(CITRIXLBPROVIDER, "connection limit of member %s of %s, set the one of the pool", member.IP, poolName)
+	}
+	if member.Priority > 0 {
+		return unsupported(CITRIXLBPROVIDER, "priority of member %s of %s", member.IP, poolName)
+	}
+	return nil
+}
+
+func (p *citrixProvider)AddMember(ctx context.Context, poolName string, member Member)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := p.checkMember(poolName, member)
+	if err != nil {
+		return err
+	}
+	return p.drv.AddMemberToPool(poolName, member.IP, member.Port, memberWeight(member))
+}
+
+func (p *citrixProvider)UpdateMember(ctx context.Context, poolName string, member Member)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := p.checkMember(poolName, member)
+	if err != nil {
+		return err
+	}
+	return p.drv.SetMemberWeightInPool(poolName, member.IP, member.Port, memberWeight(member))
+}
+
+func (p *citrixProvider)RemoveMember(ctx context.Context, poolName string, member Member)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.RemoveMemberFromPool(poolName, member.IP, member.Port)
+}
+
+func (p *citrixProvider)EnableMember(ctx context.Context, poolName string, member Member)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.EnableMemberInPool(poolName, member.IP, member.Port)
+}
+
+// DisableMember disables the member gracefully without a delay, the device
+// waits for its connections to finish.
+func (p *citrixProvider)DisableMember(ctx context.Context, poolName string, member Member)error{
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.drv.DrainMemberInPool(poolName, member.IP, member.Port, 0)
+}
+
+func (p *citrixProvider)PoolMembers(ctx context.Context, poolName string)(map[string]bool, error){
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p.drv.MembersInPool(poolName)
+}
+
+func (p *citrixProvider)MemberConnections(ctx context.Context, poolName string, member Member)(int, error){
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return p.drv.MemberConnectionsInPool(poolName, member.IP, member.Port)
+}
@@ -0,0 +1,24 @@
+package drivers
+
+import (
+	"testing"
+)
+
+func TestCitrixRule(t *testing.T) {
+	cases := []struct {
+		rule		Rule
+		wantName	string
+		wantPath	string
+	}{
+		{Rule{Host : "example.com", Path : "/api/v1"}, "vs_example.com__api_v1", "/api/v1"},
+		{Rule{Host : "example.com", Path : "/"}, "vs_example.com_nilpath", ""},
+		{Rule{Host : "*.example.com"}, "vs_any.example.com_nilpath", ""},
+		{Rule{Name : "named", Host : "*.example.com", Path : "/api"}, "named", "/api"},
+	}
+	for _, c := range cases {
+		name, path := citrixRule("vs", c.rule)
+		if name != c.wantName || path != c.wantPath {
+			t.Errorf("citrixRule(%+v) = %q, %q, want %q, %q", c.rule, name, path, c.wantName, c.wantPath)
+		}
+	}
+}
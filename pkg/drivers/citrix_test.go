@@ -0,0 +1,27 @@
+package drivers
+
+import (
+	"testing"
+)
+
+func TestMatchRule(t *testing.T) {
+	cases := []struct {
+		host		string
+		path		string
+		want		string
+	}{
+		{"", "", "true"},
+		{"*", "", "true"},
+		{"example.com", "", `HTTP.REQ.HOSTNAME.EQ("example.com")`},
+		{"*.example.com", "", `HTTP.REQ.HOSTNAME.ENDSWITH(".example.com")`},
+		{"", "/api",
+			`(HTTP.REQ.URL.PATH.EQ("/api") || HTTP.REQ.URL.PATH.STARTSWITH("/api/"))`},
+		{"example.com", "/api/",
+			`HTTP.REQ.HOSTNAME.EQ("example.com") && (HTTP.REQ.URL.PATH.EQ("/api") || HTTP.REQ.URL.PATH.STARTSWITH("/api/"))`},
+	}
+	for _, c := range cases {
+		if got := matchRule(c.host, c.path); got != c.want {
+			t.Errorf("matchRule(%q, %q) = %s, want %s", c.host, c.path, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package drivers
+
+// Device is how a driver reaches its load balancer, EnvDevice reads it from
+// the environment.
+type Device struct {
+	// Address is the url of the management interface.
+	Address		string
+	Username	string
+	Password	string
+	// Partition is the default BIG-IP partition, Common when empty.
+	Partition	string
+	// InsecureSkipVerify accepts any certificate of the management interface.
+	InsecureSkipVerify	bool
+	// CABundle are the PEM certificates trusted for the management interface,
+	// the system ones when empty.
+	CABundle	[]byte
+	// LoginProvider is the BIG-IP login provider of the user, tmos when empty.
+	LoginProvider	string
+	// TLSSecret reads the certificate and key of the TLS Secret name in
+	// namespace, see Cert.Secret.
+	TLSSecret	func(namespace, name string)([]byte, []byte, error)
+}
+
+// EnvDevice returns the device of the environment of provider, whose login
+// may be replaced by the one of a Secret.
+func EnvDevice(provider string)Device{
+	r, ok := lookup(provider)
+	if !ok || r.env == nil {
+		return Device{}
+	}
+	return r.env()
+}
@@ -0,0 +1,209 @@
+package drivers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// ErrorReason tells the controllers what a failed device call means.
+type ErrorReason string
+
+const (
+	ErrorReasonUnknown			ErrorReason = ""
+	// the object to create is already on the device.
+	ErrorReasonAlreadyExists	ErrorReason = "AlreadyExists"
+	// the object to change or delete is not on the device.
+	ErrorReasonNotFound			ErrorReason = "NotFound"
+	// the device refused the change because of the objects it has, like
+	// deleting one still in use.
+	ErrorReasonConflict			ErrorReason = "Conflict"
+	// the device could not be reached or was busy, the call can be retried.
+	ErrorReasonTransient		ErrorReason = "Transient"
+	// the provider lacks the feature, see Capabilities.
+	ErrorReasonUnsupported		ErrorReason = "Unsupported"
+)
+
+// Error is a failed call to a device with the reason the driver found in
+// its answer.
+type Error struct {
+	Reason		ErrorReason
+	// Code is the error code of the device, like the NetScaler errorcode or
+	// the BIG-IP message id, zero when it sent none.
+	Code		int
+	Err			error
+}
+
+func (e *Error)Error()string{
+	if e.Reason == ErrorReasonUnknown {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+}
+
+// ReasonForError returns the reason of a driver error, unknown for other ones.
+func ReasonForError(err error)ErrorReason{
+	if e, ok := err.(*Error); ok {
+		return e.Reason
+	}
+	return ErrorReasonUnknown
+}
+
+func IsAlreadyExists(err error)bool{
+	return ReasonForError(err) == ErrorReasonAlreadyExists
+}
+
+func IsNotFound(err error)bool{
+	return ReasonForError(err) == ErrorReasonNotFound
+}
+
+func IsConflict(err error)bool{
+	return ReasonForError(err) == ErrorReasonConflict
+}
+
+func IsTransient(err error)bool{
+	return ReasonForError(err) == ErrorReasonTransient
+}
+
+func IsUnsupported(err error)bool{
+	return ReasonForError(err) == ErrorReasonUnsupported
+}
+
+// NetScaler errorcodes, see the NITRO API reference.
+const (
+	nsErrNoSuchResource		= 258
+	nsErrAlreadyExists		= 273
+)
+
+var (
+	// go-nitro only returns the http status and body of a failure as text,
+	// like: failed: 409 Conflict ({ "errorcode": 273, "message": ... }).
+	nitroStatusRe		= regexp.MustCompile(`failed: (\d{3}) `)
+	nitroErrorcodeRe	= regexp.MustCompile(`"errorcode"\s*:\s*(\d+)`)
+)
+
+// nitroError classifies an error of go-nitro by the errorcode of the
+// NetScaler, or by its http status when the code is not a known one.
+func nitroError(err error)error{
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(net.Error); ok {
+		return &Error{Reason : ErrorReasonTransient, Err : err}
+	}
+	e := &Error{Err : err}
+	if m := nitroErrorcodeRe.FindStringSubmatch(err.Error()); m != nil {
+		e.Code, _ = strconv.Atoi(m[1])
+	}
+	switch e.Code {
+		case nsErrNoSuchResource:
+			e.Reason = ErrorReasonNotFound
+			return e
+		case nsErrAlreadyExists:
+			e.Reason = ErrorReasonAlreadyExists
+			return e
+	}
+	if m := nitroStatusRe.FindStringSubmatch(err.Error()); m != nil {
+		e.Reason = httpReason(m[1])
+	}
+	return e
+}
+
+// httpReason returns the reason of an http status code of a device.
+func httpReason(status string)ErrorReason{
+	switch status {
+		case "404":
+			return ErrorReasonNotFound
+		case "409":
+			return ErrorReasonConflict
+		case "502", "503", "504":
+			return ErrorReasonTransient
+	}
+	return ErrorReasonUnknown
+}
+
+// BIG-IP message ids, the text following them changes with the version and
+// the language of the device.
+const (
+	f5ErrNotFound		= 0x01020036
+	f5ErrAlreadyExists	= 0x01020066
+	f5ErrInUse			= 0x01070265
+)
+
+var (
+	// go-bigip returns the message of an iControl REST error, like
+	// 01020066:3: The requested Pool (/Common/p) already exists in partition Common.
+	f5MessageIdRe	= regexp.MustCompile(`^([0-9a-fA-F]{8}):\d+:`)
+	// or the status of an answer without json, like HTTP 503 :: ...
+	f5StatusRe		= regexp.MustCompile(`^HTTP (\d{3}) ::`)
+	// go-bigip drops the status of a refused token, only its message is
+	// left, like X-F5-Auth-Token does not exist.
+	f5AuthRe		= regexp.MustCompile(`(?i)X-F5-Auth-Token|authentication required|authorization failed`)
+)
+
+// f5Error classifies an error of go-bigip by the message id of the BIG-IP, or
+// by the http status when the answer had none.
+func f5Error(err error)error{
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	if _, ok := err.(net.Error); ok {
+		return &Error{Reason : ErrorReasonTransient, Err : err}
+	}
+	e := &Error{Err : err}
+	if m := f5MessageIdRe.FindStringSubmatch(err.Error()); m != nil {
+		id, _ := strconv.ParseInt(m[1], 16, 64)
+		e.Code = int(id)
+		e.Reason = f5Reason(e.Code)
+	} else if m := f5StatusRe.FindStringSubmatch(err.Error()); m != nil {
+		e.Code, _ = strconv.Atoi(m[1])
+		e.Reason = httpReason(m[1])
+	}
+	return e
+}
+
+// isF5Unauthorized tells whether the BIG-IP refused the token of a request.
+func isF5Unauthorized(err error)bool{
+	e, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+	return e.Code == http.StatusUnauthorized || (e.Code == 0 && f5AuthRe.MatchString(e.Err.Error()))
+}
+
+func f5Reason(id int)ErrorReason{
+	switch id {
+		case f5ErrNotFound:
+			return ErrorReasonNotFound
+		case f5ErrAlreadyExists:
+			return ErrorReasonAlreadyExists
+		case f5ErrInUse:
+			return ErrorReasonConflict
+	}
+	return ErrorReasonUnknown
+}
+
+// f5ResponseError classifies a failed iControl REST answer by the message id
+// in its body, or by its status when the body has no known one.
+func f5ResponseError(status int, body []byte)error{
+	var resp struct {
+		Code		int		`json:"code"`
+		Message		string	`json:"message"`
+	}
+	json.Unmarshal(body, &resp)
+	if resp.Message == "" {
+		resp.Message = string(body)
+	}
+	err := f5Error(fmt.Errorf("%s", resp.Message))
+	if e := err.(*Error); e.Reason == ErrorReasonUnknown {
+		e.Code = status
+		e.Reason = httpReason(strconv.Itoa(status))
+	}
+	return err
+}
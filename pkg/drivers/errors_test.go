@@ -0,0 +1,106 @@
+package drivers
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestNitroError(t *testing.T) {
+	cases := []struct {
+		name		string
+		err			error
+		reason		ErrorReason
+		code		int
+	}{
+		{"already exists",
+			errors.New(`[ERROR] nitro-go: Failed to create resource of type lbvserver, name=vs, err=failed: 409 Conflict ({ "errorcode": 273, "message": "Resource already exists", "severity": "ERROR" })`),
+			ErrorReasonAlreadyExists, nsErrAlreadyExists},
+		{"no such resource",
+			errors.New(`failed: 404 Not Found ({ "errorcode": 258, "message": "No such resource [name, vs]", "severity": "ERROR" })`),
+			ErrorReasonNotFound, nsErrNoSuchResource},
+		{"unknown errorcode by status",
+			errors.New(`failed: 409 Conflict ({ "errorcode": 1335, "message": "Entity in use", "severity": "ERROR" })`),
+			ErrorReasonConflict, 1335},
+		{"busy",
+			errors.New(`failed: 503 Service Unavailable (busy)`),
+			ErrorReasonTransient, 0},
+		{"unreachable",
+			&net.DNSError{Err : "no such host", Name : "netscaler"},
+			ErrorReasonTransient, 0},
+		{"unknown",
+			errors.New("bad request"),
+			ErrorReasonUnknown, 0},
+	}
+	for _, c := range cases {
+		err := nitroError(c.err)
+		if reason := ReasonForError(err); reason != c.reason {
+			t.Errorf("%s: reason %q, want %q", c.name, reason, c.reason)
+		}
+		if e, ok := err.(*Error); ok && e.Code != c.code {
+			t.Errorf("%s: code %d, want %d", c.name, e.Code, c.code)
+		}
+	}
+	if nitroError(nil) != nil {
+		t.Errorf("nil error classified as a failure")
+	}
+}
+
+func TestF5Error(t *testing.T) {
+	cases := []struct {
+		name		string
+		err			error
+		reason		ErrorReason
+		code		int
+	}{
+		{"already exists",
+			errors.New("01020066:3: The requested Pool (/Common/p) already exists in partition Common."),
+			ErrorReasonAlreadyExists, f5ErrAlreadyExists},
+		{"not found",
+			errors.New("01020036:3: The requested Pool (/Common/p) was not found."),
+			ErrorReasonNotFound, f5ErrNotFound},
+		{"in use",
+			errors.New("01070265:3: The Pool (/Common/p) cannot be deleted because it is in use by a Virtual Server (/Common/vs)."),
+			ErrorReasonConflict, f5ErrInUse},
+		{"unknown message id",
+			errors.New("01070734:3: Configuration error: invalid port"),
+			ErrorReasonUnknown, 0x01070734},
+		{"status without json",
+			errors.New("HTTP 503 :: Service Unavailable"),
+			ErrorReasonTransient, 503},
+		{"unreachable",
+			&net.DNSError{Err : "no such host", Name : "bigip"},
+			ErrorReasonTransient, 0},
+		{"classified already",
+			&Error{Reason : ErrorReasonNotFound, Code : 404, Err : errors.New("not found")},
+			ErrorReasonNotFound, 404},
+	}
+	for _, c := range cases {
+		err := f5Error(c.err)
+		if reason := ReasonForError(err); reason != c.reason {
+			t.Errorf("%s: reason %q, want %q", c.name, reason, c.reason)
+		}
+		if e, ok := err.(*Error); ok && e.Code != c.code {
+			t.Errorf("%s: code %d, want %d", c.name, e.Code, c.code)
+		}
+	}
+}
+
+func TestIsF5Unauthorized(t *testing.T) {
+	cases := []struct {
+		name		string
+		err			error
+		want		bool
+	}{
+		{"status", &Error{Code : 401, Err : errors.New("unauthorized")}, true},
+		{"refused token", f5Error(errors.New("X-F5-Auth-Token does not exist.")), true},
+		{"message id", f5Error(errors.New("01020036:3: The requested Pool (/Common/p) was not found.")), false},
+		{"not a driver error", errors.New("authentication required"), false},
+		{"nil", nil, false},
+	}
+	for _, c := range cases {
+		if got := isF5Unauthorized(c.err); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package drivers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Load balancing methods of the pools, translated by every driver to the
+// method of its device.
+const (
+	METHODROUNDROBIN				= "RoundRobin"
+	METHODLEASTCONNECTIONS			= "LeastConnections"
+	METHODRATIO						= "Ratio"
+	METHODRATIOLEASTCONNECTIONS		= "RatioLeastConnections"
+	METHODFASTESTRESPONSE			= "FastestResponse"
+	METHODSOURCEIPHASH				= "SourceIPHash"
+	METHODLEASTBANDWIDTH			= "LeastBandwidth"
+	METHODOBSERVED					= "Observed"
+	METHODPREDICTIVE				= "Predictive"
+)
+
+// translateMethod returns the device method of the neutral method, using the
+// table of provider. Empty is RoundRobin. Other names are taken as device
+// methods, like the pools created before the neutral names have.
+func translateMethod(provider string, table map[string]string, method string)(string, error){
+	if method == "" {
+		method = METHODROUNDROBIN
+	}
+	for neutral, native := range table {
+		if strings.EqualFold(neutral, method) {
+			if native == "" {
+				return "", fmt.Errorf("lb method %s is not supported by %s", neutral, provider)
+			}
+			return native, nil
+		}
+	}
+	for neutral, native := range table {
+		if native != "" && native == method {
+			glog.Warningf("lb method %s is deprecated, use %s", method, neutral)
+			return native, nil
+		}
+	}
+	glog.Warningf("lb method %s is not a neutral one, it is passed to %s as is", method, provider)
+	return method, nil
+}
@@ -0,0 +1,33 @@
+package drivers
+
+import (
+	"testing"
+)
+
+func TestTranslateMethod(t *testing.T) {
+	cases := []struct {
+		name		string
+		table		map[string]string
+		method		string
+		want		string
+		wantErr		bool
+	}{
+		{"empty is round robin", f5Methods, "", "round-robin", false},
+		{"neutral", f5Methods, METHODLEASTCONNECTIONS, "least-connections-member", false},
+		{"neutral of another case", citrixMethods, "leastconnections", "LEASTCONNECTION", false},
+		{"unsupported", f5Methods, METHODSOURCEIPHASH, "", true},
+		{"unsupported by citrix", citrixMethods, METHODOBSERVED, "", true},
+		{"deprecated native", f5Methods, "ratio-member", "ratio-member", false},
+		{"unknown passed as is", citrixMethods, "CUSTOMLOAD", "CUSTOMLOAD", false},
+	}
+	for _, c := range cases {
+		got, err := translateMethod("test", c.table, c.method)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: error %v, want error %v", c.name, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// MODEHTTP virtual servers route requests to pools by their rules.
+	MODEHTTP	= "http"
+	// MODEL4 virtual servers forward connections to their default pool.
+	MODEL4		= "l4"
+)
+
+// Provider is the load balancer of a device, whatever its vendor. Every call
+// gives up once ctx is done, a call already sent to the device is not
+// undone. The AS3 provider cancels its requests with ctx, the f5 and citrix
+// ones, whose clients take no context, only check it between their requests
+// and wait for the one in flight. Features the device lacks, see
+// Capabilities, fail with an Unsupported error.
+type Provider interface {
+	// Type is the provider name, like f5 or citrix.
+	Type()string
+	Capabilities()Capabilities
+	Login(ctx context.Context)error
+	// Logout ends the session of the driver on the device, if it has one.
+	Logout()
+
+	CreateVirtualServer(ctx context.Context, vs VirtualServer)error
+	DeleteVirtualServer(ctx context.Context, name string)error
+	SetDefaultPool(ctx context.Context, vsName string, poolName string)error
+	UnsetDefaultPool(ctx context.Context, vsName string, poolName string)error
+	SetDefaultResponse(ctx context.Context, vsName string, resp Response)error
+	UnsetDefaultResponse(ctx context.Context, vsName string)error
+	AddRule(ctx context.Context, vsName string, rule Rule)error
+	RemoveRule(ctx context.Context, vsName string, rule Rule)error
+	AddCert(ctx context.Context, vsName string, cert Cert)error
+	RemoveCert(ctx context.Context, vsName string, cert Cert)error
+	// SetSourceRanges limits the clients of the virtual server to the CIDRs
+	// of ranges, none allow all of them.
+	SetSourceRanges(ctx context.Context, vsName string, ranges []string)error
+
+	CreatePool(ctx context.Context, pool Pool)error
+	// UpdatePool applies the settings of pool after CreatePool.
+	UpdatePool(ctx context.Context, pool Pool)error
+	DeletePool(ctx context.Context, name string)error
+	// SetBackupPool fails poolName over to backupName when less than
+	// threshold percent of its members are up, see Capabilities.BackupPool.
+	SetBackupPool(ctx context.Context, poolName string, backupName string, threshold int)error
+	UnsetBackupPool(ctx context.Context, poolName string)error
+	AddMember(ctx context.Context, poolName string, member Member)error
+	// UpdateMember applies the weight and limits of a member of the pool.
+	UpdateMember(ctx context.Context, poolName string, member Member)error
+	RemoveMember(ctx context.Context, poolName string, member Member)error
+	EnableMember(ctx context.Context, poolName string, member Member)error
+	// DisableMember stops sending new connections to the member, the open
+	// ones are left to finish.
+	DisableMember(ctx context.Context, poolName string, member Member)error
+	MemberConnections(ctx context.Context, poolName string, member Member)(int, error)
+}
+
+// Partitioned is a Provider whose device keeps the objects of the namespaces
+// apart, like the BIG-IP partitions.
+type Partitioned interface {
+	Partition(name string)Provider
+}
+
+// MemberLister is a Provider reading back the members of a pool, the
+// controllers reconcile the pools they have no state of with it.
+type MemberLister interface {
+	// PoolMembers returns the members of the pool, "ip:port" -> enabled.
+	PoolMembers(ctx context.Context, poolName string)(map[string]bool, error)
+}
+
+// Batcher is a Provider able to apply the calls of a sync at once.
+type Batcher interface {
+	Batch()Batch
+}
+
+// Batch is a Provider collecting its calls, they are checked when they are
+// made but only Commit applies them to the device.
+type Batch interface {
+	Provider
+	Commit(ctx context.Context)error
+}
+
+// Capabilities tells the controllers which features a provider has beyond
+// the HTTP virtual servers and pools all of them support.
+type Capabilities struct {
+	// L4 virtual servers, see MODEL4.
+	L4					bool
+	// PortRanges are ports like 5060-5070 and * on L4 virtual servers.
+	PortRanges			bool
+	SourceRanges		bool
+	Redirect			bool
+	Rewrite				bool
+	DefaultResponse		bool
+	// PoolTLS encrypts the traffic toward the members.
+	PoolTLS				bool
+	// PoolConnectionLimit caps the connections of every member of a pool,
+	// MemberConnectionLimit caps them member by member.
+	PoolConnectionLimit		bool
+	MemberConnectionLimit	bool
+	// MemberPriority sends traffic to lower priority members only when less
+	// than Pool.MinActiveMembers higher ones are up.
+	MemberPriority		bool
+	// BackupPool fails a pool over to another pool, the devices with
+	// MemberPriority do it within the pool.
+	BackupPool			bool
+}
+
+type VirtualServer struct {
+	Name		string
+	// Mode is MODEHTTP or MODEL4.
+	Mode		string
+	IP			string
+	// Port is a port, or on L4 virtual servers a range like 5060-5070 or *
+	// for any.
+	Port		string
+	// Protocol is tcp, udp or sctp on L4 virtual servers, or tls for TLS
+	// passed through to the members.
+	Protocol	string
+	// TLS terminates TLS with the certificates added by AddCert, on L4
+	// virtual servers too when the device can.
+	TLS			bool
+}
+
+type Pool struct {
+	Name		string
+	// Method is one of the neutral METHOD* lb methods.
+	Method		string
+	// Protocol toward the members, like HTTP, TCP or SSL, HTTP when empty.
+	Protocol	string
+	// SlowStart ramps up new members over this many seconds.
+	SlowStart	int
+	// ConnectionLimit caps the connections of every member, zero is none.
+	ConnectionLimit		int
+	MinActiveMembers	int
+}
+
+type Member struct {
+	IP			string
+	// Port zero is any port.
+	Port		int
+	// Weight is the share of the traffic of the member, 1 when zero.
+	Weight		int
+	// ConnectionLimit caps the connections of the member, zero is none.
+	ConnectionLimit	int
+	Priority	int
+}
+
+// Rule sends the requests for Host and Path to Pool, or answers them with a
+// redirect. Rewrite changes the path before the request reaches Pool.
+type Rule struct {
+	// Name names the device objects of the rule where the provider needs
+	// one, it is derived from the virtual server, Host and Path when empty.
+	Name		string
+	// Host may start with *. to match the subdomains, empty matches all.
+	Host		string
+	Path		string
+	Pool		string
+	Redirect	*Redirect
+	Rewrite		*Rewrite
+}
+
+type Redirect struct {
+	Scheme		string
+	Host		string
+	Code		int
+}
+
+type Rewrite struct {
+	// Prefix of the path to replace, the Path of the rule when empty.
+	Prefix		string
+	Replacement	string
+}
+
+// Response is a static answer to the requests no rule matches.
+type Response struct {
+	Code		int
+	ContentType	string
+	Body		string
+}
+
+// Cert is a certificate served by a TLS virtual server, chosen by SNI.
+type Cert struct {
+	Name		string
+	// ServerName is the SNI name of the certificate.
+	ServerName	string
+	// Default is served to the clients sending no known name.
+	Default		bool
+	Cert		[]byte
+	Key			[]byte
+	// Namespace and Secret name the TLS Secret of Cert and Key, the
+	// providers keeping their state on the device keep it rather than the
+	// key, see Device.TLSSecret.
+	Namespace	string
+	Secret		string
+}
+
+// unsupported is the error of a feature the provider lacks.
+func unsupported(provider string, format string, args ...interface{})error{
+	return &Error{
+		Reason : ErrorReasonUnsupported,
+		Err : fmt.Errorf("%s: %s", provider, fmt.Sprintf(format, args...)),
+	}
+}
+
+// memberWeight returns the weight of member, 1 when it has none.
+func memberWeight(member Member)int{
+	if member.Weight <= 0 {
+		return 1
+	}
+	return member.Weight
+}
+
+// rewritePrefix returns the prefix rule rewrites.
+func rewritePrefix(rule Rule)string{
+	if rule.Rewrite.Prefix != "" {
+		return rule.Rewrite.Prefix
+	}
+	return rule.Path
+}
@@ -0,0 +1,70 @@
+package drivers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory builds the Provider of device.
+type Factory func(device Device)(Provider, error)
+
+type registration struct {
+	factory		Factory
+	env			func()Device
+}
+
+var (
+	registryLock	sync.RWMutex
+	registry		= make(map[string]registration)
+)
+
+// Register makes the provider name available to the controllers, name is
+// the type of the LoadBalancerDevices it drives. env returns the device of
+// the environment, it may be nil. Providers register in the init of their
+// package, out-of-tree ones are compiled in by importing theirs in cmd.
+func Register(name string, factory Factory, env func()Device){
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if factory == nil {
+		panic("drivers: Register factory of " + name + " is nil")
+	}
+	if _, ok := registry[name]; ok {
+		panic("drivers: Register called twice for provider " + name)
+	}
+	registry[name] = registration{factory : factory, env : env}
+}
+
+func lookup(name string)(registration, bool){
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	r, ok := registry[name]
+	return r, ok
+}
+
+// Registered tells if the provider name was registered.
+func Registered(name string)bool{
+	_, ok := lookup(name)
+	return ok
+}
+
+// Providers returns the names of the registered providers, sorted.
+func Providers()[]string{
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProvider returns the Provider name of device.
+func NewProvider(name string, device Device)(Provider, error){
+	r, ok := lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported device type %s", name)
+	}
+	return r.factory(device)
+}
@@ -1,163 +1,455 @@
-package utils
-
-
-import (
-	"fmt"
-	"net"
-	"os"
-	"strconv"
-	"time"	
-	
-	"k8s.io/api/core/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	
-	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
-	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
-	
-	crdv1 "github.com/sak0/ygw/pkg/apis/external/v1"
-	lbv1 "github.com/sak0/ygw/pkg/apis/loadbalance/v1"
-)
-
-func WaitCRDReady(clientset apiextensionsclient.Interface, crdName string) error {
-	err := Retry(5*time.Second, 20, func() (bool, error) {
-		crd, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(crdName, meta_v1.GetOptions{})
-		if err != nil {
-			return false, err
-		}
-		for _, cond := range crd.Status.Conditions {
-			switch cond.Type {
-			case apiextensionsv1beta1.Established:
-				if cond.Status == apiextensionsv1beta1.ConditionTrue {
-					return true, nil
-				}
-			case apiextensionsv1beta1.NamesAccepted:
-				if cond.Status == apiextensionsv1beta1.ConditionFalse {
-					return false, fmt.Errorf("Name conflict: %v", cond.Reason)
-				}
-			}
-		}
-		return false, nil
-	})
-	if err != nil {
-		return fmt.Errorf("wait CRD created failed: %v", err)
-	}
-	return nil
-}
-
-func GetEndpointMap(ep *v1.Endpoints)map[string]int{
-	var ipmap = make(map[string]int)
-	
-	if len(ep.Subsets) < 1 {
-		return ipmap
-	}
-	for _, epaddr := range ep.Subsets[0].Addresses {
-		ip := epaddr.IP
-		for _, epport := range ep.Subsets[0].Ports {
-			port := strconv.Itoa(int(epport.Port))
-			ipstr := ip + ":" + port
-			ipmap[ipstr] = 1
-		}
-	}
-	
-	return ipmap
-}
-
-
-func InClusterConfig() (*rest.Config, error) {
-	// Work around https://github.com/kubernetes/kubernetes/issues/40973
-	// See https://github.com/coreos/etcd-operator/issues/731#issuecomment-283804819
-	if len(os.Getenv("KUBERNETES_SERVICE_HOST")) == 0 {
-		addrs, err := net.LookupHost("kubernetes.default.svc")
-		if err != nil {
-			panic(err)
-		}
-		os.Setenv("KUBERNETES_SERVICE_HOST", addrs[0])
-	}
-	if len(os.Getenv("KUBERNETES_SERVICE_PORT")) == 0 {
-		os.Setenv("KUBERNETES_SERVICE_PORT", "443")
-	}
-	cfg, err := rest.InClusterConfig()
-	if err != nil {
-		return nil, err
-	}
-	return cfg, nil
-}
-
-func MustNewKubeClient() kubernetes.Interface {
-	cfg, err := InClusterConfig()
-	if err != nil {
-		panic(err)
-	}
-	return kubernetes.NewForConfigOrDie(cfg)
-}
-
-func GetMembersMap(pool *crdv1.ExternalNatPool)map[string]int {
-	memberMap := make(map[string]int)
-	if len(pool.Spec.Members) < 1 {
-		return memberMap
-	}
-	
-	for _, member := range pool.Spec.Members {
-		memberStr := member.IP + ":" + member.Port
-		memberMap[memberStr] = 1
-	}
-	
-	return memberMap
-}
-
-func GetCALBMembersMap(pool *lbv1.CAppLoadBalancePool)map[string]int {
-	memberMap := make(map[string]int)
-	if len(pool.Spec.Members) < 1 {
-		return memberMap
-	}
-	
-	var weight string
-	for _, member := range pool.Spec.Members {
-		if member.Weight != "" {
-			weight = member.Weight
-		} else {
-			weight = "1"
-		}		
-		
-		memberStr := member.IP + ":" + member.Port + ":" + weight
-		memberMap[memberStr] = 1	
-	}
-	
-	return memberMap
-}
-
-func GetRulesMap(aex *crdv1.AppExternalNat)map[crdv1.AppExternalNatRule]int {
-	rulesMap := make(map[crdv1.AppExternalNatRule]int)
-	if len(aex.Spec.Rules) < 1 {
-		return rulesMap
-	}
-	
-	for _, rule := range aex.Spec.Rules{
-		rulesMap[rule] = 1
-	}
-	
-	return rulesMap
-}
-
-func GetCALBPathsMap(calb *lbv1.CAppLoadBalance)map[string]int{
-	pathsMap := make(map[string]int)
-	if len(calb.Spec.Rules) < 1 {
-		return pathsMap
-	} 
-	
-	for _, rule := range calb.Spec.Rules {
-		domainName := rule.Host 
-		for _, path := range rule.Paths {
-			pathName := path.Path
-			if pathName == "" {
-				pathName = "nilpath"
-			}		
-			poolName := path.Pool
-			keyStr := domainName + "_" + pathName + "_" + poolName
-			pathsMap[keyStr] = 1
-		}
-	}
-	return pathsMap
+package utils
+
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"	
+	
+	"github.com/golang/glog"
+	
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	
+	crdv1 "github.com/sak0/ygw/pkg/apis/external/v1"
+	lbv1 "github.com/sak0/ygw/pkg/apis/loadbalance/v1"
+)
+
+func WaitCRDReady(clientset apiextensionsclient.Interface, crdName string) error {
+	err := Retry(5*time.Second, 20, func() (bool, error) {
+		crd, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(crdName, meta_v1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, cond := range crd.Status.Conditions {
+			switch cond.Type {
+			case apiextensionsv1beta1.Established:
+				if cond.Status == apiextensionsv1beta1.ConditionTrue {
+					return true, nil
+				}
+			case apiextensionsv1beta1.NamesAccepted:
+				if cond.Status == apiextensionsv1beta1.ConditionFalse {
+					return false, fmt.Errorf("Name conflict: %v", cond.Reason)
+				}
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("wait CRD created failed: %v", err)
+	}
+	return nil
+}
+
+// ResourceServed tells whether the api server serves the resource plural of
+// groupVersion, a resource whose CRD is not installed is not.
+func ResourceServed(client kubernetes.Interface, groupVersion string, plural string)(bool, error){
+	resources, err := client.Discovery().ServerResourcesForGroupVersion(groupVersion)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Name == plural {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func GetEndpointMap(ep *v1.Endpoints)map[string]int{
+	var ipmap = make(map[string]int)
+	
+	for _, subset := range ep.Subsets {
+		for _, epaddr := range subset.Addresses {
+			ip := epaddr.IP
+			for _, epport := range subset.Ports {
+				port := strconv.Itoa(int(epport.Port))
+				ipstr := net.JoinHostPort(ip, port)
+				ipmap[ipstr] = 1
+			}
+		}
+	}
+	
+	return ipmap
+}
+
+// GetServicePort finds the port of svc named or numbered port. An empty port
+// is accepted when the service has exactly one.
+func GetServicePort(svc *v1.Service, port string)(*v1.ServicePort, error){
+	if port == "" && len(svc.Spec.Ports) == 1 {
+		return &svc.Spec.Ports[0], nil
+	}
+	for i, svcPort := range svc.Spec.Ports {
+		if svcPort.Name == port || strconv.Itoa(int(svcPort.Port)) == port {
+			return &svc.Spec.Ports[i], nil
+		}
+	}
+	return nil, fmt.Errorf("service %s/%s has no port %q", svc.Namespace, svc.Name, port)
+}
+
+// GetEndpointMembers returns "ip:port" of every endpoint behind svcPort, across
+// all subsets, mapped to whether the endpoint is ready.
+func GetEndpointMembers(ep *v1.Endpoints, svcPort *v1.ServicePort)map[string]bool{
+	members := make(map[string]bool)
+	
+	for _, subset := range ep.Subsets {
+		for _, epport := range subset.Ports {
+			if epport.Name != svcPort.Name || epport.Protocol != svcPort.Protocol {
+				continue
+			}
+			port := strconv.Itoa(int(epport.Port))
+			for _, epaddr := range subset.Addresses {
+				members[net.JoinHostPort(epaddr.IP, port)] = true
+			}
+			for _, epaddr := range subset.NotReadyAddresses {
+				if _, ok := members[net.JoinHostPort(epaddr.IP, port)]; !ok {
+					members[net.JoinHostPort(epaddr.IP, port)] = false
+				}
+			}
+		}
+	}
+	
+	return members
+}
+
+// GetNodePortMembers returns "InternalIP:NodePort" of every schedulable node
+// matching selector, mapped to whether the node is Ready.
+func GetNodePortMembers(nodes []interface{}, svcPort *v1.ServicePort, selector map[string]string)(map[string]bool, error){
+	members := make(map[string]bool)
+	if svcPort.NodePort == 0 {
+		return members, fmt.Errorf("service port %s has no node port", svcPort.Name)
+	}
+	port := strconv.Itoa(int(svcPort.NodePort))
+	
+	nodeSelector := labels.SelectorFromSet(labels.Set(selector))
+	for _, obj := range nodes {
+		node := obj.(*v1.Node)
+		if node.Spec.Unschedulable || !nodeSelector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		ip := GetNodeInternalIP(node)
+		if ip == "" {
+			continue
+		}
+		members[net.JoinHostPort(ip, port)] = IsNodeReady(node)
+	}
+	
+	return members, nil
+}
+
+func GetNodeInternalIP(node *v1.Node)string{
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			return addr.Address
+		}
+	}
+	return ""
+}
+
+func IsNodeReady(node *v1.Node)bool{
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == v1.NodeReady {
+			return cond.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// NodeMembershipChanged tells whether an update of a node can change the
+// members of NodePort pools, so that status heartbeats are ignored.
+func NodeMembershipChanged(oldNode, newNode *v1.Node)bool{
+	return oldNode.Spec.Unschedulable != newNode.Spec.Unschedulable ||
+		!reflect.DeepEqual(oldNode.Labels, newNode.Labels) ||
+		GetNodeInternalIP(oldNode) != GetNodeInternalIP(newNode) ||
+		IsNodeReady(oldNode) != IsNodeReady(newNode)
+}
+
+// GetServiceRefMembers returns the members a serviceRef pool should have, as
+// "ip:port" mapped to whether the member should be enabled. A missing Service
+// has no members, they come with its error.
+func GetServiceRefMembers(svcStore, epStore, nodeStore cache.Store, namespace, name, port, mode string, 
+	nodeSelector map[string]string)(map[string]bool, error){
+	obj, exists, err := svcStore.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		// the members of a deleted service go away with it.
+		return make(map[string]bool), fmt.Errorf("service %s/%s not found", namespace, name)
+	}
+	svcPort, err := GetServicePort(obj.(*v1.Service), port)
+	if err != nil {
+		return nil, err
+	}
+	
+	switch mode {
+		case crdv1.SERVICEREFMODENODEPORT:
+			return GetNodePortMembers(nodeStore.List(), svcPort, nodeSelector)
+		case "", crdv1.SERVICEREFMODEENDPOINTS:
+			members := make(map[string]bool)
+			obj, exists, err = epStore.GetByKey(namespace + "/" + name)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				members = GetEndpointMembers(obj.(*v1.Endpoints), svcPort)
+			}
+			return members, nil
+		default:
+			return nil, fmt.Errorf("unknown serviceRef mode %s", mode)
+	}
+}
+
+// GetTLSSecret returns the certificate and key of a kubernetes.io/tls secret.
+func GetTLSSecret(client kubernetes.Interface, namespace, name string)([]byte, []byte, error){
+	secret, err := client.CoreV1().Secrets(namespace).Get(name, meta_v1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, ok := secret.Data[v1.TLSCertKey]
+	if !ok {
+		return nil, nil, fmt.Errorf("secret %s/%s has no %s", namespace, name, v1.TLSCertKey)
+	}
+	key, ok := secret.Data[v1.TLSPrivateKeyKey]
+	if !ok {
+		return nil, nil, fmt.Errorf("secret %s/%s has no %s", namespace, name, v1.TLSPrivateKeyKey)
+	}
+	return cert, key, nil
+}
+
+// F5PartitionAnnotation on a Namespace selects the BIG-IP partition of the
+// objects created in the namespace. On an object it records the partition its
+// objects were created in, they stay there when the namespace changes.
+const F5PartitionAnnotation = "ygw.yonghui.cn/bigip-partition"
+
+var (
+	f5PartitionLock	sync.Mutex
+	f5Partitions	= make(map[string]f5Partition)
+)
+
+type f5Partition struct {
+	name	string
+	read	time.Time
+}
+
+// GetF5Partition returns the BIG-IP partition of namespace: its annotation,
+// else the namespace itself when perNamespace is set, else empty for the
+// partition of the device. Namespaces
+// are read again after a minute, the last partition seen is used when the
+// namespace can't be read.
+func GetF5Partition(client kubernetes.Interface, namespace string, perNamespace bool)string{
+	f5PartitionLock.Lock()
+	cached, ok := f5Partitions[namespace]
+	f5PartitionLock.Unlock()
+	if ok && time.Since(cached.read) < time.Minute {
+		return cached.name
+	}
+	
+	partition := ""
+	if perNamespace {
+		partition = namespace
+	}
+	ns, err := client.CoreV1().Namespaces().Get(namespace, meta_v1.GetOptions{})
+	if err != nil {
+		if ok {
+			partition = cached.name
+		}
+		glog.Errorf("Get namespace %s failed, use partition %s: %v", namespace, partition, err)
+		return partition
+	}
+	if value := ns.Annotations[F5PartitionAnnotation]; value != "" {
+		partition = value
+	}
+	f5PartitionLock.Lock()
+	f5Partitions[namespace] = f5Partition{name : partition, read : time.Now()}
+	f5PartitionLock.Unlock()
+	return partition
+}
+
+func InClusterConfig() (*rest.Config, error) {
+	// Work around https://github.com/kubernetes/kubernetes/issues/40973
+	// See https://github.com/coreos/etcd-operator/issues/731#issuecomment-283804819
+	if len(os.Getenv("KUBERNETES_SERVICE_HOST")) == 0 {
+		addrs, err := net.LookupHost("kubernetes.default.svc")
+		if err != nil {
+			panic(err)
+		}
+		os.Setenv("KUBERNETES_SERVICE_HOST", addrs[0])
+	}
+	if len(os.Getenv("KUBERNETES_SERVICE_PORT")) == 0 {
+		os.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	}
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func MustNewKubeClient() kubernetes.Interface {
+	cfg, err := InClusterConfig()
+	if err != nil {
+		panic(err)
+	}
+	return kubernetes.NewForConfigOrDie(cfg)
+}
+
+func GetMembersMap(pool *crdv1.ExternalNatPool)map[string]int {
+	memberMap := make(map[string]int)
+	if len(pool.Spec.Members) < 1 {
+		return memberMap
+	}
+	
+	for _, member := range pool.Spec.Members {
+		memberStr := net.JoinHostPort(member.IP, member.Port)
+		memberMap[memberStr] = 1
+	}
+	
+	return memberMap
+}
+
+func GetCALBMembersMap(pool *lbv1.CAppLoadBalancePool)map[string]int {
+	memberMap := make(map[string]int)
+	if len(pool.Spec.Members) < 1 {
+		return memberMap
+	}
+	
+	for _, member := range pool.Spec.Members {
+		memberMap[calbMemberKey(member)] = 1	
+	}
+	
+	return memberMap
+}
+
+func calbMemberKey(member lbv1.CAppLoadBalancePoolMember)string{
+	weight := "1"
+	if member.Weight != "" {
+		weight = member.Weight
+	}
+	return net.JoinHostPort(member.IP, member.Port) + "/" + weight
+}
+
+// GetCALBPriorityMembersMap splits the members of a pool like GetCALBMembersMap
+// into the highest priority ones and the standby ones. Without minActiveMembers
+// every member is primary.
+func GetCALBPriorityMembersMap(pool *lbv1.CAppLoadBalancePool)(map[string]int, map[string]int){
+	primary := make(map[string]int)
+	backup := make(map[string]int)
+	top := 0
+	for i, member := range pool.Spec.Members {
+		priority, _ := strconv.Atoi(member.Priority)
+		if i == 0 || priority > top {
+			top = priority
+		}
+	}
+	for _, member := range pool.Spec.Members {
+		priority, _ := strconv.Atoi(member.Priority)
+		if pool.Spec.MinActiveMembers > 0 && priority < top {
+			backup[calbMemberKey(member)] = 1
+		} else {
+			primary[calbMemberKey(member)] = 1
+		}
+	}
+	return primary, backup
+}
+
+// SplitMemberWeight splits a key of GetCALBMembersMap into ip, port and weight.
+func SplitMemberWeight(member string)(string, string, string){
+	weight := "1"
+	if i := strings.LastIndex(member, "/"); i >= 0 {
+		member, weight = member[:i], member[i+1:]
+	}
+	ip, port, _ := net.SplitHostPort(member)
+	return ip, port, weight
+}
+
+// GetDuration parses a duration of a pool spec like drainTimeout, an empty or
+// invalid one falls back to defaultValue.
+func GetDuration(value string, defaultValue string)time.Duration{
+	if value != "" {
+		d, err := time.ParseDuration(value)
+		if err == nil {
+			return d
+		}
+		glog.Warningf("Invalid duration %s, use %s", value, defaultValue)
+	}
+	d, _ := time.ParseDuration(defaultValue)
+	return d
+}
+
+func GetRulesMap(aex *crdv1.AppExternalNat)map[crdv1.AppExternalNatRule]int {
+	rulesMap := make(map[crdv1.AppExternalNatRule]int)
+	if len(aex.Spec.Rules) < 1 {
+		return rulesMap
+	}
+	
+	for _, rule := range aex.Spec.Rules{
+		rulesMap[rule] = 1
+	}
+	
+	return rulesMap
+}
+
+// GetCALBPoolProtocol returns the protocol of the members, HTTP when it
+// isn't set.
+func GetCALBPoolProtocol(pool *lbv1.CAppLoadBalancePool)string{
+	if pool.Spec.Protocol != "" {
+		return strings.ToUpper(pool.Spec.Protocol)
+	}
+	return lbv1.PROTOCOLHTTP
+}
+
+// GetCALBProtocol returns the protocol of the csvserver, SSL with tls and
+// HTTP without when it isn't set.
+func GetCALBProtocol(calb *lbv1.CAppLoadBalance)string{
+	if calb.Spec.Protocol != "" {
+		return strings.ToUpper(calb.Spec.Protocol)
+	}
+	if len(calb.Spec.TLS) > 0 {
+		return lbv1.PROTOCOLSSL
+	}
+	return lbv1.PROTOCOLHTTP
+}
+
+func GetCALBPathsMap(calb *lbv1.CAppLoadBalance)map[string]int{
+	pathsMap := make(map[string]int)
+	if len(calb.Spec.Rules) < 1 {
+		return pathsMap
+	} 
+	
+	for _, rule := range calb.Spec.Rules {
+		domainName := rule.Host 
+		for _, path := range rule.Paths {
+			pathName := path.Path
+			if pathName == "" {
+				pathName = "nilpath"
+			}		
+			poolName := path.Pool
+			keyStr := domainName + "_" + pathName + "_" + poolName
+			if path.Redirect != (lbv1.HTTPRedirect{}) {
+				keyStr = keyStr + "_" + fmt.Sprintf("redirect%v", path.Redirect)
+			}
+			if path.Rewrite != (lbv1.HTTPRewrite{}) {
+				keyStr = keyStr + "_" + fmt.Sprintf("rewrite%v", path.Rewrite)
+			}
+			pathsMap[keyStr] = 1
+		}
+	}
+	return pathsMap
 }
\ No newline at end of file
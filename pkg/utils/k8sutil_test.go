@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	lbv1 "github.com/sak0/ygw/pkg/apis/loadbalance/v1"
+)
+
+func TestSplitMemberWeight(t *testing.T) {
+	cases := []struct {
+		member		string
+		ip			string
+		port		string
+		weight		string
+	}{
+		{"10.0.0.1:80/3", "10.0.0.1", "80", "3"},
+		{"10.0.0.1:80", "10.0.0.1", "80", "1"},
+		{"[fd00::1]:443/2", "fd00::1", "443", "2"},
+		{"[fd00::1]:443", "fd00::1", "443", "1"},
+	}
+	for _, c := range cases {
+		ip, port, weight := SplitMemberWeight(c.member)
+		if ip != c.ip || port != c.port || weight != c.weight {
+			t.Errorf("SplitMemberWeight(%q) = %q, %q, %q, want %q, %q, %q",
+				c.member, ip, port, weight, c.ip, c.port, c.weight)
+		}
+	}
+}
+
+func TestGetCALBPriorityMembersMap(t *testing.T) {
+	members := []lbv1.CAppLoadBalancePoolMember{
+		{IP : "10.0.0.1", Port : "80", Priority : "10"},
+		{IP : "10.0.0.2", Port : "80", Weight : "2", Priority : "10"},
+		{IP : "10.0.0.3", Port : "80", Priority : "5"},
+		{IP : "fd00::1", Port : "80"},
+	}
+	cases := []struct {
+		name				string
+		members				[]lbv1.CAppLoadBalancePoolMember
+		minActiveMembers	int
+		primary				map[string]int
+		backup				map[string]int
+	}{
+		{"no members", nil, 1, map[string]int{}, map[string]int{}},
+		{"without minActiveMembers all are primary", members, 0,
+			map[string]int{"10.0.0.1:80/1" : 1, "10.0.0.2:80/2" : 1, "10.0.0.3:80/1" : 1, "[fd00::1]:80/1" : 1},
+			map[string]int{}},
+		{"lower priorities are standby", members, 1,
+			map[string]int{"10.0.0.1:80/1" : 1, "10.0.0.2:80/2" : 1},
+			map[string]int{"10.0.0.3:80/1" : 1, "[fd00::1]:80/1" : 1}},
+		{"negative priorities", []lbv1.CAppLoadBalancePoolMember{
+				{IP : "10.0.0.1", Port : "80", Priority : "-5"},
+				{IP : "10.0.0.2", Port : "80", Priority : "-1"},
+			}, 1,
+			map[string]int{"10.0.0.2:80/1" : 1},
+			map[string]int{"10.0.0.1:80/1" : 1}},
+	}
+	for _, c := range cases {
+		pool := &lbv1.CAppLoadBalancePool{}
+		pool.Spec.Members = c.members
+		pool.Spec.MinActiveMembers = c.minActiveMembers
+		primary, backup := GetCALBPriorityMembersMap(pool)
+		if !reflect.DeepEqual(primary, c.primary) || !reflect.DeepEqual(backup, c.backup) {
+			t.Errorf("%s: got %v, %v, want %v, %v", c.name, primary, backup, c.primary, c.backup)
+		}
+	}
+}
@@ -1,159 +1,195 @@
-package utils
-
-import (
-	"encoding/hex"
-	"hash/fnv"
-	"os"
-	"reflect"
-	"strconv"
-	"strings"
-	
-	"github.com/golang/glog"
-	
-	"github.com/sak0/ygw/pkg/client"
-
-	clientset "k8s.io/client-go/kubernetes"
-	apiextcs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/rest"	
-)
-
-func getClientConfig(kubeconfig string) (*rest.Config, error) {
-	/*if kubeconfig != "" {
-		return clientcmd.BuildConfigFromFlags("", kubeconfig)
-	}*/
-	return rest.InClusterConfig()
-}
-
-func CreateClients(kubeconf string)(*clientset.Clientset, *apiextcs.Clientset, 
-									*rest.RESTClient, *runtime.Scheme, 
-									*rest.RESTClient, *runtime.Scheme, error){
-	config, err := getClientConfig(kubeconf)
-	if err != nil {
-		glog.Errorf("Get KubeConfig failed: %v", err)
-		return nil, nil, nil, nil, nil, nil, err
-	}
-
-	// create extclient and create our CRD, this only need to run once
-	extClient, err := apiextcs.NewForConfig(config)
-	if err != nil {
-		glog.Errorf("Get ExtApiClient failed: %v", err)
-		return nil, nil, nil, nil, nil, nil, err
-	}
-	
-	kubeClient, err := clientset.NewForConfig(config)
-	if err != nil {
-		glog.Errorf("Get KubeClient failed: %v", err)
-		return nil, nil, nil, nil, nil, nil, err
-	}
-	// Create a new clientset which include our CRD schema
-	crdcs, scheme, err := client.NewClient(config)
-	if err != nil {
-		glog.Errorf("Get CrdClient failed: %v", err)
-		return nil, nil, nil, nil, nil, nil, err
-	}
-	
-	lbcs, lbscheme, err := client.NewLBClient(config)
-	if err != nil {
-		glog.Errorf("Get LBClient failed: %v", err)
-		return nil, nil, nil, nil, nil, nil, err
-	}	
-	
-	return kubeClient, extClient, crdcs, scheme, lbcs, lbscheme, nil
-}
-
-func Contain(obj interface{}, target interface{}) bool {
-    targetValue := reflect.ValueOf(target)
-    switch reflect.TypeOf(target).Kind() {
-    case reflect.Slice, reflect.Array:
-        for i := 0; i < targetValue.Len(); i++ {
-            if targetValue.Index(i).Interface() == obj {
-                return true
-            }
-        }
-    case reflect.Map:
-        if targetValue.MapIndex(reflect.ValueOf(obj)).IsValid() {
-            return true
-        }
-    }
-
-    return false
-}									
-									
-func hashIp()string{
-	ctrlIp := os.Getenv("KUBERNETES_SERVICE_HOST")
-	a := fnv.New32()
-	a.Write([]byte(ctrlIp))
-	return hex.EncodeToString(a.Sum(nil))
-}
-									
-func GenerateLbNameCLB(namespace string, vip string, port string, protocol string)string {
-	devHash := hashIp()
-	lbName := devHash + "_CLB_" + namespace + "_" + 
-			strings.Replace(vip, ".", "_", -1) + "_" + protocol + "_" + port 
-	return lbName
-}
-
-func GenerateSvcNameCLB(namespace string, ip string, port int32, protocol string)string {
-	devHash := hashIp()
-	portstr := strconv.Itoa(int(port))
-	svcName := devHash + "_CLB_" + namespace + "_" + 
-			strings.Replace(ip, ".", "_", -1) + "_" + protocol + "_" + portstr
-	return svcName		
-}
-
-func GenerateSvcGroupNameCLB(namespace string, svcname string)string {
-	devHash := hashIp()
-	gpName := devHash + "_CALB_" + namespace + "_" + svcname
-	return gpName
-}
-
-func GenerateServerNameCALB(namespace string, ip string)string {
-	devHash := hashIp()
-	serverName := devHash + "_CALB_" + namespace + "_" + strings.Replace(ip, ".", "_", -1)
-	return serverName
-}
-
-func GeneratePortNameCALB(namespace string, ip string)string {
-	devHash := hashIp()
-	portName := devHash + "_CALB_" + namespace + "_" + strings.Replace(ip, ".", "_", -1)
-	return portName
-}
-
-func GeneratePoolNameEXP(namespace string, name string)string {
-	devHash := hashIp()
-	poolName := namespace + "_" + name + "_" + devHash 
-	return poolName
-}
-
-func GenerateCexName(namespace string, name string)string {
-	devHash := hashIp()
-	cexName := "C_" + namespace + "_" + name + "_" + devHash 
-	return cexName
-}
-
-func GenerateAexName(namespace string, name string)string {
-	devHash := hashIp()
-	cexName := "A_" + namespace + "_" + name + "_" + devHash 
-	return cexName
-}
-
-func GeneratePoolNameCALBP(namespace string, name string)string {
-	devHash := hashIp()
-	poolName := namespace + "_" + name + "_" + devHash 
-	return poolName	
-}
-
-func GenerateCALBName(name string)string{
-	devHash := hashIp()
-	lbName := name + "_" + devHash
-	return lbName
-}
-
-func GeneratePolicyName(lbName, domainName, path string)string{
-	if path == "" {
-		path = "nilpath"
-	}
-	path = strings.Replace(path, "/", "_", -1)
-	return lbName + "_" + domainName + "_" + path
+package utils
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	
+	"github.com/golang/glog"
+	
+	"github.com/sak0/ygw/pkg/client"
+
+	clientset "k8s.io/client-go/kubernetes"
+	apiextcs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"	
+)
+
+func getClientConfig(kubeconfig string) (*rest.Config, error) {
+	/*if kubeconfig != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}*/
+	return rest.InClusterConfig()
+}
+
+func CreateClients(kubeconf string)(*clientset.Clientset, *apiextcs.Clientset, 
+									*rest.RESTClient, *runtime.Scheme, 
+									*rest.RESTClient, *runtime.Scheme,
+									*rest.RESTClient, *runtime.Scheme, error){
+	config, err := getClientConfig(kubeconf)
+	if err != nil {
+		glog.Errorf("Get KubeConfig failed: %v", err)
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+
+	// create extclient and create our CRD, this only need to run once
+	extClient, err := apiextcs.NewForConfig(config)
+	if err != nil {
+		glog.Errorf("Get ExtApiClient failed: %v", err)
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+	
+	kubeClient, err := clientset.NewForConfig(config)
+	if err != nil {
+		glog.Errorf("Get KubeClient failed: %v", err)
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+	// Create a new clientset which include our CRD schema
+	crdcs, scheme, err := client.NewClient(config)
+	if err != nil {
+		glog.Errorf("Get CrdClient failed: %v", err)
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+	
+	lbcs, lbscheme, err := client.NewLBClient(config)
+	if err != nil {
+		glog.Errorf("Get LBClient failed: %v", err)
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}	
+
+	gwcs, gwscheme, err := client.NewGatewayClient(config)
+	if err != nil {
+		glog.Errorf("Get GatewayClient failed: %v", err)
+		return nil, nil, nil, nil, nil, nil, nil, nil, err
+	}
+	
+	return kubeClient, extClient, crdcs, scheme, lbcs, lbscheme, gwcs, gwscheme, nil
+}
+
+func Contain(obj interface{}, target interface{}) bool {
+    targetValue := reflect.ValueOf(target)
+    switch reflect.TypeOf(target).Kind() {
+    case reflect.Slice, reflect.Array:
+        for i := 0; i < targetValue.Len(); i++ {
+            if targetValue.Index(i).Interface() == obj {
+                return true
+            }
+        }
+    case reflect.Map:
+        if targetValue.MapIndex(reflect.ValueOf(obj)).IsValid() {
+            return true
+        }
+    }
+
+    return false
+}									
+									
+func hashIp()string{
+	ctrlIp := os.Getenv("KUBERNETES_SERVICE_HOST")
+	a := fnv.New32()
+	a.Write([]byte(ctrlIp))
+	return hex.EncodeToString(a.Sum(nil))
+}
+									
+// ipToName turns an IPv4 or IPv6 address into a part of an object name.
+func ipToName(ip string)string{
+	return strings.NewReplacer(".", "_", ":", "_").Replace(ip)
+}
+									
+func GenerateLbNameCLB(namespace string, vip string, port string, protocol string)string {
+	devHash := hashIp()
+	lbName := devHash + "_CLB_" + namespace + "_" + 
+			ipToName(vip) + "_" + protocol + "_" + port 
+	return lbName
+}
+
+func GenerateSvcNameCLB(namespace string, ip string, port int32, protocol string)string {
+	devHash := hashIp()
+	portstr := strconv.Itoa(int(port))
+	svcName := devHash + "_CLB_" + namespace + "_" + 
+			ipToName(ip) + "_" + protocol + "_" + portstr
+	return svcName		
+}
+
+func GenerateSvcGroupNameCLB(namespace string, svcname string)string {
+	devHash := hashIp()
+	gpName := devHash + "_CALB_" + namespace + "_" + svcname
+	return gpName
+}
+
+func GenerateServerNameCALB(namespace string, ip string)string {
+	devHash := hashIp()
+	serverName := devHash + "_CALB_" + namespace + "_" + ipToName(ip)
+	return serverName
+}
+
+func GeneratePortNameCALB(namespace string, ip string)string {
+	devHash := hashIp()
+	portName := devHash + "_CALB_" + namespace + "_" + ipToName(ip)
+	return portName
+}
+
+func GeneratePoolNameEXP(namespace string, name string)string {
+	devHash := hashIp()
+	poolName := namespace + "_" + name + "_" + devHash 
+	return poolName
+}
+
+func GenerateCexName(namespace string, name string)string {
+	devHash := hashIp()
+	cexName := "C_" + namespace + "_" + name + "_" + devHash 
+	return cexName
+}
+
+func GenerateCexListenerName(namespace string, name string, protocol string, port string)string {
+	return GenerateCexName(namespace, name) + "_" + protocol + "_" + strings.Replace(port, "-", "_", -1)
+}
+
+func GenerateAexName(namespace string, name string)string {
+	devHash := hashIp()
+	cexName := "A_" + namespace + "_" + name + "_" + devHash 
+	return cexName
+}
+
+func GeneratePoolNameCALBP(namespace string, name string)string {
+	devHash := hashIp()
+	poolName := namespace + "_" + name + "_" + devHash 
+	return poolName	
+}
+
+// GenerateBackupPoolNameCALBP names the lbvserver of the standby members.
+func GenerateBackupPoolNameCALBP(namespace string, name string)string {
+	return GeneratePoolNameCALBP(namespace, name) + "_backup"
+}
+
+func GenerateCALBName(name string)string{
+	devHash := hashIp()
+	lbName := name + "_" + devHash
+	return lbName
+}
+
+// GenerateGatewayListenerName names the virtual server or csvserver of the
+// listeners of a Gateway on one port.
+func GenerateGatewayListenerName(namespace string, name string, port int32)string{
+	devHash := hashIp()
+	return "G_" + namespace + "_" + name + "_" + strconv.Itoa(int(port)) + "_" + devHash
+}
+
+// GenerateCertName keeps certificate names short, netscaler limits certkey
+// names to 31 characters.
+func GenerateCertName(lbName, secretName string)string{
+	a := fnv.New32()
+	a.Write([]byte(lbName + "/" + secretName))
+	return "ygw_cert_" + hex.EncodeToString(a.Sum(nil))
+}
+
+func GeneratePolicyName(lbName, domainName, path string)string{
+	if path == "" {
+		path = "nilpath"
+	}
+	path = strings.Replace(path, "/", "_", -1)
+	return lbName + "_" + domainName + "_" + path
 }										
\ No newline at end of file